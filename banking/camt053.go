@@ -0,0 +1,186 @@
+package banking
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"fakturierung-backend/utils"
+)
+
+// ISO 20022 camt.053 (versions .001.02 to .001.08). Elements are matched by local
+// name, so the namespace version does not matter.
+
+type camtParty struct {
+	Nm  string `xml:"Nm"`
+	Pty struct {
+		Nm string `xml:"Nm"`
+	} `xml:"Pty"` // camt.053.001.08 nests the party
+}
+
+func (p camtParty) name() string {
+	if p.Nm != "" {
+		return p.Nm
+	}
+	return p.Pty.Nm
+}
+
+type camtAccount struct {
+	Id struct {
+		IBAN string `xml:"IBAN"`
+	} `xml:"Id"`
+}
+
+type camtAmount struct {
+	Value string `xml:",chardata"`
+	Ccy   string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Dt   string `xml:"Dt"`
+	DtTm string `xml:"DtTm"`
+}
+
+func (d camtDate) parse() (time.Time, bool) {
+	if d.Dt != "" {
+		if t, err := time.Parse("2006-01-02", strings.TrimSpace(d.Dt)); err == nil {
+			return t, true
+		}
+	}
+	if d.DtTm != "" {
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05"} {
+			if t, err := time.Parse(layout, strings.TrimSpace(d.DtTm)); err == nil {
+				return dateOnly(t), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+type camtTxDetails struct {
+	Refs struct {
+		EndToEndId  string `xml:"EndToEndId"`
+		AcctSvcrRef string `xml:"AcctSvcrRef"`
+	} `xml:"Refs"`
+	Amt       *camtAmount `xml:"Amt"`
+	RltdPties struct {
+		Dbtr     camtParty   `xml:"Dbtr"`
+		DbtrAcct camtAccount `xml:"DbtrAcct"`
+		Cdtr     camtParty   `xml:"Cdtr"`
+		CdtrAcct camtAccount `xml:"CdtrAcct"`
+	} `xml:"RltdPties"`
+	RmtInf struct {
+		Ustrd []string `xml:"Ustrd"`
+		Strd  []struct {
+			CdtrRefInf struct {
+				Ref string `xml:"Ref"`
+			} `xml:"CdtrRefInf"`
+			AddtlRmtInf []string `xml:"AddtlRmtInf"`
+		} `xml:"Strd"`
+	} `xml:"RmtInf"`
+	AddtlTxInf string `xml:"AddtlTxInf"`
+}
+
+type camtEntry struct {
+	Amt          camtAmount `xml:"Amt"`
+	CdtDbtInd    string     `xml:"CdtDbtInd"`
+	RvslInd      bool       `xml:"RvslInd"`
+	BookgDt      camtDate   `xml:"BookgDt"`
+	ValDt        camtDate   `xml:"ValDt"`
+	AcctSvcrRef  string     `xml:"AcctSvcrRef"`
+	AddtlNtryInf string     `xml:"AddtlNtryInf"`
+	NtryDtls     []struct {
+		TxDtls []camtTxDetails `xml:"TxDtls"`
+	} `xml:"NtryDtls"`
+}
+
+type camtDocument struct {
+	Stmts []struct {
+		Id   string      `xml:"Id"`
+		Acct camtAccount `xml:"Acct"`
+		Ntry []camtEntry `xml:"Ntry"`
+	} `xml:"BkToCstmrStmt>Stmt"`
+}
+
+// ParseCAMT053 parses an ISO 20022 camt.053 bank-to-customer statement. Batch
+// entries are split into one transaction per transaction detail.
+func ParseCAMT053(data []byte) ([]Statement, error) {
+	var doc camtDocument
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("camt.053: %w", err)
+	}
+	if len(doc.Stmts) == 0 {
+		return nil, fmt.Errorf("camt.053: no statement found")
+	}
+
+	var out []Statement
+	for _, s := range doc.Stmts {
+		st := Statement{Format: FormatCAMT053, AccountIBAN: NormalizeIBAN(s.Acct.Id.IBAN), StatementID: strings.TrimSpace(s.Id)}
+		for i, e := range s.Ntry {
+			credit := e.CdtDbtInd == "CRDT"
+			if e.RvslInd { // a reversal flips the booking direction
+				credit = !credit
+			}
+			booking, ok := e.BookgDt.parse()
+			if !ok {
+				return nil, fmt.Errorf("camt.053: entry %d: missing booking date", i+1)
+			}
+			var value *time.Time
+			if v, ok := e.ValDt.parse(); ok {
+				value = &v
+			}
+
+			details := []camtTxDetails{{}}
+			if len(e.NtryDtls) > 0 && len(e.NtryDtls[0].TxDtls) > 0 {
+				details = e.NtryDtls[0].TxDtls
+			}
+			for _, d := range details {
+				amt := e.Amt
+				if d.Amt != nil && len(details) > 1 {
+					amt = *d.Amt
+				}
+				v, err := utils.ParseMoney(amt.Value)
+				if err != nil {
+					return nil, fmt.Errorf("camt.053: entry %d: invalid amount %q", i+1, amt.Value)
+				}
+				tx := Transaction{
+					BookingDate:   booking,
+					ValueDate:     value,
+					Amount:        v,
+					Currency:      amt.Ccy,
+					EndToEndID:    strings.TrimSpace(d.Refs.EndToEndId),
+					BankReference: strings.TrimSpace(e.AcctSvcrRef),
+				}
+				if tx.EndToEndID == "NOTPROVIDED" {
+					tx.EndToEndID = ""
+				}
+				if d.Refs.AcctSvcrRef != "" {
+					tx.BankReference = strings.TrimSpace(d.Refs.AcctSvcrRef)
+				}
+				if credit {
+					tx.CounterpartyName = strings.TrimSpace(d.RltdPties.Dbtr.name())
+					tx.CounterpartyIBAN = NormalizeIBAN(d.RltdPties.DbtrAcct.Id.IBAN)
+				} else {
+					tx.Amount = -tx.Amount
+					tx.CounterpartyName = strings.TrimSpace(d.RltdPties.Cdtr.name())
+					tx.CounterpartyIBAN = NormalizeIBAN(d.RltdPties.CdtrAcct.Id.IBAN)
+				}
+				parts := append([]string{}, d.RmtInf.Ustrd...)
+				for _, s := range d.RmtInf.Strd {
+					parts = append(parts, s.CdtrRefInf.Ref)
+					parts = append(parts, s.AddtlRmtInf...)
+				}
+				if len(parts) == 0 {
+					parts = append(parts, d.AddtlTxInf, e.AddtlNtryInf)
+				}
+				tx.RemittanceInfo = joinText(parts...)
+				st.Transactions = append(st.Transactions, tx)
+			}
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
@@ -0,0 +1,107 @@
+package banking
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"fakturierung-backend/utils"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// checkTransactions compares the fields the matcher relies on.
+func checkTransactions(t *testing.T, got, want []Transaction) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d transactions, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if !g.BookingDate.Equal(w.BookingDate) || g.Amount != w.Amount || g.Currency != w.Currency ||
+			g.CounterpartyName != w.CounterpartyName || g.CounterpartyIBAN != w.CounterpartyIBAN ||
+			g.RemittanceInfo != w.RemittanceInfo || g.EndToEndID != w.EndToEndID || g.BankReference != w.BankReference {
+			t.Errorf("transaction %d:\n got  %+v\n want %+v", i+1, g, w)
+		}
+	}
+}
+
+func TestParseCAMT053(t *testing.T) {
+	data := readTestdata(t, "camt053.xml")
+	if f := DetectFormat(data); f != FormatCAMT053 {
+		t.Errorf("DetectFormat = %q, want %q", f, FormatCAMT053)
+	}
+	stmts, err := ParseCAMT053(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stmts) != 1 {
+		t.Fatalf("got %d statements, want 1", len(stmts))
+	}
+	st := stmts[0]
+	if st.AccountIBAN != "AT611904300234573201" || st.StatementID != "STMT-2025-03" {
+		t.Errorf("statement header: %q %q", st.AccountIBAN, st.StatementID)
+	}
+	if v := st.Transactions[0].ValueDate; v == nil || !v.Equal(day("2025-03-04")) {
+		t.Errorf("value date: %v", v)
+	}
+	checkTransactions(t, st.Transactions, []Transaction{
+		{
+			BookingDate: day("2025-03-03"), Amount: utils.Cents(11900), Currency: "EUR",
+			CounterpartyName: "Muster GmbH", CounterpartyIBAN: "DE89370400440532013000",
+			RemittanceInfo: "Rechnung RE-2025-0001", EndToEndID: "E2E-1", BankReference: "BANKREF1",
+		},
+		{
+			// debit with a date-time booking date; NOTPROVIDED is no end-to-end id
+			BookingDate: day("2025-03-04"), Amount: utils.Cents(-5000), Currency: "EUR",
+			CounterpartyName: "Stadtwerke", CounterpartyIBAN: "AT483200000012345864",
+			RemittanceInfo: "Strom Maerz", BankReference: "BANKREF2",
+		},
+		{
+			// reversed credit without details
+			BookingDate: day("2025-03-05"), Amount: utils.Cents(-2000), Currency: "EUR",
+			RemittanceInfo: "Storno Gutschrift", BankReference: "BANKREF3",
+		},
+		{
+			// batch entry split per transaction detail
+			BookingDate: day("2025-03-06"), Amount: utils.Cents(10000), Currency: "EUR",
+			RemittanceInfo: "RF18539007547034", EndToEndID: "E2E-2", BankReference: "BATCH1-1",
+		},
+		{
+			BookingDate: day("2025-03-06"), Amount: utils.Cents(20000), Currency: "EUR",
+			RemittanceInfo: "RE-2025-0002", EndToEndID: "E2E-3", BankReference: "BATCH1",
+		},
+	})
+}
+
+func TestParseCAMT053Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not xml", "no statement"},
+		{"no statement", `<Document><BkToCstmrStmt></BkToCstmrStmt></Document>`},
+		{"missing booking date", `<Document><BkToCstmrStmt><Stmt><Ntry><Amt Ccy="EUR">1.00</Amt><CdtDbtInd>CRDT</CdtDbtInd></Ntry></Stmt></BkToCstmrStmt></Document>`},
+		{"invalid amount", `<Document><BkToCstmrStmt><Stmt><Ntry><Amt Ccy="EUR">1,00</Amt><CdtDbtInd>CRDT</CdtDbtInd><BookgDt><Dt>2025-03-03</Dt></BookgDt></Ntry></Stmt></BkToCstmrStmt></Document>`},
+	}
+	for _, tt := range tests {
+		if _, err := ParseCAMT053([]byte(tt.data)); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package banking
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"fakturierung-backend/utils"
+)
+
+// CSVFormat describes the layout of a bank's CSV export. Columns are referenced by
+// their header name (case-insensitive). Either AmountColumn (signed) or the pair
+// CreditColumn/DebitColumn must be set.
+type CSVFormat struct {
+	Delimiter         string   `json:"delimiter"`  // default ";"
+	SkipLines         int      `json:"skip_lines"` // preamble lines before the header
+	DateColumn        string   `json:"date_column"`
+	ValueDateColumn   string   `json:"value_date_column"`
+	DateFormat        string   `json:"date_format"` // Go layout, default "02.01.2006"
+	AmountColumn      string   `json:"amount_column"`
+	CreditColumn      string   `json:"credit_column"`
+	DebitColumn       string   `json:"debit_column"`
+	DecimalComma      bool     `json:"decimal_comma"` // "1.234,56"
+	CurrencyColumn    string   `json:"currency_column"`
+	NameColumn        string   `json:"name_column"`
+	IBANColumn        string   `json:"iban_column"`
+	RemittanceColumns []string `json:"remittance_columns"` // joined with a space
+	ReferenceColumn   string   `json:"reference_column"`
+}
+
+// parseCSVAmount parses "1.234,56" / "-1234.56" style amounts.
+func parseCSVAmount(s string, decimalComma bool) (utils.Money, error) {
+	s = strings.TrimSpace(strings.NewReplacer(" ", "", "\u00a0", "", "'", "").Replace(s))
+	if s == "" {
+		return 0, nil
+	}
+	if decimalComma {
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.Replace(s, ",", ".", 1)
+	} else {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	return utils.ParseMoney(strings.TrimPrefix(s, "+"))
+}
+
+// latin1ToUTF8 converts Windows-1252/ISO-8859-1 input (common in bank exports).
+func latin1ToUTF8(data []byte) []byte {
+	if utf8.Valid(data) {
+		return data
+	}
+	var b bytes.Buffer
+	for _, c := range data {
+		b.WriteRune(rune(c))
+	}
+	return b.Bytes()
+}
+
+// ParseCSV parses a bank CSV export according to the given format.
+func ParseCSV(data []byte, f CSVFormat) (Statement, error) {
+	st := Statement{Format: FormatCSV}
+	if f.DateColumn == "" || (f.AmountColumn == "" && f.CreditColumn == "" && f.DebitColumn == "") {
+		return st, fmt.Errorf("csv: date and amount columns are required")
+	}
+	delim := ';'
+	if f.Delimiter != "" {
+		delim, _ = utf8.DecodeRuneInString(f.Delimiter)
+	}
+	layout := f.DateFormat
+	if layout == "" {
+		layout = "02.01.2006"
+	}
+
+	data = bytes.TrimPrefix(latin1ToUTF8(data), []byte("\xef\xbb\xbf"))
+	for i := 0; i < f.SkipLines; i++ {
+		nl := bytes.IndexByte(data, '\n')
+		if nl < 0 {
+			return st, fmt.Errorf("csv: file shorter than skip_lines")
+		}
+		data = data[nl+1:]
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = delim
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	header, err := r.Read()
+	if err != nil {
+		return st, fmt.Errorf("csv: missing header: %w", err)
+	}
+	index := map[string]int{}
+	for i, h := range header {
+		index[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	col := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		i, ok := index[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return -1, fmt.Errorf("csv: column %q not found", name)
+		}
+		return i, nil
+	}
+	cols := map[string]int{}
+	for key, name := range map[string]string{
+		"date": f.DateColumn, "value_date": f.ValueDateColumn, "amount": f.AmountColumn,
+		"credit": f.CreditColumn, "debit": f.DebitColumn, "currency": f.CurrencyColumn,
+		"name": f.NameColumn, "iban": f.IBANColumn, "reference": f.ReferenceColumn,
+	} {
+		i, err := col(name)
+		if err != nil {
+			return st, err
+		}
+		cols[key] = i
+	}
+	var remittance []int
+	for _, name := range f.RemittanceColumns {
+		i, err := col(name)
+		if err != nil {
+			return st, err
+		}
+		remittance = append(remittance, i)
+	}
+
+	line := f.SkipLines + 1
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return st, fmt.Errorf("csv: line %d: %w", line, err)
+		}
+		get := func(key string) string {
+			if i := cols[key]; i >= 0 && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		if get("date") == "" {
+			continue // blank or summary line
+		}
+		booking, err := time.Parse(layout, get("date"))
+		if err != nil {
+			return st, fmt.Errorf("csv: line %d: invalid date %q", line, get("date"))
+		}
+		tx := Transaction{
+			BookingDate:      dateOnly(booking),
+			Currency:         strings.ToUpper(get("currency")),
+			CounterpartyName: get("name"),
+			CounterpartyIBAN: NormalizeIBAN(get("iban")),
+			BankReference:    get("reference"),
+		}
+		if s := get("value_date"); s != "" {
+			if v, err := time.Parse(layout, s); err == nil {
+				v = dateOnly(v)
+				tx.ValueDate = &v
+			}
+		}
+		if cols["amount"] >= 0 {
+			if tx.Amount, err = parseCSVAmount(get("amount"), f.DecimalComma); err != nil {
+				return st, fmt.Errorf("csv: line %d: invalid amount %q", line, get("amount"))
+			}
+		} else {
+			credit, err1 := parseCSVAmount(get("credit"), f.DecimalComma)
+			debit, err2 := parseCSVAmount(get("debit"), f.DecimalComma)
+			if err1 != nil || err2 != nil {
+				return st, fmt.Errorf("csv: line %d: invalid amount", line)
+			}
+			if debit > 0 {
+				debit = -debit
+			}
+			tx.Amount = credit + debit
+		}
+		var parts []string
+		for _, i := range remittance {
+			if i < len(rec) {
+				parts = append(parts, rec[i])
+			}
+		}
+		tx.RemittanceInfo = joinText(parts...)
+		st.Transactions = append(st.Transactions, tx)
+	}
+	return st, nil
+}
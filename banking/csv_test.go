@@ -0,0 +1,108 @@
+package banking
+
+import (
+	"testing"
+
+	"fakturierung-backend/utils"
+)
+
+func TestParseCSV(t *testing.T) {
+	f := CSVFormat{
+		SkipLines:         1,
+		DateColumn:        "Buchungstag",
+		ValueDateColumn:   "Valuta",
+		AmountColumn:      "Betrag",
+		DecimalComma:      true,
+		CurrencyColumn:    "Waehrung",
+		NameColumn:        "Auftraggeber",
+		IBANColumn:        "IBAN",
+		RemittanceColumns: []string{"Verwendungszweck", "Zusatz"},
+		ReferenceColumn:   "Referenz",
+	}
+	st, err := ParseCSV(readTestdata(t, "statement.csv"), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Format != FormatCSV {
+		t.Errorf("format %q", st.Format)
+	}
+	checkTransactions(t, st.Transactions, []Transaction{
+		{
+			BookingDate: day("2025-03-03"), Amount: utils.Cents(119000), Currency: "EUR",
+			CounterpartyName: "Muster GmbH", CounterpartyIBAN: "DE89370400440532013000",
+			RemittanceInfo: "Rechnung RE-2025-0001", BankReference: "BANKREF1",
+		},
+		{
+			BookingDate: day("2025-03-04"), Amount: utils.Cents(-5000), Currency: "EUR",
+			CounterpartyName: "Stadtwerke", CounterpartyIBAN: "AT483200000012345864",
+			RemittanceInfo: "Strom", BankReference: "BANKREF2",
+		},
+		{
+			BookingDate: day("2025-03-05"), Amount: utils.Cents(50), Currency: "EUR",
+			CounterpartyName: `Zinsen "Q1"`, RemittanceInfo: "Habenzinsen",
+		},
+	})
+}
+
+func TestParseCSVCreditDebitColumns(t *testing.T) {
+	// Latin-1 export with separate credit/debit columns and decimal points
+	data := []byte("Datum,Haben,Soll,Empf\xe4nger\n2025-03-03,\"1,190.00\",,M\xfcller\n2025-03-04,,50.25,Stadtwerke\n")
+	f := CSVFormat{
+		Delimiter:    ",",
+		DateColumn:   "Datum",
+		DateFormat:   "2006-01-02",
+		CreditColumn: "Haben",
+		DebitColumn:  "Soll",
+		NameColumn:   "Empfänger",
+	}
+	st, err := ParseCSV(data, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTransactions(t, st.Transactions, []Transaction{
+		{BookingDate: day("2025-03-03"), Amount: utils.Cents(119000), CounterpartyName: "Müller"},
+		{BookingDate: day("2025-03-04"), Amount: utils.Cents(-5025), CounterpartyName: "Stadtwerke"},
+	})
+}
+
+func TestParseCSVAmount(t *testing.T) {
+	tests := []struct {
+		in           string
+		decimalComma bool
+		want         utils.Money
+		wantErr      bool
+	}{
+		{"1.234,56", true, 123456, false},
+		{"-1.234,56", true, -123456, false},
+		{"+0,5", true, 50, false},
+		{"1 234,56", true, 123456, false},
+		{"1,234.56", false, 123456, false},
+		{"1'234.56", false, 123456, false},
+		{"-0.005", false, -1, false},
+		{"", true, 0, false},
+		{"12,3,4", true, 0, true},
+		{"abc", false, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCSVAmount(tt.in, tt.decimalComma)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseCSVAmount(%q) = %s, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseCSVAmount(%q, %v) = %s, %v, want %s", tt.in, tt.decimalComma, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseCSVMissingColumn(t *testing.T) {
+	f := CSVFormat{DateColumn: "Datum", AmountColumn: "Betrag"}
+	if _, err := ParseCSV([]byte("Datum;Summe\n03.03.2025;1,00\n"), f); err == nil {
+		t.Error("expected an error for a missing amount column")
+	}
+	if _, err := ParseCSV([]byte("Datum;Betrag\n"), CSVFormat{DateColumn: "Datum"}); err == nil {
+		t.Error("expected an error without any amount column")
+	}
+}
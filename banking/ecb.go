@@ -0,0 +1,58 @@
+package banking
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ECB euro foreign exchange reference rates (eurofxref-daily.xml, -hist-90d.xml,
+// -hist.xml): Cube elements nested as Cube/Cube[@time]/Cube[@currency,@rate].
+// Elements are matched by local name, so the gesmes envelope is not required.
+
+// ECBRate is one reference rate: Rate units of Currency per euro on Date.
+type ECBRate struct {
+	Date     time.Time
+	Currency string
+	Rate     float64
+}
+
+type ecbFile struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// ParseECBRates reads an ECB reference rate file, all days it contains.
+func ParseECBRates(data []byte) ([]ECBRate, error) {
+	var f ecbFile
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&f); err != nil {
+		return nil, fmt.Errorf("ecb rates: %w", err)
+	}
+	var out []ECBRate
+	for _, d := range f.Days {
+		day, err := time.Parse("2006-01-02", strings.TrimSpace(d.Time))
+		if err != nil {
+			return nil, fmt.Errorf("ecb rates: invalid date %q", d.Time)
+		}
+		for _, r := range d.Rates {
+			ccy := strings.ToUpper(strings.TrimSpace(r.Currency))
+			rate, err := strconv.ParseFloat(strings.TrimSpace(r.Rate), 64)
+			if len(ccy) != 3 || err != nil || rate <= 0 {
+				return nil, fmt.Errorf("ecb rates: invalid rate %q for %q on %s", r.Rate, r.Currency, d.Time)
+			}
+			out = append(out, ECBRate{Date: day, Currency: ccy, Rate: rate})
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("ecb rates: no rates found")
+	}
+	return out, nil
+}
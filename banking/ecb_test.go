@@ -0,0 +1,49 @@
+package banking
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseECBRatesInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cube string
+		err  string
+	}{
+		{"no rates", `<Cube time="2025-03-04"></Cube>`, "no rates found"},
+		{"bad date", `<Cube time="04.03.2025"><Cube currency="USD" rate="1.05"/></Cube>`, "invalid date"},
+		{"zero rate", `<Cube time="2025-03-04"><Cube currency="USD" rate="0"/></Cube>`, "invalid rate"},
+		{"negative rate", `<Cube time="2025-03-04"><Cube currency="USD" rate="-1.05"/></Cube>`, "invalid rate"},
+		{"not a number", `<Cube time="2025-03-04"><Cube currency="USD" rate="1,05"/></Cube>`, "invalid rate"},
+		{"bad currency", `<Cube time="2025-03-04"><Cube currency="US" rate="1.05"/></Cube>`, "invalid rate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseECBRates([]byte(`<Envelope><Cube>` + tt.cube + `</Cube></Envelope>`))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+	if _, err := ParseECBRates([]byte("<Envelope><Cube>")); err == nil {
+		t.Error("truncated XML accepted")
+	}
+}
+
+func TestParseECBRatesDaily(t *testing.T) {
+	got, err := ParseECBRates([]byte(`<Envelope><Cube><Cube time="2025-03-04">
+		<Cube currency="usd" rate=" 1.0550 "/><Cube currency="JPY" rate="157.42"/></Cube></Cube></Envelope>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ECBRate{{day("2025-03-04"), "USD", 1.055}, {day("2025-03-04"), "JPY", 157.42}}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if !got[i].Date.Equal(want[i].Date) || got[i].Currency != want[i].Currency || got[i].Rate != want[i].Rate {
+			t.Errorf("rate %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package banking
+
+import (
+	"strings"
+)
+
+// NormalizeIBAN removes spaces and upper-cases an IBAN.
+func NormalizeIBAN(s string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(s), ""))
+}
+
+// mod97 computes the ISO 7064 MOD 97-10 remainder of an alphanumeric string
+// (letters count as 10..35); -1 for invalid characters.
+func mod97(s string) int {
+	rem := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			rem = (rem*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			rem = (rem*100 + int(r-'A') + 10) % 97
+		default:
+			return -1
+		}
+	}
+	return rem
+}
+
+func countryPrefix(s string) bool {
+	return len(s) >= 4 && s[0] >= 'A' && s[0] <= 'Z' && s[1] >= 'A' && s[1] <= 'Z'
+}
+
+// ValidIBAN checks length, characters and the ISO 13616 mod-97 checksum of a
+// normalized IBAN.
+func ValidIBAN(iban string) bool {
+	if len(iban) < 15 || len(iban) > 34 || !countryPrefix(iban) {
+		return false
+	}
+	return mod97(iban[4:]+iban[:4]) == 1
+}
+
+// ValidCreditorID checks a normalized SEPA creditor identifier (e.g.
+// "DE98ZZZ09999999999"). The creditor business code (positions 5-7) is not part
+// of the checksum.
+func ValidCreditorID(id string) bool {
+	if len(id) < 8 || len(id) > 35 || !countryPrefix(id) {
+		return false
+	}
+	return mod97(id[7:]+id[:4]) == 1
+}
+
+// ValidBIC checks the shape of a BIC (8 or 11 characters).
+func ValidBIC(bic string) bool {
+	if len(bic) != 8 && len(bic) != 11 {
+		return false
+	}
+	for i, r := range bic {
+		letter := r >= 'A' && r <= 'Z'
+		digit := r >= '0' && r <= '9'
+		if (i < 6 && !letter) || (i >= 6 && !letter && !digit) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+package banking
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"fakturierung-backend/utils"
+)
+
+// SWIFT MT940 customer statement. Supports the German/Austrian structured :86:
+// field (?20..?29 remittance, ?31 IBAN, ?32/?33 name) and plain free text.
+
+// :61: value date, optional entry date, D/C mark (RC/RD = reversal), optional funds
+// code, amount, transaction type, customer reference, optional //bank reference
+var mt940Line61 = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?([0-9]+,[0-9]*)([NF][A-Z0-9]{3})([^/]*?)(?://(.*))?$`)
+
+// SEPA keywords inside :86: remittance text (EREF+, KREF+, MREF+, SVWZ+, ...)
+var sepaKeyword = regexp.MustCompile(`[A-Z]{4}\+`)
+
+type mt940Field struct {
+	tag   string
+	value string
+}
+
+// mt940Fields splits the message into tagged fields, joining continuation lines.
+func mt940Fields(data []byte) []mt940Field {
+	var out []mt940Field
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "-" || strings.HasPrefix(trimmed, "-}") || strings.HasPrefix(trimmed, "{") {
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			if end := strings.Index(line[1:], ":"); end > 0 {
+				out = append(out, mt940Field{tag: line[1 : end+1], value: line[end+2:]})
+				continue
+			}
+		}
+		if len(out) > 0 {
+			out[len(out)-1].value += "\n" + line
+		}
+	}
+	return out
+}
+
+func mt940Amount(s string) (utils.Money, error) {
+	return utils.ParseMoney(strings.Replace(s, ",", ".", 1))
+}
+
+// mt940Details extracts name, IBAN and remittance text from a :86: field.
+func mt940Details(s string, tx *Transaction) {
+	s = strings.ReplaceAll(s, "\n", "")
+	if len(s) < 4 || s[3] != '?' {
+		tx.RemittanceInfo = joinText(s)
+		return
+	}
+	var remittance, name []string
+	for _, part := range strings.Split(s[3:], "?")[1:] {
+		if len(part) < 2 {
+			continue
+		}
+		code, val := part[:2], part[2:]
+		switch {
+		case code >= "20" && code <= "29", code >= "60" && code <= "63":
+			remittance = append(remittance, val)
+		case code == "31":
+			if iban := NormalizeIBAN(val); len(iban) >= 15 && iban[0] >= 'A' && iban[0] <= 'Z' {
+				tx.CounterpartyIBAN = iban
+			}
+		case code == "32" || code == "33":
+			name = append(name, val)
+		}
+	}
+	// Remittance fields are fixed-width chunks: join without separators
+	text := strings.Join(remittance, "")
+	tx.RemittanceInfo = joinText(text)
+	tx.CounterpartyName = joinText(strings.Join(name, ""))
+	if i := strings.Index(text, "EREF+"); i >= 0 {
+		ref := text[i+5:]
+		if loc := sepaKeyword.FindStringIndex(ref); loc != nil {
+			ref = ref[:loc[0]]
+		}
+		if ref = strings.TrimSpace(ref); ref != "NOTPROVIDED" {
+			tx.EndToEndID = ref
+		}
+	}
+}
+
+// ParseMT940 parses a SWIFT MT940 file with one or more statements.
+func ParseMT940(data []byte) ([]Statement, error) {
+	var out []Statement
+	var cur *Statement
+	var currency string
+	var last *Transaction
+
+	for _, f := range mt940Fields(data) {
+		switch f.tag {
+		case "20":
+			out = append(out, Statement{Format: FormatMT940, StatementID: strings.TrimSpace(f.value)})
+			cur, last, currency = &out[len(out)-1], nil, ""
+		case "25":
+			if cur == nil {
+				return nil, fmt.Errorf("mt940: :25: before :20:")
+			}
+			acct := strings.TrimSpace(f.value)
+			if i := strings.Index(acct, "/"); i >= 0 {
+				acct = acct[i+1:]
+			}
+			if iban := NormalizeIBAN(acct); ValidIBAN(iban) {
+				cur.AccountIBAN = iban
+			}
+		case "60F", "60M":
+			if len(f.value) >= 10 {
+				currency = f.value[7:10]
+			}
+		case "61":
+			if cur == nil {
+				return nil, fmt.Errorf("mt940: :61: before :20:")
+			}
+			first, extra, _ := strings.Cut(f.value, "\n")
+			m := mt940Line61.FindStringSubmatch(strings.TrimSpace(first))
+			if m == nil {
+				return nil, fmt.Errorf("mt940: invalid :61: line %q", first)
+			}
+			value, err := time.Parse("060102", m[1])
+			if err != nil {
+				return nil, fmt.Errorf("mt940: invalid value date %q", m[1])
+			}
+			booking := value
+			if m[2] != "" {
+				if b, err := time.Parse("20060102", fmt.Sprintf("%04d%s", value.Year(), m[2])); err == nil {
+					// entry date around new year may fall into the neighbouring year
+					if b.Sub(value) > 180*24*time.Hour {
+						b = b.AddDate(-1, 0, 0)
+					} else if value.Sub(b) > 180*24*time.Hour {
+						b = b.AddDate(1, 0, 0)
+					}
+					booking = b
+				}
+			}
+			amount, err := mt940Amount(m[5])
+			if err != nil {
+				return nil, fmt.Errorf("mt940: invalid amount %q", m[5])
+			}
+			if m[3] == "D" || m[3] == "RC" {
+				amount = -amount
+			}
+			v := value
+			cur.Transactions = append(cur.Transactions, Transaction{
+				BookingDate:   booking,
+				ValueDate:     &v,
+				Amount:        amount,
+				Currency:      currency,
+				BankReference: strings.TrimSpace(m[8]),
+			})
+			last = &cur.Transactions[len(cur.Transactions)-1]
+			if ref := strings.TrimSpace(m[7]); ref != "" && ref != "NONREF" {
+				last.EndToEndID = ref
+			}
+			if extra = strings.TrimSpace(extra); extra != "" && last.BankReference == "" {
+				last.BankReference = extra
+			}
+		case "86":
+			if last != nil {
+				mt940Details(f.value, last)
+				last = nil
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("mt940: no statement found")
+	}
+	return out, nil
+}
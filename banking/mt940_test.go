@@ -0,0 +1,78 @@
+package banking
+
+import (
+	"testing"
+
+	"fakturierung-backend/utils"
+)
+
+func TestParseMT940(t *testing.T) {
+	data := readTestdata(t, "mt940.sta")
+	if f := DetectFormat(data); f != FormatMT940 {
+		t.Errorf("DetectFormat = %q, want %q", f, FormatMT940)
+	}
+	stmts, err := ParseMT940(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stmts) != 1 {
+		t.Fatalf("got %d statements, want 1", len(stmts))
+	}
+	st := stmts[0]
+	if st.AccountIBAN != "AT611904300234573201" || st.StatementID != "STARTUMS" {
+		t.Errorf("statement header: %q %q", st.AccountIBAN, st.StatementID)
+	}
+	checkTransactions(t, st.Transactions, []Transaction{
+		{
+			// structured :86: with EREF, remittance split over ?21/?22
+			BookingDate: day("2025-03-03"), Amount: utils.Cents(11900), Currency: "EUR",
+			CounterpartyName: "Muster GmbH", CounterpartyIBAN: "DE89370400440532013000",
+			RemittanceInfo: "EREF+E2E-1SVWZ+Rechnung RE-2025-0001", EndToEndID: "E2E-1", BankReference: "BANKREF1",
+		},
+		{
+			BookingDate: day("2025-03-04"), Amount: utils.Cents(-5000), Currency: "EUR",
+			RemittanceInfo: "Lastschrift Stadtwerke Strom", EndToEndID: "KREF1", BankReference: "BANKREF2",
+		},
+		{
+			// RC: reversal of a credit is money going out
+			BookingDate: day("2025-03-05"), Amount: utils.Cents(-2000), Currency: "EUR",
+			RemittanceInfo: "Storno Gutschrift", BankReference: "BANKREF3",
+		},
+		{
+			// RD: reversal of a debit comes back in; bank reference on the second line
+			BookingDate: day("2025-03-06"), Amount: utils.Cents(1050), Currency: "EUR",
+			RemittanceInfo: "Rueckbuchung Lastschrift", BankReference: "BANKREF4",
+		},
+	})
+}
+
+func TestParseMT940EntryDateAcrossNewYear(t *testing.T) {
+	data := ":20:X\n:60F:C241231EUR0,00\n:61:2412311231C1,00NTRFNONREF\n:61:2501021231C2,00NTRFNONREF\n:61:2412310102C3,00NTRFNONREF\n"
+	stmts, err := ParseMT940([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2024-12-31", "2024-12-31", "2025-01-02"}
+	for i, tx := range stmts[0].Transactions {
+		if !tx.BookingDate.Equal(day(want[i])) {
+			t.Errorf("transaction %d: booking date %s, want %s", i+1, tx.BookingDate.Format("2006-01-02"), want[i])
+		}
+	}
+}
+
+func TestParseMT940Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"line before statement", ":61:2503030303C1,00NTRFNONREF\n"},
+		{"malformed line", ":20:X\n:61:garbage\n"},
+		{"invalid value date", ":20:X\n:61:2513400303C1,00NTRFNONREF\n"},
+	}
+	for _, tt := range tests {
+		if _, err := ParseMT940([]byte(tt.data)); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package banking
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"fakturierung-backend/utils"
+)
+
+// SEPA direct debit initiation, ISO 20022 pain.008.001.02 (SEPA Core scheme).
+
+const pain008NS = "urn:iso:std:iso:20022:tech:xsd:pain.008.001.02"
+
+// SEPA sequence types.
+const (
+	SeqFirst     = "FRST"
+	SeqRecurring = "RCUR"
+	SeqOneOff    = "OOFF"
+	SeqFinal     = "FNAL"
+)
+
+// DirectDebit is one collection from a debtor under a signed mandate.
+type DirectDebit struct {
+	EndToEndID   string
+	Amount       utils.Money
+	MandateID    string
+	MandateDate  time.Time
+	SequenceType string
+	DebtorName   string
+	DebtorIBAN   string
+	DebtorBIC    string // optional (IBAN-only)
+	Remittance   string
+}
+
+// DirectDebitBatch is one pain.008 message. Debits are grouped into one payment
+// information block per sequence type.
+type DirectDebitBatch struct {
+	MessageID      string
+	CreatedAt      time.Time
+	CollectionDate time.Time
+	CreditorName   string
+	CreditorIBAN   string
+	CreditorBIC    string // optional (IBAN-only)
+	CreditorID     string // SEPA creditor identifier
+	Debits         []DirectDebit
+}
+
+type p8Party struct {
+	Nm string `xml:"Nm"`
+}
+
+type p8Account struct {
+	IBAN string `xml:"Id>IBAN"`
+}
+
+type p8Othr struct {
+	ID string `xml:"Id"`
+}
+
+type p8Agent struct {
+	BIC  string  `xml:"FinInstnId>BIC,omitempty"`
+	Othr *p8Othr `xml:"FinInstnId>Othr,omitempty"`
+}
+
+func p8AgentFor(bic string) p8Agent {
+	if bic == "" {
+		return p8Agent{Othr: &p8Othr{ID: "NOTPROVIDED"}}
+	}
+	return p8Agent{BIC: bic}
+}
+
+type p8Amount struct {
+	Value string `xml:",chardata"`
+	Ccy   string `xml:"Ccy,attr"`
+}
+
+type p8RmtInf struct {
+	Ustrd string `xml:"Ustrd"`
+}
+
+type p8Tx struct {
+	EndToEndID string    `xml:"PmtId>EndToEndId"`
+	InstdAmt   p8Amount  `xml:"InstdAmt"`
+	MndtID     string    `xml:"DrctDbtTx>MndtRltdInf>MndtId"`
+	DtOfSgntr  string    `xml:"DrctDbtTx>MndtRltdInf>DtOfSgntr"`
+	DbtrAgt    p8Agent   `xml:"DbtrAgt"`
+	Dbtr       p8Party   `xml:"Dbtr"`
+	DbtrAcct   p8Account `xml:"DbtrAcct"`
+	RmtInf     *p8RmtInf `xml:"RmtInf,omitempty"`
+}
+
+type p8PmtInf struct {
+	PmtInfID     string    `xml:"PmtInfId"`
+	PmtMtd       string    `xml:"PmtMtd"`
+	BtchBookg    bool      `xml:"BtchBookg"`
+	NbOfTxs      int       `xml:"NbOfTxs"`
+	CtrlSum      string    `xml:"CtrlSum"`
+	SvcLvl       string    `xml:"PmtTpInf>SvcLvl>Cd"`
+	LclInstrm    string    `xml:"PmtTpInf>LclInstrm>Cd"`
+	SeqTp        string    `xml:"PmtTpInf>SeqTp"`
+	ReqdColltnDt string    `xml:"ReqdColltnDt"`
+	Cdtr         p8Party   `xml:"Cdtr"`
+	CdtrAcct     p8Account `xml:"CdtrAcct"`
+	CdtrAgt      p8Agent   `xml:"CdtrAgt"`
+	ChrgBr       string    `xml:"ChrgBr"`
+	CdtrSchmeID  string    `xml:"CdtrSchmeId>Id>PrvtId>Othr>Id"`
+	SchmeNm      string    `xml:"CdtrSchmeId>Id>PrvtId>Othr>SchmeNm>Prtry"`
+	Txs          []p8Tx    `xml:"DrctDbtTxInf"`
+}
+
+type p8Document struct {
+	XMLName xml.Name `xml:"Document"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	XSI     string   `xml:"xmlns:xsi,attr"`
+	Init    struct {
+		MsgID    string     `xml:"GrpHdr>MsgId"`
+		CreDtTm  string     `xml:"GrpHdr>CreDtTm"`
+		NbOfTxs  int        `xml:"GrpHdr>NbOfTxs"`
+		CtrlSum  string     `xml:"GrpHdr>CtrlSum"`
+		InitgPty p8Party    `xml:"GrpHdr>InitgPty"`
+		PmtInf   []p8PmtInf `xml:"PmtInf"`
+	} `xml:"CstmrDrctDbtInitn"`
+}
+
+var sepaTransliteration = strings.NewReplacer(
+	"Ä", "Ae", "Ö", "Oe", "Ü", "Ue", "ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss",
+	"&", "+", "é", "e", "è", "e", "á", "a", "à", "a", "ó", "o", "ò", "o", "ç", "c", "ñ", "n",
+)
+
+// SEPAText restricts text to the SEPA Latin character set (umlauts are
+// transliterated, anything else becomes a space) and cuts it to max runes.
+func SEPAText(s string, max int) string {
+	s = sepaTransliteration.Replace(s)
+	out := []rune(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("/-?:().,'+ ", r):
+			return r
+		}
+		return ' '
+	}, s))
+	if len(out) > max {
+		out = out[:max]
+	}
+	return strings.TrimSpace(strings.Join(strings.Fields(string(out)), " "))
+}
+
+func sepaAmount(m utils.Money) string {
+	return m.String()
+}
+
+// Validate reports missing or malformed batch data, one entry per problem.
+func (b DirectDebitBatch) Validate() []string {
+	var missing []string
+	if b.CreditorName == "" {
+		missing = append(missing, "creditor name")
+	}
+	if !ValidIBAN(b.CreditorIBAN) {
+		missing = append(missing, "creditor iban")
+	}
+	if b.CreditorBIC != "" && !ValidBIC(b.CreditorBIC) {
+		missing = append(missing, "creditor bic")
+	}
+	if !ValidCreditorID(b.CreditorID) {
+		missing = append(missing, "creditor id")
+	}
+	if len(b.Debits) == 0 {
+		missing = append(missing, "at least one debit")
+	}
+	for _, d := range b.Debits {
+		ref := d.EndToEndID
+		if d.Amount <= 0 {
+			missing = append(missing, ref+": positive amount")
+		}
+		if d.MandateID == "" || d.MandateDate.IsZero() {
+			missing = append(missing, ref+": mandate reference and signature date")
+		}
+		if !ValidIBAN(d.DebtorIBAN) {
+			missing = append(missing, ref+": debtor iban")
+		}
+		if d.DebtorBIC != "" && !ValidBIC(d.DebtorBIC) {
+			missing = append(missing, ref+": debtor bic")
+		}
+		switch d.SequenceType {
+		case SeqFirst, SeqRecurring, SeqOneOff, SeqFinal:
+		default:
+			missing = append(missing, ref+": sequence type")
+		}
+	}
+	return missing
+}
+
+// RenderPain008 serializes the batch as pain.008.001.02 XML.
+func RenderPain008(b DirectDebitBatch) ([]byte, error) {
+	if missing := b.Validate(); len(missing) > 0 {
+		return nil, fmt.Errorf("pain.008: invalid batch: %s", strings.Join(missing, ", "))
+	}
+
+	doc := p8Document{Xmlns: pain008NS, XSI: "http://www.w3.org/2001/XMLSchema-instance"}
+	doc.Init.MsgID = SEPAText(b.MessageID, 35)
+	doc.Init.CreDtTm = b.CreatedAt.UTC().Format("2006-01-02T15:04:05")
+	doc.Init.InitgPty = p8Party{Nm: SEPAText(b.CreditorName, 70)}
+
+	var total utils.Money
+	for _, seq := range []string{SeqFirst, SeqRecurring, SeqOneOff, SeqFinal} {
+		inf := p8PmtInf{
+			PmtInfID:     SEPAText(b.MessageID+"-"+seq, 35),
+			PmtMtd:       "DD",
+			BtchBookg:    true,
+			SvcLvl:       "SEPA",
+			LclInstrm:    "CORE",
+			SeqTp:        seq,
+			ReqdColltnDt: b.CollectionDate.Format("2006-01-02"),
+			Cdtr:         p8Party{Nm: SEPAText(b.CreditorName, 70)},
+			CdtrAcct:     p8Account{IBAN: b.CreditorIBAN},
+			CdtrAgt:      p8AgentFor(b.CreditorBIC),
+			ChrgBr:       "SLEV",
+			CdtrSchmeID:  b.CreditorID,
+			SchmeNm:      "SEPA",
+		}
+		var sum utils.Money
+		for _, d := range b.Debits {
+			if d.SequenceType != seq {
+				continue
+			}
+			tx := p8Tx{
+				EndToEndID: SEPAText(d.EndToEndID, 35),
+				InstdAmt:   p8Amount{Value: sepaAmount(d.Amount), Ccy: "EUR"},
+				MndtID:     SEPAText(d.MandateID, 35),
+				DtOfSgntr:  d.MandateDate.Format("2006-01-02"),
+				DbtrAgt:    p8AgentFor(d.DebtorBIC),
+				Dbtr:       p8Party{Nm: SEPAText(d.DebtorName, 70)},
+				DbtrAcct:   p8Account{IBAN: d.DebtorIBAN},
+			}
+			if ustrd := SEPAText(d.Remittance, 140); ustrd != "" {
+				tx.RmtInf = &p8RmtInf{Ustrd: ustrd}
+			}
+			inf.Txs = append(inf.Txs, tx)
+			sum += d.Amount
+		}
+		if len(inf.Txs) == 0 {
+			continue
+		}
+		inf.NbOfTxs = len(inf.Txs)
+		inf.CtrlSum = sepaAmount(sum)
+		doc.Init.PmtInf = append(doc.Init.PmtInf, inf)
+		doc.Init.NbOfTxs += inf.NbOfTxs
+		total += sum
+	}
+	doc.Init.CtrlSum = sepaAmount(total)
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
@@ -0,0 +1,97 @@
+package banking
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func pain008Batch() DirectDebitBatch {
+	return DirectDebitBatch{
+		MessageID:      "DD-2025-0007",
+		CreatedAt:      time.Date(2025, 3, 3, 9, 30, 0, 0, time.FixedZone("CET", 3600)),
+		CollectionDate: day("2025-03-10"),
+		CreditorName:   "Müller & Söhne GmbH",
+		CreditorIBAN:   "AT611904300234573201",
+		CreditorBIC:    "GIBAATWWXXX",
+		CreditorID:     "DE98ZZZ09999999999",
+		Debits: []DirectDebit{
+			{EndToEndID: "RE-2025-0012", Amount: 12050, MandateID: "M-001", MandateDate: day("2024-11-02"),
+				SequenceType: SeqRecurring, DebtorName: "Kunde AG", DebtorIBAN: "DE89370400440532013000",
+				DebtorBIC: "COBADEFFXXX", Remittance: "Rechnung RE-2025-0012"},
+			{EndToEndID: "RE-2025-0013", Amount: 9999, MandateID: "M-002", MandateDate: day("2025-02-20"),
+				SequenceType: SeqFirst, DebtorName: "Jürgen Groß", DebtorIBAN: "AT483200000012345864",
+				Remittance: "Rechnung RE-2025-0013 – März"},
+			{EndToEndID: "RE-2025-0014", Amount: 1, MandateID: "M-001", MandateDate: day("2024-11-02"),
+				SequenceType: SeqRecurring, DebtorName: "Kunde AG", DebtorIBAN: "DE89370400440532013000",
+				DebtorBIC: "COBADEFFXXX"},
+		},
+	}
+}
+
+func TestRenderPain008Golden(t *testing.T) {
+	got, err := RenderPain008(pain008Batch())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const golden = "testdata/pain008.xml"
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := readTestdata(t, "pain008.xml"); !bytes.Equal(got, want) {
+		t.Errorf("pain.008 differs from %s (go test -run Pain008 -update rewrites it):\n%s", golden, got)
+	}
+}
+
+func TestRenderPain008Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(b *DirectDebitBatch)
+		problem string
+	}{
+		{"creditor iban", func(b *DirectDebitBatch) { b.CreditorIBAN = "AT611904300234573202" }, "creditor iban"},
+		{"creditor id", func(b *DirectDebitBatch) { b.CreditorID = "DE00ZZZ09999999999" }, "creditor id"},
+		{"no debits", func(b *DirectDebitBatch) { b.Debits = nil }, "at least one debit"},
+		{"zero amount", func(b *DirectDebitBatch) { b.Debits[0].Amount = 0 }, "RE-2025-0012: positive amount"},
+		{"mandate date", func(b *DirectDebitBatch) { b.Debits[1].MandateDate = time.Time{} }, "RE-2025-0013: mandate reference"},
+		{"sequence type", func(b *DirectDebitBatch) { b.Debits[2].SequenceType = "ONCE" }, "RE-2025-0014: sequence type"},
+		{"debtor bic", func(b *DirectDebitBatch) { b.Debits[0].DebtorBIC = "COBA" }, "RE-2025-0012: debtor bic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := pain008Batch()
+			tt.change(&b)
+			_, err := RenderPain008(b)
+			if err == nil || !strings.Contains(err.Error(), tt.problem) {
+				t.Errorf("err = %v, want it to mention %q", err, tt.problem)
+			}
+		})
+	}
+}
+
+func TestSEPAText(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"Müller & Söhne", 70, "Mueller + Soehne"},
+		{"Straße 1 – Wien", 70, "Strasse 1 Wien"},
+		{"  a   b  ", 70, "a b"},
+		{"Rechnung: 12/2025 (Teil 1)", 70, "Rechnung: 12/2025 (Teil 1)"},
+		{"ABCDEFGHIJ", 4, "ABCD"},
+		{"Ä€", 70, "Ae"},
+	}
+	for _, tt := range tests {
+		if got := SEPAText(tt.in, tt.max); got != tt.want {
+			t.Errorf("SEPAText(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+		}
+	}
+}
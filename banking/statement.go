@@ -0,0 +1,69 @@
+// Package banking parses bank account statements (CAMT.053, MT940, CSV) into a
+// common transaction list for payment matching.
+package banking
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"time"
+
+	"fakturierung-backend/utils"
+)
+
+// Supported statement formats.
+const (
+	FormatCAMT053 = "camt053"
+	FormatMT940   = "mt940"
+	FormatCSV     = "csv"
+)
+
+// ErrUnknownFormat is returned when a file matches none of the supported formats.
+var ErrUnknownFormat = errors.New("unknown bank statement format")
+
+// Transaction is one booked statement line. Amount is signed: credits (money
+// received) are positive, debits negative.
+type Transaction struct {
+	BookingDate      time.Time
+	ValueDate        *time.Time
+	Amount           utils.Money
+	Currency         string
+	CounterpartyName string
+	CounterpartyIBAN string
+	RemittanceInfo   string
+	EndToEndID       string
+	BankReference    string
+}
+
+// Statement is one account statement; a file may contain several.
+type Statement struct {
+	Format       string
+	AccountIBAN  string
+	StatementID  string
+	Transactions []Transaction
+}
+
+// DetectFormat guesses the format of an uploaded file from its content.
+func DetectFormat(data []byte) string {
+	head := data
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	switch {
+	case bytes.Contains(head, []byte("BkToCstmrStmt")):
+		return FormatCAMT053
+	case bytes.Contains(head, []byte(":20:")) && bytes.Contains(data, []byte(":61:")):
+		return FormatMT940
+	}
+	return ""
+}
+
+// joinText collapses whitespace of free-text fragments into one line.
+func joinText(parts ...string) string {
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
+
+// dateOnly truncates a time to its UTC calendar day.
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
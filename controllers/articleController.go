@@ -18,19 +18,25 @@ import (
 // ===== DTOs =====
 
 type ArticleDTO struct {
-	Name        string  `json:"name" validate:"required,min=1"`
-	Description string  `json:"description" validate:"omitempty"`
-	UnitPrice   float64 `json:"unit_price" validate:"required,gt=0"`
-	Active      bool    `json:"active" validate:"required"`
+	Name        string      `json:"name" validate:"required,min=1"`
+	Description string      `json:"description" validate:"omitempty"`
+	UnitPrice   utils.Money `json:"unit_price" validate:"required,gt=0"`
+	Unit        string      `json:"unit" validate:"omitempty,oneof=piece hour day kg m flat_rate"` // "" => piece
+	Active      bool        `json:"active" validate:"required"`
+	// nil => tenant default tax category
+	TaxCategoryID *uint `json:"tax_category_id" validate:"omitempty,gt=0"`
 }
 
 // Pointer-based for partial updates; requires optimistic-lock version
 type ArticleUpdateDTO struct {
-	Version     uint     `json:"version" validate:"required,gt=0"`
-	Name        *string  `json:"name" validate:"omitempty"`
-	Description *string  `json:"description" validate:"omitempty"`
-	UnitPrice   *float64 `json:"unit_price" validate:"omitempty,gt=0"`
-	Active      *bool    `json:"active" validate:"omitempty"`
+	Version     uint         `json:"version" validate:"required,gt=0"`
+	Name        *string      `json:"name" validate:"omitempty"`
+	Description *string      `json:"description" validate:"omitempty"`
+	UnitPrice   *utils.Money `json:"unit_price" validate:"omitempty,gt=0"`
+	Unit        *string      `json:"unit" validate:"omitempty,oneof=piece hour day kg m flat_rate"`
+	Active      *bool        `json:"active" validate:"omitempty"`
+	// Tax category for invoice lines referencing this article
+	TaxCategoryID *uint `json:"tax_category_id" validate:"omitempty,gt=0"`
 }
 
 func parseIntDefault(s string, def int) int {
@@ -66,10 +72,12 @@ func CreateArticles(c *fiber.Ctx) error {
 	articles := make([]models.Article, 0, len(inputs))
 	for _, in := range inputs {
 		articles = append(articles, models.Article{
-			Name:        in.Name,
-			Description: in.Description,
-			UnitPrice:   in.UnitPrice,
-			Active:      in.Active,
+			Name:          in.Name,
+			Description:   in.Description,
+			UnitPrice:     in.UnitPrice,
+			Unit:          in.Unit,
+			Active:        in.Active,
+			TaxCategoryID: in.TaxCategoryID,
 		})
 	}
 
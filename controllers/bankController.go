@@ -0,0 +1,667 @@
+package controllers
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"fakturierung-backend/banking"
+	"fakturierung-backend/database"
+	"fakturierung-backend/middlewares"
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ===== DTOs =====
+
+type BankCSVProfileCreateDTO struct {
+	Name              string   `json:"name" validate:"required,min=1"`
+	Delimiter         string   `json:"delimiter" validate:"omitempty,len=1"`
+	SkipLines         int      `json:"skip_lines" validate:"gte=0,lte=100"`
+	DateColumn        string   `json:"date_column" validate:"required"`
+	ValueDateColumn   string   `json:"value_date_column" validate:"omitempty"`
+	DateFormat        string   `json:"date_format" validate:"omitempty"` // Go layout, e.g. "02.01.2006"
+	AmountColumn      string   `json:"amount_column" validate:"required_without_all=CreditColumn DebitColumn"`
+	CreditColumn      string   `json:"credit_column" validate:"omitempty"`
+	DebitColumn       string   `json:"debit_column" validate:"omitempty"`
+	DecimalComma      bool     `json:"decimal_comma"`
+	CurrencyColumn    string   `json:"currency_column" validate:"omitempty"`
+	NameColumn        string   `json:"name_column" validate:"omitempty"`
+	IBANColumn        string   `json:"iban_column" validate:"omitempty"`
+	RemittanceColumns []string `json:"remittance_columns" validate:"omitempty"`
+	ReferenceColumn   string   `json:"reference_column" validate:"omitempty"`
+}
+
+type BankLineAssignDTO struct {
+	InvoiceID uint `json:"invoice_id" validate:"required,gt=0"`
+}
+
+// ===== Helpers =====
+
+const (
+	lineStatusMatched   = "matched"
+	lineStatusReview    = "review"
+	lineStatusUnmatched = "unmatched"
+	lineStatusIgnored   = "ignored"
+	lineStatusDuplicate = "duplicate"
+
+	// match scores: a confident match needs the invoice number plus amount or IBAN,
+	// or (without any number hit) a unique IBAN + amount match
+	scoreNumber = 60
+	scoreAmount = 30
+	scoreIBAN   = 20
+
+	maxMatchCandidates = 5
+)
+
+// openInvoice is a published invoice with an open balance, as seen by the matcher.
+type openInvoice struct {
+	ID            uint
+	InvoiceNumber string
+	Currency      string
+	CustomerIBAN  string
+	OpenAmount    utils.Money
+	PaidTotal     utils.Money
+	SkontoRate    float64
+	SkontoDueDate *time.Time
+	RoundingMode  utils.RoundingMode
+}
+
+// skontoHit reports whether amount, received on day, settles the invoice with its
+// early-payment discount: nothing paid yet and the deadline not passed.
+func (inv openInvoice) skontoHit(amount utils.Money, day time.Time) bool {
+	if inv.SkontoRate <= 0 || inv.SkontoDueDate == nil || inv.PaidTotal != 0 {
+		return false
+	}
+	mode := inv.RoundingMode
+	if mode == "" {
+		mode = utils.RoundHalfUp
+	}
+	return skontoTotal(inv.OpenAmount, inv.SkontoRate, mode) == amount &&
+		day.Before(skontoDeadline(*inv.SkontoDueDate))
+}
+
+// lineCurrency is the currency of a statement line; banks that omit it book in euro.
+func lineCurrency(line *models.BankStatementLine) string {
+	if line.Currency == "" {
+		return defaultCurrency
+	}
+	return line.Currency
+}
+
+func loadOpenInvoices(tx *gorm.DB) ([]openInvoice, error) {
+	var out []openInvoice
+	err := tx.Raw(`SELECT invoices.id, invoices.invoice_number, invoices.currency, COALESCE(customers.iban, '') AS customer_iban,
+			` + invoiceOpenSQL + ` AS open_amount, invoices.paid_total, invoices.skonto_rate, invoices.skonto_due_date,
+			invoices.rounding_mode
+		FROM invoices LEFT JOIN customers ON customers.id = invoices.c_id
+		WHERE ` + invoiceIssuedSQL + ` AND NOT invoices.cancelled AND ` + invoiceOpenSQL + ` > 0
+		ORDER BY invoices.id`).Scan(&out).Error
+	return out, err
+}
+
+// alnumUpper keeps letters and digits only, upper-cased, so "RE-2025 / 0001" in a
+// wrapped bank text still matches "RE-2025-0001".
+func alnumUpper(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, s)
+}
+
+// containsRef reports whether the normalized text contains the normalized number
+// without being part of a longer number (RE20251 must not match RE202510).
+func containsRef(text, number string) bool {
+	if len(number) < 4 {
+		return false
+	}
+	isDigit := func(b byte) bool { return b >= '0' && b <= '9' }
+	for from := 0; ; {
+		i := strings.Index(text[from:], number)
+		if i < 0 {
+			return false
+		}
+		i += from
+		end := i + len(number)
+		before := i > 0 && isDigit(text[i-1]) && isDigit(number[0])
+		after := end < len(text) && isDigit(text[end]) && isDigit(number[len(number)-1])
+		if !before && !after {
+			return true
+		}
+		from = i + 1
+	}
+}
+
+// matchCandidates scores open invoices in the line's currency against an incoming
+// statement line.
+func matchCandidates(line *models.BankStatementLine, open []openInvoice) []models.MatchCandidate {
+	text := alnumUpper(line.RemittanceInfo + " " + line.EndToEndID)
+	currency := lineCurrency(line)
+	var out []models.MatchCandidate
+	for _, inv := range open {
+		if inv.Currency != currency {
+			continue
+		}
+		c := models.MatchCandidate{InvoiceID: inv.ID, InvoiceNumber: inv.InvoiceNumber, OpenAmount: inv.OpenAmount}
+		if containsRef(text, alnumUpper(inv.InvoiceNumber)) {
+			c.Score += scoreNumber
+			c.Reasons = append(c.Reasons, "number")
+		}
+		if inv.OpenAmount == line.Amount {
+			c.Score += scoreAmount
+			c.Reasons = append(c.Reasons, "amount")
+		} else if inv.skontoHit(line.Amount, line.BookingDate) {
+			c.Score += scoreAmount
+			c.Reasons = append(c.Reasons, "skonto")
+		}
+		if line.CounterpartyIBAN != "" && inv.CustomerIBAN == line.CounterpartyIBAN {
+			c.Score += scoreIBAN
+			c.Reasons = append(c.Reasons, "iban")
+		}
+		if c.Score > 0 {
+			out = append(out, c)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	if len(out) > maxMatchCandidates {
+		out = out[:maxMatchCandidates]
+	}
+	return out
+}
+
+// confidentMatch returns the candidate to book automatically, if any.
+func confidentMatch(cands []models.MatchCandidate) (models.MatchCandidate, bool) {
+	if len(cands) == 0 {
+		return models.MatchCandidate{}, false
+	}
+	top := cands[0]
+	if top.Score >= scoreNumber {
+		numberHits := 0
+		for _, c := range cands {
+			if c.Score >= scoreNumber {
+				numberHits++
+			}
+		}
+		return top, numberHits == 1 && top.Score > scoreNumber
+	}
+	unique := len(cands) == 1 || cands[1].Score < top.Score
+	return top, unique && top.Score == scoreAmount+scoreIBAN
+}
+
+// lineIdentity is what identifies a transaction across overlapping statements: the
+// account, booking date, amount and the bank's reference (else the end-to-end id,
+// else counterparty IBAN and remittance text). Keep in sync with the migration backfill.
+func lineIdentity(accountIBAN string, line *models.BankStatementLine) string {
+	ref := line.BankReference
+	if ref == "" {
+		ref = line.EndToEndID
+	}
+	if ref == "" {
+		ref = line.CounterpartyIBAN + "/" + line.RemittanceInfo
+	}
+	return strings.Join([]string{
+		banking.NormalizeIBAN(accountIBAN), line.BookingDate.Format("2006-01-02"), line.Amount.String(), ref,
+	}, "|")
+}
+
+// lineDedupeKey is the stored key of the occurrence-th (1-based) line of a statement
+// with this identity, so identical transactions on the same day stay distinct.
+func lineDedupeKey(identity string, occurrence int) string {
+	sum := md5.Sum([]byte(identity + "|" + strconv.Itoa(occurrence)))
+	return hex.EncodeToString(sum[:])
+}
+
+// bookStatementLine creates the payment for a matched line and links both.
+func bookStatementLine(tx *gorm.DB, line *models.BankStatementLine, invoiceID uint, matchedBy string, by actor) error {
+	ref := line.EndToEndID
+	if ref == "" {
+		ref = line.BankReference
+	}
+	note := line.RemittanceInfo
+	if len(note) > 200 {
+		note = note[:200]
+	}
+	payment := models.Payment{
+		InvoiceID: invoiceID,
+		Kind:      paymentKindPayment,
+		Amount:    line.Amount,
+		Method:    "bank-transfer",
+		Reference: ref,
+		Note:      strings.ToValidUTF8(note, ""),
+		PaidAt:    line.BookingDate,
+	}
+	if err := changePayments(tx, invoiceID, by, func(inv *models.Invoice) error {
+		payment.Currency = inv.Currency
+		return tx.Create(&payment).Error
+	}); err != nil {
+		return err
+	}
+	line.Status = lineStatusMatched
+	line.InvoiceID = &invoiceID
+	line.PaymentID = &payment.ID
+	line.MatchedBy = matchedBy
+	return nil
+}
+
+func csvFormatFrom(p models.BankCSVProfile) banking.CSVFormat {
+	return banking.CSVFormat{
+		Delimiter:         p.Delimiter,
+		SkipLines:         p.SkipLines,
+		DateColumn:        p.DateColumn,
+		ValueDateColumn:   p.ValueDateColumn,
+		DateFormat:        p.DateFormat,
+		AmountColumn:      p.AmountColumn,
+		CreditColumn:      p.CreditColumn,
+		DebitColumn:       p.DebitColumn,
+		DecimalComma:      p.DecimalComma,
+		CurrencyColumn:    p.CurrencyColumn,
+		NameColumn:        p.NameColumn,
+		IBANColumn:        p.IBANColumn,
+		RemittanceColumns: p.RemittanceColumns,
+		ReferenceColumn:   p.ReferenceColumn,
+	}
+}
+
+// parseStatementFile parses an upload in the requested (or detected) format.
+func parseStatementFile(tx *gorm.DB, data []byte, format string, profileID int) ([]banking.Statement, error) {
+	if format == "" {
+		format = banking.DetectFormat(data)
+		if format == "" && profileID > 0 {
+			format = banking.FormatCSV
+		}
+	}
+	switch format {
+	case banking.FormatCAMT053:
+		return banking.ParseCAMT053(data)
+	case banking.FormatMT940:
+		return banking.ParseMT940(data)
+	case banking.FormatCSV:
+		if profileID <= 0 {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "profile_id is required for csv statements")
+		}
+		var p models.BankCSVProfile
+		if err := tx.First(&p, "id = ?", profileID).Error; err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "csv profile not found")
+		}
+		st, err := banking.ParseCSV(data, csvFormatFrom(p))
+		if err != nil {
+			return nil, err
+		}
+		return []banking.Statement{st}, nil
+	}
+	return nil, banking.ErrUnknownFormat
+}
+
+// ===== Handlers =====
+
+// POST /api/bank-csv-profile
+func CreateBankCSVProfile(c *fiber.Ctx) error {
+	var in BankCSVProfileCreateDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+	delimiter := in.Delimiter // may be a tab, keep untrimmed
+	utils.NormalizeDTO(&in)
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	profile := models.BankCSVProfile{
+		Name:              in.Name,
+		Delimiter:         delimiter,
+		SkipLines:         in.SkipLines,
+		DateColumn:        in.DateColumn,
+		ValueDateColumn:   in.ValueDateColumn,
+		DateFormat:        in.DateFormat,
+		AmountColumn:      in.AmountColumn,
+		CreditColumn:      in.CreditColumn,
+		DebitColumn:       in.DebitColumn,
+		DecimalComma:      in.DecimalComma,
+		CurrencyColumn:    in.CurrencyColumn,
+		NameColumn:        in.NameColumn,
+		IBANColumn:        in.IBANColumn,
+		RemittanceColumns: datatypes.NewJSONSlice(in.RemittanceColumns),
+		ReferenceColumn:   in.ReferenceColumn,
+	}
+	if err := db.Create(&profile).Error; err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "could not create csv profile")
+	}
+	return c.Status(fiber.StatusCreated).JSON(profile)
+}
+
+// GET /api/bank-csv-profiles
+func GetBankCSVProfiles(c *fiber.Ctx) error {
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var profiles []models.BankCSVProfile
+	if err := db.Order("name ASC").Find(&profiles).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"csv_profiles": profiles, "message": "success"})
+}
+
+// POST /api/bank-statements  (multipart: file, format=camt053|mt940|csv, profile_id)
+// Stores the statement lines and matches incoming credits to open invoices: confident
+// matches are booked as payments right away, the rest lands in the review queue.
+// Lines already imported with an overlapping statement are stored as duplicates.
+func ImportBankStatement(c *fiber.Ctx) error {
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "file is required")
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "could not read file")
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || len(data) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "could not read file")
+	}
+	format := strings.ToLower(strings.TrimSpace(c.FormValue("format")))
+	profileID := utils.ParseIntDefault(c.FormValue("profile_id"), 0)
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var imported []models.BankStatement
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var dup int64
+		if err := tx.Model(&models.BankStatement{}).Where("sha256 = ?", digest).Count(&dup).Error; err != nil {
+			return err
+		}
+		if dup > 0 {
+			return fiber.NewError(fiber.StatusConflict, "statement file was already imported")
+		}
+		stmts, err := parseStatementFile(tx, data, format, profileID)
+		if err != nil {
+			var fe *fiber.Error
+			if errors.As(err, &fe) {
+				return fe
+			}
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		open, err := loadOpenInvoices(tx)
+		if err != nil {
+			return err
+		}
+
+		for seq, s := range stmts {
+			st := models.BankStatement{
+				Format:       s.Format,
+				FileName:     fh.Filename,
+				SHA256:       digest,
+				Seq:          seq,
+				AccountIBAN:  s.AccountIBAN,
+				StatementRef: s.StatementID,
+				LineCount:    len(s.Transactions),
+				ImportedAt:   time.Now().UTC(),
+			}
+			if err := tx.Create(&st).Error; err != nil {
+				return err
+			}
+			seen := make(map[string]int) // occurrences per line identity in this statement
+			for _, t := range s.Transactions {
+				line := models.BankStatementLine{
+					StatementID:      st.ID,
+					BookingDate:      t.BookingDate,
+					ValueDate:        t.ValueDate,
+					Amount:           t.Amount,
+					Currency:         t.Currency,
+					CounterpartyName: t.CounterpartyName,
+					CounterpartyIBAN: t.CounterpartyIBAN,
+					RemittanceInfo:   t.RemittanceInfo,
+					EndToEndID:       t.EndToEndID,
+					BankReference:    t.BankReference,
+					Status:           lineStatusUnmatched,
+				}
+				identity := lineIdentity(s.AccountIBAN, &line)
+				seen[identity]++
+				line.DedupeKey = lineDedupeKey(identity, seen[identity])
+				var known int64
+				if err := tx.Model(&models.BankStatementLine{}).
+					Where("dedupe_key = ? AND status <> ?", line.DedupeKey, lineStatusDuplicate).
+					Count(&known).Error; err != nil {
+					return err
+				}
+				switch {
+				case known > 0:
+					line.Status = lineStatusDuplicate // booked with an overlapping statement
+					st.Duplicates++
+				case line.Amount <= 0:
+					line.Status = lineStatusIgnored // outgoing money is not matched
+				default:
+					cands := matchCandidates(&line, open)
+					line.Candidates = datatypes.NewJSONSlice(cands)
+					if best, ok := confidentMatch(cands); ok {
+						if err := bookStatementLine(tx, &line, best.InvoiceID, "auto", requestActor(c)); err != nil {
+							return err
+						}
+						st.Matched++
+						for i := range open {
+							if open[i].ID != best.InvoiceID {
+								continue
+							}
+							if open[i].skontoHit(line.Amount, line.BookingDate) {
+								open[i].OpenAmount = 0 // settled with the discount
+							} else {
+								open[i].OpenAmount -= line.Amount
+							}
+							open[i].PaidTotal += line.Amount
+						}
+					} else if len(cands) > 0 {
+						line.Status = lineStatusReview
+					}
+				}
+				if err := tx.Create(&line).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&st).Updates(map[string]any{"matched": st.Matched, "duplicates": st.Duplicates}).Error; err != nil {
+				return err
+			}
+			imported = append(imported, st)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"statements": imported, "message": "success"})
+}
+
+// GET /api/bank-statements?limit=50&offset=0
+func GetBankStatements(c *fiber.Ctx) error {
+	limit := parseIntDefault(c.Query("limit"), 50)
+	offset := parseIntDefault(c.Query("offset"), 0)
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var statements []models.BankStatement
+	if err := db.Order("imported_at DESC, id DESC").Limit(limit).Offset(offset).Find(&statements).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"statements": statements, "message": "success"})
+}
+
+// GET /api/bank-statements/:id
+func GetBankStatement(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid statement id")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var st models.BankStatement
+	if err := db.Preload("Lines", func(q *gorm.DB) *gorm.DB { return q.Order("id ASC") }).
+		First(&st, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "statement not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"statement": st, "message": "success"})
+}
+
+// GET /api/bank-statement-lines?status=review,unmatched&limit=50&offset=0
+// The review queue: by default lines that still need a decision.
+func GetBankStatementLines(c *fiber.Ctx) error {
+	limit := parseIntDefault(c.Query("limit"), 50)
+	offset := parseIntDefault(c.Query("offset"), 0)
+	statuses := []string{lineStatusReview, lineStatusUnmatched}
+	if s := strings.TrimSpace(c.Query("status")); s != "" {
+		statuses = nil
+		for _, st := range strings.Split(strings.ToLower(s), ",") {
+			switch st = strings.TrimSpace(st); st {
+			case lineStatusMatched, lineStatusReview, lineStatusUnmatched, lineStatusIgnored, lineStatusDuplicate:
+				statuses = append(statuses, st)
+			default:
+				return fiber.NewError(fiber.StatusBadRequest, "invalid status: "+st)
+			}
+		}
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var lines []models.BankStatementLine
+	if err := db.Where("status IN ?", statuses).
+		Order("booking_date ASC, id ASC").Limit(limit).Offset(offset).
+		Find(&lines).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"lines": lines, "message": "success"})
+}
+
+// lockReviewLine loads a statement line that still awaits a decision.
+func lockReviewLine(tx *gorm.DB, id int) (models.BankStatementLine, error) {
+	var line models.BankStatementLine
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&line, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return line, fiber.NewError(fiber.StatusNotFound, "statement line not found")
+		}
+		return line, err
+	}
+	if line.Status != lineStatusReview && line.Status != lineStatusUnmatched {
+		return line, fiber.NewError(fiber.StatusConflict, "statement line is already "+line.Status)
+	}
+	return line, nil
+}
+
+// POST /api/bank-statement-lines/:id/assign  Body: { "invoice_id": 123 }
+// Books the line as payment on the chosen invoice.
+func AssignBankStatementLine(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid statement line id")
+	}
+	var in BankLineAssignDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var line models.BankStatementLine
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if line, err = lockReviewLine(tx, id); err != nil {
+			return err
+		}
+		if line.Amount <= 0 {
+			return fiber.NewError(fiber.StatusConflict, "only incoming payments can be assigned")
+		}
+		var inv models.Invoice
+		if err := tx.Select("id", "published", "document_type", "currency").First(&inv, "id = ?", in.InvoiceID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fiber.NewError(fiber.StatusBadRequest, "invoice not found")
+			}
+			return err
+		}
+		if !inv.IssuedInvoice() {
+			return fiber.NewError(fiber.StatusBadRequest, "payments can only be assigned to published invoices")
+		}
+		if inv.Currency != lineCurrency(&line) {
+			return fiber.NewError(fiber.StatusBadRequest,
+				fmt.Sprintf("invoice is billed in %s, the payment is in %s", inv.Currency, lineCurrency(&line)))
+		}
+		if err := bookStatementLine(tx, &line, inv.ID, "manual", requestActor(c)); err != nil {
+			return err
+		}
+		if err := tx.Model(&line).Updates(map[string]any{
+			"status": line.Status, "invoice_id": line.InvoiceID, "payment_id": line.PaymentID, "matched_by": line.MatchedBy,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.BankStatement{}).Where("id = ?", line.StatementID).
+			Update("matched", gorm.Expr("matched + 1")).Error
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(line)
+}
+
+// POST /api/bank-statement-lines/:id/ignore
+// Dismisses a line from the review queue (e.g. not invoice related).
+func IgnoreBankStatementLine(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid statement line id")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var line models.BankStatementLine
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if line, err = lockReviewLine(tx, id); err != nil {
+			return err
+		}
+		line.Status = lineStatusIgnored
+		return tx.Model(&line).Update("status", line.Status).Error
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(line)
+}
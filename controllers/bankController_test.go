@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+)
+
+func TestContainsRef(t *testing.T) {
+	tests := []struct {
+		text, number string
+		want         bool
+	}{
+		{"RECHNUNGRE20250001DANKE", "RE20250001", true},
+		{"RE20250001", "RE20250001", true},
+		{"ZAHLUNG2025000112", "20250001", false}, // part of a longer number
+		{"RE202500010", "RE20250001", false},
+		{"1RE20250001", "RE20250001", true}, // a letter-led number may follow a digit
+		{"RE202500011RE20250001", "RE20250001", true},
+		{"RE20250002", "RE20250001", false},
+		{"ABC123", "123", false}, // too short to be a reference
+		{"", "RE20250001", false},
+	}
+	for _, tt := range tests {
+		if got := containsRef(tt.text, tt.number); got != tt.want {
+			t.Errorf("containsRef(%q, %q) = %v, want %v", tt.text, tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestAlnumUpper(t *testing.T) {
+	if got := alnumUpper("re-2025 / 0001, Dank!"); got != "RE20250001DANK" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestMatchCandidates(t *testing.T) {
+	open := []openInvoice{
+		{ID: 1, InvoiceNumber: "RE-2025-0001", Currency: "EUR", CustomerIBAN: "AT611904300234573201", OpenAmount: 11900},
+		{ID: 2, InvoiceNumber: "RE-2025-0002", Currency: "EUR", CustomerIBAN: "DE89370400440532013000", OpenAmount: 5000},
+		{ID: 3, InvoiceNumber: "RE-2025-0003", Currency: "EUR", CustomerIBAN: "DE89370400440532013000", OpenAmount: 11900},
+		{ID: 4, InvoiceNumber: "RE-2025-0004", Currency: "USD", CustomerIBAN: "AT611904300234573201", OpenAmount: 11900},
+	}
+	tests := []struct {
+		name string
+		line models.BankStatementLine
+		want []models.MatchCandidate
+	}{
+		{
+			name: "number in remittance, amount and iban",
+			line: models.BankStatementLine{Amount: 11900, RemittanceInfo: "Rechnung RE 2025 0001", CounterpartyIBAN: "AT611904300234573201"},
+			want: []models.MatchCandidate{
+				{InvoiceID: 1, InvoiceNumber: "RE-2025-0001", OpenAmount: 11900, Score: scoreNumber + scoreAmount + scoreIBAN, Reasons: []string{"number", "amount", "iban"}},
+				{InvoiceID: 3, InvoiceNumber: "RE-2025-0003", OpenAmount: 11900, Score: scoreAmount, Reasons: []string{"amount"}},
+			},
+		},
+		{
+			name: "number in end-to-end id only",
+			line: models.BankStatementLine{Amount: 100, EndToEndID: "RE-2025-0002", Currency: "EUR"},
+			want: []models.MatchCandidate{
+				{InvoiceID: 2, InvoiceNumber: "RE-2025-0002", OpenAmount: 5000, Score: scoreNumber, Reasons: []string{"number"}},
+			},
+		},
+		{
+			name: "amount only",
+			line: models.BankStatementLine{Amount: 5000, RemittanceInfo: "Danke"},
+			want: []models.MatchCandidate{
+				{InvoiceID: 2, InvoiceNumber: "RE-2025-0002", OpenAmount: 5000, Score: scoreAmount, Reasons: []string{"amount"}},
+			},
+		},
+		{
+			name: "iban only",
+			line: models.BankStatementLine{Amount: 100, CounterpartyIBAN: "DE89370400440532013000"},
+			want: []models.MatchCandidate{
+				{InvoiceID: 2, InvoiceNumber: "RE-2025-0002", OpenAmount: 5000, Score: scoreIBAN, Reasons: []string{"iban"}},
+				{InvoiceID: 3, InvoiceNumber: "RE-2025-0003", OpenAmount: 11900, Score: scoreIBAN, Reasons: []string{"iban"}},
+			},
+		},
+		{
+			name: "other currency",
+			line: models.BankStatementLine{Amount: 11900, Currency: "USD", CounterpartyIBAN: "AT611904300234573201"},
+			want: []models.MatchCandidate{
+				{InvoiceID: 4, InvoiceNumber: "RE-2025-0004", OpenAmount: 11900, Score: scoreAmount + scoreIBAN, Reasons: []string{"amount", "iban"}},
+			},
+		},
+		{
+			name: "nothing",
+			line: models.BankStatementLine{Amount: 1, RemittanceInfo: "RE-2025-00010"},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchCandidates(&tt.line, open); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchCandidatesSkonto(t *testing.T) {
+	due := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	open := []openInvoice{{ID: 1, InvoiceNumber: "RE-2025-0001", Currency: "EUR", OpenAmount: 10000, SkontoRate: 0.02, SkontoDueDate: &due}}
+
+	line := models.BankStatementLine{Amount: 9800, BookingDate: due}
+	got := matchCandidates(&line, open)
+	if len(got) != 1 || got[0].Score != scoreAmount || !reflect.DeepEqual(got[0].Reasons, []string{"skonto"}) {
+		t.Errorf("within the discount period: %+v", got)
+	}
+	line.BookingDate = due.AddDate(0, 0, 1)
+	if got := matchCandidates(&line, open); len(got) != 0 {
+		t.Errorf("after the discount period: %+v", got)
+	}
+}
+
+func TestMatchCandidatesLimit(t *testing.T) {
+	var open []openInvoice
+	for i := uint(1); i <= maxMatchCandidates+2; i++ {
+		open = append(open, openInvoice{ID: i, InvoiceNumber: "X", Currency: "EUR", OpenAmount: 100})
+	}
+	open = append(open, openInvoice{ID: 99, InvoiceNumber: "RE-2025-0099", Currency: "EUR", OpenAmount: 200})
+	line := models.BankStatementLine{Amount: 100, RemittanceInfo: "RE-2025-0099"}
+	got := matchCandidates(&line, open)
+	if len(got) != maxMatchCandidates {
+		t.Fatalf("got %d candidates, want %d", len(got), maxMatchCandidates)
+	}
+	if got[0].InvoiceID != 99 || got[1].InvoiceID != 1 {
+		t.Errorf("not ordered by score, then invoice: %+v", got)
+	}
+}
+
+func TestConfidentMatch(t *testing.T) {
+	cand := func(id uint, score int) models.MatchCandidate {
+		return models.MatchCandidate{InvoiceID: id, Score: score}
+	}
+	tests := []struct {
+		name   string
+		cands  []models.MatchCandidate
+		wantID uint
+		wantOK bool
+	}{
+		{"none", nil, 0, false},
+		{"number and amount", []models.MatchCandidate{cand(1, scoreNumber+scoreAmount)}, 1, true},
+		{"number and iban", []models.MatchCandidate{cand(1, scoreNumber+scoreIBAN), cand(2, scoreAmount)}, 1, true},
+		{"number only", []models.MatchCandidate{cand(1, scoreNumber)}, 1, false},
+		{"two number hits", []models.MatchCandidate{cand(1, scoreNumber+scoreAmount+scoreIBAN), cand(2, scoreNumber)}, 1, false},
+		{"unique iban and amount", []models.MatchCandidate{cand(1, scoreAmount+scoreIBAN), cand(2, scoreAmount)}, 1, true},
+		{"ambiguous iban and amount", []models.MatchCandidate{cand(1, scoreAmount+scoreIBAN), cand(2, scoreAmount+scoreIBAN)}, 1, false},
+		{"amount only", []models.MatchCandidate{cand(1, scoreAmount)}, 1, false},
+		{"iban only", []models.MatchCandidate{cand(1, scoreIBAN)}, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := confidentMatch(tt.cands)
+			if ok != tt.wantOK || got.InvoiceID != tt.wantID {
+				t.Errorf("got %d, %v; want %d, %v", got.InvoiceID, ok, tt.wantID, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLineDedupeKey(t *testing.T) {
+	booking := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	line := models.BankStatementLine{BookingDate: booking, Amount: utils.Cents(11900), BankReference: "BANKREF1", EndToEndID: "E2E-1"}
+	a := lineIdentity("AT61 1904 3002 3457 3201", &line)
+	if a != "AT611904300234573201|2025-03-03|119.00|BANKREF1" {
+		t.Errorf("identity %q", a)
+	}
+	line.BankReference = ""
+	if b := lineIdentity("AT611904300234573201", &line); b != "AT611904300234573201|2025-03-03|119.00|E2E-1" {
+		t.Errorf("identity without bank reference %q", b)
+	}
+	line.EndToEndID = ""
+	line.CounterpartyIBAN, line.RemittanceInfo = "DE89370400440532013000", "Rechnung"
+	if c := lineIdentity("AT611904300234573201", &line); c != "AT611904300234573201|2025-03-03|119.00|DE89370400440532013000/Rechnung" {
+		t.Errorf("identity without references %q", c)
+	}
+	if k1, k2 := lineDedupeKey(a, 1), lineDedupeKey(a, 2); k1 == k2 || len(k1) != 32 || k1 != lineDedupeKey(a, 1) {
+		t.Errorf("keys %q %q", k1, k2)
+	}
+}
+
+func TestSkontoHitRoundingMode(t *testing.T) {
+	due := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	// 2 % of 1.25 is 0.025: half-up settles with 1.22, half-even with 1.23
+	inv := openInvoice{OpenAmount: 125, SkontoRate: 0.02, SkontoDueDate: &due}
+	if !inv.skontoHit(122, due) || inv.skontoHit(123, due) {
+		t.Error("default rounding should be half-up")
+	}
+	inv.RoundingMode = utils.RoundHalfEven
+	if !inv.skontoHit(123, due) || inv.skontoHit(122, due) {
+		t.Error("half-even invoice should settle with 1.23")
+	}
+}
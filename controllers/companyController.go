@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"fakturierung-backend/banking"
+	"fakturierung-backend/database"
+	"fakturierung-backend/middlewares"
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ===== DTOs =====
+
+// Pointer-based partial update; requires optimistic-lock version
+type CompanyUpdateDTO struct {
+	Version     uint    `json:"version" validate:"required,gt=0"`
+	CompanyName *string `json:"company_name" validate:"omitempty,min=1"`
+	Address     *string `json:"address" validate:"omitempty,min=1"`
+	City        *string `json:"city" validate:"omitempty,min=1"`
+	Country     *string `json:"country" validate:"omitempty,min=1"`
+	Zip         *string `json:"zip" validate:"omitempty,min=1"`
+	Homepage    *string `json:"homepage" validate:"omitempty"`
+	UID         *string `json:"uid" validate:"omitempty"`
+	Email       *string `json:"email" validate:"omitempty,email"`
+	Phone       *string `json:"phone" validate:"omitempty"`
+	BankName    *string `json:"bank_name" validate:"omitempty"`
+	IBAN        *string `json:"iban" validate:"omitempty,min=15,max=34"`
+	BIC         *string `json:"bic" validate:"omitempty,min=8,max=11"`
+	// SEPA creditor identifier (direct debits)
+	CreditorID   *string `json:"creditor_id" validate:"omitempty,max=35"`
+	PaymentTerms *string `json:"payment_terms" validate:"omitempty"`
+	// default payment term (days) for new invoices
+	PaymentTermDays *int `json:"payment_term_days" validate:"omitempty,gte=0,lte=365"`
+	// default early-payment discount (fraction) within skonto_days, e.g. 0.02 / 14
+	SkontoRate *float64 `json:"skonto_rate" validate:"omitempty,gte=0,lt=1" normalize:"-"`
+	SkontoDays *int     `json:"skonto_days" validate:"omitempty,gte=0,lte=365"`
+	// rounding of new documents: tax per line or per rate on the document sums
+	TaxRounding  *string `json:"tax_rounding" validate:"omitempty,oneof=line document"`
+	RoundingMode *string `json:"rounding_mode" validate:"omitempty,oneof=half_up half_even"`
+	// small business (Kleinunternehmer): new invoices without VAT
+	SmallBusiness *bool `json:"small_business"`
+	// base currency (ISO 4217); fixed once documents have been published
+	Currency *string `json:"currency" validate:"omitempty,iso4217"`
+	// IANA time zone, e.g. Europe/Vienna; decides the year of document numbers
+	TimeZone *string `json:"time_zone" validate:"omitempty,timezone"`
+}
+
+// ===== Helpers =====
+
+// tenantSchema returns the request's tenant schema (set by the auth middleware).
+func tenantSchema(c *fiber.Ctx) string {
+	schema, _ := c.Locals("schema").(string)
+	return schema
+}
+
+// loadCompany returns the company (public schema) owning the given tenant schema.
+func loadCompany(db *gorm.DB, schema string) (models.Company, error) {
+	var company models.Company
+	if strings.TrimSpace(schema) == "" {
+		return company, fiber.NewError(fiber.StatusUnauthorized, "auth context missing")
+	}
+	if err := db.Preload("ContactPerson").First(&company, "schema_name = ?", schema).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return company, fiber.NewError(fiber.StatusNotFound, "company not found")
+		}
+		return company, err
+	}
+	return company, nil
+}
+
+// defaultTimeZone applies when the company has no (valid) time zone configured.
+const defaultTimeZone = "Europe/Vienna"
+
+// companyLocation returns the tenant's time zone.
+func companyLocation(tx *gorm.DB, schema string) *time.Location {
+	name := defaultTimeZone
+	if company, err := loadCompany(tx, schema); err == nil && company.TimeZone != "" {
+		name = company.TimeZone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc, _ = time.LoadLocation(defaultTimeZone)
+	}
+	return loc
+}
+
+// ===== Handlers =====
+
+// GET /api/company
+func GetCompany(c *fiber.Ctx) error {
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+	company, err := loadCompany(db, tenantSchema(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"company": company, "message": "success"})
+}
+
+// PUT /api/company
+func UpdateCompany(c *fiber.Ctx) error {
+	var in CompanyUpdateDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+	utils.NormalizePtrDTO(&in)
+	if in.IBAN != nil {
+		iban := strings.ToUpper(strings.ReplaceAll(*in.IBAN, " ", ""))
+		in.IBAN = &iban
+	}
+	if in.BIC != nil {
+		bic := strings.ToUpper(*in.BIC)
+		in.BIC = &bic
+	}
+	if in.CreditorID != nil {
+		id := banking.NormalizeIBAN(*in.CreditorID)
+		if id != "" && !banking.ValidCreditorID(id) {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid creditor_id")
+		}
+		in.CreditorID = &id
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+	existing, err := loadCompany(db, tenantSchema(c))
+	if err != nil {
+		return err
+	}
+	termDays := existing.PaymentTermDays
+	if in.PaymentTermDays != nil {
+		termDays = *in.PaymentTermDays
+	}
+	if termDays <= 0 {
+		termDays = defaultPaymentTermDays // as applied to new invoices
+	}
+	if in.Currency != nil && *in.Currency != baseCurrency(existing) {
+		var published int64
+		if err := db.Model(&models.Invoice{}).Where("published = ?", true).Count(&published).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "db error")
+		}
+		if published > 0 {
+			return fiber.NewError(fiber.StatusConflict, "base currency cannot change after documents were published")
+		}
+	}
+	skonto := withSkonto(skontoTerms{Rate: existing.SkontoRate, Days: existing.SkontoDays}, in.SkontoRate, in.SkontoDays)
+	if err := checkSkonto(skonto, termDays); err != nil {
+		return err
+	}
+
+	updates := utils.UpdatesFromPtrDTO(&in, nil)
+	if len(updates) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "no fields to update")
+	}
+	updates["version"] = gorm.Expr("version + 1")
+
+	res := db.Model(&models.Company{}).
+		Where("id = ? AND version = ?", existing.Id, in.Version).
+		Updates(updates)
+	if res.Error != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "could not update company")
+	}
+	if res.RowsAffected == 0 {
+		return fiber.NewError(fiber.StatusConflict, "stale update, please reload")
+	}
+
+	out, err := loadCompany(db, tenantSchema(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(out)
+}
@@ -0,0 +1,347 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"fakturierung-backend/database"
+	"fakturierung-backend/middlewares"
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ===== DTOs =====
+
+type CreditNoteItemDTO struct {
+	ItemID uint    `json:"item_id" validate:"required,gt=0"` // line of the original invoice
+	Amount float64 `json:"amount" validate:"required,gt=0"`  // quantity to credit
+}
+
+// Empty items => credit everything that is not credited yet (full Storno).
+type CreditNoteCreateDTO struct {
+	Items []CreditNoteItemDTO `json:"items" validate:"omitempty,dive"`
+}
+
+// ===== Helpers =====
+
+// creditedLine is what earlier credit notes already credited of an invoice line:
+// the quantity (positive) and the line sums (negative).
+type creditedLine struct {
+	Amount     float64
+	Discount   utils.Money
+	NetPrice   utils.Money
+	TaxAmount  utils.Money
+	GrossPrice utils.Money
+}
+
+// creditedLines returns what was already credited per original invoice line.
+func creditedLines(tx *gorm.DB, invoiceID uint) (map[uint]creditedLine, error) {
+	type row struct {
+		CreditedItemID uint
+		Amount         float64
+		Discount       utils.Money
+		NetPrice       utils.Money
+		TaxAmount      utils.Money
+		GrossPrice     utils.Money
+	}
+	var rows []row
+	if err := tx.Model(&models.InvoiceItem{}).
+		Select("invoice_items.credited_item_id AS credited_item_id, SUM(invoice_items.amount) AS amount, "+
+			"SUM(invoice_items.discount) AS discount, SUM(invoice_items.net_price) AS net_price, "+
+			"SUM(invoice_items.tax_amount) AS tax_amount, SUM(invoice_items.gross_price) AS gross_price").
+		Joins("JOIN invoices ON invoices.id = invoice_items.invoice_id").
+		Where("invoices.corrects_id = ? AND invoice_items.credited_item_id IS NOT NULL", invoiceID).
+		Group("invoice_items.credited_item_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[uint]creditedLine, len(rows))
+	for _, r := range rows {
+		out[r.CreditedItemID] = creditedLine{
+			Amount:     r.Amount,
+			Discount:   r.Discount,
+			NetPrice:   r.NetPrice,
+			TaxAmount:  r.TaxAmount,
+			GrossPrice: r.GrossPrice,
+		}
+	}
+	return out, nil
+}
+
+// creditLine builds the negated credit note line for qty units of orig, rounded
+// like the original invoice. The line discount is credited as an absolute amount in
+// proportion to the quantity (no rate: it would not match the rounded share). The
+// line that completes the credit takes whatever prior credits left open, so that
+// a Storno nets the original to zero.
+func creditLine(orig models.InvoiceItem, qty float64, prior creditedLine, p roundingPolicy) models.InvoiceItem {
+	origID := orig.ID
+	line := models.InvoiceItem{
+		ArticleID:      orig.ArticleID,
+		Description:    orig.Description,
+		Amount:         qty,
+		Unit:           orig.Unit,
+		UnitPrice:      -orig.UnitPrice,
+		TaxRate:        orig.TaxRate,
+		CreditedItemID: &origID,
+	}
+	if utils.Round3(prior.Amount+qty) >= orig.Amount {
+		line.Discount = -(orig.Discount + prior.Discount)
+		line.NetPrice = -(orig.NetPrice + prior.NetPrice)
+		line.TaxAmount = -(orig.TaxAmount + prior.TaxAmount)
+		line.GrossPrice = -(orig.GrossPrice + prior.GrossPrice)
+		return line
+	}
+	line.Discount = -orig.Discount.MulRatio(int64(math.Round(qty*1000)), int64(math.Round(orig.Amount*1000)), p.Mode)
+	return p.line(line)
+}
+
+// creditDiscount returns the (negative) share of the invoice's document discount
+// for the credit note lines: in proportion to their net, or everything not credited
+// yet when the note completes the Storno.
+func creditDiscount(tx *gorm.DB, inv *models.Invoice, lines []models.InvoiceItem, fully bool, p roundingPolicy) (utils.Money, error) {
+	if inv.Discount == 0 {
+		return 0, nil
+	}
+	if fully {
+		var credited utils.Money
+		if err := tx.Model(&models.Invoice{}).Where("corrects_id = ?", inv.ID).
+			Select("COALESCE(SUM(discount), 0)").Scan(&credited).Error; err != nil {
+			return 0, err
+		}
+		return -(inv.Discount + credited), nil
+	}
+	var net, origNet utils.Money
+	for _, l := range lines {
+		net += l.NetPrice
+	}
+	for _, it := range inv.Items {
+		origNet += it.NetPrice
+	}
+	if origNet == 0 {
+		return 0, nil
+	}
+	return inv.Discount.MulRatio(int64(net), int64(origNet), p.Mode), nil
+}
+
+// ===== Handlers =====
+
+// POST /api/invoices/:id/cancel
+// Issues a credit note (full or partial) for a published invoice. The credit note is
+// published immediately with its own number; the original is marked cancelled once
+// every line is fully credited. Both documents get a new version snapshot.
+func CancelInvoice(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid invoice id")
+	}
+
+	var in CreditNoteCreateDTO
+	if len(c.Body()) > 0 {
+		if err := middlewares.BindAndValidate(c, &in); err != nil {
+			return err
+		}
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var creditNote, original models.Invoice
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var inv models.Invoice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Items").Preload("Deductions").First(&inv, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fiber.NewError(fiber.StatusNotFound, "invoice not found")
+			}
+			return err
+		}
+		if inv.CorrectsID != nil || inv.DocumentType == models.DocumentCreditNote {
+			return fiber.NewError(fiber.StatusBadRequest, "a credit note cannot be cancelled")
+		}
+		if !inv.IssuedInvoice() {
+			return fiber.NewError(fiber.StatusBadRequest, "only published invoices can be cancelled")
+		}
+		if inv.Cancelled {
+			return fiber.NewError(fiber.StatusConflict, "invoice is already cancelled")
+		}
+		switch inv.InvoiceType {
+		case invoiceTypeDownPayment:
+			taken, err := deductingInvoices(tx, []uint{inv.ID}, 0)
+			if err != nil {
+				return err
+			}
+			if number, ok := taken[inv.ID]; ok {
+				return fiber.NewError(fiber.StatusConflict, "down-payment invoice is deducted on final invoice "+number+"; cancel that first")
+			}
+		case invoiceTypeFinal:
+			// the deductions cannot be split over partial credit notes
+			if len(in.Items) > 0 {
+				return fiber.NewError(fiber.StatusBadRequest, "final invoices can only be cancelled in full")
+			}
+		}
+
+		credited, err := creditedLines(tx, inv.ID)
+		if err != nil {
+			return err
+		}
+		byID := make(map[uint]models.InvoiceItem, len(inv.Items))
+		for _, it := range inv.Items {
+			byID[it.ID] = it
+		}
+
+		// Requested quantities per original line (default: everything still open)
+		requested := make(map[uint]float64)
+		if len(in.Items) == 0 {
+			for _, it := range inv.Items {
+				if open := utils.Round3(it.Amount - credited[it.ID].Amount); open > 0 {
+					requested[it.ID] = open
+				}
+			}
+		} else {
+			for _, r := range in.Items {
+				orig, ok := byID[r.ItemID]
+				if !ok {
+					return fiber.NewError(fiber.StatusBadRequest, "item_id does not belong to this invoice")
+				}
+				requested[r.ItemID] = utils.Round3(requested[r.ItemID] + utils.Round3(r.Amount))
+				if utils.Round3(credited[r.ItemID].Amount+requested[r.ItemID]) > orig.Amount {
+					return fiber.NewError(fiber.StatusBadRequest, "amount exceeds the quantity left to credit")
+				}
+			}
+		}
+		if len(requested) == 0 {
+			return fiber.NewError(fiber.StatusConflict, "nothing left to credit")
+		}
+
+		rounding := invoiceRounding(&inv)
+		var lines []models.InvoiceItem
+		for _, it := range inv.Items { // keep original line order
+			qty, ok := requested[it.ID]
+			if !ok {
+				continue
+			}
+			prior := credited[it.ID]
+			lines = append(lines, creditLine(it, qty, prior, rounding))
+			prior.Amount += qty
+			credited[it.ID] = prior
+		}
+
+		fully := true
+		for _, it := range inv.Items {
+			if utils.Round3(credited[it.ID].Amount) < it.Amount {
+				fully = false
+				break
+			}
+		}
+
+		discount, err := creditDiscount(tx, &inv, lines, fully, rounding)
+		if err != nil {
+			return err
+		}
+		breakdown, subtotal, taxTotal, discount, err := documentTotals(lines, documentDiscount{Amount: discount}, rounding)
+		if err != nil {
+			return err
+		}
+		var deductions []models.InvoiceDeduction
+		if len(inv.Deductions) > 0 {
+			deductions = negatedDeductions(inv.Deductions)
+			breakdown, subtotal, taxTotal = deductBreakdown(breakdown, deductions)
+		}
+
+		now := time.Now().UTC()
+		number, err := allocateNumber(tx, tenantSchema(c), sequenceCreditNote, now)
+		if err != nil {
+			return err
+		}
+		origID := inv.ID
+		creditNote = models.Invoice{
+			DocumentType:  models.DocumentCreditNote,
+			InvoiceNumber: number,
+			CId:           inv.CId,
+			Currency:      inv.Currency,
+			Items:         lines,
+			Subtotal:      subtotal,
+			TaxTotal:      taxTotal,
+			Total:         subtotal + taxTotal,
+			TaxBreakdown:  breakdown,
+			DiscountRate:  inv.DiscountRate,
+			Discount:      discount,
+			TaxTreatment:  inv.TaxTreatment,
+			TaxNote:       inv.TaxNote,
+			InvoiceType:   inv.InvoiceType,
+			Deductions:    deductions,
+			TaxRounding:   rounding.TaxRounding,
+			RoundingMode:  string(rounding.Mode),
+			Version:       1,
+			CorrectsID:    &origID,
+		}
+		// Converted with the corrected invoice's rate, so both cancel out in the base currency
+		if inv.ExchangeRate != nil {
+			creditNote.BaseCurrency, creditNote.ExchangeRate, creditNote.ExchangeRateDate = inv.BaseCurrency, inv.ExchangeRate, inv.ExchangeRateDate
+			setBaseTotals(&creditNote)
+		} else if err := lockExchangeRate(tx, tenantSchema(c), &creditNote, now); err != nil {
+			return err
+		}
+		// Insert unpublished first: the read-only trigger rejects item inserts on published documents
+		if err := tx.Create(&creditNote).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Invoice{}).Where("id = ?", creditNote.ID).
+			Updates(map[string]any{"published": true, "published_at": &now}).Error; err != nil {
+			return err
+		}
+		creditNote.Published = true
+		creditNote.PublishedAt = &now
+		if err := snapshotInvoice(tx, &creditNote, requestActor(c), models.VersionCreate); err != nil {
+			return err
+		}
+		if _, err := storeInvoicePDF(tx, tenantSchema(c), creditNote.ID); err != nil {
+			return err
+		}
+
+		if fully {
+			if err := tx.Model(&models.Invoice{}).Where("id = ?", inv.ID).
+				Updates(map[string]any{"cancelled": true, "cancelled_at": &now}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Preload(clause.Associations).First(&original, "id = ?", inv.ID).Error; err != nil {
+			return err
+		}
+		return snapshotInvoice(tx, &original, requestActor(c), models.VersionCredit)
+	})
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"credit_note": creditNote,
+		"invoice":     original,
+		"message":     "success",
+	})
+}
+
+// GET /api/invoices/:id/credit-notes
+func GetCreditNotes(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid invoice id")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var notes []models.Invoice
+	if err := db.Preload("Items").Where("corrects_id = ?", id).Order("id ASC").Find(&notes).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"credit_notes": notes})
+}
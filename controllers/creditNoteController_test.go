@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"testing"
+
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+)
+
+// discounted returns an invoice line computed like the invoice handlers do.
+func discounted(p roundingPolicy, unitPrice utils.Money, qty, rate, discountRate float64, discount utils.Money) models.InvoiceItem {
+	it := item(unitPrice, qty, rate)
+	it.ID = 1
+	it.DiscountRate, it.Discount = discountRate, discount
+	return p.line(it)
+}
+
+func TestCreditLine(t *testing.T) {
+	p := roundingPolicy{TaxRounding: models.TaxRoundingLine, Mode: utils.RoundHalfUp}
+	// 3 x 10.00 at 20% less 10%: 30.00 - 3.00 = 27.00 net, 5.40 tax
+	rated := discounted(p, 1000, 3, 0.2, 0.1, 0)
+	// 3 x 10.00 at 20% less a fixed 1.00: 29.00 net, 5.80 tax
+	fixed := discounted(p, 1000, 3, 0.2, 0, 100)
+
+	tests := []struct {
+		name                      string
+		orig                      models.InvoiceItem
+		qty                       float64
+		prior                     creditedLine
+		discount, net, tax, gross utils.Money
+	}{
+		{"full line mirrors the original", rated, 3, creditedLine{}, -300, -2700, -540, -3240},
+		{"partial rate discount", rated, 1, creditedLine{}, -100, -900, -180, -1080},
+		{"partial fixed discount", fixed, 1, creditedLine{}, -33, -967, -193, -1160},
+		{"rest after a partial credit", fixed, 2, creditedLine{Amount: 1, Discount: -33, NetPrice: -967, TaxAmount: -193, GrossPrice: -1160},
+			-67, -1933, -387, -2320},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := creditLine(tt.orig, tt.qty, tt.prior, p)
+			if got.Discount != tt.discount || got.NetPrice != tt.net || got.TaxAmount != tt.tax || got.GrossPrice != tt.gross {
+				t.Errorf("discount/net/tax/gross = %s/%s/%s/%s, want %s/%s/%s/%s",
+					got.Discount, got.NetPrice, got.TaxAmount, got.GrossPrice, tt.discount, tt.net, tt.tax, tt.gross)
+			}
+			if got.DiscountRate != 0 {
+				t.Errorf("DiscountRate = %v, want only the absolute discount", got.DiscountRate)
+			}
+			if got.Amount != tt.qty || got.UnitPrice != -tt.orig.UnitPrice || got.CreditedItemID == nil || *got.CreditedItemID != tt.orig.ID {
+				t.Errorf("line = %+v", got)
+			}
+		})
+	}
+}
+
+// A Storno after partial credit notes credits exactly what is still open, even
+// where the rounded partial shares do not add up to the original line.
+func TestCreditLineStornoNetsPartialCredits(t *testing.T) {
+	halfUp := roundingPolicy{TaxRounding: models.TaxRoundingLine, Mode: utils.RoundHalfUp}
+	halfEven := roundingPolicy{TaxRounding: models.TaxRoundingLine, Mode: utils.RoundHalfEven}
+
+	tests := []struct {
+		name     string
+		policy   roundingPolicy
+		orig     models.InvoiceItem
+		partials []float64 // quantities credited before the Storno
+	}{
+		{"thirds of a rate discount", halfUp, discounted(halfUp, 333, 3, 0.2, 0.1, 0), []float64{1, 1}},
+		{"thirds of a fixed discount", halfUp, discounted(halfUp, 333, 3, 0.2, 0, 100), []float64{1}},
+		{"half even fractional quantities", halfEven, discounted(halfEven, 1255, 2.5, 0.1, 0.03, 0), []float64{0.5, 1.25}},
+		{"no partial credits", halfUp, discounted(halfUp, 1999, 7, 0.13, 0.05, 0), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prior creditedLine
+			credit := func(qty float64) {
+				l := creditLine(tt.orig, qty, prior, tt.policy)
+				prior.Amount += qty
+				prior.Discount += l.Discount
+				prior.NetPrice += l.NetPrice
+				prior.TaxAmount += l.TaxAmount
+				prior.GrossPrice += l.GrossPrice
+			}
+			for _, qty := range tt.partials {
+				credit(qty)
+			}
+			credit(utils.Round3(tt.orig.Amount - prior.Amount))
+
+			if prior.Discount != -tt.orig.Discount || prior.NetPrice != -tt.orig.NetPrice ||
+				prior.TaxAmount != -tt.orig.TaxAmount || prior.GrossPrice != -tt.orig.GrossPrice {
+				t.Errorf("credited %+v, want the negated original %s/%s/%s/%s",
+					prior, tt.orig.Discount, tt.orig.NetPrice, tt.orig.TaxAmount, tt.orig.GrossPrice)
+			}
+		})
+	}
+}
+
+func TestCreditDiscountPartial(t *testing.T) {
+	p := roundingPolicy{TaxRounding: models.TaxRoundingLine, Mode: utils.RoundHalfUp}
+	inv := models.Invoice{
+		Discount: 1000,
+		Items:    totalsLines(p, item(10000, 3, 0.2), item(5000, 1, 0.1)),
+	}
+	tests := []struct {
+		name  string
+		lines []models.InvoiceItem
+		want  utils.Money
+	}{
+		{"one of three units", []models.InvoiceItem{creditLine(inv.Items[0], 1, creditedLine{}, p)}, -286},
+		{"second line", []models.InvoiceItem{creditLine(inv.Items[1], 1, creditedLine{}, p)}, -143},
+		{"no lines", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := creditDiscount(nil, &inv, tt.lines, false, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("creditDiscount = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
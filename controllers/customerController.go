@@ -2,9 +2,12 @@ package controllers
 
 import (
 	"errors"
+	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
+	"fakturierung-backend/banking"
 	"fakturierung-backend/database"
 	"fakturierung-backend/middlewares"
 	"fakturierung-backend/models"
@@ -31,6 +34,21 @@ type CustomerCreateDTO struct {
 	Homepage     string `json:"homepage" validate:"omitempty"`
 	UID          string `json:"uid" validate:"omitempty"`
 	Email        string `json:"email" validate:"required,email"`
+	// default tax treatment of the customer's documents ("" = by the company)
+	TaxTreatment string `json:"tax_treatment" validate:"omitempty,oneof=domestic reverse_charge intra_eu_supply export exempt"`
+	// e-invoice buyer reference (Leitweg-ID)
+	BuyerReference string `json:"buyer_reference" validate:"omitempty,max=100"`
+	// our supplier number at the customer (ebInterface)
+	SupplierNumber string `json:"supplier_number" validate:"omitempty,max=35"`
+	// currency of the customer's documents ("" = the company's base currency)
+	Currency string `json:"currency" validate:"omitempty,iso4217"`
+	// bank account, used to match incoming transfers
+	IBAN string `json:"iban" validate:"omitempty,max=42"`
+	BIC  string `json:"bic" validate:"omitempty,min=8,max=11"`
+	// SEPA direct debit mandate
+	MandateReference string `json:"mandate_reference" validate:"omitempty,max=35"`
+	MandateSignedAt  string `json:"mandate_signed_at" validate:"omitempty,datetime=2006-01-02"`
+	MandateSequence  string `json:"mandate_sequence" validate:"omitempty,oneof=FRST RCUR OOFF FNAL"`
 }
 
 // Pointer-based partial update; requires optimistic-lock version
@@ -50,6 +68,47 @@ type CustomerUpdateDTO struct {
 	Homepage     *string `json:"homepage" validate:"omitempty"`
 	UID          *string `json:"uid" validate:"omitempty"`
 	Email        *string `json:"email" validate:"omitempty,email"`
+	// default tax treatment of the customer's documents ("" = by the company)
+	TaxTreatment *string `json:"tax_treatment" validate:"omitempty,oneof=domestic reverse_charge intra_eu_supply export exempt"`
+	// e-invoice buyer reference (Leitweg-ID)
+	BuyerReference *string `json:"buyer_reference" validate:"omitempty,max=100"`
+	// our supplier number at the customer (ebInterface)
+	SupplierNumber *string `json:"supplier_number" validate:"omitempty,max=35"`
+	// currency of the customer's documents ("" = the company's base currency)
+	Currency *string `json:"currency" validate:"omitempty,iso4217"`
+	// bank account, used to match incoming transfers
+	IBAN *string `json:"iban" validate:"omitempty,max=42"`
+	BIC  *string `json:"bic" validate:"omitempty,max=11"`
+	// SEPA direct debit mandate ("" clears the signature date)
+	MandateReference *string `json:"mandate_reference" validate:"omitempty,max=35"`
+	MandateSignedAt  *string `json:"mandate_signed_at" validate:"omitempty"`
+	MandateSequence  *string `json:"mandate_sequence" validate:"omitempty,oneof=FRST RCUR OOFF FNAL"`
+}
+
+// customerIBAN normalizes an optional IBAN and rejects invalid checksums.
+func customerIBAN(s string) (string, error) {
+	iban := banking.NormalizeIBAN(s)
+	if iban != "" && !banking.ValidIBAN(iban) {
+		return "", fiber.NewError(fiber.StatusBadRequest, "invalid iban")
+	}
+	return iban, nil
+}
+
+// customerBIC upper-cases an optional BIC and rejects malformed ones.
+func customerBIC(s string) (string, error) {
+	bic := strings.ToUpper(strings.TrimSpace(s))
+	if bic != "" && !banking.ValidBIC(bic) {
+		return "", fiber.NewError(fiber.StatusBadRequest, "invalid bic")
+	}
+	return bic, nil
+}
+
+// checkCustomerTreatment rejects an EU B2B default treatment without a valid VAT id.
+func checkCustomerTreatment(treatment, uid string) error {
+	if needsCustomerVATID(treatment) && !reVATID.MatchString(normalizeVATID(uid)) {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("tax treatment %s requires a valid uid", treatment))
+	}
+	return nil
 }
 
 // ===== Handlers =====
@@ -61,6 +120,26 @@ func CreateCustomer(c *fiber.Ctx) error {
 		return err
 	}
 	utils.NormalizeDTO(&in)
+	iban, err := customerIBAN(in.IBAN)
+	if err != nil {
+		return err
+	}
+	bic, err := customerBIC(in.BIC)
+	if err != nil {
+		return err
+	}
+	var signedAt *time.Time
+	if in.MandateSignedAt != "" {
+		d, _ := time.Parse("2006-01-02", in.MandateSignedAt)
+		signedAt = &d
+	}
+	if err := checkCustomerTreatment(in.TaxTreatment, in.UID); err != nil {
+		return err
+	}
+	sequence := in.MandateSequence
+	if sequence == "" && in.MandateReference != "" {
+		sequence = banking.SeqFirst
+	}
 
 	db, err := database.GetTenantDB(c)
 	if err != nil {
@@ -68,20 +147,30 @@ func CreateCustomer(c *fiber.Ctx) error {
 	}
 
 	customer := models.Customer{
-		FirstName:    in.FirstName,
-		LastName:     in.LastName,
-		Salutation:   in.Salutation,
-		Title:        in.Title,
-		PhoneNumber:  in.PhoneNumber,
-		MobileNumber: in.MobileNumber,
-		CompanyName:  in.CompanyName,
-		Address:      in.Address,
-		City:         in.City,
-		Country:      in.Country,
-		Zip:          in.Zip,
-		Homepage:     in.Homepage,
-		UID:          in.UID,
-		Email:        in.Email,
+		FirstName:      in.FirstName,
+		LastName:       in.LastName,
+		Salutation:     in.Salutation,
+		Title:          in.Title,
+		PhoneNumber:    in.PhoneNumber,
+		MobileNumber:   in.MobileNumber,
+		CompanyName:    in.CompanyName,
+		Address:        in.Address,
+		City:           in.City,
+		Country:        in.Country,
+		Zip:            in.Zip,
+		Homepage:       in.Homepage,
+		UID:            in.UID,
+		Email:          in.Email,
+		TaxTreatment:   in.TaxTreatment,
+		BuyerReference: in.BuyerReference,
+		SupplierNumber: in.SupplierNumber,
+		Currency:       in.Currency,
+		IBAN:           iban,
+		BIC:            bic,
+
+		MandateReference: in.MandateReference,
+		MandateSignedAt:  signedAt,
+		MandateSequence:  sequence,
 	}
 	if err := db.Create(&customer).Error; err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "could not create customer")
@@ -145,6 +234,41 @@ func UpdateCustomer(c *fiber.Ctx) error {
 	if len(updates) == 0 {
 		return fiber.NewError(fiber.StatusBadRequest, "no fields to update")
 	}
+	if in.TaxTreatment != nil || in.UID != nil {
+		treatment, uid := existing.TaxTreatment, existing.UID
+		if in.TaxTreatment != nil {
+			treatment = *in.TaxTreatment
+		}
+		if in.UID != nil {
+			uid = *in.UID
+		}
+		if err := checkCustomerTreatment(treatment, uid); err != nil {
+			return err
+		}
+	}
+	if in.IBAN != nil {
+		iban, err := customerIBAN(*in.IBAN)
+		if err != nil {
+			return err
+		}
+		updates["iban"] = iban
+	}
+	if in.BIC != nil {
+		bic, err := customerBIC(*in.BIC)
+		if err != nil {
+			return err
+		}
+		updates["bic"] = bic
+	}
+	if in.MandateSignedAt != nil {
+		if *in.MandateSignedAt == "" {
+			updates["mandate_signed_at"] = nil
+		} else if d, err := time.Parse("2006-01-02", *in.MandateSignedAt); err == nil {
+			updates["mandate_signed_at"] = d
+		} else {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid mandate_signed_at")
+		}
+	}
 	updates["version"] = gorm.Expr("version + 1")
 
 	res := db.Model(&models.Customer{}).
@@ -0,0 +1,388 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"fakturierung-backend/banking"
+	"fakturierung-backend/database"
+	"fakturierung-backend/middlewares"
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ===== DTOs =====
+
+type DirectDebitCreateDTO struct {
+	InvoiceIDs     []uint `json:"invoice_ids" validate:"required,min=1,dive,gt=0"`
+	CollectionDate string `json:"collection_date" validate:"required,datetime=2006-01-02"`
+}
+
+// ===== Helpers =====
+
+const (
+	batchStatusPending   = "pending"
+	batchStatusConfirmed = "confirmed"
+	batchStatusCancelled = "cancelled"
+
+	paymentMethodDirectDebit = "sepa-direct-debit"
+)
+
+// errDirectDebitInvalid aborts batch creation; the reasons are reported separately.
+var errDirectDebitInvalid = errors.New("direct debit validation failed")
+
+// openAmounts returns the open balance of the given invoices.
+func openAmounts(tx *gorm.DB, ids []uint) (map[uint]utils.Money, error) {
+	type row struct {
+		ID         uint
+		OpenAmount utils.Money
+	}
+	var rows []row
+	if err := tx.Raw(`SELECT invoices.id, `+invoiceOpenSQL+` AS open_amount FROM invoices WHERE invoices.id IN ?`, ids).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[uint]utils.Money, len(rows))
+	for _, r := range rows {
+		out[r.ID] = r.OpenAmount
+	}
+	return out, nil
+}
+
+// lockPendingBatch loads a batch with its items that is still awaiting confirmation.
+func lockPendingBatch(tx *gorm.DB, id int) (models.DirectDebitBatch, error) {
+	var b models.DirectDebitBatch
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Omit("content").Preload("Items").First(&b, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return b, fiber.NewError(fiber.StatusNotFound, "direct debit batch not found")
+		}
+		return b, err
+	}
+	if b.Status != batchStatusPending {
+		return b, fiber.NewError(fiber.StatusConflict, "direct debit batch is already "+b.Status)
+	}
+	return b, nil
+}
+
+func batchInvoiceIDs(b models.DirectDebitBatch) []uint {
+	ids := make([]uint, 0, len(b.Items))
+	for _, it := range b.Items {
+		ids = append(ids, it.InvoiceID)
+	}
+	return ids
+}
+
+// ===== Handlers =====
+
+// POST /api/direct-debits  Body: { "invoice_ids": [..], "collection_date": "YYYY-MM-DD" }
+// Collects the open balance of published invoices from customers with a SEPA mandate.
+// Generates a pain.008.001.02 file and marks the invoices collection pending.
+func CreateDirectDebitBatch(c *fiber.Ctx) error {
+	var in DirectDebitCreateDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+	collection, err := parseDate(in.CollectionDate)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid collection_date")
+	}
+	now := time.Now().UTC()
+	if !collection.After(now) {
+		return fiber.NewError(fiber.StatusBadRequest, "collection_date must be in the future")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var batch models.DirectDebitBatch
+	var missing []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		company, err := loadCompany(tx, tenantSchema(c))
+		if err != nil {
+			return err
+		}
+
+		var invoices []models.Invoice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Customer").Where("id IN ?", in.InvoiceIDs).Order("id ASC").Find(&invoices).Error; err != nil {
+			return err
+		}
+		found := map[uint]bool{}
+		for _, inv := range invoices {
+			found[inv.ID] = true
+		}
+		for _, id := range in.InvoiceIDs {
+			if !found[id] {
+				missing = append(missing, fmt.Sprintf("invoice %d: not found", id))
+			}
+		}
+		open, err := openAmounts(tx, in.InvoiceIDs)
+		if err != nil {
+			return err
+		}
+
+		batch = models.DirectDebitBatch{CollectionDate: collection, Status: batchStatusPending}
+		dd := banking.DirectDebitBatch{
+			CreatedAt:      now,
+			CollectionDate: collection,
+			CreditorName:   company.CompanyName,
+			CreditorIBAN:   banking.NormalizeIBAN(company.IBAN),
+			CreditorBIC:    company.BIC,
+			CreditorID:     company.CreditorID,
+		}
+		for _, inv := range invoices {
+			ref := inv.InvoiceNumber
+			switch {
+			case !inv.IssuedInvoice():
+				missing = append(missing, fmt.Sprintf("invoice %d: not a published invoice", inv.ID))
+				continue
+			case inv.Cancelled:
+				missing = append(missing, ref+": cancelled")
+				continue
+			case inv.CollectionPending:
+				missing = append(missing, ref+": collection already pending")
+				continue
+			case open[inv.ID] <= 0:
+				missing = append(missing, ref+": nothing open")
+				continue
+			case inv.Currency != defaultCurrency:
+				missing = append(missing, ref+": not billed in EUR (SEPA)")
+				continue
+			}
+			cu := inv.Customer
+			if cu.MandateReference == "" || cu.MandateSignedAt == nil {
+				missing = append(missing, ref+": customer has no SEPA mandate")
+				continue
+			}
+			seq := cu.MandateSequence
+			if seq == "" {
+				seq = banking.SeqFirst
+			}
+			d := banking.DirectDebit{
+				EndToEndID:   ref,
+				Amount:       open[inv.ID],
+				MandateID:    cu.MandateReference,
+				MandateDate:  *cu.MandateSignedAt,
+				SequenceType: seq,
+				DebtorName:   cu.CompanyName,
+				DebtorIBAN:   cu.IBAN,
+				DebtorBIC:    cu.BIC,
+				Remittance:   "Rechnung " + ref,
+			}
+			dd.Debits = append(dd.Debits, d)
+			batch.Items = append(batch.Items, models.DirectDebitItem{
+				InvoiceID:    inv.ID,
+				CustomerID:   cu.Id,
+				Amount:       open[inv.ID],
+				EndToEndID:   banking.SEPAText(ref, 35),
+				MandateID:    d.MandateID,
+				SequenceType: seq,
+			})
+			batch.Total += open[inv.ID]
+		}
+		missing = append(missing, dd.Validate()...)
+		if len(missing) > 0 {
+			return errDirectDebitInvalid
+		}
+
+		batch.Count = len(batch.Items)
+		batch.MessageID = fmt.Sprintf("DD-%s-%d", now.Format("20060102150405"), now.Nanosecond()/1e6)
+		dd.MessageID = batch.MessageID
+		content, err := banking.RenderPain008(dd)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		batch.Content = content
+		batch.SHA256 = hex.EncodeToString(sum[:])
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Invoice{}).Where("id IN ?", batchInvoiceIDs(batch)).
+			Update("collection_pending", true).Error
+	})
+	if errors.Is(err, errDirectDebitInvalid) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"message": "direct debit validation failed",
+			"missing": missing,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(batch)
+}
+
+// GET /api/direct-debits?status=pending|confirmed|cancelled
+func GetDirectDebitBatches(c *fiber.Ctx) error {
+	limit := parseIntDefault(c.Query("limit"), 50)
+	offset := parseIntDefault(c.Query("offset"), 0)
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	q := db.Omit("content").Order("id DESC")
+	if s := c.Query("status"); s != "" {
+		q = q.Where("status = ?", s)
+	}
+	var batches []models.DirectDebitBatch
+	if err := q.Limit(limit).Offset(offset).Find(&batches).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"direct_debits": batches, "message": "success"})
+}
+
+// GET /api/direct-debits/:id
+func GetDirectDebitBatch(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid direct debit id")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var b models.DirectDebitBatch
+	if err := db.Omit("content").Preload("Items").First(&b, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "direct debit batch not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"direct_debit": b, "message": "success"})
+}
+
+// GET /api/direct-debits/:id/xml — the stored pain.008 file
+func GetDirectDebitXML(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid direct debit id")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var b models.DirectDebitBatch
+	if err := db.First(&b, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "direct debit batch not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return sendDocument(c, "application/xml", b.MessageID+".xml", b.Content)
+}
+
+// POST /api/direct-debits/:id/confirm
+// The bank accepted the batch: books one payment per invoice on the collection date
+// and moves first-time mandates (FRST) to recurring (RCUR).
+func ConfirmDirectDebitBatch(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid direct debit id")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var b models.DirectDebitBatch
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if b, err = lockPendingBatch(tx, id); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Invoice{}).Where("id IN ?", batchInvoiceIDs(b)).
+			Update("collection_pending", false).Error; err != nil {
+			return err
+		}
+		var firstCustomers []uint
+		for i := range b.Items {
+			it := &b.Items[i]
+			payment := models.Payment{
+				InvoiceID: it.InvoiceID,
+				Kind:      paymentKindPayment,
+				Amount:    it.Amount,
+				Method:    paymentMethodDirectDebit,
+				Reference: it.EndToEndID,
+				Note:      b.MessageID,
+				PaidAt:    b.CollectionDate,
+			}
+			if err := changePayments(tx, it.InvoiceID, requestActor(c), func(inv *models.Invoice) error {
+				payment.Currency = inv.Currency
+				return tx.Create(&payment).Error
+			}); err != nil {
+				return err
+			}
+			it.PaymentID = &payment.ID
+			if err := tx.Model(it).Update("payment_id", payment.ID).Error; err != nil {
+				return err
+			}
+			if it.SequenceType == banking.SeqFirst {
+				firstCustomers = append(firstCustomers, it.CustomerID)
+			}
+		}
+		if len(firstCustomers) > 0 {
+			if err := tx.Model(&models.Customer{}).
+				Where("id IN ? AND mandate_sequence IN ?", firstCustomers, []string{"", banking.SeqFirst}).
+				Update("mandate_sequence", banking.SeqRecurring).Error; err != nil {
+				return err
+			}
+		}
+		now := time.Now().UTC()
+		b.Status, b.ConfirmedAt = batchStatusConfirmed, &now
+		return tx.Model(&b).Updates(map[string]any{"status": b.Status, "confirmed_at": b.ConfirmedAt}).Error
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(b)
+}
+
+// POST /api/direct-debits/:id/cancel
+// The batch was not submitted or rejected as a whole: releases its invoices.
+func CancelDirectDebitBatch(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid direct debit id")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var b models.DirectDebitBatch
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if b, err = lockPendingBatch(tx, id); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Invoice{}).Where("id IN ?", batchInvoiceIDs(b)).
+			Update("collection_pending", false).Error; err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		b.Status, b.CancelledAt = batchStatusCancelled, &now
+		return tx.Model(&b).Updates(map[string]any{"status": b.Status, "cancelled_at": b.CancelledAt}).Error
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(b)
+}
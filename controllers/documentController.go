@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"fakturierung-backend/database"
+	"fakturierung-backend/documents"
+	"fakturierung-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	formatPDF      = "pdf"
+	contentTypePDF = "application/pdf"
+)
+
+// ===== Helpers =====
+
+// loadInvoiceData gathers invoice (items, customer), issuing company and article names.
+func loadInvoiceData(tx *gorm.DB, schema string, id uint) (documents.InvoiceData, error) {
+	var d documents.InvoiceData
+	if err := tx.Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		Preload("Customer").
+		Preload("Deductions", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		First(&d.Invoice, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return d, fiber.NewError(fiber.StatusNotFound, "invoice not found")
+		}
+		return d, err
+	}
+	company, err := loadCompany(tx, schema)
+	if err != nil {
+		return d, err
+	}
+	d.Company = company
+
+	ids := make([]string, 0, len(d.Invoice.Items))
+	for _, it := range d.Invoice.Items {
+		ids = append(ids, it.ArticleID)
+	}
+	var articles []models.Article
+	if len(ids) > 0 {
+		if err := tx.Select("id", "name").Where("id IN ?", ids).Find(&articles).Error; err != nil {
+			return d, err
+		}
+	}
+	d.ArticleNames = make(map[string]string, len(articles))
+	for _, a := range articles {
+		d.ArticleNames[a.Id] = a.Name
+	}
+
+	if d.Invoice.CorrectsID != nil {
+		var orig models.Invoice
+		if err := tx.First(&orig, "id = ?", *d.Invoice.CorrectsID).Error; err != nil {
+			return d, err
+		}
+		d.Corrected = &orig
+	}
+	return d, nil
+}
+
+// storeRendering persists a rendering for the invoice's latest version.
+func storeRendering(tx *gorm.DB, invoiceID uint, format, contentType string, content []byte) (models.InvoiceDocument, error) {
+	next, err := nextVersionNo(tx, invoiceID)
+	if err != nil {
+		return models.InvoiceDocument{}, err
+	}
+	sum := sha256.Sum256(content)
+	doc := models.InvoiceDocument{
+		InvoiceID:   invoiceID,
+		VersionNo:   next - 1,
+		Format:      format,
+		ContentType: contentType,
+		Content:     content,
+		SHA256:      hex.EncodeToString(sum[:]),
+	}
+	return doc, tx.Create(&doc).Error
+}
+
+// storeInvoicePDF renders and stores the PDF of a just-published invoice version.
+func storeInvoicePDF(tx *gorm.DB, schema string, invoiceID uint) (models.InvoiceDocument, error) {
+	d, err := loadInvoiceData(tx, schema, invoiceID)
+	if err != nil {
+		return models.InvoiceDocument{}, err
+	}
+	pdf, err := documents.RenderInvoicePDF(d)
+	if err != nil {
+		return models.InvoiceDocument{}, err
+	}
+	return storeRendering(tx, invoiceID, formatPDF, contentTypePDF, pdf)
+}
+
+func sendDocument(c *fiber.Ctx, contentType, filename string, content []byte) error {
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="%s"`, filename))
+	return c.Send(content)
+}
+
+// ===== Handlers =====
+
+// GET /api/invoices/:id/pdf?version=n
+// Finalized documents are served from the stored rendering (byte-identical on every
+// download); drafts are rendered on the fly.
+func GetInvoicePDF(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid invoice id")
+	}
+	version := c.QueryInt("version", 0)
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var inv models.Invoice
+	if err := db.First(&inv, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "invoice not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	filename := documents.Number(&inv)
+	if filename == "" {
+		filename = fmt.Sprintf("entwurf-%d", inv.ID)
+	}
+	filename += ".pdf"
+
+	if !inv.Published {
+		if version > 0 {
+			return fiber.NewError(fiber.StatusNotFound, "no stored document for this version")
+		}
+		d, err := loadInvoiceData(db, tenantSchema(c), inv.ID)
+		if err != nil {
+			return err
+		}
+		pdf, err := documents.RenderInvoicePDF(d)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "pdf rendering failed")
+		}
+		return sendDocument(c, contentTypePDF, filename, pdf)
+	}
+
+	var doc models.InvoiceDocument
+	q := db.Where("invoice_id = ? AND format = ?", inv.ID, formatPDF)
+	if version > 0 {
+		q = q.Where("version_no = ?", version)
+	}
+	res := q.Order("version_no DESC").Limit(1).Find(&doc)
+	if res.Error != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	if res.RowsAffected == 0 {
+		if version > 0 {
+			return fiber.NewError(fiber.StatusNotFound, "no stored document for this version")
+		}
+		// Published before renderings were stored: render once and keep it
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var e error
+			doc, e = storeInvoicePDF(tx, tenantSchema(c), inv.ID)
+			return e
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return sendDocument(c, doc.ContentType, filename, doc.Content)
+}
+
+// GET /api/invoices/:id/documents  (metadata of stored renderings)
+func ListInvoiceDocuments(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid invoice id")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var docs []models.InvoiceDocument
+	if err := db.Omit("content").Where("invoice_id = ?", id).Order("version_no ASC, id ASC").Find(&docs).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"documents": docs})
+}
+
+// GET /api/invoices/:id/qr?format=png|svg&size=300
+// EPC GiroCode for the invoice's open amount, paid to the tenant's bank account.
+func GetInvoiceQR(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid invoice id")
+	}
+	format := strings.ToLower(strings.TrimSpace(c.Query("format", "png")))
+	if format != "png" && format != "svg" {
+		return fiber.NewError(fiber.StatusBadRequest, "format must be png or svg")
+	}
+	size := parseIntDefault(c.Query("size"), 300)
+	if size < 100 || size > 2000 {
+		return fiber.NewError(fiber.StatusBadRequest, "size must be between 100 and 2000")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+	d, err := loadInvoiceData(db, tenantSchema(c), uint(id))
+	if err != nil {
+		return err
+	}
+	e, ok := documents.EPCForInvoice(d)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "no payment code: invoice not issued, nothing open or no bank account")
+	}
+	payload, err := e.Payload()
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+	}
+
+	name := "girocode-" + d.Invoice.InvoiceNumber
+	if format == "svg" {
+		content, err := documents.EPCQRSVG(payload)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "qr code rendering failed")
+		}
+		return sendDocument(c, "image/svg+xml", name+".svg", content)
+	}
+	content, err := documents.EPCQRPNG(payload, size)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "qr code rendering failed")
+	}
+	return sendDocument(c, "image/png", name+".png", content)
+}
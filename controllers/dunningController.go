@@ -0,0 +1,394 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"fakturierung-backend/database"
+	"fakturierung-backend/documents"
+	"fakturierung-backend/middlewares"
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ===== DTOs =====
+
+type DunningLevelCreateDTO struct {
+	Level        int         `json:"level" validate:"required,gt=0"`
+	Name         string      `json:"name" validate:"required,min=1"`
+	DaysOverdue  int         `json:"days_overdue" validate:"gte=0"`
+	PaymentDays  int         `json:"payment_days" validate:"gte=0,lte=365"`
+	Fee          utils.Money `json:"fee" validate:"gte=0"`
+	InterestRate float64     `json:"interest_rate" validate:"gte=0,lte=1"` // annual, fraction
+	Text         string      `json:"text" validate:"omitempty"`
+}
+
+// Pointer-based partial update; requires optimistic-lock version
+type DunningLevelUpdateDTO struct {
+	Version      uint         `json:"version" validate:"required,gt=0"`
+	Name         *string      `json:"name" validate:"omitempty,min=1"`
+	DaysOverdue  *int         `json:"days_overdue" validate:"omitempty,gte=0"`
+	PaymentDays  *int         `json:"payment_days" validate:"omitempty,gte=0,lte=365"`
+	Fee          *utils.Money `json:"fee" validate:"omitempty,gte=0"`
+	InterestRate *float64     `json:"interest_rate" validate:"omitempty,gte=0,lte=1"`
+	Text         *string      `json:"text" validate:"omitempty"`
+	Active       *bool        `json:"active" validate:"omitempty"`
+}
+
+type DunningRunDTO struct {
+	AsOf   string `json:"as_of" validate:"omitempty,datetime=2006-01-02"` // default: today
+	DryRun bool   `json:"dry_run"`
+}
+
+// ===== Helpers =====
+
+// daysBetween counts whole calendar days from a to b (negative if b is before a).
+func daysBetween(a, b time.Time) int {
+	da := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	db := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(db.Sub(da).Hours() / 24)
+}
+
+// dunningInterest is simple default interest on the open amount (act/365).
+func dunningInterest(open utils.Money, annualRate float64, days int, mode utils.RoundingMode) utils.Money {
+	if open <= 0 || annualRate <= 0 || days <= 0 {
+		return 0
+	}
+	// the rate has at most 4 decimals (numeric(5,4))
+	return open.MulRatio(int64(math.Round(annualRate*10000))*int64(days), 365*10000, mode)
+}
+
+// creditedTotals sums the (negative) totals of published credit notes per corrected invoice.
+func creditedTotals(tx *gorm.DB, invoiceIDs []uint) (map[uint]utils.Money, error) {
+	type row struct {
+		CorrectsID uint
+		Sum        utils.Money
+	}
+	var rows []row
+	if err := tx.Model(&models.Invoice{}).
+		Select("corrects_id, COALESCE(SUM(total), 0) AS sum").
+		Where("corrects_id IN ? AND published = ?", invoiceIDs, true).
+		Group("corrects_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[uint]utils.Money, len(rows))
+	for _, r := range rows {
+		out[r.CorrectsID] = r.Sum
+	}
+	return out, nil
+}
+
+// latestNotices returns the highest-level notice issued so far per invoice.
+func latestNotices(tx *gorm.DB, invoiceIDs []uint) (map[uint]models.DunningNotice, error) {
+	var notices []models.DunningNotice
+	if err := tx.Raw(`SELECT DISTINCT ON (invoice_id) * FROM dunning_notices
+		WHERE invoice_id IN ? ORDER BY invoice_id, level DESC`, invoiceIDs).
+		Scan(&notices).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[uint]models.DunningNotice, len(notices))
+	for _, n := range notices {
+		out[n.InvoiceID] = n
+	}
+	return out, nil
+}
+
+// nextDunningLevel picks the level following the last issued one, if it is due:
+// the invoice must be overdue long enough and the previous reminder's deadline
+// must have passed. Levels are sorted ascending.
+func nextDunningLevel(levels []models.DunningLevel, last *models.DunningNotice, daysOverdue int, asOf time.Time) *models.DunningLevel {
+	lastLevel := 0
+	if last != nil {
+		lastLevel = last.Level
+		if daysBetween(last.DueDate, asOf) <= 0 {
+			return nil
+		}
+	}
+	for i := range levels {
+		if levels[i].Level > lastLevel {
+			if daysOverdue >= levels[i].DaysOverdue {
+				return &levels[i]
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// ===== Handlers =====
+
+// POST /api/dunning-level
+func CreateDunningLevel(c *fiber.Ctx) error {
+	var in DunningLevelCreateDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+	// no DTO normalization: it would round the interest rate to two decimals
+	in.Name = strings.TrimSpace(in.Name)
+	in.Text = strings.TrimSpace(in.Text)
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	level := models.DunningLevel{
+		Level:        in.Level,
+		Name:         in.Name,
+		DaysOverdue:  in.DaysOverdue,
+		PaymentDays:  in.PaymentDays,
+		Fee:          in.Fee,
+		InterestRate: in.InterestRate,
+		Text:         in.Text,
+		Active:       true,
+	}
+	if err := db.Create(&level).Error; err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "could not create dunning level")
+	}
+	return c.Status(fiber.StatusCreated).JSON(level)
+}
+
+// GET /api/dunning-levels
+func GetDunningLevels(c *fiber.Ctx) error {
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var levels []models.DunningLevel
+	if err := db.Order("level ASC").Find(&levels).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"dunning_levels": levels, "message": "success"})
+}
+
+// PUT /api/dunning-levels/:id
+func UpdateDunningLevel(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid dunning level id")
+	}
+
+	var in DunningLevelUpdateDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+	if in.Name != nil {
+		trim := strings.TrimSpace(*in.Name)
+		in.Name = &trim
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var existing models.DunningLevel
+	if err := db.First(&existing, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "dunning level not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+
+	updates := utils.UpdatesFromPtrDTO(&in, nil)
+	if len(updates) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "no fields to update")
+	}
+	updates["version"] = gorm.Expr("version + 1")
+
+	res := db.Model(&models.DunningLevel{}).
+		Where("id = ? AND version = ?", id, in.Version).
+		Updates(updates)
+	if res.Error != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "could not update dunning level")
+	}
+	if res.RowsAffected == 0 {
+		return fiber.NewError(fiber.StatusConflict, "stale update, please reload")
+	}
+
+	var out models.DunningLevel
+	if err := db.First(&out, "id = ?", id).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to reload dunning level")
+	}
+	return c.JSON(out)
+}
+
+// POST /api/dunning/run
+// Body: { "as_of": "2025-10-31", "dry_run": false } (both optional)
+// Finds published invoices past their due date with an open balance and issues the
+// next reminder level for each (at most one level per run). Invoices locked by a
+// concurrent run are skipped; the unique (invoice, level) index is the last guard.
+func RunDunning(c *fiber.Ctx) error {
+	var in DunningRunDTO
+	if len(c.Body()) > 0 {
+		if err := middlewares.BindAndValidate(c, &in); err != nil {
+			return err
+		}
+	}
+	asOf := time.Now().UTC()
+	if strings.TrimSpace(in.AsOf) != "" {
+		t, err := time.Parse("2006-01-02", in.AsOf)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid as_of date")
+		}
+		asOf = t
+	}
+	asOf = time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC)
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	notices := []models.DunningNotice{}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var levels []models.DunningLevel
+		if err := tx.Where("active = ?", true).Order("level ASC").Find(&levels).Error; err != nil {
+			return err
+		}
+		if len(levels) == 0 {
+			return nil
+		}
+
+		var invoices []models.Invoice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("published = ? AND document_type = ? AND cancelled = ? AND collection_pending = ?", true, models.DocumentInvoice, false, false).
+			Where("due_date < ?", asOf).
+			Order("due_date ASC, id ASC").
+			Find(&invoices).Error; err != nil {
+			return err
+		}
+		if len(invoices) == 0 {
+			return nil
+		}
+		ids := make([]uint, 0, len(invoices))
+		for _, inv := range invoices {
+			ids = append(ids, inv.ID)
+		}
+		credited, err := creditedTotals(tx, ids)
+		if err != nil {
+			return err
+		}
+		last, err := latestNotices(tx, ids)
+		if err != nil {
+			return err
+		}
+
+		for _, inv := range invoices {
+			open := inv.Total + credited[inv.ID] - inv.PaidTotal
+			if open <= 0 {
+				continue
+			}
+			daysOverdue := daysBetween(*inv.DueDate, asOf)
+			var prev *models.DunningNotice
+			if n, ok := last[inv.ID]; ok {
+				prev = &n
+			}
+			level := nextDunningLevel(levels, prev, daysOverdue, asOf)
+			if level == nil {
+				continue
+			}
+
+			feesTotal := level.Fee
+			if prev != nil {
+				feesTotal += prev.FeesTotal
+			}
+			interest := dunningInterest(open, level.InterestRate, daysOverdue, invoiceRounding(&inv).Mode)
+			notice := models.DunningNotice{
+				InvoiceID:   inv.ID,
+				Level:       level.Level,
+				LevelName:   level.Name,
+				IssuedAt:    asOf,
+				DaysOverdue: daysOverdue,
+				OpenAmount:  open,
+				Fee:         level.Fee,
+				FeesTotal:   feesTotal,
+				Interest:    interest,
+				TotalDue:    open + feesTotal + interest,
+				DueDate:     asOf.AddDate(0, 0, level.PaymentDays),
+			}
+			if !in.DryRun {
+				d, err := loadInvoiceData(tx, tenantSchema(c), inv.ID)
+				if err != nil {
+					return err
+				}
+				pdf, err := documents.RenderReminderPDF(documents.ReminderData{InvoiceData: d, Notice: notice, Text: level.Text})
+				if err != nil {
+					return err
+				}
+				sum := sha256.Sum256(pdf)
+				notice.Content = pdf
+				notice.SHA256 = hex.EncodeToString(sum[:])
+				if err := tx.Create(&notice).Error; err != nil {
+					return err
+				}
+			}
+			notices = append(notices, notice)
+		}
+		return nil
+	})
+	if err != nil {
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			return fe
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "dunning run failed")
+	}
+	return c.JSON(fiber.Map{"notices": notices, "dry_run": in.DryRun, "as_of": asOf.Format("2006-01-02"), "message": "success"})
+}
+
+// GET /api/invoices/:id/dunning
+func GetInvoiceDunning(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid invoice id")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var notices []models.DunningNotice
+	if err := db.Omit("content").Where("invoice_id = ?", id).Order("level ASC").Find(&notices).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"notices": notices})
+}
+
+// GET /api/dunning-notices/:id/pdf
+func GetDunningNoticePDF(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid dunning notice id")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var notice models.DunningNotice
+	if err := db.First(&notice, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "dunning notice not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	var number string
+	if err := db.Model(&models.Invoice{}).Select("invoice_number").Where("id = ?", notice.InvoiceID).Scan(&number).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return sendDocument(c, contentTypePDF, fmt.Sprintf("%s-mahnung-%d.pdf", number, notice.Level), notice.Content)
+}
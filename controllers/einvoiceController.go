@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"fakturierung-backend/database"
+	"fakturierung-backend/documents"
+	"fakturierung-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	contentTypeXML = "application/xml"
+)
+
+// ===== Helpers =====
+
+// renderEInvoice validates the invoice against the format's mandatory business terms
+// and renders it. A non-empty missing list means nothing was rendered.
+func renderEInvoice(d documents.InvoiceData, format string) (content []byte, contentType string, missing []string, err error) {
+	e := documents.BuildEInvoice(d)
+	if missing = e.Validate(format); len(missing) > 0 {
+		return nil, "", missing, nil
+	}
+	switch format {
+	case documents.FormatXRechnungCII:
+		content, err = documents.RenderCII(e, format)
+		return content, contentTypeXML, nil, err
+	case documents.FormatUBL:
+		content, err = documents.RenderUBL(e)
+		return content, contentTypeXML, nil, err
+	case documents.FormatEbInterface:
+		content, err = documents.RenderEbInterface(e)
+		return content, contentTypeXML, nil, err
+	case documents.FormatFacturX:
+		cii, err := documents.RenderCII(e, format)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		content, err = documents.RenderFacturX(d, cii)
+		return content, contentTypePDF, nil, err
+	}
+	return nil, "", nil, fmt.Errorf("unsupported e-invoice format %q", format)
+}
+
+func einvoiceFilename(inv *models.Invoice, format string) string {
+	switch format {
+	case documents.FormatFacturX:
+		return inv.InvoiceNumber + "-facturx.pdf"
+	case documents.FormatUBL:
+		return inv.InvoiceNumber + "-ubl.xml"
+	case documents.FormatEbInterface:
+		return inv.InvoiceNumber + "-ebinterface.xml"
+	default:
+		return inv.InvoiceNumber + "-xrechnung.xml"
+	}
+}
+
+// ===== Handlers =====
+
+// GET /api/invoices/:id/einvoice?format=xrechnung-cii|ubl|facturx|ebinterface
+// Only published invoices and credit notes qualify. The first successful rendering of
+// a published version is stored and served byte-identical afterwards.
+func GetInvoiceEInvoice(c *fiber.Ctx) error {
+	format := strings.ToLower(strings.TrimSpace(c.Query("format", documents.FormatXRechnungCII)))
+	switch format {
+	case documents.FormatXRechnungCII, documents.FormatUBL, documents.FormatFacturX, documents.FormatEbInterface:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "format must be one of xrechnung-cii, ubl, facturx, ebinterface")
+	}
+	return serveEInvoice(c, format)
+}
+
+// GET /api/invoices/:id/ebinterface
+// ebInterface 6.1 XML for upload to the Austrian e-Rechnung.gv.at portal.
+func GetInvoiceEbInterface(c *fiber.Ctx) error {
+	return serveEInvoice(c, documents.FormatEbInterface)
+}
+
+func serveEInvoice(c *fiber.Ctx, format string) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid invoice id")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var inv models.Invoice
+	if err := db.First(&inv, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "invoice not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	if inv.DocumentType != models.DocumentInvoice && inv.DocumentType != models.DocumentCreditNote {
+		return fiber.NewError(fiber.StatusBadRequest, "only invoices and credit notes can be exported as e-invoice")
+	}
+	if !inv.Published {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"message": "e-invoice validation failed",
+			"missing": []string{"BT-1 invoice number (publish the invoice first)"},
+		})
+	}
+
+	var doc models.InvoiceDocument
+	res := db.Where("invoice_id = ? AND format = ?", inv.ID, format).Order("version_no DESC").Limit(1).Find(&doc)
+	if res.Error != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	if res.RowsAffected > 0 {
+		return sendDocument(c, doc.ContentType, einvoiceFilename(&inv, format), doc.Content)
+	}
+
+	d, err := loadInvoiceData(db, tenantSchema(c), inv.ID)
+	if err != nil {
+		return err
+	}
+	content, contentType, missing, err := renderEInvoice(d, format)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "e-invoice rendering failed")
+	}
+	if len(missing) > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"message": "e-invoice validation failed",
+			"missing": missing,
+		})
+	}
+	if _, err := storeRendering(db, inv.ID, format, contentType, content); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "could not store e-invoice")
+	}
+	return sendDocument(c, contentType, einvoiceFilename(&inv, format), content)
+}
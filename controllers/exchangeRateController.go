@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"fakturierung-backend/banking"
+	"fakturierung-backend/database"
+	"fakturierung-backend/middlewares"
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ===== DTOs =====
+
+// Rate: units of currency per unit of the company's base currency (ECB convention)
+type ExchangeRateCreateDTO struct {
+	Currency string  `json:"currency" validate:"required,iso4217"`
+	Date     string  `json:"date" validate:"required,datetime=2006-01-02"`
+	Rate     float64 `json:"rate" validate:"required,gt=0"`
+}
+
+// ===== Helpers =====
+
+// Sources of an exchange rate.
+const (
+	rateSourceManual = "manual"
+	rateSourceECB    = "ecb"
+)
+
+const defaultCurrency = "EUR"
+
+var reCurrency = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// parseCurrency upper-cases a currency code from a form and checks its shape.
+func parseCurrency(s string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(s))
+	if !reCurrency.MatchString(code) {
+		return "", fmt.Errorf("invalid currency")
+	}
+	return code, nil
+}
+
+// baseCurrency returns the company's base currency.
+func baseCurrency(company models.Company) string {
+	if company.Currency == "" {
+		return defaultCurrency
+	}
+	return company.Currency
+}
+
+// documentCurrency resolves a new document's currency: the requested one, else the
+// customer's, else the company's base currency.
+func documentCurrency(tx *gorm.DB, schema string, customerID uint, requested string) (string, error) {
+	if requested != "" {
+		return requested, nil
+	}
+	var customer models.Customer
+	if err := tx.Select("currency").First(&customer, "id = ?", customerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fiber.NewError(fiber.StatusBadRequest, "customer not found")
+		}
+		return "", err
+	}
+	if customer.Currency != "" {
+		return customer.Currency, nil
+	}
+	company, err := loadCompany(tx, schema)
+	if err != nil {
+		return "", err
+	}
+	return baseCurrency(company), nil
+}
+
+// minExchangeRate is the smallest rate numeric(18,6) can hold; anything below
+// would be stored as 0 and could not convert amounts.
+const minExchangeRate = 0.000001
+
+// roundRate keeps the 6 decimals an exchange rate is stored with.
+func roundRate(x float64) float64 { return math.Round(x*1e6) / 1e6 }
+
+// validRate reports whether a rate survives rounding to the stored 6 decimals.
+func validRate(x float64) bool { return roundRate(x) >= minExchangeRate }
+
+// saveExchangeRate inserts the rate or replaces the one of the same currency and day.
+func saveExchangeRate(tx *gorm.DB, r *models.ExchangeRate) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "currency"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "source"}),
+	}).Create(r).Error
+}
+
+// exchangeRateOn returns the latest rate of currency quoted on or before day.
+func exchangeRateOn(tx *gorm.DB, currency string, day time.Time) (models.ExchangeRate, error) {
+	var r models.ExchangeRate
+	err := tx.Where("currency = ? AND date <= ?", currency, day.Format("2006-01-02")).
+		Order("date DESC").First(&r).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return r, fiber.NewError(fiber.StatusBadRequest,
+			fmt.Sprintf("no exchange rate for %s on or before %s", currency, day.Format("2006-01-02")))
+	}
+	return r, err
+}
+
+// lockExchangeRate fixes inv's conversion into the company's base currency as of day
+// (rate 1 in the base currency itself) and computes its base-currency totals.
+func lockExchangeRate(tx *gorm.DB, schema string, inv *models.Invoice, day time.Time) error {
+	company, err := loadCompany(tx, schema)
+	if err != nil {
+		return err
+	}
+	base := baseCurrency(company)
+	rate, quoted := 1.0, day.Truncate(24*time.Hour)
+	if inv.Currency != base {
+		r, err := exchangeRateOn(tx, inv.Currency, day)
+		if err != nil {
+			return err
+		}
+		if !validRate(r.Rate) {
+			return fiber.NewError(fiber.StatusBadRequest,
+				fmt.Sprintf("invalid exchange rate for %s on %s", inv.Currency, r.Date.Format("2006-01-02")))
+		}
+		rate, quoted = r.Rate, r.Date
+	}
+	inv.BaseCurrency, inv.ExchangeRate, inv.ExchangeRateDate = base, &rate, &quoted
+	setBaseTotals(inv)
+	return nil
+}
+
+// setBaseTotals converts inv's totals with its locked rate; the tax is converted per
+// rate, as the VAT of every rate has to be stated in the base currency.
+func setBaseTotals(inv *models.Invoice) {
+	sub, tax := inv.Subtotal, inv.TaxTotal
+	if rate := *inv.ExchangeRate; rate != 1 {
+		mode := invoiceRounding(inv).Mode
+		sub, tax = inv.Subtotal.DivRate(rate, mode), 0
+		for _, tl := range inv.TaxBreakdown {
+			tax += tl.Tax.DivRate(rate, mode)
+		}
+	}
+	total := sub + tax
+	inv.BaseSubtotal, inv.BaseTaxTotal, inv.BaseTotal = &sub, &tax, &total
+}
+
+// baseCurrencyUpdates are the columns lockExchangeRate / setBaseTotals fill in.
+func baseCurrencyUpdates(inv *models.Invoice) map[string]any {
+	return map[string]any{
+		"base_currency":      inv.BaseCurrency,
+		"exchange_rate":      inv.ExchangeRate,
+		"exchange_rate_date": inv.ExchangeRateDate,
+		"base_subtotal":      inv.BaseSubtotal,
+		"base_tax_total":     inv.BaseTaxTotal,
+		"base_total":         inv.BaseTotal,
+	}
+}
+
+// ecbRates turns ECB euro reference rates into rates against base: cross rates via
+// the base currency's euro rate (days without it are skipped) and the euro itself.
+func ecbRates(in []banking.ECBRate, base string) []models.ExchangeRate {
+	var out []models.ExchangeRate
+	if base == defaultCurrency {
+		for _, r := range in {
+			if validRate(r.Rate) {
+				out = append(out, models.ExchangeRate{Currency: r.Currency, Date: r.Date, Rate: roundRate(r.Rate), Source: rateSourceECB})
+			}
+		}
+		return out
+	}
+	perEuro := make(map[time.Time]float64)
+	for _, r := range in {
+		if r.Currency == base && r.Rate > 0 {
+			perEuro[r.Date] = r.Rate
+		}
+	}
+	for _, r := range in {
+		b, ok := perEuro[r.Date]
+		if !ok || r.Currency == base || !validRate(r.Rate/b) {
+			continue
+		}
+		out = append(out, models.ExchangeRate{Currency: r.Currency, Date: r.Date, Rate: roundRate(r.Rate / b), Source: rateSourceECB})
+	}
+	for day, b := range perEuro {
+		if !validRate(1 / b) {
+			continue
+		}
+		out = append(out, models.ExchangeRate{Currency: defaultCurrency, Date: day, Rate: roundRate(1 / b), Source: rateSourceECB})
+	}
+	return out
+}
+
+// ===== Handlers =====
+
+// POST /api/exchange-rate (replaces the rate of the same currency and day)
+func CreateExchangeRate(c *fiber.Ctx) error {
+	var in ExchangeRateCreateDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+	day, _ := parseDate(in.Date)
+	if !validRate(in.Rate) {
+		return fiber.NewError(fiber.StatusBadRequest, "rate must be at least 0.000001")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+	company, err := loadCompany(db, tenantSchema(c))
+	if err != nil {
+		return err
+	}
+	if in.Currency == baseCurrency(company) {
+		return fiber.NewError(fiber.StatusBadRequest, "currency is the base currency")
+	}
+
+	rate := models.ExchangeRate{Currency: in.Currency, Date: day, Rate: roundRate(in.Rate), Source: rateSourceManual}
+	if err := saveExchangeRate(db, &rate); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "could not save exchange rate")
+	}
+	return c.Status(fiber.StatusCreated).JSON(rate)
+}
+
+// POST /api/exchange-rates/ecb (ECB reference rate XML as "file" upload or request body)
+func ImportECBRates(c *fiber.Ctx) error {
+	var data []byte
+	if fh, err := c.FormFile("file"); err == nil {
+		f, err := fh.Open()
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "could not read file")
+		}
+		data, err = io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "could not read file")
+		}
+	} else {
+		data = c.Body()
+	}
+	if len(data) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "file is required")
+	}
+	parsed, err := banking.ParseECBRates(data)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+	company, err := loadCompany(db, tenantSchema(c))
+	if err != nil {
+		return err
+	}
+	base := baseCurrency(company)
+	rates := ecbRates(parsed, base)
+	if len(rates) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("file has no rates for the base currency %s", base))
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for i := range rates {
+			if err := saveExchangeRate(tx, &rates[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"imported": len(rates), "message": "success"})
+}
+
+// GET /api/exchange-rates?currency=CHF&from=2025-01-01&to=2025-12-31&limit=100&offset=0
+func GetExchangeRates(c *fiber.Ctx) error {
+	limit := utils.ParseIntDefault(c.Query("limit"), 100)
+	offset := utils.ParseIntDefault(c.Query("offset"), 0)
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	query := db.Model(&models.ExchangeRate{})
+	if currency := strings.ToUpper(strings.TrimSpace(c.Query("currency"))); currency != "" {
+		query = query.Where("currency = ?", currency)
+	}
+	if from := c.Query("from"); from != "" {
+		day, err := parseDate(from)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid from date")
+		}
+		query = query.Where("date >= ?", day)
+	}
+	if to := c.Query("to"); to != "" {
+		day, err := parseDate(to)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid to date")
+		}
+		query = query.Where("date <= ?", day)
+	}
+
+	var rates []models.ExchangeRate
+	if err := query.Order("date DESC, currency ASC").Limit(limit).Offset(offset).Find(&rates).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"exchange_rates": rates, "message": "success"})
+}
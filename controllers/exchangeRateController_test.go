@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"fakturierung-backend/banking"
+	"fakturierung-backend/models"
+)
+
+func TestValidRate(t *testing.T) {
+	tests := []struct {
+		rate float64
+		want bool
+	}{
+		{1, true},
+		{0.000001, true},
+		{0.0000005, true}, // rounds up to the smallest storable rate
+		{0.0000004, false},
+		{0, false},
+		{-1.05, false},
+	}
+	for _, tt := range tests {
+		if got := validRate(tt.rate); got != tt.want {
+			t.Errorf("validRate(%v) = %v, want %v", tt.rate, got, tt.want)
+		}
+	}
+}
+
+// ecbTestRates parses the ECB sample and returns ecbRates(base) in a stable order.
+func ecbTestRates(t *testing.T, base string) []models.ExchangeRate {
+	t.Helper()
+	data, err := os.ReadFile("testdata/eurofxref-hist.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := banking.ParseECBRates(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 8 {
+		t.Fatalf("parsed %d rates, want 8", len(parsed))
+	}
+	out := ecbRates(parsed, base)
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Date.Equal(out[j].Date) {
+			return out[i].Date.Before(out[j].Date)
+		}
+		return out[i].Currency < out[j].Currency
+	})
+	return out
+}
+
+func ecbRate(currency string, day time.Time, rate float64) models.ExchangeRate {
+	return models.ExchangeRate{Currency: currency, Date: day, Rate: rate, Source: rateSourceECB}
+}
+
+func TestECBRatesEuroBase(t *testing.T) {
+	mar3, mar4 := date(2025, 3, 3), date(2025, 3, 4)
+	want := []models.ExchangeRate{
+		ecbRate("IDR", mar3, 17268.12), ecbRate("JPY", mar3, 157.31), ecbRate("USD", mar3, 1.0478),
+		// XTS (0.0000004) would be stored as 0 and is dropped
+		ecbRate("CHF", mar4, 0.94), ecbRate("IDR", mar4, 17310.5), ecbRate("JPY", mar4, 157.42), ecbRate("USD", mar4, 1.055),
+	}
+	if got := ecbTestRates(t, "EUR"); !reflect.DeepEqual(got, want) {
+		t.Errorf("ecbRates(EUR)\n got  %+v\n want %+v", got, want)
+	}
+}
+
+func TestECBRatesCrossRates(t *testing.T) {
+	mar4 := date(2025, 3, 4)
+	// CHF is only quoted on 4 March, so 3 March is skipped
+	want := []models.ExchangeRate{
+		ecbRate("EUR", mar4, 1.06383), ecbRate("IDR", mar4, 18415.425532), ecbRate("JPY", mar4, 167.468085), ecbRate("USD", mar4, 1.12234),
+	}
+	if got := ecbTestRates(t, "CHF"); !reflect.DeepEqual(got, want) {
+		t.Errorf("ecbRates(CHF)\n got  %+v\n want %+v", got, want)
+	}
+	// against a weak base currency small cross rates fall below 6 decimals
+	for _, r := range ecbTestRates(t, "IDR") {
+		if !validRate(r.Rate) || r.Currency == "XTS" {
+			t.Errorf("ecbRates(IDR) kept unstorable rate %+v", r)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fakturierung-backend/database"
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ===== Helpers =====
+
+// Invoice types of documents of type models.DocumentInvoice.
+const (
+	invoiceTypeStandard    = "standard"
+	invoiceTypeDownPayment = "down_payment"
+	invoiceTypeFinal       = "final"
+)
+
+// standingDeductionSQL limits deductions to final invoices that still stand
+// (not a credit note, not cancelled).
+const standingDeductionSQL = `invoices.document_type = 'invoice' AND NOT invoices.cancelled`
+
+// deductingInvoices maps down-payment IDs to the number of the standing final invoice
+// (other than exceptID) that already deducts them.
+func deductingInvoices(tx *gorm.DB, ids []uint, exceptID uint) (map[uint]string, error) {
+	type row struct {
+		DownPaymentID uint
+		InvoiceNumber string
+	}
+	var rows []row
+	if err := tx.Model(&models.InvoiceDeduction{}).
+		Select("invoice_deductions.down_payment_id, invoices.invoice_number").
+		Joins("JOIN invoices ON invoices.id = invoice_deductions.invoice_id").
+		Where("invoice_deductions.down_payment_id IN ? AND invoices.id <> ? AND "+standingDeductionSQL, ids, exceptID).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[uint]string, len(rows))
+	for _, r := range rows {
+		if r.InvoiceNumber == "" {
+			r.InvoiceNumber = "(draft)"
+		}
+		out[r.DownPaymentID] = r.InvoiceNumber
+	}
+	return out, nil
+}
+
+// buildDeductions checks the down-payment invoices that the customer's final invoice
+// finalID (0 while creating) in currency deducts, and takes over their amounts.
+func buildDeductions(tx *gorm.DB, customerID, finalID uint, currency string, ids []uint) ([]models.InvoiceDeduction, error) {
+	if len(ids) == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "a final invoice needs at least one down-payment invoice (down_payment_ids)")
+	}
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "invalid or duplicate down_payment_ids")
+		}
+		seen[id] = true
+	}
+
+	// Lock the down payments exclusively so neither a concurrent cancellation nor a
+	// second final invoice deducting the same down payment can slip in between
+	var dps []models.Invoice
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).Order("published_at ASC, id ASC").Find(&dps).Error; err != nil {
+		return nil, err
+	}
+	if len(dps) != len(ids) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "down-payment invoice not found")
+	}
+	for _, dp := range dps {
+		switch {
+		case dp.DocumentType != models.DocumentInvoice || dp.InvoiceType != invoiceTypeDownPayment:
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invoice %d is not a down-payment invoice", dp.ID))
+		case !dp.Published:
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("down-payment invoice %d is not published", dp.ID))
+		case dp.Cancelled:
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("down-payment invoice %s is cancelled", dp.InvoiceNumber))
+		case dp.CId != customerID:
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("down-payment invoice %s belongs to another customer", dp.InvoiceNumber))
+		case dp.Currency != currency:
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("down-payment invoice %s is billed in %s", dp.InvoiceNumber, dp.Currency))
+		}
+	}
+	taken, err := deductingInvoices(tx, ids, finalID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]models.InvoiceDeduction, 0, len(dps))
+	for _, dp := range dps {
+		if number, ok := taken[dp.ID]; ok {
+			return nil, fiber.NewError(fiber.StatusConflict,
+				fmt.Sprintf("down-payment invoice %s is already deducted on final invoice %s", dp.InvoiceNumber, number))
+		}
+		out = append(out, models.InvoiceDeduction{
+			DownPaymentID: dp.ID,
+			InvoiceNumber: dp.InvoiceNumber,
+			IssuedAt:      dp.PublishedAt,
+			Subtotal:      dp.Subtotal,
+			TaxTotal:      dp.TaxTotal,
+			Total:         dp.Total,
+			TaxBreakdown:  dp.TaxBreakdown,
+		})
+	}
+	return out, nil
+}
+
+// negatedDeductions mirrors a final invoice's deductions for its credit note.
+func negatedDeductions(in []models.InvoiceDeduction) []models.InvoiceDeduction {
+	out := make([]models.InvoiceDeduction, 0, len(in))
+	for _, d := range in {
+		lines := make([]models.TaxLine, 0, len(d.TaxBreakdown))
+		for _, tl := range d.TaxBreakdown {
+			lines = append(lines, models.TaxLine{Rate: tl.Rate, Net: -tl.Net, Tax: -tl.Tax, Gross: -tl.Gross})
+		}
+		out = append(out, models.InvoiceDeduction{
+			DownPaymentID: d.DownPaymentID,
+			InvoiceNumber: d.InvoiceNumber,
+			IssuedAt:      d.IssuedAt,
+			Subtotal:      -d.Subtotal,
+			TaxTotal:      -d.TaxTotal,
+			Total:         -d.Total,
+			TaxBreakdown:  datatypes.NewJSONSlice(lines),
+		})
+	}
+	return out
+}
+
+// deductBreakdown subtracts the deductions from a per-rate breakdown. Rates that net
+// to zero are dropped; the remaining subtotal and tax are returned with it.
+func deductBreakdown(breakdown []models.TaxLine, deductions []models.InvoiceDeduction) ([]models.TaxLine, utils.Money, utils.Money) {
+	byRate := make(map[float64]*models.TaxLine, len(breakdown))
+	for _, tl := range breakdown {
+		l := tl
+		byRate[tl.Rate] = &l
+	}
+	for _, d := range deductions {
+		for _, tl := range d.TaxBreakdown {
+			l, ok := byRate[tl.Rate]
+			if !ok {
+				l = &models.TaxLine{Rate: tl.Rate}
+				byRate[tl.Rate] = l
+			}
+			l.Net -= tl.Net
+			l.Tax -= tl.Tax
+			l.Gross -= tl.Gross
+		}
+	}
+	out := make([]models.TaxLine, 0, len(byRate))
+	for _, l := range byRate {
+		if l.Net == 0 && l.Tax == 0 {
+			continue
+		}
+		out = append(out, *l)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Rate < out[j].Rate })
+	subtotal, taxTotal := sumBreakdown(out)
+	return out, subtotal, taxTotal
+}
+
+// finalTotals returns a final invoice's remaining subtotal, tax, total and breakdown:
+// its per-rate breakdown less the deducted down payments, rate by rate.
+func finalTotals(breakdown []models.TaxLine, deductions []models.InvoiceDeduction) (utils.Money, utils.Money, utils.Money, []models.TaxLine, error) {
+	breakdown, subtotal, taxTotal := deductBreakdown(breakdown, deductions)
+	total := subtotal + taxTotal
+	if total < 0 {
+		return 0, 0, 0, nil, fiber.NewError(fiber.StatusBadRequest, "down payments exceed the final invoice amount")
+	}
+	return subtotal, taxTotal, total, breakdown, nil
+}
+
+// deductionIDs lists the down-payment invoices behind the deductions.
+func deductionIDs(deductions []models.InvoiceDeduction) []uint {
+	out := make([]uint, 0, len(deductions))
+	for _, d := range deductions {
+		out = append(out, d.DownPaymentID)
+	}
+	return out
+}
+
+// parseIDList reads a comma-separated list of IDs (legacy form fields).
+func parseIDList(v, field string) ([]uint, error) {
+	var out []uint
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("invalid %s", field)
+		}
+		out = append(out, uint(n))
+	}
+	return out, nil
+}
+
+// ===== Handlers =====
+
+// GET /api/down-payments?customer_id=1
+// Published down-payment invoices not yet deducted on a final invoice.
+func GetDownPayments(c *fiber.Ctx) error {
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	q := withPaymentStatus(db.Model(&models.Invoice{})).
+		Where("invoices.invoice_type = ? AND "+invoiceIssuedSQL+" AND NOT invoices.cancelled", invoiceTypeDownPayment).
+		Where(`NOT EXISTS (SELECT 1 FROM invoice_deductions d JOIN invoices f ON f.id = d.invoice_id
+			WHERE d.down_payment_id = invoices.id AND f.document_type = 'invoice' AND NOT f.cancelled)`)
+	if s := strings.TrimSpace(c.Query("customer_id")); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid customer_id")
+		}
+		q = q.Where("invoices.c_id = ?", id)
+	}
+	var invoices []models.Invoice
+	if err := q.Order("invoices.published_at ASC, invoices.id ASC").Find(&invoices).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"invoices": invoices, "message": "success"})
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"fakturierung-backend/utils"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -21,68 +23,288 @@ import (
 // ====== DTOs ======
 
 type InvoiceItemDTO struct {
-	ArticleID   string  `json:"article_id" validate:"required"`
-	Description string  `json:"description" validate:"omitempty"`
-	Amount      int     `json:"amount" validate:"required,gt=0"`
-	UnitPrice   float64 `json:"unit_price" validate:"required,gt=0"`
+	ArticleID   string      `json:"article_id" validate:"required"`
+	Description string      `json:"description" validate:"omitempty"`
+	Amount      float64     `json:"amount" validate:"required,gt=0"`                               // quantity, up to 3 decimals
+	Unit        string      `json:"unit" validate:"omitempty,oneof=piece hour day kg m flat_rate"` // "" => article's unit
+	UnitPrice   utils.Money `json:"unit_price" validate:"required,gt=0"`
+	TaxRate     *float64    `json:"tax_rate" validate:"omitempty,gte=0,lte=1"` // per-line override; nil => article's tax category
+	// line discount before tax: a rate (0.1 == 10 %) or a fixed amount, not both
+	DiscountRate   float64     `json:"discount_rate" validate:"omitempty,gte=0,lte=1"`
+	DiscountAmount utils.Money `json:"discount_amount" validate:"omitempty,gte=0"`
 }
 
 type InvoiceCreateDTO struct {
-	Type       string           `json:"type" validate:"omitempty,oneof=quotation invoice"`
-	Draft      *bool            `json:"draft" validate:"omitempty"`
+	Type       string           `json:"type" validate:"omitempty,oneof=quotation order_confirmation delivery_note invoice down_payment final"`
+	Draft      *bool            `json:"draft" validate:"omitempty"` // deprecated: draft=true without type creates a quotation
 	CustomerID uint             `json:"customer_id" validate:"required,gt=0"`
 	Items      []InvoiceItemDTO `json:"items" validate:"required,min=1,dive"`
+	// final invoices: the down-payment invoices to deduct
+	DownPaymentIDs []uint `json:"down_payment_ids" validate:"omitempty,dive,gt=0"`
+	// days until due after publishing; nil => company default
+	PaymentTermDays *int `json:"payment_term_days" validate:"omitempty,gte=0,lte=365"`
+	// early-payment discount (fraction) within skonto_days; nil => company default
+	SkontoRate *float64 `json:"skonto_rate" validate:"omitempty,gte=0,lt=1"`
+	SkontoDays *int     `json:"skonto_days" validate:"omitempty,gte=0,lte=365"`
+	// quotations: end of the offer's validity (YYYY-MM-DD); default set when finalized
+	ValidUntil string `json:"valid_until" validate:"omitempty"`
+	// document discount before tax: a rate of the lines' net total or a fixed amount
+	DiscountRate   *float64     `json:"discount_rate" validate:"omitempty,gte=0,lte=1"`
+	DiscountAmount *utils.Money `json:"discount_amount" validate:"omitempty,gte=0"`
+	// VAT treatment; "" => the customer's default (or exempt for small businesses)
+	TaxTreatment string `json:"tax_treatment" validate:"omitempty,oneof=domestic reverse_charge intra_eu_supply export exempt"`
+	// ISO 4217 code; "" => the customer's currency, else the company's base currency
+	Currency string `json:"currency" validate:"omitempty,iso4217"`
 }
 
 // Pointer-based partial update (only non-nil fields updated) + required optimistic-lock version
 type InvoiceUpdateDTO struct {
-	Version    uint              `json:"version" validate:"required,gt=0"`
-	CustomerID *uint             `json:"customer_id" validate:"omitempty,gt=0"`
-	Items      *[]InvoiceItemDTO `json:"items" validate:"omitempty,min=1"` // if present, each item will be validated
+	Version         uint              `json:"version" validate:"required,gt=0"`
+	CustomerID      *uint             `json:"customer_id" validate:"omitempty,gt=0"`
+	Items           *[]InvoiceItemDTO `json:"items" validate:"omitempty,min=1"`            // if present, each item will be validated
+	DownPaymentIDs  *[]uint           `json:"down_payment_ids" validate:"omitempty,min=1"` // final invoices only
+	PaymentTermDays *int              `json:"payment_term_days" validate:"omitempty,gte=0,lte=365"`
+	SkontoRate      *float64          `json:"skonto_rate" validate:"omitempty,gte=0,lt=1" normalize:"-"`
+	SkontoDays      *int              `json:"skonto_days" validate:"omitempty,gte=0,lte=365"`
+	ValidUntil      *string           `json:"valid_until" validate:"omitempty"` // quotations only
+	// replaces the document discount (discount_rate 0 removes it)
+	DiscountRate   *float64     `json:"discount_rate" validate:"omitempty,gte=0,lte=1" normalize:"-"`
+	DiscountAmount *utils.Money `json:"discount_amount" validate:"omitempty,gte=0"`
+	TaxTreatment   *string      `json:"tax_treatment" validate:"omitempty,oneof=domestic reverse_charge intra_eu_supply export exempt"`
+	Currency       *string      `json:"currency" validate:"omitempty,iso4217"`
 }
 
 type PaymentCreateDTO struct {
-	Amount    float64 `json:"amount" validate:"required,gt=0"`
-	Method    string  `json:"method" validate:"omitempty"`
-	Reference string  `json:"reference" validate:"omitempty"`
-	Note      string  `json:"note" validate:"omitempty"`
-	PaidAt    string  `json:"paid_at" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Amount    utils.Money `json:"amount" validate:"required,gt=0"`
+	Currency  string      `json:"currency" validate:"omitempty,iso4217"` // must match the invoice's
+	Method    string      `json:"method" validate:"omitempty"`
+	Reference string      `json:"reference" validate:"omitempty"`
+	Note      string      `json:"note" validate:"omitempty"`
+	PaidAt    string      `json:"paid_at" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
 }
 
 // ====== Helpers ======
 
-func toItems(items []InvoiceItemDTO, taxRate float64) ([]models.InvoiceItem, float64, float64) {
-	var out []models.InvoiceItem
-	var subtotal, taxTotal float64
+// units lists the accepted units of measure.
+var units = map[string]bool{
+	models.UnitPiece: true, models.UnitHour: true, models.UnitDay: true,
+	models.UnitKilogram: true, models.UnitMeter: true, models.UnitFlatRate: true,
+}
+
+// defaultTaxRate applies when neither the article nor the tenant defines a tax category.
+const defaultTaxRate = 0.2
+
+// articleDefaults are the line values an article supplies unless the line overrides them.
+type articleDefaults struct {
+	Rate float64
+	Unit string
+}
+
+// resolveArticleDefaults maps every referenced article ID to its tax rate (the
+// article's active tax category, else the tenant's default category, else
+// defaultTaxRate) and its unit of measure.
+func resolveArticleDefaults(tx *gorm.DB, items []InvoiceItemDTO) (map[string]articleDefaults, error) {
+	fallback := defaultTaxRate
+	var def models.TaxCategory
+	res := tx.Where("is_default = ? AND active = ?", true, true).Order("id ASC").Limit(1).Find(&def)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected > 0 {
+		fallback = def.Rate
+	}
+
+	ids := make([]string, 0, len(items))
 	for _, it := range items {
-		unit := utils.Round2(it.UnitPrice)
-		net := utils.Round2(unit * float64(it.Amount))
-		tax := utils.Round2(net * taxRate)
-		gross := utils.Round2(net + tax)
-
-		subtotal = utils.Round2(subtotal + net)
-		taxTotal = utils.Round2(taxTotal + tax)
-
-		out = append(out, models.InvoiceItem{
-			ArticleID:   strings.TrimSpace(it.ArticleID),
-			Description: strings.TrimSpace(it.Description),
-			Amount:      it.Amount,
-			UnitPrice:   unit,
-			TaxRate:     taxRate,
-			NetPrice:    net,
-			TaxAmount:   tax,
-			GrossPrice:  gross,
+		ids = append(ids, strings.TrimSpace(it.ArticleID))
+	}
+	type row struct {
+		Id   string
+		Rate *float64
+		Unit string
+	}
+	var rows []row
+	if err := tx.Model(&models.Article{}).
+		Select("articles.id AS id, tax_categories.rate AS rate, articles.unit AS unit").
+		Joins("LEFT JOIN tax_categories ON tax_categories.id = articles.tax_category_id AND tax_categories.active").
+		Where("articles.id IN ?", ids).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	defaults := make(map[string]articleDefaults, len(ids))
+	for _, id := range ids {
+		defaults[id] = articleDefaults{Rate: fallback, Unit: models.UnitPiece}
+	}
+	for _, r := range rows {
+		d := defaults[r.Id]
+		if r.Rate != nil {
+			d.Rate = *r.Rate
+		}
+		if r.Unit != "" {
+			d.Unit = r.Unit
+		}
+		defaults[r.Id] = d
+	}
+	return defaults, nil
+}
+
+// toItems computes the lines, discounts included, under the given rounding policy.
+// Tax treatments other than domestic bill every line at 0 %.
+func toItems(items []InvoiceItemDTO, defaults map[string]articleDefaults, p roundingPolicy, treatment string) ([]models.InvoiceItem, error) {
+	var out []models.InvoiceItem
+	for i, it := range items {
+		articleID := strings.TrimSpace(it.ArticleID)
+		def := defaults[articleID]
+		taxRate := def.Rate
+		if it.TaxRate != nil {
+			taxRate = *it.TaxRate
+		}
+		if zeroRated(treatment) {
+			taxRate = 0
+		}
+		unitOfMeasure := def.Unit
+		if u := strings.TrimSpace(it.Unit); u != "" {
+			unitOfMeasure = u
+		}
+
+		if it.DiscountRate > 0 && it.DiscountAmount > 0 {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("item %d: set either discount_rate or discount_amount", i+1))
+		}
+
+		line := p.line(models.InvoiceItem{
+			ArticleID:    articleID,
+			Description:  strings.TrimSpace(it.Description),
+			Amount:       utils.Round3(it.Amount),
+			Unit:         unitOfMeasure,
+			UnitPrice:    it.UnitPrice,
+			TaxRate:      taxRate,
+			DiscountRate: it.DiscountRate,
+			Discount:     it.DiscountAmount,
 		})
+		if line.NetPrice < 0 {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("item %d: discount exceeds the line amount", i+1))
+		}
+		out = append(out, line)
+	}
+	return out, nil
+}
+
+// buildItems resolves tax rates and units for the given lines and computes the items.
+func buildItems(tx *gorm.DB, in []InvoiceItemDTO, p roundingPolicy, treatment string) ([]models.InvoiceItem, error) {
+	defaults, err := resolveArticleDefaults(tx, in)
+	if err != nil {
+		return nil, err
+	}
+	return toItems(in, defaults, p, treatment)
+}
+
+// taxBreakdown sums net/tax/gross per tax rate, ordered by rate. With document
+// rounding the tax of each rate is computed once on its summed net instead of
+// adding up the rounded line taxes.
+func taxBreakdown(items []models.InvoiceItem, p roundingPolicy) []models.TaxLine {
+	byRate := make(map[float64]*models.TaxLine)
+	for _, it := range items {
+		l, ok := byRate[it.TaxRate]
+		if !ok {
+			l = &models.TaxLine{Rate: it.TaxRate}
+			byRate[it.TaxRate] = l
+		}
+		l.Net += it.NetPrice
+		l.Tax += it.TaxAmount
+		l.Gross += it.GrossPrice
+	}
+	out := make([]models.TaxLine, 0, len(byRate))
+	for _, l := range byRate {
+		if p.TaxRounding == models.TaxRoundingDocument {
+			l.Tax = l.Net.MulRate(l.Rate, p.Mode)
+			l.Gross = l.Net + l.Tax
+		}
+		out = append(out, *l)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Rate < out[j].Rate })
+	return out
+}
+
+// documentDiscount is a discount on the whole document before tax: Rate of the lines'
+// net total, or the fixed Amount when Rate is 0.
+type documentDiscount struct {
+	Rate   float64
+	Amount utils.Money
+}
+
+// invoiceDiscount returns the document discount stored on an invoice.
+func invoiceDiscount(inv *models.Invoice) documentDiscount {
+	if inv.DiscountRate > 0 {
+		return documentDiscount{Rate: inv.DiscountRate}
+	}
+	return documentDiscount{Amount: inv.Discount}
+}
+
+// newDocumentDiscount reads the request's discount fields; nil => no change.
+func newDocumentDiscount(rate *float64, amount *utils.Money) (*documentDiscount, error) {
+	switch {
+	case rate != nil && amount != nil && *rate > 0 && *amount > 0:
+		return nil, fiber.NewError(fiber.StatusBadRequest, "set either discount_rate or discount_amount")
+	case rate != nil && *rate > 0:
+		return &documentDiscount{Rate: *rate}, nil
+	case amount != nil:
+		return &documentDiscount{Amount: *amount}, nil
+	case rate != nil:
+		return &documentDiscount{}, nil
+	}
+	return nil, nil
+}
+
+// documentTotals returns the per-rate breakdown of the lines less the document
+// discount, with the remaining subtotal and tax total and the discount amount.
+// The discount is split over the rates in proportion to their nets (the last rate
+// takes the rounding remainder) and reduces each rate's tax base.
+func documentTotals(items []models.InvoiceItem, d documentDiscount, p roundingPolicy) ([]models.TaxLine, utils.Money, utils.Money, utils.Money, error) {
+	breakdown := taxBreakdown(items, p)
+	net, _ := sumBreakdown(breakdown)
+	discount := d.Amount
+	if d.Rate > 0 {
+		discount = net.MulRate(d.Rate, p.Mode)
+	}
+	if discount.Abs() > net.Abs() {
+		return nil, 0, 0, 0, fiber.NewError(fiber.StatusBadRequest, "discount exceeds the net total")
 	}
-	return out, subtotal, taxTotal
+	if discount != 0 {
+		rest := discount
+		for i := range breakdown {
+			l := &breakdown[i]
+			share := rest
+			if i < len(breakdown)-1 {
+				share = discount.MulRatio(int64(l.Net), int64(net), p.Mode)
+			}
+			rest -= share
+			l.Discount = share
+			l.Net -= share
+			if p.TaxRounding == models.TaxRoundingDocument {
+				l.Tax = l.Net.MulRate(l.Rate, p.Mode)
+			} else {
+				l.Tax -= share.MulRate(l.Rate, p.Mode)
+			}
+			l.Gross = l.Net + l.Tax
+		}
+	}
+	subtotal, taxTotal := sumBreakdown(breakdown)
+	return breakdown, subtotal, taxTotal, discount, nil
+}
+
+// sumBreakdown returns the net subtotal and the tax total of a breakdown.
+func sumBreakdown(breakdown []models.TaxLine) (subtotal, taxTotal utils.Money) {
+	for _, l := range breakdown {
+		subtotal += l.Net
+		taxTotal += l.Tax
+	}
+	return subtotal, taxTotal
 }
 
 // Backward-compatible parser for old x-www-form-urlencoded bracket keys.
-func extractInvoiceItems(data map[string]string) ([]models.InvoiceItem, float64, float64, error) {
-	var items []models.InvoiceItem
-	var subtotal float64
-	var taxTotal float64
-	taxRate := 0.2 // TODO: tenant config
+func extractInvoiceItems(data map[string]string) ([]InvoiceItemDTO, error) {
+	var items []InvoiceItemDTO
 
 	for i := 0; ; i++ {
 		prefix := fmt.Sprintf("articles[%d]", i)
@@ -94,44 +316,271 @@ func extractInvoiceItems(data map[string]string) ([]models.InvoiceItem, float64,
 		unitPriceStr := data[prefix+"[unit_price]"]
 		description := data[prefix+"[description]"]
 
-		amount, err := strconv.Atoi(amountStr)
-		if err != nil {
-			return nil, 0, 0, fmt.Errorf("invalid amount at index %d", i)
+		amount, err := strconv.ParseFloat(strings.TrimSpace(amountStr), 64)
+		if err != nil || amount <= 0 {
+			return nil, fmt.Errorf("invalid amount at index %d", i)
 		}
-		unitPrice, err := strconv.ParseFloat(unitPriceStr, 64)
+		unit := strings.TrimSpace(data[prefix+"[unit]"])
+		if unit != "" && !units[unit] {
+			return nil, fmt.Errorf("invalid unit at index %d", i)
+		}
+		unitPrice, err := utils.ParseMoney(unitPriceStr)
 		if err != nil {
-			return nil, 0, 0, fmt.Errorf("invalid unit price at index %d", i)
-		}
-
-		unit := utils.Round2(unitPrice)
-		net := utils.Round2(unit * float64(amount))
-		tax := utils.Round2(net * taxRate)
-		gross := utils.Round2(net + tax)
-
-		subtotal = utils.Round2(subtotal + net)
-		taxTotal = utils.Round2(taxTotal + tax)
-
-		items = append(items, models.InvoiceItem{
-			ArticleID:   strings.TrimSpace(articleID),
-			Description: strings.TrimSpace(description),
-			Amount:      amount,
-			UnitPrice:   unit,
-			TaxRate:     taxRate,
-			NetPrice:    net,
-			TaxAmount:   tax,
-			GrossPrice:  gross,
+			return nil, fmt.Errorf("invalid unit price at index %d", i)
+		}
+		var taxRate *float64
+		if v := strings.TrimSpace(data[prefix+"[tax_rate]"]); v != "" {
+			r, err := strconv.ParseFloat(v, 64)
+			if err != nil || r < 0 || r > 1 {
+				return nil, fmt.Errorf("invalid tax rate at index %d", i)
+			}
+			taxRate = &r
+		}
+		var discountRate float64
+		if v := strings.TrimSpace(data[prefix+"[discount_rate]"]); v != "" {
+			if discountRate, err = strconv.ParseFloat(v, 64); err != nil || discountRate < 0 || discountRate > 1 {
+				return nil, fmt.Errorf("invalid discount rate at index %d", i)
+			}
+		}
+		var discountAmount utils.Money
+		if v := strings.TrimSpace(data[prefix+"[discount_amount]"]); v != "" {
+			if discountAmount, err = utils.ParseMoney(v); err != nil || discountAmount < 0 {
+				return nil, fmt.Errorf("invalid discount amount at index %d", i)
+			}
+		}
+
+		items = append(items, InvoiceItemDTO{
+			ArticleID:      strings.TrimSpace(articleID),
+			Description:    strings.TrimSpace(description),
+			Amount:         amount,
+			Unit:           unit,
+			UnitPrice:      unitPrice,
+			TaxRate:        taxRate,
+			DiscountRate:   discountRate,
+			DiscountAmount: discountAmount,
 		})
 	}
-	return items, subtotal, taxTotal, nil
+	return items, nil
+}
+
+// itemLines turns stored lines back into request lines, e.g. to rebuild them under
+// another tax treatment. Without keepRates the rates come from the articles again.
+func itemLines(items []models.InvoiceItem, keepRates bool) []InvoiceItemDTO {
+	out := make([]InvoiceItemDTO, 0, len(items))
+	for _, it := range items {
+		line := InvoiceItemDTO{
+			ArticleID:    it.ArticleID,
+			Description:  it.Description,
+			Amount:       it.Amount,
+			Unit:         it.Unit,
+			UnitPrice:    it.UnitPrice,
+			DiscountRate: it.DiscountRate,
+		}
+		if keepRates {
+			rate := it.TaxRate
+			line.TaxRate = &rate
+		}
+		if it.DiscountRate == 0 {
+			line.DiscountAmount = it.Discount
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// documentType resolves the requested "type" into document and invoice type.
+// down_payment/final are invoices of that invoice type; without a type the legacy
+// draft flag selects a quotation.
+func documentType(typ string, legacyDraft bool) (string, string, error) {
+	switch typ = strings.ToLower(strings.TrimSpace(typ)); typ {
+	case "":
+		if legacyDraft {
+			return models.DocumentQuotation, invoiceTypeStandard, nil
+		}
+		return models.DocumentInvoice, invoiceTypeStandard, nil
+	case models.DocumentQuotation, models.DocumentOrderConfirmation, models.DocumentDeliveryNote, models.DocumentInvoice:
+		return typ, invoiceTypeStandard, nil
+	case invoiceTypeDownPayment, invoiceTypeFinal:
+		return models.DocumentInvoice, typ, nil
+	}
+	return "", "", errors.New("invalid type")
+}
+
+// invoiceKind names the document for its version snapshots.
+func invoiceKind(inv *models.Invoice) string {
+	if inv.CorrectsID != nil {
+		return models.DocumentCreditNote
+	}
+	if inv.DocumentType == models.DocumentInvoice {
+		switch inv.InvoiceType {
+		case invoiceTypeDownPayment:
+			return "down_payment"
+		case invoiceTypeFinal:
+			return "final_invoice"
+		}
+	}
+	return inv.DocumentType
 }
 
-func kindFromDraft(draft bool) string {
-	if draft {
-		return "quotation"
+// defaultPaymentTermDays applies when the company has no payment term configured.
+const defaultPaymentTermDays = 14
+
+// companyPaymentTermDays returns the tenant's default payment term for new invoices.
+func companyPaymentTermDays(tx *gorm.DB, schema string) int {
+	company, err := loadCompany(tx, schema)
+	if err != nil || company.PaymentTermDays <= 0 {
+		return defaultPaymentTermDays
+	}
+	return company.PaymentTermDays
+}
+
+// parseTermDays reads an optional legacy-form payment term.
+func parseTermDays(v string) (*int, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil, nil
 	}
-	return "invoice"
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > 365 {
+		return nil, fmt.Errorf("invalid payment_term_days")
+	}
+	return &n, nil
+}
+
+// skontoTerms is an early-payment discount: Rate off the total when paid within Days.
+type skontoTerms struct {
+	Rate float64
+	Days int
+}
+
+// companySkonto returns the tenant's default early-payment discount (none if unset).
+func companySkonto(tx *gorm.DB, schema string) skontoTerms {
+	company, err := loadCompany(tx, schema)
+	if err != nil || company.SkontoRate <= 0 {
+		return skontoTerms{}
+	}
+	return skontoTerms{Rate: company.SkontoRate, Days: company.SkontoDays}
+}
+
+// withSkonto overrides the given terms with the non-nil request fields.
+func withSkonto(s skontoTerms, rate *float64, days *int) skontoTerms {
+	if rate != nil {
+		s.Rate = *rate
+	}
+	if days != nil {
+		s.Days = *days
+	}
+	return s
+}
+
+// checkSkonto rejects a discount window that does not end before the net due date.
+func checkSkonto(s skontoTerms, termDays int) error {
+	if s.Rate > 0 && s.Days >= termDays {
+		return fiber.NewError(fiber.StatusBadRequest, "skonto_days must be shorter than payment_term_days")
+	}
+	return nil
+}
+
+// skontoTotal is the amount that settles total when the discount applies, rounded
+// with the document's rounding mode.
+func skontoTotal(total utils.Money, rate float64, mode utils.RoundingMode) utils.Money {
+	return total - total.MulRate(rate, mode)
 }
 
+// roundingPolicy is how a document rounds: tax per line or per rate on the document
+// sums, ties half-up or half-even. It is taken from the company when the document is
+// created and kept with it, so later setting changes do not alter existing documents.
+type roundingPolicy struct {
+	TaxRounding string // models.TaxRounding*
+	Mode        utils.RoundingMode
+}
+
+// companyRounding returns the tenant's rounding settings (line/half-up if unset).
+func companyRounding(tx *gorm.DB, schema string) roundingPolicy {
+	p := roundingPolicy{TaxRounding: models.TaxRoundingLine, Mode: utils.RoundHalfUp}
+	company, err := loadCompany(tx, schema)
+	if err != nil {
+		return p
+	}
+	if company.TaxRounding != "" {
+		p.TaxRounding = company.TaxRounding
+	}
+	if company.RoundingMode != "" {
+		p.Mode = utils.RoundingMode(company.RoundingMode)
+	}
+	return p
+}
+
+// invoiceRounding returns the policy stored on a document.
+func invoiceRounding(inv *models.Invoice) roundingPolicy {
+	p := roundingPolicy{TaxRounding: inv.TaxRounding, Mode: utils.RoundingMode(inv.RoundingMode)}
+	if p.TaxRounding == "" {
+		p.TaxRounding = models.TaxRoundingLine
+	}
+	if p.Mode == "" {
+		p.Mode = utils.RoundHalfUp
+	}
+	return p
+}
+
+// line fills in discount, net, tax and gross of an item from its quantity, unit
+// price, discount and tax rate. A fixed Discount is kept unless DiscountRate is set.
+func (p roundingPolicy) line(it models.InvoiceItem) models.InvoiceItem {
+	base := it.UnitPrice.MulQty(it.Amount, p.Mode)
+	if it.DiscountRate > 0 {
+		it.Discount = base.MulRate(it.DiscountRate, p.Mode)
+	}
+	it.NetPrice = base - it.Discount
+	it.TaxAmount = it.NetPrice.MulRate(it.TaxRate, p.Mode)
+	it.GrossPrice = it.NetPrice + it.TaxAmount
+	return it
+}
+
+// parseSkontoForm reads the optional legacy-form early-payment discount.
+func parseSkontoForm(data map[string]string) (*float64, *int, error) {
+	var rate *float64
+	if v := strings.TrimSpace(data["skonto_rate"]); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r < 0 || r >= 1 {
+			return nil, nil, fmt.Errorf("invalid skonto_rate")
+		}
+		rate = &r
+	}
+	var days *int
+	if v := strings.TrimSpace(data["skonto_days"]); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 365 {
+			return nil, nil, fmt.Errorf("invalid skonto_days")
+		}
+		days = &n
+	}
+	return rate, days, nil
+}
+
+// parseDiscountForm reads the optional legacy-form document discount.
+func parseDiscountForm(data map[string]string) (*documentDiscount, error) {
+	var rate *float64
+	if v := strings.TrimSpace(data["discount_rate"]); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r < 0 || r > 1 {
+			return nil, fmt.Errorf("invalid discount_rate")
+		}
+		rate = &r
+	}
+	var amount *utils.Money
+	if v := strings.TrimSpace(data["discount_amount"]); v != "" {
+		m, err := utils.ParseMoney(v)
+		if err != nil || m < 0 {
+			return nil, fmt.Errorf("invalid discount_amount")
+		}
+		amount = &m
+	}
+	return newDocumentDiscount(rate, amount)
+}
+
+// errPublishedReadOnly is returned for any attempt to change a published document.
+var errPublishedReadOnly = fiber.NewError(fiber.StatusConflict, "invoice is published and read-only; issue a credit note instead")
+
 func nextVersionNo(tx *gorm.DB, invoiceID uint) (int, error) {
 	var n int
 	err := tx.Model(&models.InvoiceVersion{}).
@@ -143,39 +592,138 @@ func nextVersionNo(tx *gorm.DB, invoiceID uint) (int, error) {
 	return n + 1, nil
 }
 
-func snapshotInvoice(tx *gorm.DB, inv *models.Invoice) error {
+// versionSnapshot is the content of an InvoiceVersion.
+type versionSnapshot struct {
+	DocumentType     string                    `json:"document_type"`
+	InvoiceNumber    string                    `json:"invoice_number"`
+	QuotationNumber  string                    `json:"quotation_number"`
+	DocumentNumber   string                    `json:"document_number"`
+	CustomerID       uint                      `json:"customer_id"`
+	Currency         string                    `json:"currency"`
+	Subtotal         utils.Money               `json:"subtotal"`
+	TaxTotal         utils.Money               `json:"tax_total"`
+	Total            utils.Money               `json:"total"`
+	TaxBreakdown     []models.TaxLine          `json:"tax_breakdown"`
+	DiscountRate     float64                   `json:"discount_rate"`
+	Discount         utils.Money               `json:"discount"`
+	TaxTreatment     string                    `json:"tax_treatment"`
+	TaxNote          string                    `json:"tax_note"`
+	BaseCurrency     string                    `json:"base_currency"`
+	ExchangeRate     *float64                  `json:"exchange_rate"`
+	ExchangeRateDate *time.Time                `json:"exchange_rate_date"`
+	BaseSubtotal     *utils.Money              `json:"base_subtotal"`
+	BaseTaxTotal     *utils.Money              `json:"base_tax_total"`
+	BaseTotal        *utils.Money              `json:"base_total"`
+	InvoiceType      string                    `json:"invoice_type"`
+	Deductions       []models.InvoiceDeduction `json:"deductions,omitempty"`
+	Published        bool                      `json:"published"`
+	PublishedAt      *time.Time                `json:"published_at"`
+	Items            []models.InvoiceItem      `json:"items"`
+	PaidTotal        utils.Money               `json:"paid_total"`
+	CorrectsID       *uint                     `json:"corrects_id"`
+	Cancelled        bool                      `json:"cancelled"`
+	CancelledAt      *time.Time                `json:"cancelled_at"`
+	PaymentTermDays  int                       `json:"payment_term_days"`
+	DueDate          *time.Time                `json:"due_date"`
+	SkontoRate       float64                   `json:"skonto_rate"`
+	SkontoDays       int                       `json:"skonto_days"`
+	SkontoDueDate    *time.Time                `json:"skonto_due_date"`
+	SkontoTotal      *utils.Money              `json:"skonto_total"`
+	RecurringID      *uint                     `json:"recurring_id"`
+	ValidUntil       *time.Time                `json:"valid_until"`
+	QuotationStatus  string                    `json:"quotation_status"`
+	SourceID         *uint                     `json:"source_id"`
+	Payments         []models.Payment          `json:"payments"`
+}
+
+// actor is who triggers a change and why; recorded on the versions it produces.
+type actor struct {
+	UserID string // "" for scheduler runs
+	Reason string
+}
+
+// changeReasonHeader optionally states why a document is changed. Header values are
+// limited to ASCII in practice, so the "reason" body field takes precedence.
+const changeReasonHeader = "X-Change-Reason"
+
+// requestActor returns the authenticated user and the request's change reason: the
+// optional "reason" field of the request body (JSON or form), else the header.
+func requestActor(c *fiber.Ctx) actor {
+	userID, _ := c.Locals("userID").(string)
+	var body struct {
+		Reason string `json:"reason" form:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		_ = c.BodyParser(&body) // bodies without a reason object (e.g. JSON arrays) fall back to the header
+	}
+	reason := strings.TrimSpace(body.Reason)
+	if reason == "" {
+		reason = strings.TrimSpace(c.Get(changeReasonHeader))
+	}
+	return actor{UserID: userID, Reason: reason}
+}
+
+// snapshotInvoice records the invoice's current state as its next version, made by
+// `by` through action (models.Version*).
+func snapshotInvoice(tx *gorm.DB, inv *models.Invoice, by actor, action string) error {
 	verNo, err := nextVersionNo(tx, inv.ID)
 	if err != nil {
 		return err
 	}
 	var items []models.InvoiceItem
-	if err := tx.Model(&models.InvoiceItem{}).Where("invoice_id = ?", inv.ID).Find(&items).Error; err != nil {
+	if err := tx.Model(&models.InvoiceItem{}).Where("invoice_id = ?", inv.ID).Order("id ASC").Find(&items).Error; err != nil {
 		return err
 	}
-
-	type versionSnapshot struct {
-		InvoiceNumber string               `json:"invoice_number"`
-		CustomerID    uint                 `json:"customer_id"`
-		Subtotal      float64              `json:"subtotal"`
-		TaxTotal      float64              `json:"tax_total"`
-		Total         float64              `json:"total"`
-		Draft         bool                 `json:"draft"`
-		Published     bool                 `json:"published"`
-		PublishedAt   *time.Time           `json:"published_at"`
-		Items         []models.InvoiceItem `json:"items"`
-		PaidTotal     float64              `json:"paid_total"`
+	var payments []models.Payment
+	if err := tx.Where("invoice_id = ?", inv.ID).Order("id ASC").Find(&payments).Error; err != nil {
+		return err
+	}
+	var deductions []models.InvoiceDeduction
+	if err := tx.Where("invoice_id = ?", inv.ID).Order("id ASC").Find(&deductions).Error; err != nil {
+		return err
 	}
+
 	snap := versionSnapshot{
-		InvoiceNumber: inv.InvoiceNumber,
-		CustomerID:    inv.CId,
-		Subtotal:      inv.Subtotal,
-		TaxTotal:      inv.TaxTotal,
-		Total:         inv.Total,
-		Draft:         inv.Draft,
-		Published:     inv.Published,
-		PublishedAt:   inv.PublishedAt,
-		Items:         items,
-		PaidTotal:     inv.PaidTotal,
+		DocumentType:     inv.DocumentType,
+		InvoiceNumber:    inv.InvoiceNumber,
+		QuotationNumber:  inv.QuotationNumber,
+		DocumentNumber:   inv.DocumentNumber,
+		CustomerID:       inv.CId,
+		Currency:         inv.Currency,
+		Subtotal:         inv.Subtotal,
+		TaxTotal:         inv.TaxTotal,
+		Total:            inv.Total,
+		TaxBreakdown:     inv.TaxBreakdown,
+		DiscountRate:     inv.DiscountRate,
+		Discount:         inv.Discount,
+		TaxTreatment:     inv.TaxTreatment,
+		TaxNote:          inv.TaxNote,
+		BaseCurrency:     inv.BaseCurrency,
+		ExchangeRate:     inv.ExchangeRate,
+		ExchangeRateDate: inv.ExchangeRateDate,
+		BaseSubtotal:     inv.BaseSubtotal,
+		BaseTaxTotal:     inv.BaseTaxTotal,
+		BaseTotal:        inv.BaseTotal,
+		InvoiceType:      inv.InvoiceType,
+		Deductions:       deductions,
+		Published:        inv.Published,
+		PublishedAt:      inv.PublishedAt,
+		Items:            items,
+		PaidTotal:        inv.PaidTotal,
+		CorrectsID:       inv.CorrectsID,
+		Cancelled:        inv.Cancelled,
+		CancelledAt:      inv.CancelledAt,
+		PaymentTermDays:  inv.PaymentTermDays,
+		DueDate:          inv.DueDate,
+		SkontoRate:       inv.SkontoRate,
+		SkontoDays:       inv.SkontoDays,
+		SkontoDueDate:    inv.SkontoDueDate,
+		SkontoTotal:      inv.SkontoTotal,
+		RecurringID:      inv.RecurringID,
+		ValidUntil:       inv.ValidUntil,
+		QuotationStatus:  inv.QuotationStatus,
+		SourceID:         inv.SourceID,
+		Payments:         payments,
 	}
 	js, err := json.Marshal(snap)
 	if err != nil {
@@ -184,21 +732,25 @@ func snapshotInvoice(tx *gorm.DB, inv *models.Invoice) error {
 	record := models.InvoiceVersion{
 		InvoiceID: inv.ID,
 		VersionNo: verNo,
-		Kind:      kindFromDraft(inv.Draft),
+		Kind:      invoiceKind(inv),
+		Action:    action,
+		UserID:    by.UserID,
+		Reason:    by.Reason,
 		Snapshot:  js,
 	}
 	return tx.Create(&record).Error
 }
 
-func recalcPaidTotal(tx *gorm.DB, invoiceID uint) (float64, error) {
-	var sum float64
+// recalcPaidTotal sums the payments that count: refunds (negative) and granted
+// early-payment discounts included, reversed and deleted payments excluded.
+func recalcPaidTotal(tx *gorm.DB, invoiceID uint) (utils.Money, error) {
+	var sum utils.Money
 	if err := tx.Model(&models.Payment{}).
-		Where("invoice_id = ?", invoiceID).
+		Where("invoice_id = ? AND reversed = ?", invoiceID, false).
 		Select("COALESCE(SUM(amount), 0)").
 		Scan(&sum).Error; err != nil {
 		return 0, err
 	}
-	sum = utils.Round2(sum)
 	if err := tx.Model(&models.Invoice{}).Where("id = ?", invoiceID).Update("paid_total", sum).Error; err != nil {
 		return 0, err
 	}
@@ -247,6 +799,210 @@ func validateArticleRefs(tx *gorm.DB, items []models.InvoiceItem, requireActive
 	return nil
 }
 
+// newInvoice carries the input for creating a document of any type.
+type newInvoice struct {
+	DocumentType    string // models.Document*
+	InvoiceType     string // "" => standard
+	CustomerID      uint
+	Lines           []InvoiceItemDTO
+	DownPaymentIDs  []uint     // final invoices
+	PaymentTermDays *int       // nil => company default
+	SkontoRate      *float64   // nil => company default
+	SkontoDays      *int       // nil => company default
+	RecurringID     *uint      // set when generated from a recurring template
+	ValidUntil      *time.Time // quotations only
+	SourceID        *uint      // set when copied from another document
+	Discount        documentDiscount
+	TaxTreatment    string // "" => the customer's / company's default
+	Currency        string // "" => the customer's currency, else the base currency
+}
+
+// createInvoiceTx builds and validates the items, stores the new invoice and takes
+// its first snapshot. Shared by CreateInvoice and the recurring-invoice scheduler.
+func createInvoiceTx(tx *gorm.DB, schema string, in newInvoice, by actor) (models.Invoice, error) {
+	rounding := companyRounding(tx, schema)
+	treatment, taxNote, err := taxTreatmentFor(tx, schema, in.CustomerID, in.TaxTreatment)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	currency, err := documentCurrency(tx, schema, in.CustomerID, in.Currency)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	items, err := buildItems(tx, in.Lines, rounding, treatment)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	// Validate all article IDs exist & active
+	if err := validateArticleRefs(tx, items, true); err != nil {
+		return models.Invoice{}, err
+	}
+
+	typ := in.InvoiceType
+	if typ == "" || in.DocumentType != models.DocumentInvoice {
+		typ = invoiceTypeStandard
+	}
+	breakdown, subtotal, taxTotal, discount, err := documentTotals(items, in.Discount, rounding)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	total := subtotal + taxTotal
+	var deductions []models.InvoiceDeduction
+	if typ == invoiceTypeFinal {
+		if deductions, err = buildDeductions(tx, in.CustomerID, 0, currency, in.DownPaymentIDs); err != nil {
+			return models.Invoice{}, err
+		}
+		if subtotal, taxTotal, total, breakdown, err = finalTotals(breakdown, deductions); err != nil {
+			return models.Invoice{}, err
+		}
+	} else if len(in.DownPaymentIDs) > 0 {
+		return models.Invoice{}, fiber.NewError(fiber.StatusBadRequest, "down_payment_ids only apply to final invoices")
+	}
+
+	if in.ValidUntil != nil && in.DocumentType != models.DocumentQuotation {
+		return models.Invoice{}, fiber.NewError(fiber.StatusBadRequest, "valid_until only applies to quotations")
+	}
+	days := companyPaymentTermDays(tx, schema)
+	if in.PaymentTermDays != nil {
+		days = *in.PaymentTermDays
+	}
+	skonto := withSkonto(companySkonto(tx, schema), in.SkontoRate, in.SkontoDays)
+	if err := checkSkonto(skonto, days); err != nil {
+		return models.Invoice{}, err
+	}
+
+	invoice := models.Invoice{
+		DocumentType:    in.DocumentType,
+		InvoiceNumber:   "",
+		CId:             in.CustomerID,
+		Currency:        currency,
+		Items:           items,
+		Subtotal:        subtotal,
+		TaxTotal:        taxTotal,
+		Total:           total,
+		TaxBreakdown:    breakdown,
+		DiscountRate:    in.Discount.Rate,
+		Discount:        discount,
+		TaxTreatment:    treatment,
+		TaxNote:         taxNote,
+		InvoiceType:     typ,
+		Deductions:      deductions,
+		Published:       false,
+		PublishedAt:     nil,
+		PaidTotal:       0,
+		PaymentTermDays: days,
+		SkontoRate:      skonto.Rate,
+		SkontoDays:      skonto.Days,
+		TaxRounding:     rounding.TaxRounding,
+		RoundingMode:    string(rounding.Mode),
+		RecurringID:     in.RecurringID,
+		ValidUntil:      in.ValidUntil,
+		SourceID:        in.SourceID,
+		Version:         1, // start optimistic-lock version at 1
+	}
+	if err := tx.Create(&invoice).Error; err != nil {
+		return models.Invoice{}, err
+	}
+	if err := snapshotInvoice(tx, &invoice, by, models.VersionCreate); err != nil {
+		return models.Invoice{}, err
+	}
+	return invoice, nil
+}
+
+// publishInvoiceTx finalizes a draft document: it assigns the number of its type (if
+// absent), marks it published (invoices also get their due date and Skonto deadline),
+// snapshots it and stores the issued PDF.
+// Shared by PublishInvoice and auto-publishing recurring invoices.
+func publishInvoiceTx(tx *gorm.DB, schema string, id uint, by actor) (models.Invoice, error) {
+	var out models.Invoice
+	// Lock the invoice so concurrent publishes cannot both draw a number for it
+	var inv models.Invoice
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&inv, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return out, fiber.ErrNotFound
+		}
+		return out, err
+	}
+	if inv.Published {
+		return out, fiber.NewError(fiber.StatusConflict, "document is already finalized")
+	}
+	now := time.Now().UTC()
+	updates := map[string]any{"published": true}
+	// The customer's VAT id may have changed since the draft: check it and freeze the notice
+	if inv.TaxTreatment != models.TaxTreatmentDomestic {
+		_, note, err := taxTreatmentFor(tx, schema, inv.CId, inv.TaxTreatment)
+		if err != nil {
+			return out, err
+		}
+		updates["tax_note"] = note
+	}
+	// Each document type draws from its own sequence
+	column, number, seq := "invoice_number", inv.InvoiceNumber, sequenceInvoice
+	switch inv.DocumentType {
+	case models.DocumentQuotation:
+		column, number, seq = "quotation_number", inv.QuotationNumber, sequenceQuotation
+	case models.DocumentOrderConfirmation:
+		column, number, seq = "document_number", inv.DocumentNumber, sequenceOrderConfirmation
+	case models.DocumentDeliveryNote:
+		column, number, seq = "document_number", inv.DocumentNumber, sequenceDeliveryNote
+	}
+	if number == "" {
+		n, err := allocateNumber(tx, schema, seq, now)
+		if err != nil {
+			return out, err
+		}
+		updates[column] = n
+	}
+	publishedAt := now
+	if inv.PublishedAt == nil {
+		updates["published_at"] = &now
+	} else {
+		publishedAt = *inv.PublishedAt
+	}
+	// Lock the conversion into the base currency as of the issue date
+	if err := lockExchangeRate(tx, schema, &inv, publishedAt); err != nil {
+		return out, err
+	}
+	for column, v := range baseCurrencyUpdates(&inv) {
+		updates[column] = v
+	}
+	// Quotations are sent with their validity
+	if inv.DocumentType == models.DocumentQuotation {
+		updates["quotation_status"] = quotationStatusSent
+		if inv.ValidUntil != nil && inv.ValidUntil.Before(publishedAt.Truncate(24*time.Hour)) {
+			return out, fiber.NewError(fiber.StatusBadRequest, "valid_until lies in the past")
+		}
+		if inv.ValidUntil == nil {
+			validUntil := publishedAt.AddDate(0, 0, defaultQuotationValidityDays)
+			updates["valid_until"] = &validUntil
+		}
+	}
+	// Payment terms only run for invoices
+	if inv.DocumentType == models.DocumentInvoice {
+		if inv.DueDate == nil {
+			due := publishedAt.AddDate(0, 0, inv.PaymentTermDays)
+			updates["due_date"] = &due
+		}
+		if inv.SkontoRate > 0 && inv.SkontoDueDate == nil {
+			skontoDue := publishedAt.AddDate(0, 0, inv.SkontoDays)
+			updates["skonto_due_date"] = &skontoDue
+			updates["skonto_total"] = skontoTotal(inv.Total, inv.SkontoRate, invoiceRounding(&inv).Mode)
+		}
+	}
+	if err := tx.Model(&models.Invoice{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return out, err
+	}
+	if err := tx.Preload(clause.Associations).First(&out, "id = ?", id).Error; err != nil {
+		return out, err
+	}
+	if err := snapshotInvoice(tx, &out, by, models.VersionPublish); err != nil {
+		return out, err
+	}
+	// Keep the legally issued rendering of this version
+	_, err := storeInvoicePDF(tx, schema, out.ID)
+	return out, err
+}
+
 // ====== Core endpoints ======
 
 // POST /api/invoice
@@ -256,10 +1012,17 @@ func CreateInvoice(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
 	}
 
-	var draft bool
-	var items []models.InvoiceItem
-	var subtotal, taxTotal float64
+	var docType, invoiceType string
+	var downPaymentIDs []uint
+	var lines []InvoiceItemDTO
 	var customerID uint
+	var termDays *int
+	var skontoRate *float64
+	var skontoDays *int
+	var discount *documentDiscount
+	var taxTreatment string
+	var currency string
+	var validUntil *time.Time
 
 	if strings.Contains(strings.ToLower(c.Get("Content-Type")), "application/json") {
 		var in InvoiceCreateDTO
@@ -268,29 +1031,33 @@ func CreateInvoice(c *fiber.Ctx) error {
 		}
 		utils.NormalizeDTO(&in)
 
-		switch strings.ToLower(strings.TrimSpace(in.Type)) {
-		case "quotation":
-			draft = true
-		case "invoice":
-			draft = false
-		default:
-			if in.Draft != nil {
-				draft = *in.Draft
-			}
+		docType, invoiceType, err = documentType(in.Type, in.Draft != nil && *in.Draft)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
 		}
-		items, subtotal, taxTotal = toItems(in.Items, 0.2)
+		lines = in.Items
 		customerID = in.CustomerID
+		downPaymentIDs = in.DownPaymentIDs
+		termDays = in.PaymentTermDays
+		skontoRate, skontoDays = in.SkontoRate, in.SkontoDays
+		taxTreatment = in.TaxTreatment
+		currency = in.Currency
+		if discount, err = newDocumentDiscount(in.DiscountRate, in.DiscountAmount); err != nil {
+			return err
+		}
+		if validUntil, err = parseValidUntil(in.ValidUntil); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
 	} else {
 		// legacy form
 		var data map[string]string
 		if err := c.BodyParser(&data); err != nil {
 			return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
 		}
-		if v := strings.TrimSpace(data["type"]); v != "" {
-			draft = strings.ToLower(v) == "quotation"
-		} else {
-			d, _ := strconv.ParseBool(data["draft"])
-			draft = d
+		legacyDraft, _ := strconv.ParseBool(data["draft"])
+		docType, invoiceType, err = documentType(data["type"], legacyDraft)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
 		}
 		cid, err := strconv.Atoi(data["customer_id"])
 		if err != nil || cid <= 0 {
@@ -298,42 +1065,57 @@ func CreateInvoice(c *fiber.Ctx) error {
 		}
 		customerID = uint(cid)
 		var e error
-		items, subtotal, taxTotal, e = extractInvoiceItems(data)
+		lines, e = extractInvoiceItems(data)
 		if e != nil {
 			return fiber.NewError(fiber.StatusBadRequest, e.Error())
 		}
+		if termDays, e = parseTermDays(data["payment_term_days"]); e != nil {
+			return fiber.NewError(fiber.StatusBadRequest, e.Error())
+		}
+		if skontoRate, skontoDays, e = parseSkontoForm(data); e != nil {
+			return fiber.NewError(fiber.StatusBadRequest, e.Error())
+		}
+		if discount, e = parseDiscountForm(data); e != nil {
+			return fiber.NewError(fiber.StatusBadRequest, e.Error())
+		}
+		if taxTreatment = strings.TrimSpace(data["tax_treatment"]); taxTreatment != "" && !validTaxTreatment(taxTreatment) {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid tax_treatment")
+		}
+		if v := strings.TrimSpace(data["currency"]); v != "" {
+			if currency, e = parseCurrency(v); e != nil {
+				return fiber.NewError(fiber.StatusBadRequest, e.Error())
+			}
+		}
+		if downPaymentIDs, e = parseIDList(data["down_payment_ids"], "down_payment_ids"); e != nil {
+			return fiber.NewError(fiber.StatusBadRequest, e.Error())
+		}
+		if validUntil, e = parseValidUntil(data["valid_until"]); e != nil {
+			return fiber.NewError(fiber.StatusBadRequest, e.Error())
+		}
 	}
 
-	total := utils.Round2(subtotal + taxTotal)
+	if discount == nil {
+		discount = &documentDiscount{}
+	}
 
 	var out models.Invoice
 	err = db.Transaction(func(tx *gorm.DB) error {
-		// Validate all article IDs exist & active
-		if err := validateArticleRefs(tx, items, true); err != nil {
-			return err
-		}
-
-		invoice := models.Invoice{
-			InvoiceNumber: "",
-			CId:           customerID,
-			Items:         items,
-			Subtotal:      utils.Round2(subtotal),
-			TaxTotal:      utils.Round2(taxTotal),
-			Total:         total,
-			Draft:         draft,
-			Published:     false,
-			PublishedAt:   nil,
-			PaidTotal:     0,
-			Version:       1, // start optimistic-lock version at 1
-		}
-		if err := tx.Create(&invoice).Error; err != nil {
-			return err
-		}
-		if err := snapshotInvoice(tx, &invoice); err != nil {
-			return err
-		}
-		out = invoice
-		return nil
+		var err error
+		out, err = createInvoiceTx(tx, tenantSchema(c), newInvoice{
+			DocumentType:    docType,
+			InvoiceType:     invoiceType,
+			CustomerID:      customerID,
+			Lines:           lines,
+			DownPaymentIDs:  downPaymentIDs,
+			PaymentTermDays: termDays,
+			SkontoRate:      skontoRate,
+			SkontoDays:      skontoDays,
+			Discount:        *discount,
+			TaxTreatment:    taxTreatment,
+			Currency:        currency,
+			ValidUntil:      validUntil,
+		}, requestActor(c))
+		return err
 	})
 	if err != nil {
 		return err
@@ -355,12 +1137,27 @@ func UpdateInvoice(c *fiber.Ctx) error {
 
 	// Ensure exists (clean 404)
 	var existing models.Invoice
-	if err := db.Preload("Items").First(&existing, "id = ?", id).Error; err != nil {
+	if err := db.Preload("Items").Preload("Deductions").First(&existing, "id = ?", id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return fiber.NewError(fiber.StatusNotFound, "invoice not found")
 		}
 		return fiber.NewError(fiber.StatusInternalServerError, "db error")
 	}
+	if existing.Published {
+		return errPublishedReadOnly
+	}
+
+	var clientVersion uint
+	var customerID *uint
+	var termDays *int
+	var skontoRate *float64
+	var skontoDays *int
+	var downPaymentIDs *[]uint
+	var discount *documentDiscount
+	var taxTreatment *string
+	var currency *string
+	var validUntil *string
+	var items *[]InvoiceItemDTO
 
 	// JSON (pointer DTO) preferred; legacy form kept for compatibility
 	if strings.Contains(strings.ToLower(c.Get("Content-Type")), "application/json") {
@@ -369,140 +1166,361 @@ func UpdateInvoice(c *fiber.Ctx) error {
 			return err
 		}
 		utils.NormalizePtrDTO(&in)
+		if discount, err = newDocumentDiscount(in.DiscountRate, in.DiscountAmount); err != nil {
+			return err
+		}
 
-		var newItems []models.InvoiceItem
-		var subtotal, taxTotal float64
-		itemsProvided := in.Items != nil
-		if itemsProvided {
+		clientVersion = in.Version
+		customerID = in.CustomerID
+		taxTreatment = in.TaxTreatment
+		currency = in.Currency
+		termDays = in.PaymentTermDays
+		skontoRate = in.SkontoRate
+		skontoDays = in.SkontoDays
+		downPaymentIDs = in.DownPaymentIDs
+		validUntil = in.ValidUntil
+		if in.Items != nil {
 			// validate each item
 			for _, it := range *in.Items {
 				if err := middlewares.ValidateStruct(it); err != nil {
 					return err
 				}
 			}
-			newItems, subtotal, taxTotal = toItems(*in.Items, 0.2)
+			items = in.Items
 		}
-
-		type invoicePatch struct {
-			CId      *uint    `gorm:"column:c_id"`
-			Subtotal *float64 `gorm:"column:subtotal"`
-			TaxTotal *float64 `gorm:"column:tax_total"`
-			Total    *float64 `gorm:"column:total"`
+	} else {
+		// ---- Legacy form path ----
+		var data map[string]string
+		if err := c.BodyParser(&data); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
 		}
-		var patch invoicePatch
-		if in.CustomerID != nil {
-			patch.CId = in.CustomerID
+		v, err := strconv.Atoi(data["version"])
+		if err != nil || v <= 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "version is required")
 		}
-		if itemsProvided {
-			st := utils.Round2(subtotal)
-			tt := utils.Round2(taxTotal)
-			t := utils.Round2(subtotal + taxTotal)
-			patch.Subtotal = &st
-			patch.TaxTotal = &tt
-			patch.Total = &t
-		}
-
-		// perform atomic update with version check + optional items replace + snapshot
-		err = db.Transaction(func(tx *gorm.DB) error {
-			if itemsProvided {
-				if err := validateArticleRefs(tx, newItems, true); err != nil {
-					return err
-				}
-			}
+		clientVersion = uint(v)
 
-			res := tx.Model(&models.Invoice{}).
-				Where("id = ? AND version = ?", id, in.Version).
-				Updates(map[string]any{
-					"c_id":      patch.CId,
-					"subtotal":  patch.Subtotal,
-					"tax_total": patch.TaxTotal,
-					"total":     patch.Total,
-					"version":   gorm.Expr("version + 1"),
-				})
-			if res.Error != nil {
-				return res.Error
-			}
-			if res.RowsAffected == 0 {
-				return fiber.NewError(fiber.StatusConflict, "stale update, please reload")
-			}
+		cid, err := strconv.Atoi(data["customer_id"])
+		if err != nil || cid <= 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid customer id")
+		}
+		ucid := uint(cid)
+		customerID = &ucid
 
-			if itemsProvided {
-				if err := tx.Model(&existing).Association("Items").Replace(newItems); err != nil {
-					return err
-				}
+		lines, e := extractInvoiceItems(data)
+		if e != nil {
+			return fiber.NewError(fiber.StatusBadRequest, e.Error())
+		}
+		items = &lines
+		if termDays, e = parseTermDays(data["payment_term_days"]); e != nil {
+			return fiber.NewError(fiber.StatusBadRequest, e.Error())
+		}
+		if skontoRate, skontoDays, e = parseSkontoForm(data); e != nil {
+			return fiber.NewError(fiber.StatusBadRequest, e.Error())
+		}
+		if discount, e = parseDiscountForm(data); e != nil {
+			return fiber.NewError(fiber.StatusBadRequest, e.Error())
+		}
+		if v := strings.TrimSpace(data["tax_treatment"]); v != "" {
+			if !validTaxTreatment(v) {
+				return fiber.NewError(fiber.StatusBadRequest, "invalid tax_treatment")
 			}
-
-			var out models.Invoice
-			if err := tx.Preload(clause.Associations).First(&out, "id = ?", id).Error; err != nil {
-				return err
+			taxTreatment = &v
+		}
+		if v := strings.TrimSpace(data["currency"]); v != "" {
+			code, e := parseCurrency(v)
+			if e != nil {
+				return fiber.NewError(fiber.StatusBadRequest, e.Error())
 			}
-			return snapshotInvoice(tx, &out)
-		})
-		if err != nil {
-			return err
+			currency = &code
+		}
+		if v := strings.TrimSpace(data["down_payment_ids"]); v != "" {
+			ids, e := parseIDList(v, "down_payment_ids")
+			if e != nil {
+				return fiber.NewError(fiber.StatusBadRequest, e.Error())
+			}
+			downPaymentIDs = &ids
 		}
-		return c.SendStatus(fiber.StatusNoContent)
+		if v, ok := data["valid_until"]; ok {
+			validUntil = &v
+		}
+	}
+	err = updateDraft(db, tenantSchema(c), &existing, draftUpdate{
+		Version:        clientVersion,
+		CustomerID:     customerID,
+		Items:          items,
+		DownPaymentIDs: downPaymentIDs,
+		TermDays:       termDays,
+		SkontoRate:     skontoRate,
+		SkontoDays:     skontoDays,
+		Discount:       discount,
+		TaxTreatment:   taxTreatment,
+		Currency:       currency,
+		ValidUntil:     validUntil,
+	}, requestActor(c), models.VersionUpdate)
+	if err != nil {
+		return err
 	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
 
-	// ---- Legacy form path ----
-	var data map[string]string
-	if err := c.BodyParser(&data); err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+// draftUpdate is a change of a draft document; nil fields stay as they are.
+// Version is the optimistic-lock version the change was made against.
+type draftUpdate struct {
+	Version        uint
+	CustomerID     *uint
+	Items          *[]InvoiceItemDTO
+	DownPaymentIDs *[]uint
+	TermDays       *int
+	SkontoRate     *float64
+	SkontoDays     *int
+	Discount       *documentDiscount
+	TaxTreatment   *string
+	Currency       *string
+	ValidUntil     *string
+}
+
+// updateDraft applies u to a draft under its optimistic lock, recomputing lines and
+// totals, and records a new version.
+func updateDraft(db *gorm.DB, schema string, existing *models.Invoice, u draftUpdate, by actor, action string) error {
+	var lines []InvoiceItemDTO
+	itemsProvided := u.Items != nil
+	if itemsProvided {
+		lines = *u.Items
+	}
+	if u.DownPaymentIDs != nil && existing.InvoiceType != invoiceTypeFinal {
+		return fiber.NewError(fiber.StatusBadRequest, "down_payment_ids only apply to final invoices")
 	}
-	versionStr := data["version"]
-	v, err := strconv.Atoi(versionStr)
-	if err != nil || v <= 0 {
-		return fiber.NewError(fiber.StatusBadRequest, "version is required")
+	var validUntilDate *time.Time
+	if u.ValidUntil != nil {
+		if existing.DocumentType != models.DocumentQuotation {
+			return fiber.NewError(fiber.StatusBadRequest, "valid_until only applies to quotations")
+		}
+		var err error
+		if validUntilDate, err = parseValidUntil(*u.ValidUntil); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
 	}
-	clientVersion := uint(v)
 
-	cid, err := strconv.Atoi(data["customer_id"])
-	if err != nil || cid <= 0 {
-		return fiber.NewError(fiber.StatusBadRequest, "invalid customer id")
+	effectiveDays := existing.PaymentTermDays
+	if u.TermDays != nil {
+		effectiveDays = *u.TermDays
 	}
-	newItems, subtotal, taxTotal, e := extractInvoiceItems(data)
-	if e != nil {
-		return fiber.NewError(fiber.StatusBadRequest, e.Error())
+	skonto := withSkonto(skontoTerms{Rate: existing.SkontoRate, Days: existing.SkontoDays}, u.SkontoRate, u.SkontoDays)
+	if err := checkSkonto(skonto, effectiveDays); err != nil {
+		return err
 	}
-	total := utils.Round2(subtotal + taxTotal)
+	rounding := invoiceRounding(existing)
 
-	err = db.Transaction(func(tx *gorm.DB) error {
-		if err := validateArticleRefs(tx, newItems, true); err != nil {
-			return err
+	// perform atomic update with version check + optional items replace + snapshot
+	return db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]any{
+			"version": gorm.Expr("version + 1"),
+		}
+		if u.CustomerID != nil {
+			updates["c_id"] = *u.CustomerID
+		}
+		if u.TermDays != nil {
+			updates["payment_term_days"] = *u.TermDays
+		}
+		if u.SkontoRate != nil || u.SkontoDays != nil {
+			updates["skonto_rate"] = skonto.Rate
+			updates["skonto_days"] = skonto.Days
+		}
+		if u.ValidUntil != nil {
+			updates["valid_until"] = validUntilDate // "" clears it
+		}
+		// Tax treatment and its notice follow the customer: a new customer brings
+		// its default unless a treatment is given
+		newCustomer := u.CustomerID != nil && *u.CustomerID != existing.CId
+		treatment := existing.TaxTreatment
+		if u.TaxTreatment != nil || newCustomer {
+			cid, requested := existing.CId, existing.TaxTreatment
+			if newCustomer {
+				cid, requested = *u.CustomerID, ""
+			}
+			if u.TaxTreatment != nil {
+				requested = *u.TaxTreatment
+			}
+			var note string
+			var err error
+			if treatment, note, err = taxTreatmentFor(tx, schema, cid, requested); err != nil {
+				return err
+			}
+			updates["tax_treatment"] = treatment
+			updates["tax_note"] = note
+		}
+		if treatment != existing.TaxTreatment && !itemsProvided {
+			// re-rate the current lines; zero-rated ones fall back to their articles' rates
+			lines, itemsProvided = itemLines(existing.Items, !zeroRated(existing.TaxTreatment)), true
+		}
+		// The currency too (amounts are not converted, they are meant in the new currency)
+		docCurrency := existing.Currency
+		if u.Currency != nil || newCustomer {
+			cid, requested := existing.CId, existing.Currency
+			if newCustomer {
+				cid, requested = *u.CustomerID, ""
+			}
+			if u.Currency != nil {
+				requested = *u.Currency
+			}
+			var err error
+			if docCurrency, err = documentCurrency(tx, schema, cid, requested); err != nil {
+				return err
+			}
+			updates["currency"] = docCurrency
+		}
+
+		items := existing.Items
+		if itemsProvided {
+			var err error
+			if items, err = buildItems(tx, lines, rounding, treatment); err != nil {
+				return err
+			}
+			if err := validateArticleRefs(tx, items, true); err != nil {
+				return err
+			}
+		}
+
+		// Totals follow the lines and the document discount
+		rededuct := existing.InvoiceType == invoiceTypeFinal &&
+			(itemsProvided || u.Discount != nil || u.DownPaymentIDs != nil || u.CustomerID != nil || docCurrency != existing.Currency)
+		var breakdown []models.TaxLine
+		if itemsProvided || u.Discount != nil || rededuct {
+			d := invoiceDiscount(existing)
+			if u.Discount != nil {
+				d = *u.Discount
+			}
+			var subtotal, taxTotal, amount utils.Money
+			var err error
+			if breakdown, subtotal, taxTotal, amount, err = documentTotals(items, d, rounding); err != nil {
+				return err
+			}
+			updates["subtotal"] = subtotal
+			updates["tax_total"] = taxTotal
+			updates["total"] = subtotal + taxTotal
+			updates["tax_breakdown"] = datatypes.NewJSONSlice(breakdown)
+			updates["discount_rate"] = d.Rate
+			updates["discount"] = amount
+		}
+
+		// Final invoices: re-check the deducted down payments and the remaining amounts
+		var deductions []models.InvoiceDeduction
+		if rededuct {
+			ids, cid := deductionIDs(existing.Deductions), existing.CId
+			if u.DownPaymentIDs != nil {
+				ids = *u.DownPaymentIDs
+			}
+			if u.CustomerID != nil {
+				cid = *u.CustomerID
+			}
+			var err error
+			if deductions, err = buildDeductions(tx, cid, existing.ID, docCurrency, ids); err != nil {
+				return err
+			}
+			subtotal, taxTotal, total, breakdown, err := finalTotals(breakdown, deductions)
+			if err != nil {
+				return err
+			}
+			updates["subtotal"] = subtotal
+			updates["tax_total"] = taxTotal
+			updates["total"] = total
+			updates["tax_breakdown"] = datatypes.NewJSONSlice(breakdown)
 		}
 
 		res := tx.Model(&models.Invoice{}).
-			Where("id = ? AND version = ?", id, clientVersion).
-			Updates(map[string]any{
-				"c_id":      uint(cid),
-				"subtotal":  utils.Round2(subtotal),
-				"tax_total": utils.Round2(taxTotal),
-				"total":     total,
-				"version":   gorm.Expr("version + 1"),
-			})
+			Where("id = ? AND version = ? AND published = ?", existing.ID, u.Version, false).
+			Updates(updates)
 		if res.Error != nil {
 			return res.Error
 		}
 		if res.RowsAffected == 0 {
+			// Either someone bumped the version or the invoice got published meanwhile
+			var published bool
+			if err := tx.Model(&models.Invoice{}).Select("published").Where("id = ?", existing.ID).Scan(&published).Error; err == nil && published {
+				return errPublishedReadOnly
+			}
 			return fiber.NewError(fiber.StatusConflict, "stale update, please reload")
 		}
 
-		if err := tx.Model(&existing).Association("Items").Replace(newItems); err != nil {
-			return err
+		if itemsProvided {
+			if err := tx.Model(existing).Association("Items").Replace(items); err != nil {
+				return err
+			}
+		}
+		if rededuct {
+			if err := tx.Where("invoice_id = ?", existing.ID).Delete(&models.InvoiceDeduction{}).Error; err != nil {
+				return err
+			}
+			for i := range deductions {
+				deductions[i].InvoiceID = existing.ID
+			}
+			if err := tx.Create(&deductions).Error; err != nil {
+				return err
+			}
 		}
+
 		var out models.Invoice
-		if err := tx.Preload(clause.Associations).First(&out, "id = ?", id).Error; err != nil {
+		if err := tx.Preload(clause.Associations).First(&out, "id = ?", existing.ID).Error; err != nil {
 			return err
 		}
-		return snapshotInvoice(tx, &out)
+		return snapshotInvoice(tx, &out, by, action)
 	})
-	if err != nil {
-		return err
-	}
-	return c.SendStatus(fiber.StatusNoContent)
 }
 
-// GET /api/invoices?type=quotation|invoice|published&limit=50&offset=0
+// Payment status is derived in SQL so lists can be filtered and sorted on it.
+// Open balance = total + published credit notes (negative) - payments.
+const (
+	invoiceOpenSQL = `(invoices.total - invoices.paid_total + COALESCE((SELECT SUM(cn.total) FROM invoices cn
+		WHERE cn.corrects_id = invoices.id AND cn.published), 0))`
+	invoiceIssuedSQL = `(invoices.published AND invoices.document_type = 'invoice')`
+)
+
+var (
+	invoiceOpenAmountSQL    = "CASE WHEN " + invoiceIssuedSQL + " THEN " + invoiceOpenSQL + " END"
+	invoicePaymentStatusSQL = "CASE WHEN NOT " + invoiceIssuedSQL + " THEN ''" +
+		" WHEN " + invoiceOpenSQL + " < 0 THEN 'overpaid'" +
+		" WHEN invoices.cancelled THEN 'cancelled'" +
+		" WHEN " + invoiceOpenSQL + " = 0 THEN 'paid'" +
+		" WHEN invoices.collection_pending THEN 'collection_pending'" +
+		" WHEN invoices.due_date::date < CURRENT_DATE THEN 'overdue'" +
+		" WHEN invoices.paid_total > 0 THEN 'partially_paid'" +
+		" ELSE 'open' END"
+)
+
+var paymentStatuses = map[string]bool{
+	"open": true, "partially_paid": true, "paid": true, "overpaid": true, "overdue": true, "cancelled": true,
+	"collection_pending": true,
+}
+
+// Sort keys accepted by GetInvoices (prefix "-" for descending)
+var invoiceSortColumns = map[string]string{
+	"id":       "invoices.id",
+	"number":   "COALESCE(NULLIF(invoices.invoice_number, ''), NULLIF(invoices.document_number, ''), invoices.quotation_number)",
+	"date":     "COALESCE(invoices.published_at, invoices.created_at)",
+	"due_date": "invoices.due_date",
+	"total":    "invoices.total",
+	"open":     invoiceOpenAmountSQL,
+	"status":   invoicePaymentStatusSQL,
+	"customer": "invoices.c_id",
+}
+
+// withPaymentStatus selects the derived open amount and payment status.
+func withPaymentStatus(q *gorm.DB) *gorm.DB {
+	return q.Select("invoices.*, " + invoiceOpenAmountSQL + " AS open_amount, " + invoicePaymentStatusSQL + " AS payment_status")
+}
+
+// GET /api/invoices?type=quotation|order_confirmation|delivery_note|invoice|credit_note|down_payment|final|published
+//
+//	&state=draft|finalized&quotation_status=sent,accepted,declined,expired&source_id=1
+//	&status=open,partially_paid,paid,overpaid,overdue,cancelled,collection_pending
+//	&customer_id=1&q=RE-2025&date_from=2025-01-01&date_to=2025-12-31
+//	&due_from=...&due_to=...&min_total=&max_total=&min_open=&max_open=
+//	&sort=-date&limit=50&offset=0
+//
+// "type" filters by document type (down_payment/final: invoices of that invoice type,
+// published: issued invoices); "state" by lifecycle.
+// Dates are inclusive (YYYY-MM-DD); "date" is the issue date (published_at, else created_at).
 func GetInvoices(c *fiber.Ctx) error {
 	var invoices []models.Invoice
 
@@ -515,16 +1533,116 @@ func GetInvoices(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
 	}
 
-	q := db.Model(&models.Invoice{}).Preload("Customer")
+	q := withPaymentStatus(db.Model(&models.Invoice{})).Preload("Customer")
 	switch typ {
-	case "quotation":
-		q = q.Where("draft = ?", true)
-	case "invoice":
-		q = q.Where("draft = ? AND published = ?", false, false)
+	case "":
+	case models.DocumentQuotation, models.DocumentOrderConfirmation, models.DocumentDeliveryNote,
+		models.DocumentInvoice, models.DocumentCreditNote:
+		q = q.Where("invoices.document_type = ?", typ)
 	case "published":
-		q = q.Where("published = ?", true)
+		q = q.Where(invoiceIssuedSQL)
+	case invoiceTypeDownPayment, invoiceTypeFinal:
+		q = q.Where("invoices.document_type = ? AND invoices.invoice_type = ?", models.DocumentInvoice, typ)
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "invalid type: "+typ)
+	}
+	switch state := strings.ToLower(strings.TrimSpace(c.Query("state"))); state {
+	case "":
+	case "draft":
+		q = q.Where("NOT invoices.published")
+	case "finalized":
+		q = q.Where("invoices.published")
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "invalid state: "+state)
+	}
+
+	if s := strings.TrimSpace(c.Query("status")); s != "" {
+		var statuses []string
+		for _, st := range strings.Split(strings.ToLower(s), ",") {
+			st = strings.TrimSpace(st)
+			if !paymentStatuses[st] {
+				return fiber.NewError(fiber.StatusBadRequest, "invalid status: "+st)
+			}
+			statuses = append(statuses, st)
+		}
+		q = q.Where(invoicePaymentStatusSQL+" IN ?", statuses)
+	}
+	if s := strings.TrimSpace(c.Query("customer_id")); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid customer_id")
+		}
+		q = q.Where("invoices.c_id = ?", id)
+	}
+	if s := strings.TrimSpace(c.Query("quotation_status")); s != "" {
+		var statuses []string
+		for _, st := range strings.Split(strings.ToLower(s), ",") {
+			st = strings.TrimSpace(st)
+			if !quotationStatuses[st] {
+				return fiber.NewError(fiber.StatusBadRequest, "invalid quotation_status: "+st)
+			}
+			statuses = append(statuses, st)
+		}
+		q = q.Where("invoices.quotation_status IN ?", statuses)
+	}
+	if s := strings.TrimSpace(c.Query("source_id")); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid source_id")
+		}
+		q = q.Where("invoices.source_id = ?", id)
+	}
+	if s := strings.TrimSpace(c.Query("q")); s != "" {
+		like := "%" + strings.ToLower(s) + "%"
+		q = q.Where("LOWER(invoices.invoice_number) LIKE ? OR LOWER(invoices.quotation_number) LIKE ? OR LOWER(invoices.document_number) LIKE ?",
+			like, like, like)
+	}
+
+	dateFilters := []struct{ param, cond string }{
+		{"date_from", "COALESCE(invoices.published_at, invoices.created_at)::date >= ?"},
+		{"date_to", "COALESCE(invoices.published_at, invoices.created_at)::date <= ?"},
+		{"due_from", "invoices.due_date::date >= ?"},
+		{"due_to", "invoices.due_date::date <= ?"},
+	}
+	for _, f := range dateFilters {
+		if s := strings.TrimSpace(c.Query(f.param)); s != "" {
+			d, err := parseDate(s)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "invalid "+f.param+" (YYYY-MM-DD)")
+			}
+			q = q.Where(f.cond, d.Format("2006-01-02"))
+		}
+	}
+	amountFilters := []struct{ param, cond string }{
+		{"min_total", "invoices.total >= ?"},
+		{"max_total", "invoices.total <= ?"},
+		{"min_open", invoiceOpenAmountSQL + " >= ?"},
+		{"max_open", invoiceOpenAmountSQL + " <= ?"},
+	}
+	for _, f := range amountFilters {
+		if s := strings.TrimSpace(c.Query(f.param)); s != "" {
+			v, err := utils.ParseMoney(s)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "invalid "+f.param)
+			}
+			q = q.Where(f.cond, v)
+		}
 	}
-	if err := q.Limit(limit).Offset(offset).Find(&invoices).Error; err != nil {
+
+	order := "invoices.id ASC"
+	if s := strings.TrimSpace(c.Query("sort")); s != "" {
+		dir := "ASC"
+		if strings.HasPrefix(s, "-") {
+			dir, s = "DESC", s[1:]
+		}
+		col, ok := invoiceSortColumns[strings.ToLower(s)]
+		if !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid sort: "+s)
+		}
+		order = col + " " + dir + " NULLS LAST, invoices.id " + dir
+	}
+
+	if err := q.Order(order).Limit(limit).Offset(offset).Find(&invoices).Error; err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "db error")
 	}
 	return c.JSON(fiber.Map{"invoices": invoices, "message": "success"})
@@ -543,7 +1661,7 @@ func GetInvoice(c *fiber.Ctx) error {
 	}
 
 	var invoice models.Invoice
-	if err := db.Model(&models.Invoice{}).Preload(clause.Associations).First(&invoice, "id = ?", id).Error; err != nil {
+	if err := withPaymentStatus(db.Model(&models.Invoice{})).Preload(clause.Associations).First(&invoice, "invoices.id = ?", id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return fiber.NewError(fiber.StatusNotFound, "invoice not found")
 		}
@@ -553,19 +1671,21 @@ func GetInvoice(c *fiber.Ctx) error {
 }
 
 // PUT /api/invoices/:id/convert
-// Body: { "target": "quotation" | "invoice" }  — snapshot after convert
+// Body: { "target": "quotation" | "order_confirmation" | "delivery_note" | "invoice" }
+// Changes the type of a draft document — snapshot after convert. Finalized
+// quotations stay as they are; POST /api/quotations/:id/invoice copies them instead.
 func ConvertInvoice(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil || id <= 0 {
 		return fiber.NewError(fiber.StatusBadRequest, "invalid invoice id")
 	}
 	var body struct {
-		Target string `json:"target" validate:"required,oneof=quotation invoice"`
+		Target string `json:"target" validate:"required,oneof=quotation order_confirmation delivery_note invoice"`
 	}
 	if err := middlewares.BindAndValidate(c, &body); err != nil {
 		return err
 	}
-	newDraft := strings.ToLower(strings.TrimSpace(body.Target)) == "quotation"
+	target := strings.ToLower(strings.TrimSpace(body.Target))
 
 	db, err := database.GetTenantDB(c)
 	if err != nil {
@@ -574,41 +1694,49 @@ func ConvertInvoice(c *fiber.Ctx) error {
 
 	var out models.Invoice
 	err = db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Model(&models.Invoice{}).Where("id = ?", id).Update("draft", newDraft).Error; err != nil {
+		var inv models.Invoice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&inv, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if inv.Published {
+			return errPublishedReadOnly
+		}
+		if inv.DocumentType == models.DocumentCreditNote {
+			return fiber.NewError(fiber.StatusConflict, "credit notes cannot be converted")
+		}
+		if target != models.DocumentInvoice && inv.InvoiceType != invoiceTypeStandard {
+			return fiber.NewError(fiber.StatusConflict, "down-payment and final invoices cannot change their document type")
+		}
+		updates := map[string]any{"document_type": target}
+		if target != models.DocumentQuotation {
+			updates["valid_until"] = nil
+		}
+		if err := tx.Model(&models.Invoice{}).Where("id = ?", id).Updates(updates).Error; err != nil {
 			return err
 		}
 		if err := tx.Preload(clause.Associations).First(&out, "id = ?", id).Error; err != nil {
 			return err
 		}
-		return snapshotInvoice(tx, &out)
+		return snapshotInvoice(tx, &out, requestActor(c), models.VersionConvert)
 	})
 	if err != nil {
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			return err
+		}
 		return fiber.NewError(fiber.StatusBadRequest, "conversion failed")
 	}
 	return c.JSON(out)
 }
 
 // PUT /api/invoices/:id/publish
-// Assign number if absent; mark published; snapshot (no version bump)
+// Assign the next gapless number if absent; mark published; snapshot (no version bump)
 func PublishInvoice(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil || id <= 0 {
 		return fiber.NewError(fiber.StatusBadRequest, "invalid invoice id")
 	}
 
-	var payload struct {
-		InvoiceNumber *string `json:"invoice_number" validate:"omitempty"`
-	}
-	_ = json.Unmarshal(c.Body(), &payload)
-	if payload.InvoiceNumber != nil {
-		trim := strings.TrimSpace(*payload.InvoiceNumber)
-		if trim == "" {
-			payload.InvoiceNumber = nil
-		} else {
-			payload.InvoiceNumber = &trim
-		}
-	}
-
 	db, err := database.GetTenantDB(c)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
@@ -616,46 +1744,25 @@ func PublishInvoice(c *fiber.Ctx) error {
 
 	var out models.Invoice
 	err = db.Transaction(func(tx *gorm.DB) error {
-		var inv models.Invoice
-		if err := tx.First(&inv, "id = ?", id).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return fiber.ErrNotFound
-			}
-			return err
-		}
-		now := time.Now().UTC()
-		number := inv.InvoiceNumber
-		if payload.InvoiceNumber != nil {
-			number = *payload.InvoiceNumber
-		}
-		if number == "" {
-			number = generateInvoiceNumber()
-		}
-		if err := tx.Model(&models.Invoice{}).
-			Where("id = ?", id).
-			Updates(map[string]any{
-				"invoice_number": number,
-				"published":      true,
-				"published_at":   &now,
-				"draft":          false,
-			}).Error; err != nil {
-			return err
-		}
-		if err := tx.Preload(clause.Associations).First(&out, "id = ?", id).Error; err != nil {
-			return err
-		}
-		return snapshotInvoice(tx, &out)
+		var err error
+		out, err = publishInvoiceTx(tx, tenantSchema(c), uint(id), requestActor(c))
+		return err
 	})
 	if err != nil {
 		if errors.Is(err, fiber.ErrNotFound) {
 			return fiber.NewError(fiber.StatusNotFound, "invoice not found")
 		}
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			return fe
+		}
 		return fiber.NewError(fiber.StatusBadRequest, "publish failed")
 	}
 	return c.JSON(out)
 }
 
-// GET /api/invoices/:id/versions
+// GET /api/invoices/:id/versions?action=payment&include_snapshot=false
+// The document history: every version with its action, acting user and reason.
 func GetInvoiceVersions(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil || id <= 0 {
@@ -667,8 +1774,18 @@ func GetInvoiceVersions(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
 	}
 
+	query := db.Where("invoice_id = ?", id)
+	if action := strings.ToLower(strings.TrimSpace(c.Query("action"))); action != "" {
+		if !versionActions[action] {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid action: "+action)
+		}
+		query = query.Where("action = ?", action)
+	}
+	if c.Query("include_snapshot") == "false" {
+		query = query.Omit("snapshot")
+	}
 	var versions []models.InvoiceVersion
-	if err := db.Where("invoice_id = ?", id).Order("version_no ASC").Find(&versions).Error; err != nil {
+	if err := query.Order("version_no ASC").Find(&versions).Error; err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "db error")
 	}
 	return c.JSON(fiber.Map{"versions": versions})
@@ -685,13 +1802,9 @@ func CreatePayment(c *fiber.Ctx) error {
 	if err := middlewares.BindAndValidate(c, &in); err != nil {
 		return err
 	}
-	paidAt := time.Now().UTC()
-	if strings.TrimSpace(in.PaidAt) != "" {
-		t, err := time.Parse(time.RFC3339, in.PaidAt)
-		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "invalid paid_at format")
-		}
-		paidAt = t.UTC()
+	paidAt, err := parsePaidAt(in.PaidAt)
+	if err != nil {
+		return err
 	}
 
 	db, err := database.GetTenantDB(c)
@@ -699,41 +1812,41 @@ func CreatePayment(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
 	}
 
-	var payment models.Payment
+	payment := models.Payment{
+		InvoiceID: uint(id),
+		Kind:      paymentKindPayment,
+		Amount:    in.Amount,
+		Method:    strings.TrimSpace(in.Method),
+		Reference: strings.TrimSpace(in.Reference),
+		Note:      strings.TrimSpace(in.Note),
+		PaidAt:    paidAt,
+	}
 	err = db.Transaction(func(tx *gorm.DB) error {
-		var inv models.Invoice
-		if err := tx.First(&inv, "id = ?", id).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return fiber.ErrNotFound
+		return changePayments(tx, uint(id), requestActor(c), func(inv *models.Invoice) error {
+			if in.Currency != "" && in.Currency != inv.Currency {
+				return errCurrencyMismatch
 			}
-			return err
-		}
-		payment = models.Payment{
-			InvoiceID: uint(id),
-			Amount:    utils.Round2(in.Amount),
-			Method:    strings.TrimSpace(in.Method),
-			Reference: strings.TrimSpace(in.Reference),
-			Note:      strings.TrimSpace(in.Note),
-			PaidAt:    paidAt,
-		}
-		if err := tx.Create(&payment).Error; err != nil {
-			return err
-		}
-		if _, err := recalcPaidTotal(tx, uint(id)); err != nil {
-			return err
-		}
-		return snapshotInvoice(tx, &inv)
+			payment.Currency = inv.Currency
+			return tx.Create(&payment).Error
+		})
 	})
 	if err != nil {
 		if errors.Is(err, fiber.ErrNotFound) {
 			return fiber.NewError(fiber.StatusNotFound, "invoice not found")
 		}
+		if errors.Is(err, errCurrencyMismatch) {
+			return fiber.NewError(fiber.StatusBadRequest, "payment currency differs from the invoice currency")
+		}
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			return fe
+		}
 		return fiber.NewError(fiber.StatusBadRequest, "payment failed")
 	}
 	return c.JSON(payment)
 }
 
-// GET /api/invoices/:id/payments
+// GET /api/invoices/:id/payments?include_deleted=true
 func ListPayments(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil || id <= 0 {
@@ -745,15 +1858,13 @@ func ListPayments(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
 	}
 
+	q := db.Where("invoice_id = ?", id)
+	if includeDeleted, _ := strconv.ParseBool(c.Query("include_deleted")); includeDeleted {
+		q = q.Unscoped()
+	}
 	var payments []models.Payment
-	if err := db.Where("invoice_id = ?", id).Order("paid_at ASC, id ASC").Find(&payments).Error; err != nil {
+	if err := q.Order("paid_at ASC, id ASC").Find(&payments).Error; err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "db error")
 	}
 	return c.JSON(fiber.Map{"payments": payments})
 }
-
-// ====== Utils ======
-
-func generateInvoiceNumber() string {
-	return time.Now().Format("20060102-150405.000")
-}
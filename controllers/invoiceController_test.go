@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// totalsLines computes the items like the invoice handlers do.
+func totalsLines(p roundingPolicy, items ...models.InvoiceItem) []models.InvoiceItem {
+	out := make([]models.InvoiceItem, len(items))
+	for i, it := range items {
+		out[i] = p.line(it)
+	}
+	return out
+}
+
+func item(unitPrice utils.Money, qty, rate float64) models.InvoiceItem {
+	return models.InvoiceItem{UnitPrice: unitPrice, Amount: qty, TaxRate: rate}
+}
+
+func TestDocumentTotals(t *testing.T) {
+	lineHalfUp := roundingPolicy{TaxRounding: models.TaxRoundingLine, Mode: utils.RoundHalfUp}
+	docHalfUp := roundingPolicy{TaxRounding: models.TaxRoundingDocument, Mode: utils.RoundHalfUp}
+	lineHalfEven := roundingPolicy{TaxRounding: models.TaxRoundingLine, Mode: utils.RoundHalfEven}
+	docHalfEven := roundingPolicy{TaxRounding: models.TaxRoundingDocument, Mode: utils.RoundHalfEven}
+
+	// three lines of 0.03 at 20%: 0.006 tax each
+	small := []models.InvoiceItem{item(3, 1, 0.2), item(3, 1, 0.2), item(3, 1, 0.2)}
+	// two lines of 0.25 at 10%: 0.025 tax each, a tie per line but not on the sum
+	ties := []models.InvoiceItem{item(25, 1, 0.1), item(25, 1, 0.1)}
+	// two rates with a fixed document discount split over them
+	mixed := []models.InvoiceItem{item(10000, 1, 0.2), item(5000, 1, 0.1)}
+
+	tests := []struct {
+		name     string
+		policy   roundingPolicy
+		items    []models.InvoiceItem
+		discount documentDiscount
+		subtotal utils.Money
+		taxTotal utils.Money
+		applied  utils.Money
+	}{
+		{"per line rounds every line", lineHalfUp, small, documentDiscount{}, 9, 3, 0},
+		{"per document rounds the sum", docHalfUp, small, documentDiscount{}, 9, 2, 0},
+		{"per line half up ties", lineHalfUp, ties, documentDiscount{}, 50, 6, 0},
+		{"per line half even ties", lineHalfEven, ties, documentDiscount{}, 50, 4, 0},
+		{"per document half up", docHalfUp, ties, documentDiscount{}, 50, 5, 0},
+		{"per document half even", docHalfEven, ties, documentDiscount{}, 50, 5, 0},
+		{"fixed discount per line", lineHalfUp, mixed, documentDiscount{Amount: 1000}, 14000, 2334, 1000},
+		{"fixed discount per document", docHalfUp, mixed, documentDiscount{Amount: 1000}, 14000, 2334, 1000},
+		{"discount rate", lineHalfUp, mixed, documentDiscount{Rate: 0.1}, 13500, 2250, 1500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breakdown, subtotal, taxTotal, discount, err := documentTotals(totalsLines(tt.policy, tt.items...), tt.discount, tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subtotal != tt.subtotal || taxTotal != tt.taxTotal || discount != tt.applied {
+				t.Errorf("got subtotal %s, tax %s, discount %s; want %s, %s, %s",
+					subtotal, taxTotal, discount, tt.subtotal, tt.taxTotal, tt.applied)
+			}
+			var net, tax, shares utils.Money
+			for _, l := range breakdown {
+				net, tax, shares = net+l.Net, tax+l.Tax, shares+l.Discount
+				if l.Gross != l.Net+l.Tax {
+					t.Errorf("rate %v: gross %s != net %s + tax %s", l.Rate, l.Gross, l.Net, l.Tax)
+				}
+			}
+			if net != subtotal || tax != taxTotal || shares != discount {
+				t.Errorf("breakdown sums to %s/%s/%s, totals are %s/%s/%s", net, tax, shares, subtotal, taxTotal, discount)
+			}
+		})
+	}
+}
+
+func TestDocumentTotalsDiscountSplit(t *testing.T) {
+	p := roundingPolicy{TaxRounding: models.TaxRoundingLine, Mode: utils.RoundHalfUp}
+	items := totalsLines(p, item(10000, 1, 0.2), item(5000, 1, 0.1))
+	breakdown, _, _, _, err := documentTotals(items, documentDiscount{Amount: 1000}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10.00 split 50:100 over the rates; the last rate takes the remainder
+	want := map[float64]utils.Money{0.1: 333, 0.2: 667}
+	for _, l := range breakdown {
+		if l.Discount != want[l.Rate] {
+			t.Errorf("rate %v: discount %s, want %s", l.Rate, l.Discount, want[l.Rate])
+		}
+	}
+}
+
+func TestDocumentTotalsDiscountExceedsNet(t *testing.T) {
+	p := roundingPolicy{TaxRounding: models.TaxRoundingLine, Mode: utils.RoundHalfUp}
+	if _, _, _, _, err := documentTotals(totalsLines(p, item(500, 1, 0.2)), documentDiscount{Amount: 501}, p); err == nil {
+		t.Error("expected an error for a discount above the net total")
+	}
+}
+
+func TestRequestActorReason(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		header      string
+		want        string
+	}{
+		{"json body", fiber.MIMEApplicationJSON, `{"reason":"Preis für Größe korrigiert","items":[]}`, "", "Preis für Größe korrigiert"},
+		{"body before header", fiber.MIMEApplicationJSON, `{"reason":" Straße geändert "}`, "typo", "Straße geändert"},
+		{"header fallback", fiber.MIMEApplicationJSON, `{"version":3}`, " typo ", "typo"},
+		{"blank body reason", fiber.MIMEApplicationJSON, `{"reason":"  "}`, "typo", "typo"},
+		{"json array body", fiber.MIMEApplicationJSON, `[{"reason":"x"}]`, "batch", "batch"},
+		{"form body", fiber.MIMEApplicationForm, "reason=R%C3%BCckfrage+Kunde", "", "Rückfrage Kunde"},
+		{"no body", "", "", "publish", "publish"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			var got actor
+			app.Post("/", func(c *fiber.Ctx) error {
+				c.Locals("userID", "u1")
+				got = requestActor(c)
+				return nil
+			})
+			req := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set(fiber.HeaderContentType, tt.contentType)
+			}
+			if tt.header != "" {
+				req.Header.Set(changeReasonHeader, tt.header)
+			}
+			if _, err := app.Test(req); err != nil {
+				t.Fatal(err)
+			}
+			if got.UserID != "u1" || got.Reason != tt.want {
+				t.Errorf("actor = %+v, want reason %q", got, tt.want)
+			}
+		})
+	}
+}
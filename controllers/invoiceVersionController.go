@@ -0,0 +1,347 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"fakturierung-backend/database"
+	"fakturierung-backend/middlewares"
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ===== DTOs =====
+
+// Restores the version's content onto the draft last read at Version.
+type VersionRestoreDTO struct {
+	Version uint `json:"version" validate:"required,gt=0"`
+}
+
+// VersionFieldChange is one field that differs between two versions (JSON values).
+type VersionFieldChange struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from"`
+	To    json.RawMessage `json:"to"`
+}
+
+// VersionItemChange is a line present in both versions with differing fields;
+// Position is its 1-based position in the newer version.
+type VersionItemChange struct {
+	Position  int                  `json:"position"`
+	ArticleID string               `json:"article_id"`
+	Changes   []VersionFieldChange `json:"changes"`
+}
+
+type VersionTotalDelta struct {
+	From  utils.Money `json:"from"`
+	To    utils.Money `json:"to"`
+	Delta utils.Money `json:"delta"`
+}
+
+type InvoiceVersionDiff struct {
+	InvoiceID uint                 `json:"invoice_id"`
+	From      int                  `json:"from"`
+	To        int                  `json:"to"`
+	Fields    []VersionFieldChange `json:"fields"`
+	Items     struct {
+		Added   []models.InvoiceItem `json:"added"`
+		Removed []models.InvoiceItem `json:"removed"`
+		Changed []VersionItemChange  `json:"changed"`
+	} `json:"items"`
+	Totals struct {
+		Subtotal  VersionTotalDelta `json:"subtotal"`
+		Discount  VersionTotalDelta `json:"discount"`
+		TaxTotal  VersionTotalDelta `json:"tax_total"`
+		Total     VersionTotalDelta `json:"total"`
+		PaidTotal VersionTotalDelta `json:"paid_total"`
+	} `json:"totals"`
+}
+
+// ===== Helpers =====
+
+// Snapshot fields left out of the header comparison: lines and amounts have their
+// own sections, deductions are compared by their down-payment invoices.
+var diffSkipHeader = map[string]bool{
+	"items": true, "payments": true, "deductions": true, "tax_breakdown": true,
+	"subtotal": true, "discount": true, "tax_total": true, "total": true, "paid_total": true,
+}
+
+// versionActions are the actions a version can be filtered by (models.Version*).
+var versionActions = map[string]bool{
+	models.VersionCreate: true, models.VersionUpdate: true, models.VersionRestore: true, models.VersionConvert: true,
+	models.VersionPublish: true, models.VersionPayment: true, models.VersionCredit: true, models.VersionStatus: true,
+}
+
+// Line fields left out of the line comparison (row ids change on every update).
+var diffSkipItem = map[string]bool{"id": true}
+
+// loadVersion returns version no of the invoice with its decoded snapshot.
+func loadVersion(db *gorm.DB, invoiceID, no int) (models.InvoiceVersion, versionSnapshot, error) {
+	var v models.InvoiceVersion
+	var snap versionSnapshot
+	if err := db.Where("invoice_id = ? AND version_no = ?", invoiceID, no).First(&v).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return v, snap, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("version %d not found", no))
+		}
+		return v, snap, err
+	}
+	if err := json.Unmarshal(v.Snapshot, &snap); err != nil {
+		return v, snap, err
+	}
+	return v, snap, nil
+}
+
+// jsonFields flattens v's top-level JSON fields, without the skipped ones.
+func jsonFields(v any, skip map[string]bool) (map[string]json.RawMessage, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	for k := range skip {
+		delete(fields, k)
+	}
+	return fields, nil
+}
+
+// fieldChanges lists the fields whose JSON differs, by name; a missing field is null.
+func fieldChanges(from, to map[string]json.RawMessage) []VersionFieldChange {
+	names := make(map[string]bool, len(from))
+	for k := range from {
+		names[k] = true
+	}
+	for k := range to {
+		names[k] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for k := range names {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	null := json.RawMessage("null")
+	out := []VersionFieldChange{}
+	for _, k := range sorted {
+		a, ok := from[k]
+		if !ok {
+			a = null
+		}
+		b, ok := to[k]
+		if !ok {
+			b = null
+		}
+		if !bytes.Equal(a, b) {
+			out = append(out, VersionFieldChange{Field: k, From: a, To: b})
+		}
+	}
+	return out
+}
+
+// snapshotHeader returns the header fields of a snapshot for comparison.
+func snapshotHeader(s versionSnapshot) (map[string]json.RawMessage, error) {
+	fields, err := jsonFields(s, diffSkipHeader)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := json.Marshal(deductionIDs(s.Deductions))
+	if err != nil {
+		return nil, err
+	}
+	fields["down_payment_ids"] = ids
+	return fields, nil
+}
+
+// diffItems pairs the lines of both versions by article, in order of appearance, so
+// inserting or removing a line does not show every following line as changed.
+func diffItems(d *InvoiceVersionDiff, from, to []models.InvoiceItem) error {
+	unmatched := make(map[string][]int)
+	for i, it := range from {
+		unmatched[it.ArticleID] = append(unmatched[it.ArticleID], i)
+	}
+	paired := make([]bool, len(from))
+	for j, it := range to {
+		queue := unmatched[it.ArticleID]
+		if len(queue) == 0 {
+			d.Items.Added = append(d.Items.Added, it)
+			continue
+		}
+		i := queue[0]
+		unmatched[it.ArticleID] = queue[1:]
+		paired[i] = true
+		a, err := jsonFields(from[i], diffSkipItem)
+		if err != nil {
+			return err
+		}
+		b, err := jsonFields(it, diffSkipItem)
+		if err != nil {
+			return err
+		}
+		if changes := fieldChanges(a, b); len(changes) > 0 {
+			d.Items.Changed = append(d.Items.Changed, VersionItemChange{Position: j + 1, ArticleID: it.ArticleID, Changes: changes})
+		}
+	}
+	for i, it := range from {
+		if !paired[i] {
+			d.Items.Removed = append(d.Items.Removed, it)
+		}
+	}
+	return nil
+}
+
+func totalDelta(from, to utils.Money) VersionTotalDelta {
+	return VersionTotalDelta{From: from, To: to, Delta: to - from}
+}
+
+// diffVersions compares two snapshots: header fields, lines and totals.
+func diffVersions(invoiceID uint, fromNo, toNo int, from, to versionSnapshot) (InvoiceVersionDiff, error) {
+	d := InvoiceVersionDiff{InvoiceID: invoiceID, From: fromNo, To: toNo}
+	a, err := snapshotHeader(from)
+	if err != nil {
+		return d, err
+	}
+	b, err := snapshotHeader(to)
+	if err != nil {
+		return d, err
+	}
+	d.Fields = fieldChanges(a, b)
+
+	d.Items.Added, d.Items.Removed, d.Items.Changed = []models.InvoiceItem{}, []models.InvoiceItem{}, []VersionItemChange{}
+	if err := diffItems(&d, from.Items, to.Items); err != nil {
+		return d, err
+	}
+
+	d.Totals.Subtotal = totalDelta(from.Subtotal, to.Subtotal)
+	d.Totals.Discount = totalDelta(from.Discount, to.Discount)
+	d.Totals.TaxTotal = totalDelta(from.TaxTotal, to.TaxTotal)
+	d.Totals.Total = totalDelta(from.Total, to.Total)
+	d.Totals.PaidTotal = totalDelta(from.PaidTotal, to.PaidTotal)
+	return d, nil
+}
+
+// restoreUpdate turns a snapshot into the draft update restoring its content onto
+// existing; lines are recomputed, keeping their rates unless zero-rated.
+func restoreUpdate(existing *models.Invoice, s versionSnapshot, version uint) draftUpdate {
+	lines := itemLines(s.Items, !zeroRated(s.TaxTreatment))
+	discount := documentDiscount{Rate: s.DiscountRate}
+	if s.DiscountRate == 0 {
+		discount.Amount = s.Discount
+	}
+	u := draftUpdate{
+		Version:    version,
+		CustomerID: &s.CustomerID,
+		Items:      &lines,
+		TermDays:   &s.PaymentTermDays,
+		SkontoRate: &s.SkontoRate,
+		SkontoDays: &s.SkontoDays,
+		Discount:   &discount,
+	}
+	// versions from before tax treatments / currencies keep the current ones
+	if s.TaxTreatment != "" {
+		u.TaxTreatment = &s.TaxTreatment
+	}
+	if s.Currency != "" {
+		u.Currency = &s.Currency
+	}
+	if existing.InvoiceType == invoiceTypeFinal && len(s.Deductions) > 0 {
+		ids := deductionIDs(s.Deductions)
+		u.DownPaymentIDs = &ids
+	}
+	if existing.DocumentType == models.DocumentQuotation {
+		validUntil := ""
+		if s.ValidUntil != nil {
+			validUntil = s.ValidUntil.Format("2006-01-02")
+		}
+		u.ValidUntil = &validUntil
+	}
+	return u
+}
+
+// ===== Handlers =====
+
+// GET /api/invoices/:id/versions/:a/diff/:b
+// Changes from version a to version b (header fields, lines, total deltas).
+func GetInvoiceVersionDiff(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid invoice id")
+	}
+	a, errA := c.ParamsInt("a")
+	b, errB := c.ParamsInt("b")
+	if errA != nil || errB != nil || a <= 0 || b <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid version number")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	_, from, err := loadVersion(db, id, a)
+	if err != nil {
+		return err
+	}
+	_, to, err := loadVersion(db, id, b)
+	if err != nil {
+		return err
+	}
+	diff, err := diffVersions(uint(id), a, b, from, to)
+	if err != nil {
+		return err
+	}
+	return c.JSON(diff)
+}
+
+// POST /api/invoices/:id/versions/:n/restore — requires optimistic-lock `version`
+// Sets a draft back to the content of version n; recorded as a new version.
+func RestoreInvoiceVersion(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid invoice id")
+	}
+	n, err := c.ParamsInt("n")
+	if err != nil || n <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid version number")
+	}
+	var in VersionRestoreDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var existing models.Invoice
+	if err := db.Preload("Items").Preload("Deductions").First(&existing, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "invoice not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	if existing.Published {
+		return errPublishedReadOnly
+	}
+	v, snap, err := loadVersion(db, id, n)
+	if err != nil {
+		return err
+	}
+	if kind := invoiceKind(&existing); v.Kind != kind {
+		return fiber.NewError(fiber.StatusConflict,
+			fmt.Sprintf("version %d is a %s and cannot be restored onto a %s", n, v.Kind, kind))
+	}
+
+	if err := updateDraft(db, tenantSchema(c), &existing, restoreUpdate(&existing, snap, in.Version), requestActor(c), models.VersionRestore); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+)
+
+func versionLine(id uint, article string, qty float64, unitPrice utils.Money) models.InvoiceItem {
+	return models.InvoiceItem{ID: id, ArticleID: article, Amount: qty, UnitPrice: unitPrice, NetPrice: unitPrice.MulQty(qty, utils.RoundHalfUp)}
+}
+
+func fieldNames(changes []VersionFieldChange) []string {
+	out := make([]string, 0, len(changes))
+	for _, c := range changes {
+		out = append(out, c.Field)
+	}
+	return out
+}
+
+func articles(items []models.InvoiceItem) []string {
+	out := make([]string, 0, len(items))
+	for _, it := range items {
+		out = append(out, it.ArticleID)
+	}
+	return out
+}
+
+func TestDiffVersionsItems(t *testing.T) {
+	a1 := versionLine(1, "A", 1, 1000)
+	b1 := versionLine(2, "B", 2, 500)
+	a2 := versionLine(3, "A", 3, 1000)
+
+	type change struct {
+		position int
+		article  string
+		fields   string
+	}
+	tests := []struct {
+		name     string
+		from, to []models.InvoiceItem
+		added    []string
+		removed  []string
+		changed  []change
+	}{
+		{"unchanged", []models.InvoiceItem{a1, b1}, []models.InvoiceItem{a1, b1}, nil, nil, nil},
+		{"new row ids only", []models.InvoiceItem{a1, b1},
+			[]models.InvoiceItem{versionLine(11, "A", 1, 1000), versionLine(12, "B", 2, 500)}, nil, nil, nil},
+		{"line inserted in front", []models.InvoiceItem{a1, b1},
+			[]models.InvoiceItem{versionLine(0, "C", 1, 100), a1, b1}, []string{"C"}, nil, nil},
+		{"line removed", []models.InvoiceItem{a1, b1}, []models.InvoiceItem{b1}, nil, []string{"A"}, nil},
+		{"reordered lines pair by article", []models.InvoiceItem{a1, b1}, []models.InvoiceItem{b1, a1}, nil, nil, nil},
+		{"quantity changed", []models.InvoiceItem{a1, b1},
+			[]models.InvoiceItem{a1, versionLine(2, "B", 4, 500)}, nil, nil, []change{{2, "B", "amount,net_price"}}},
+		{"same article pairs in order", []models.InvoiceItem{a1, a2},
+			[]models.InvoiceItem{a1, versionLine(3, "A", 5, 1000)}, nil, nil, []change{{2, "A", "amount,net_price"}}},
+		{"surplus same-article line removed", []models.InvoiceItem{a1, a2}, []models.InvoiceItem{a1}, nil, []string{"A"}, nil},
+		{"article swapped", []models.InvoiceItem{a1}, []models.InvoiceItem{versionLine(1, "D", 1, 1000)}, []string{"D"}, []string{"A"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := diffVersions(7, 1, 2, versionSnapshot{Items: tt.from}, versionSnapshot{Items: tt.to})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := articles(d.Items.Added); strings.Join(got, ",") != strings.Join(tt.added, ",") {
+				t.Errorf("added = %v, want %v", got, tt.added)
+			}
+			if got := articles(d.Items.Removed); strings.Join(got, ",") != strings.Join(tt.removed, ",") {
+				t.Errorf("removed = %v, want %v", got, tt.removed)
+			}
+			if len(d.Items.Changed) != len(tt.changed) {
+				t.Fatalf("changed = %+v, want %+v", d.Items.Changed, tt.changed)
+			}
+			for i, w := range tt.changed {
+				g := d.Items.Changed[i]
+				fields := fieldNames(g.Changes)
+				if g.Position != w.position || g.ArticleID != w.article || strings.Join(fields, ",") != w.fields {
+					t.Errorf("change %d = %d/%s/%v, want %d/%s/%s", i, g.Position, g.ArticleID, fields, w.position, w.article, w.fields)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffVersionsHeaderAndTotals(t *testing.T) {
+	from := versionSnapshot{
+		CustomerID: 1, Currency: "EUR", Subtotal: 10000, Discount: 0, TaxTotal: 2000, Total: 12000, PaidTotal: 0,
+		Deductions: []models.InvoiceDeduction{{ID: 1, DownPaymentID: 40}},
+	}
+	to := from
+	to.CustomerID = 2
+	to.Subtotal, to.Discount, to.TaxTotal, to.Total, to.PaidTotal = 9000, 1000, 1800, 10800, 5000
+	to.Deductions = []models.InvoiceDeduction{{ID: 9, DownPaymentID: 40}, {ID: 10, DownPaymentID: 41}}
+
+	d, err := diffVersions(7, 3, 5, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.InvoiceID != 7 || d.From != 3 || d.To != 5 {
+		t.Errorf("header = %d %d->%d", d.InvoiceID, d.From, d.To)
+	}
+	// amounts are only reported as totals, deduction rows by their down-payment invoices
+	if got := strings.Join(fieldNames(d.Fields), ","); got != "customer_id,down_payment_ids" {
+		t.Fatalf("fields = %s", got)
+	}
+	if c := d.Fields[1]; string(c.From) != "[40]" || string(c.To) != "[40,41]" {
+		t.Errorf("down_payment_ids %s -> %s", c.From, c.To)
+	}
+	if c := d.Fields[0]; string(c.From) != "1" || string(c.To) != "2" {
+		t.Errorf("customer_id %s -> %s", c.From, c.To)
+	}
+
+	tests := []struct {
+		name string
+		got  VersionTotalDelta
+		want VersionTotalDelta
+	}{
+		{"subtotal", d.Totals.Subtotal, VersionTotalDelta{10000, 9000, -1000}},
+		{"discount", d.Totals.Discount, VersionTotalDelta{0, 1000, 1000}},
+		{"tax total", d.Totals.TaxTotal, VersionTotalDelta{2000, 1800, -200}},
+		{"total", d.Totals.Total, VersionTotalDelta{12000, 10800, -1200}},
+		{"paid total", d.Totals.PaidTotal, VersionTotalDelta{0, 5000, 5000}},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %+v, want %+v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+// Empty sections are reported as [] rather than null.
+func TestDiffVersionsEmptySections(t *testing.T) {
+	d, err := diffVersions(1, 1, 1, versionSnapshot{}, versionSnapshot{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Fields json.RawMessage `json:"fields"`
+		Items  map[string]json.RawMessage
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Fields) != "[]" || string(out.Items["added"]) != "[]" || string(out.Items["removed"]) != "[]" || string(out.Items["changed"]) != "[]" {
+		t.Errorf("empty diff = %s", raw)
+	}
+}
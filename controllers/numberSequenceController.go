@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"fakturierung-backend/database"
+	"fakturierung-backend/middlewares"
+	"fakturierung-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Sequence kinds
+const (
+	sequenceInvoice           = "invoice"
+	sequenceQuotation         = "quotation"
+	sequenceCreditNote        = "credit_note"
+	sequenceOrderConfirmation = "order_confirmation"
+	sequenceDeliveryNote      = "delivery_note"
+)
+
+// ===== DTOs =====
+
+// Pointer-based partial update; requires optimistic-lock version
+type NumberSequenceUpdateDTO struct {
+	Version     uint    `json:"version" validate:"required,gt=0"`
+	Prefix      *string `json:"prefix" validate:"omitempty,max=20"`
+	Format      *string `json:"format" validate:"omitempty,min=1,max=64"`
+	Padding     *int    `json:"padding" validate:"omitempty,gte=1,lte=12"`
+	YearlyReset *bool   `json:"yearly_reset" validate:"omitempty"`
+	NextValue   *int64  `json:"next_value" validate:"omitempty,gte=1"` // initial value, only before the first number of the period
+}
+
+// ===== Helpers =====
+
+// numberYear is the year of at in the tenant's time zone, so a document issued
+// shortly after midnight on New Year's Day gets the new year's number.
+func numberYear(tx *gorm.DB, schema string, at time.Time) int {
+	return at.In(companyLocation(tx, schema)).Year()
+}
+
+// allocateNumber draws the next number of the given sequence kind.
+// Must run inside the transaction that persists the number: the sequence row stays
+// locked until commit, and a rollback returns the number (no gaps, no duplicates).
+func allocateNumber(tx *gorm.DB, schema, kind string, at time.Time) (string, error) {
+	var seq models.NumberSequence
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("kind = ?", kind).
+		First(&seq).Error
+	if err != nil {
+		return "", err
+	}
+
+	year := numberYear(tx, schema, at)
+	if seq.YearlyReset && seq.Year != year {
+		seq.LastValue = 0
+	}
+	next := seq.LastValue + 1
+
+	if err := tx.Model(&models.NumberSequence{}).
+		Where("id = ?", seq.ID).
+		Updates(map[string]any{
+			"last_value": next,
+			"year":       year,
+		}).Error; err != nil {
+		return "", err
+	}
+	return seq.Render(next, year), nil
+}
+
+// validateSequenceFormat rejects formats that could produce duplicate numbers.
+func validateSequenceFormat(format string, yearlyReset bool) error {
+	if !strings.Contains(format, "{seq}") {
+		return fiber.NewError(fiber.StatusBadRequest, "format must contain {seq}")
+	}
+	if yearlyReset && !strings.Contains(format, "{yyyy}") && !strings.Contains(format, "{yy}") {
+		return fiber.NewError(fiber.StatusBadRequest, "format must contain {yyyy} or {yy} when yearly_reset is enabled")
+	}
+	return nil
+}
+
+// ===== Handlers =====
+
+// GET /api/number-sequences
+func GetNumberSequences(c *fiber.Ctx) error {
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var sequences []models.NumberSequence
+	if err := db.Order("kind ASC").Find(&sequences).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"number_sequences": sequences, "message": "success"})
+}
+
+// PUT /api/number-sequences/:kind
+func UpdateNumberSequence(c *fiber.Ctx) error {
+	kind := strings.ToLower(strings.TrimSpace(c.Params("kind")))
+	if kind == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "missing sequence kind in path")
+	}
+
+	var in NumberSequenceUpdateDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var out models.NumberSequence
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var seq models.NumberSequence
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&seq, "kind = ?", kind).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fiber.NewError(fiber.StatusNotFound, "number sequence not found")
+			}
+			return err
+		}
+		if seq.Version != in.Version {
+			return fiber.NewError(fiber.StatusConflict, "stale update, please reload")
+		}
+
+		updates := map[string]any{"version": gorm.Expr("version + 1")}
+		format, yearlyReset := seq.Format, seq.YearlyReset
+		if in.Prefix != nil {
+			updates["prefix"] = strings.TrimSpace(*in.Prefix)
+		}
+		if in.Format != nil {
+			format = strings.TrimSpace(*in.Format)
+			updates["format"] = format
+		}
+		if in.Padding != nil {
+			updates["padding"] = *in.Padding
+		}
+		if in.YearlyReset != nil {
+			yearlyReset = *in.YearlyReset
+			updates["yearly_reset"] = yearlyReset
+		}
+		if err := validateSequenceFormat(format, yearlyReset); err != nil {
+			return err
+		}
+		if in.NextValue != nil {
+			// Numbers must stay gapless once issued: the start value can only be set
+			// while the current period has not allocated a number yet
+			year := numberYear(tx, tenantSchema(c), time.Now())
+			current := seq.LastValue
+			if seq.YearlyReset && seq.Year != year {
+				current = 0
+			}
+			if current != 0 {
+				return fiber.NewError(fiber.StatusConflict, "next_value can only be set before the first number is issued")
+			}
+			updates["last_value"] = *in.NextValue - 1
+			updates["year"] = year
+		}
+
+		if err := tx.Model(&models.NumberSequence{}).Where("id = ?", seq.ID).Updates(updates).Error; err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "could not update number sequence")
+		}
+		return tx.First(&out, "id = ?", seq.ID).Error
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(out)
+}
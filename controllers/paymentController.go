@@ -0,0 +1,417 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"fakturierung-backend/database"
+	"fakturierung-backend/middlewares"
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ===== DTOs =====
+
+type PaymentRefundDTO struct {
+	Amount    utils.Money `json:"amount" validate:"required,gt=0"` // refunded amount (positive)
+	Method    string      `json:"method" validate:"omitempty"`
+	Reference string      `json:"reference" validate:"omitempty"`
+	Note      string      `json:"note" validate:"omitempty"`
+	PaidAt    string      `json:"paid_at" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+}
+
+type PaymentCorrectionDTO struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// ===== Helpers =====
+
+const (
+	paymentKindPayment  = "payment"
+	paymentKindRefund   = "refund"
+	paymentKindDiscount = "discount" // early-payment discount (Skonto), booked automatically
+)
+
+// errNotPayable rejects payment changes on documents that are not issued invoices or credit notes.
+var errNotPayable = fiber.NewError(fiber.StatusConflict, "payments can only be booked on published, non-cancelled invoices and credit notes")
+
+// errCurrencyMismatch rejects a payment in another currency than its invoice.
+var errCurrencyMismatch = errors.New("payment currency mismatch")
+
+// parsePaidAt parses an optional RFC 3339 timestamp, defaulting to now.
+func parsePaidAt(s string) (time.Time, error) {
+	if strings.TrimSpace(s) == "" {
+		return time.Now().UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fiber.NewError(fiber.StatusBadRequest, "invalid paid_at format")
+	}
+	return t.UTC(), nil
+}
+
+// changePayments runs a payment mutation with the invoice locked, then
+// recalculates PaidTotal and records a new invoice version.
+// Only published, non-cancelled invoices and credit notes carry payments.
+func changePayments(tx *gorm.DB, invoiceID uint, by actor, change func(inv *models.Invoice) error) error {
+	var inv models.Invoice
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&inv, "id = ?", invoiceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.ErrNotFound
+		}
+		return err
+	}
+	payable := inv.DocumentType == models.DocumentInvoice || inv.DocumentType == models.DocumentCreditNote
+	if !payable || !inv.Published || inv.Cancelled {
+		return errNotPayable
+	}
+	if err := change(&inv); err != nil {
+		return err
+	}
+	if err := applySkonto(tx, &inv); err != nil {
+		return err
+	}
+	paid, err := recalcPaidTotal(tx, invoiceID)
+	if err != nil {
+		return err
+	}
+	inv.PaidTotal = paid
+	return snapshotInvoice(tx, &inv, by, models.VersionPayment)
+}
+
+// skontoDeadline is the first instant after the discount window (end of the deadline day).
+func skontoDeadline(due time.Time) time.Time {
+	y, m, d := due.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+// earnedSkonto is the discount granted when received was paid within the window:
+// the rest of base once at least the discounted total arrived, otherwise nothing.
+func earnedSkonto(base, received utils.Money, rate float64, mode utils.RoundingMode) utils.Money {
+	if received >= base || received < skontoTotal(base, rate, mode) {
+		return 0
+	}
+	return base - received
+}
+
+// skontoTaxCorrection splits a granted discount over the invoice's tax rates in
+// proportion to their gross amounts; the last rate takes the rounding remainder.
+func skontoTaxCorrection(breakdown []models.TaxLine, discount utils.Money, mode utils.RoundingMode) []models.TaxLine {
+	var gross utils.Money
+	for _, l := range breakdown {
+		gross += l.Gross
+	}
+	if gross == 0 {
+		return nil
+	}
+	out := make([]models.TaxLine, 0, len(breakdown))
+	rest := discount
+	for i, l := range breakdown {
+		share := rest
+		if i < len(breakdown)-1 {
+			share = discount.MulRatio(int64(l.Gross), int64(gross), mode)
+		}
+		rest -= share
+		// tax contained in the gross share: share * rate / (1 + rate)
+		rate := int64(math.Round(l.Rate * 10000))
+		tax := share.MulRatio(rate, 10000+rate, mode)
+		out = append(out, models.TaxLine{Rate: l.Rate, Net: share - tax, Tax: tax, Gross: share})
+	}
+	return out
+}
+
+// applySkonto keeps the early-payment discount of a published invoice in line with
+// its payments. When the money received by the Skonto deadline covers the discounted
+// total but not the full amount, the difference is granted as a "discount" booking
+// (with its tax correction), so the invoice counts as settled. A discount whose
+// condition no longer holds, e.g. after a reversal or refund, is reversed.
+func applySkonto(tx *gorm.DB, inv *models.Invoice) error {
+	var granted []models.Payment
+	if err := tx.Where("invoice_id = ? AND kind = ? AND reversed = ?", inv.ID, paymentKindDiscount, false).
+		Find(&granted).Error; err != nil {
+		return err
+	}
+
+	var discount utils.Money
+	var grantedAt time.Time
+	if inv.IssuedInvoice() && inv.SkontoRate > 0 && inv.SkontoDueDate != nil {
+		credited, err := creditedTotals(tx, []uint{inv.ID})
+		if err != nil {
+			return err
+		}
+		base := inv.Total + credited[inv.ID]
+		deadline := skontoDeadline(*inv.SkontoDueDate)
+		var sums struct {
+			Paid       utils.Money
+			InTime     utils.Money
+			LastPaidAt *time.Time
+		}
+		if err := tx.Model(&models.Payment{}).
+			Select(`COALESCE(SUM(amount), 0) AS paid,
+				COALESCE(SUM(amount) FILTER (WHERE paid_at < ?), 0) AS in_time,
+				MAX(paid_at) FILTER (WHERE paid_at < ?) AS last_paid_at`, deadline, deadline).
+			Where("invoice_id = ? AND reversed = ? AND kind <> ?", inv.ID, false, paymentKindDiscount).
+			Scan(&sums).Error; err != nil {
+			return err
+		}
+		// money paid late or refunded later does not count towards the discount
+		received := min(sums.Paid, sums.InTime)
+		if sums.LastPaidAt != nil {
+			discount = earnedSkonto(base, received, inv.SkontoRate, invoiceRounding(inv).Mode)
+			grantedAt = *sums.LastPaidAt
+		}
+	}
+
+	if len(granted) == 1 && granted[0].Amount == discount {
+		return nil
+	}
+	reason := "early-payment discount no longer applies"
+	if discount > 0 {
+		reason = "early-payment discount recalculated"
+	}
+	now := time.Now().UTC()
+	for _, p := range granted {
+		if err := tx.Model(&p).Updates(map[string]any{
+			"reversed":        true,
+			"reversed_at":     &now,
+			"reversal_reason": reason,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	if discount <= 0 {
+		return nil
+	}
+	return tx.Create(&models.Payment{
+		InvoiceID:     inv.ID,
+		Kind:          paymentKindDiscount,
+		Amount:        discount,
+		Currency:      inv.Currency,
+		Method:        "skonto",
+		Note:          fmt.Sprintf("Skonto %.2f %%", inv.SkontoRate*100),
+		PaidAt:        grantedAt,
+		TaxCorrection: datatypes.NewJSONSlice(skontoTaxCorrection(inv.TaxBreakdown, discount, invoiceRounding(inv).Mode)),
+	}).Error
+}
+
+// loadPayment fetches a payment by id (locked) for a correction.
+func loadPayment(tx *gorm.DB, id int) (models.Payment, error) {
+	var p models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&p, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return p, fiber.NewError(fiber.StatusNotFound, "payment not found")
+		}
+		return p, err
+	}
+	return p, nil
+}
+
+// activeRefunds sums the (negative) refunds still counting against a payment.
+func activeRefunds(tx *gorm.DB, paymentID uint) (utils.Money, error) {
+	var sum utils.Money
+	err := tx.Model(&models.Payment{}).
+		Where("refund_of_id = ? AND reversed = ?", paymentID, false).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&sum).Error
+	return sum, err
+}
+
+// ===== Handlers =====
+
+// POST /api/payments/:id/refund
+// Books money paid back to the customer against an original payment. The refund is
+// a new row with a negative amount; refunds can never exceed what was received.
+func RefundPayment(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid payment id")
+	}
+	var in PaymentRefundDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+	paidAt, err := parsePaidAt(in.PaidAt)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var refund models.Payment
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var orig models.Payment
+		if err := tx.Select("invoice_id").First(&orig, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fiber.NewError(fiber.StatusNotFound, "payment not found")
+			}
+			return err
+		}
+		return changePayments(tx, orig.InvoiceID, requestActor(c), func(*models.Invoice) error {
+			orig, err := loadPayment(tx, id)
+			if err != nil {
+				return err
+			}
+			if orig.Kind != paymentKindPayment {
+				return fiber.NewError(fiber.StatusConflict, "only received payments can be refunded")
+			}
+			if orig.Reversed {
+				return fiber.NewError(fiber.StatusConflict, "payment is reversed")
+			}
+			refunded, err := activeRefunds(tx, orig.ID)
+			if err != nil {
+				return err
+			}
+			amount := in.Amount
+			if orig.Amount+refunded-amount < 0 {
+				return fiber.NewError(fiber.StatusConflict, "refund exceeds the refundable amount")
+			}
+			refund = models.Payment{
+				InvoiceID:  orig.InvoiceID,
+				Kind:       paymentKindRefund,
+				RefundOfID: &orig.ID,
+				Amount:     -amount,
+				Currency:   orig.Currency,
+				Method:     strings.TrimSpace(in.Method),
+				Reference:  strings.TrimSpace(in.Reference),
+				Note:       strings.TrimSpace(in.Note),
+				PaidAt:     paidAt,
+			}
+			return tx.Create(&refund).Error
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(refund)
+}
+
+// POST /api/payments/:id/reverse
+// Marks a wrongly booked payment or refund as reversed. The row is kept for the
+// audit trail but no longer counts towards the invoice's paid total.
+func ReversePayment(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid payment id")
+	}
+	var in PaymentCorrectionDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var out models.Payment
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var p models.Payment
+		if err := tx.Select("invoice_id").First(&p, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fiber.NewError(fiber.StatusNotFound, "payment not found")
+			}
+			return err
+		}
+		return changePayments(tx, p.InvoiceID, requestActor(c), func(*models.Invoice) error {
+			p, err := loadPayment(tx, id)
+			if err != nil {
+				return err
+			}
+			if p.Reversed {
+				return fiber.NewError(fiber.StatusConflict, "payment is already reversed")
+			}
+			if p.Kind == paymentKindDiscount {
+				return fiber.NewError(fiber.StatusConflict, "early-payment discounts follow the payments; correct those instead")
+			}
+			if p.Kind == paymentKindPayment {
+				refunded, err := activeRefunds(tx, p.ID)
+				if err != nil {
+					return err
+				}
+				if refunded != 0 {
+					return fiber.NewError(fiber.StatusConflict, "reverse the refunds of this payment first")
+				}
+			}
+			now := time.Now().UTC()
+			if err := tx.Model(&p).Updates(map[string]any{
+				"reversed":        true,
+				"reversed_at":     &now,
+				"reversal_reason": strings.TrimSpace(in.Reason),
+			}).Error; err != nil {
+				return err
+			}
+			return tx.First(&out, "id = ?", p.ID).Error
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(out)
+}
+
+// DELETE /api/payments/:id  Body: { "reason": "..." }
+// Removes a payment booked on the wrong invoice. Only allowed while the invoice is
+// not published (issued invoices use reversal); the row is soft-deleted with the
+// reason and stays listed with ?include_deleted=true.
+func DeletePayment(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid payment id")
+	}
+	var in PaymentCorrectionDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var p models.Payment
+		if err := tx.Select("invoice_id").First(&p, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fiber.NewError(fiber.StatusNotFound, "payment not found")
+			}
+			return err
+		}
+		return changePayments(tx, p.InvoiceID, requestActor(c), func(inv *models.Invoice) error {
+			if inv.Published {
+				return fiber.NewError(fiber.StatusConflict, "invoice is published; reverse the payment instead")
+			}
+			p, err := loadPayment(tx, id)
+			if err != nil {
+				return err
+			}
+			if p.Kind == paymentKindPayment {
+				var refunds int64
+				if err := tx.Model(&models.Payment{}).Where("refund_of_id = ?", p.ID).Count(&refunds).Error; err != nil {
+					return err
+				}
+				if refunds > 0 {
+					return fiber.NewError(fiber.StatusConflict, "delete the refunds of this payment first")
+				}
+			}
+			if err := tx.Model(&p).Update("deletion_reason", strings.TrimSpace(in.Reason)).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&p).Error
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
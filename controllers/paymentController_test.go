@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+)
+
+func TestSkontoDeadline(t *testing.T) {
+	due := time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)
+	deadline := skontoDeadline(due)
+	if want := time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC); !deadline.Equal(want) {
+		t.Fatalf("skontoDeadline = %s, want %s", deadline, want)
+	}
+	// the window is paid_at < deadline, as in applySkonto's query
+	tests := []struct {
+		paidAt time.Time
+		inTime bool
+	}{
+		{time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC), true},
+		{due, true},
+		{time.Date(2025, 3, 14, 23, 59, 59, 0, time.UTC), true},
+		{deadline, false},
+		{time.Date(2025, 3, 15, 0, 0, 1, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		if got := tt.paidAt.Before(deadline); got != tt.inTime {
+			t.Errorf("paid at %s in time = %v, want %v", tt.paidAt, got, tt.inTime)
+		}
+	}
+	// the time of day of the stored due date does not move the deadline
+	if got := skontoDeadline(due.Add(15 * time.Hour)); !got.Equal(deadline) {
+		t.Errorf("skontoDeadline(afternoon) = %s, want %s", got, deadline)
+	}
+}
+
+func TestEarnedSkonto(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     utils.Money
+		received utils.Money
+		mode     utils.RoundingMode
+		want     utils.Money
+	}{
+		{"discounted total", 10000, 9800, utils.RoundHalfUp, 200},
+		{"more than the discounted total", 10000, 9900, utils.RoundHalfUp, 100},
+		{"a cent short", 10000, 9799, utils.RoundHalfUp, 0},
+		{"paid in full", 10000, 10000, utils.RoundHalfUp, 0},
+		{"overpaid", 10000, 10500, utils.RoundHalfUp, 0},
+		{"nothing received", 10000, 0, utils.RoundHalfUp, 0},
+		// 2% of 1.25 is 0.025: half-up grants 0.03, half-even 0.02
+		{"tie half up", 125, 122, utils.RoundHalfUp, 3},
+		{"tie half even", 125, 122, utils.RoundHalfEven, 0},
+		{"tie half even exact", 125, 123, utils.RoundHalfEven, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := earnedSkonto(tt.base, tt.received, 0.02, tt.mode); got != tt.want {
+				t.Errorf("earnedSkonto = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkontoTaxCorrection(t *testing.T) {
+	tests := []struct {
+		name      string
+		breakdown []models.TaxLine
+		discount  utils.Money
+		mode      utils.RoundingMode
+		want      []models.TaxLine
+	}{
+		{"split by gross", []models.TaxLine{{Rate: 0.2, Gross: 12000}, {Rate: 0.1, Gross: 11000}}, 460, utils.RoundHalfUp,
+			[]models.TaxLine{{Rate: 0.2, Net: 200, Tax: 40, Gross: 240}, {Rate: 0.1, Net: 200, Tax: 20, Gross: 220}}},
+		{"last rate takes the remainder", []models.TaxLine{{Rate: 0.2, Gross: 10000}, {Rate: 0.1, Gross: 10000}, {Rate: 0.13, Gross: 10000}}, 100, utils.RoundHalfUp,
+			[]models.TaxLine{{Rate: 0.2, Net: 27, Tax: 6, Gross: 33}, {Rate: 0.1, Net: 30, Tax: 3, Gross: 33}, {Rate: 0.13, Net: 30, Tax: 4, Gross: 34}}},
+		{"tax tie half up", []models.TaxLine{{Rate: 0.2, Gross: 12000}}, 3, utils.RoundHalfUp,
+			[]models.TaxLine{{Rate: 0.2, Net: 2, Tax: 1, Gross: 3}}},
+		{"tax tie half even", []models.TaxLine{{Rate: 0.2, Gross: 12000}}, 3, utils.RoundHalfEven,
+			[]models.TaxLine{{Rate: 0.2, Net: 3, Tax: 0, Gross: 3}}},
+		{"exempt rate", []models.TaxLine{{Rate: 0, Gross: 5000}}, 100, utils.RoundHalfUp,
+			[]models.TaxLine{{Rate: 0, Net: 100, Tax: 0, Gross: 100}}},
+		{"no gross", []models.TaxLine{{Rate: 0.2}}, 100, utils.RoundHalfUp, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := skontoTaxCorrection(tt.breakdown, tt.discount, tt.mode)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("skontoTaxCorrection\n got  %+v\n want %+v", got, tt.want)
+			}
+			var gross utils.Money
+			for _, l := range got {
+				gross += l.Gross
+			}
+			if got != nil && gross != tt.discount {
+				t.Errorf("shares add up to %s, want %s", gross, tt.discount)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"fakturierung-backend/database"
+	"fakturierung-backend/middlewares"
+	"fakturierung-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Quotation statuses (finalized quotations only)
+const (
+	quotationStatusSent     = "sent"
+	quotationStatusAccepted = "accepted"
+	quotationStatusDeclined = "declined"
+	quotationStatusExpired  = "expired"
+)
+
+var quotationStatuses = map[string]bool{
+	quotationStatusSent: true, quotationStatusAccepted: true, quotationStatusDeclined: true, quotationStatusExpired: true,
+}
+
+// defaultQuotationValidityDays applies when a quotation is finalized without valid_until.
+const defaultQuotationValidityDays = 30
+
+// ===== DTOs =====
+
+type QuotationStatusDTO struct {
+	Status string `json:"status" validate:"required,oneof=accepted declined"`
+}
+
+// ===== Helpers =====
+
+// parseValidUntil reads an optional valid_until date (YYYY-MM-DD); "" => nil.
+func parseValidUntil(s string) (*time.Time, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	d, err := parseDate(s)
+	if err != nil {
+		return nil, errors.New("invalid valid_until (YYYY-MM-DD)")
+	}
+	return &d, nil
+}
+
+// quotationExpired reports whether a sent quotation's validity ended before today.
+func quotationExpired(q *models.Invoice, today time.Time) bool {
+	return q.ValidUntil != nil && q.ValidUntil.Before(today)
+}
+
+// lockQuotation loads a finalized quotation for a status change.
+func lockQuotation(tx *gorm.DB, id int) (models.Invoice, error) {
+	var q models.Invoice
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&q, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return q, fiber.NewError(fiber.StatusNotFound, "quotation not found")
+		}
+		return q, err
+	}
+	if q.DocumentType != models.DocumentQuotation {
+		return q, fiber.NewError(fiber.StatusBadRequest, "document is not a quotation")
+	}
+	if !q.Published {
+		return q, fiber.NewError(fiber.StatusConflict, "quotation is a draft; finalize it first")
+	}
+	return q, nil
+}
+
+// setQuotationStatus stores a new status (allowed on finalized rows) and snapshots it.
+func setQuotationStatus(tx *gorm.DB, q *models.Invoice, status string, by actor) error {
+	if err := tx.Model(&models.Invoice{}).Where("id = ?", q.ID).Update("quotation_status", status).Error; err != nil {
+		return err
+	}
+	if err := tx.Preload(clause.Associations).First(q, "id = ?", q.ID).Error; err != nil {
+		return err
+	}
+	return snapshotInvoice(tx, q, by, models.VersionStatus)
+}
+
+// checkQuotationOpen rejects answering a quotation that is no longer open, including
+// one past its validity that the scheduler has not expired yet.
+func checkQuotationOpen(q *models.Invoice, today time.Time) error {
+	if q.QuotationStatus != quotationStatusSent {
+		return fiber.NewError(fiber.StatusConflict, "quotation is already "+q.QuotationStatus)
+	}
+	if quotationExpired(q, today) {
+		return fiber.NewError(fiber.StatusConflict, "quotation expired on "+q.ValidUntil.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// expireQuotationsTx marks sent quotations whose validity ended before today as
+// expired and snapshots each of them.
+func expireQuotationsTx(tx *gorm.DB, today time.Time) (int, error) {
+	var due []models.Invoice
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("document_type = ? AND published AND quotation_status = ? AND valid_until < ?",
+			models.DocumentQuotation, quotationStatusSent, today).
+		Order("id ASC").Find(&due).Error; err != nil {
+		return 0, err
+	}
+	for i := range due {
+		if err := setQuotationStatus(tx, &due[i], quotationStatusExpired, actor{}); err != nil {
+			return 0, err
+		}
+	}
+	return len(due), nil
+}
+
+// ExpireQuotations expires the tenant's overdue quotations (used by the scheduler).
+func ExpireQuotations(schema string, today time.Time) (int, error) {
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	expired := 0
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`SET LOCAL search_path = "` + schema + `", public`).Error; err != nil {
+			return fmt.Errorf("set search_path failed: %w", err)
+		}
+		var err error
+		expired, err = expireQuotationsTx(tx, today)
+		return err
+	})
+	return expired, err
+}
+
+// ===== Handlers =====
+
+// PUT /api/quotations/:id/status
+// Body: { "status": "accepted" | "declined" } — records the customer's answer
+func SetQuotationStatus(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid quotation id")
+	}
+	var in QuotationStatusDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	var out models.Invoice
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if out, err = lockQuotation(tx, id); err != nil {
+			return err
+		}
+		if err := checkQuotationOpen(&out, today); err != nil {
+			return err
+		}
+		return setQuotationStatus(tx, &out, in.Status, requestActor(c))
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(out)
+}
+
+// POST /api/quotations/:id/invoice
+// Creates a draft invoice copying the quotation's customer and items, linked to it
+// via source_id. The quotation itself stays unchanged and is marked accepted.
+func CreateInvoiceFromQuotation(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid quotation id")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	var quotation, invoice models.Invoice
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if quotation, err = lockQuotation(tx, id); err != nil {
+			return err
+		}
+		if quotation.QuotationStatus != quotationStatusAccepted {
+			if err := checkQuotationOpen(&quotation, today); err != nil {
+				return err
+			}
+		}
+		var existing models.Invoice
+		err = tx.Where("source_id = ? AND document_type = ? AND NOT cancelled", quotation.ID, models.DocumentInvoice).
+			Order("id ASC").First(&existing).Error
+		if err == nil {
+			return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("invoice %d was already created from this quotation", existing.ID))
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		sourceID := quotation.ID
+		if invoice, err = createInvoiceTx(tx, tenantSchema(c), newInvoice{
+			DocumentType: models.DocumentInvoice,
+			CustomerID:   quotation.CId,
+			Lines:        itemLines(quotation.Items, true), // keep the quoted rates
+			Discount:     invoiceDiscount(&quotation),
+			TaxTreatment: quotation.TaxTreatment,
+			Currency:     quotation.Currency,
+			SourceID:     &sourceID,
+		}, requestActor(c)); err != nil {
+			return err
+		}
+		if quotation.QuotationStatus == quotationStatusAccepted {
+			return tx.Preload(clause.Associations).First(&quotation, "id = ?", quotation.ID).Error
+		}
+		return setQuotationStatus(tx, &quotation, quotationStatusAccepted, requestActor(c))
+	})
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"invoice":   invoice,
+		"quotation": quotation,
+		"message":   "success",
+	})
+}
@@ -0,0 +1,521 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"fakturierung-backend/database"
+	"fakturierung-backend/middlewares"
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ===== DTOs =====
+
+type RecurringInvoiceCreateDTO struct {
+	Name            string           `json:"name" validate:"omitempty"`
+	CustomerID      uint             `json:"customer_id" validate:"required,gt=0"`
+	Items           []InvoiceItemDTO `json:"items" validate:"required,min=1,dive"`
+	Interval        string           `json:"interval" validate:"required,oneof=week month quarter year"`
+	IntervalCount   int              `json:"interval_count" validate:"omitempty,gte=1,lte=36"`
+	StartDate       string           `json:"start_date" validate:"required,datetime=2006-01-02"`
+	EndDate         string           `json:"end_date" validate:"omitempty,datetime=2006-01-02"`
+	PaymentTermDays *int             `json:"payment_term_days" validate:"omitempty,gte=0,lte=365"`
+	AutoPublish     bool             `json:"auto_publish"`
+	CatchUp         *bool            `json:"catch_up"` // default true
+}
+
+// Pointer-based partial update; requires optimistic-lock version
+type RecurringInvoiceUpdateDTO struct {
+	Version         uint              `json:"version" validate:"required,gt=0"`
+	Name            *string           `json:"name" validate:"omitempty"`
+	CustomerID      *uint             `json:"customer_id" validate:"omitempty,gt=0"`
+	Items           *[]InvoiceItemDTO `json:"items" validate:"omitempty,min=1"`
+	Interval        *string           `json:"interval" validate:"omitempty,oneof=week month quarter year"`
+	IntervalCount   *int              `json:"interval_count" validate:"omitempty,gte=1,lte=36"`
+	EndDate         *string           `json:"end_date" validate:"omitempty"` // "" clears the end date
+	NextRunDate     *string           `json:"next_run_date" validate:"omitempty,datetime=2006-01-02"`
+	PaymentTermDays *int              `json:"payment_term_days" validate:"omitempty,gte=0,lte=365"`
+	AutoPublish     *bool             `json:"auto_publish"`
+	CatchUp         *bool             `json:"catch_up"`
+	Active          *bool             `json:"active"`
+}
+
+// ===== Helpers =====
+
+const (
+	runStatusCreated = "created"
+	runStatusSkipped = "skipped"
+)
+
+// addMonthsClamped adds months keeping the day of month where possible
+// (Jan 31 + 1 month = Feb 28/29, not Mar 3).
+func addMonthsClamped(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, time.UTC)
+}
+
+// recurringPeriodDate returns the date of period n (0-based) of a template schedule.
+func recurringPeriodDate(start time.Time, interval string, every, n int) time.Time {
+	if every < 1 {
+		every = 1
+	}
+	switch interval {
+	case "week":
+		return start.AddDate(0, 0, 7*every*n)
+	case "quarter":
+		return addMonthsClamped(start, 3*every*n)
+	case "year":
+		return addMonthsClamped(start, 12*every*n)
+	default: // month
+		return addMonthsClamped(start, every*n)
+	}
+}
+
+func parseDate(s string) (time.Time, error) {
+	return time.Parse("2006-01-02", strings.TrimSpace(s))
+}
+
+func toRecurringItems(in []InvoiceItemDTO) datatypes.JSONSlice[models.RecurringItem] {
+	out := make([]models.RecurringItem, 0, len(in))
+	for _, it := range in {
+		out = append(out, models.RecurringItem{
+			ArticleID:      strings.TrimSpace(it.ArticleID),
+			Description:    strings.TrimSpace(it.Description),
+			Amount:         utils.Round3(it.Amount),
+			Unit:           strings.TrimSpace(it.Unit),
+			UnitPrice:      it.UnitPrice,
+			TaxRate:        it.TaxRate,
+			DiscountRate:   it.DiscountRate,
+			DiscountAmount: it.DiscountAmount,
+		})
+	}
+	return datatypes.NewJSONSlice(out)
+}
+
+func fromRecurringItems(in []models.RecurringItem) []InvoiceItemDTO {
+	out := make([]InvoiceItemDTO, 0, len(in))
+	for _, it := range in {
+		out = append(out, InvoiceItemDTO{
+			ArticleID:      it.ArticleID,
+			Description:    it.Description,
+			Amount:         it.Amount,
+			Unit:           it.Unit,
+			UnitPrice:      it.UnitPrice,
+			TaxRate:        it.TaxRate,
+			DiscountRate:   it.DiscountRate,
+			DiscountAmount: it.DiscountAmount,
+		})
+	}
+	return out
+}
+
+// checkRecurringItems validates template lines the same way invoice creation will.
+func checkRecurringItems(tx *gorm.DB, lines []InvoiceItemDTO) error {
+	items, err := buildItems(tx, lines, roundingPolicy{}, "") // amounts are computed when invoicing
+	if err != nil {
+		return err
+	}
+	return validateArticleRefs(tx, items, true)
+}
+
+// generateRecurring invoices all due periods of one (locked) template up to today.
+// With catch-up disabled only the latest missed period is invoiced, earlier ones are
+// recorded as skipped. Each period is claimed in recurring_runs first, so a period
+// handled by another instance is never invoiced twice.
+func generateRecurring(tx *gorm.DB, schema string, t *models.RecurringInvoice, today time.Time, by actor) (int, error) {
+	var periods []time.Time
+	occ := t.Occurrences
+	for {
+		d := recurringPeriodDate(t.StartDate, t.Interval, t.IntervalCount, occ)
+		if d.After(today) || (t.EndDate != nil && d.After(*t.EndDate)) {
+			break
+		}
+		periods = append(periods, d)
+		occ++
+	}
+	if len(periods) == 0 {
+		return 0, nil
+	}
+
+	created := 0
+	for i, period := range periods {
+		status := runStatusCreated
+		if !t.CatchUp && i < len(periods)-1 {
+			status = runStatusSkipped
+		}
+		run := models.RecurringRun{RecurringID: t.ID, PeriodDate: period, Status: status}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&run)
+		if res.Error != nil {
+			return created, res.Error
+		}
+		if res.RowsAffected == 0 || status == runStatusSkipped {
+			continue // already handled elsewhere, or deliberately skipped
+		}
+
+		inv, err := createInvoiceTx(tx, schema, newInvoice{
+			DocumentType:    models.DocumentInvoice,
+			CustomerID:      t.CId,
+			Lines:           fromRecurringItems(t.Items),
+			PaymentTermDays: t.PaymentTermDays,
+			RecurringID:     &t.ID,
+		}, by)
+		if err != nil {
+			return created, err
+		}
+		if t.AutoPublish {
+			if _, err := publishInvoiceTx(tx, schema, inv.ID, by); err != nil {
+				return created, err
+			}
+		}
+		if err := tx.Model(&run).Update("invoice_id", inv.ID).Error; err != nil {
+			return created, err
+		}
+		created++
+	}
+
+	now := time.Now().UTC()
+	err := tx.Model(&models.RecurringInvoice{}).Where("id = ?", t.ID).Updates(map[string]any{
+		"occurrences":   occ,
+		"next_run_date": recurringPeriodDate(t.StartDate, t.Interval, t.IntervalCount, occ),
+		"last_run_at":   &now,
+		"last_error":    "",
+	}).Error
+	return created, err
+}
+
+// runRecurringTx generates due invoices for all active templates of the tenant the
+// transaction is pinned to. A per-tenant advisory lock lets only one instance work
+// on a tenant at a time; templates are additionally row-locked. A failing template
+// is rolled back to its savepoint and its error recorded, the others proceed.
+func runRecurringTx(tx *gorm.DB, schema string, today time.Time, by actor) (int, error) {
+	var locked bool
+	if err := tx.Raw(`SELECT pg_try_advisory_xact_lock(hashtext(?))`, "recurring:"+schema).Scan(&locked).Error; err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	var templates []models.RecurringInvoice
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("active = ? AND next_run_date <= ?", true, today).
+		Where("end_date IS NULL OR next_run_date <= end_date").
+		Order("id ASC").
+		Find(&templates).Error; err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for i := range templates {
+		t := &templates[i]
+		var n int
+		err := tx.Transaction(func(stx *gorm.DB) error {
+			var err error
+			n, err = generateRecurring(stx, schema, t, today, by)
+			return err
+		})
+		if err != nil {
+			log.Printf("recurring invoice %d (%s): %v", t.ID, schema, err)
+			msg := err.Error()
+			var fe *fiber.Error
+			if errors.As(err, &fe) {
+				msg = fe.Message
+			}
+			if e := tx.Model(&models.RecurringInvoice{}).Where("id = ?", t.ID).Update("last_error", msg).Error; e != nil {
+				return created, e
+			}
+			continue
+		}
+		created += n
+	}
+	return created, nil
+}
+
+// RunRecurringInvoices generates all due recurring invoices of one tenant up to
+// today in its own transaction. Used by the in-process scheduler.
+func RunRecurringInvoices(schema string, today time.Time) (int, error) {
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	created := 0
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`SET LOCAL search_path = "` + schema + `", public`).Error; err != nil {
+			return fmt.Errorf("set search_path failed: %w", err)
+		}
+		var err error
+		created, err = runRecurringTx(tx, schema, today, actor{})
+		return err
+	})
+	return created, err
+}
+
+// ===== Handlers =====
+
+// POST /api/recurring-invoice
+func CreateRecurringInvoice(c *fiber.Ctx) error {
+	var in RecurringInvoiceCreateDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+	start, err := parseDate(in.StartDate)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid start_date")
+	}
+	var end *time.Time
+	if strings.TrimSpace(in.EndDate) != "" {
+		e, err := parseDate(in.EndDate)
+		if err != nil || e.Before(start) {
+			return fiber.NewError(fiber.StatusBadRequest, "end_date must not be before start_date")
+		}
+		end = &e
+	}
+	every := in.IntervalCount
+	if every == 0 {
+		every = 1
+	}
+	catchUp := true
+	if in.CatchUp != nil {
+		catchUp = *in.CatchUp
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	template := models.RecurringInvoice{
+		Name:            strings.TrimSpace(in.Name),
+		CId:             in.CustomerID,
+		Items:           toRecurringItems(in.Items),
+		Interval:        in.Interval,
+		IntervalCount:   every,
+		StartDate:       start,
+		EndDate:         end,
+		NextRunDate:     start,
+		PaymentTermDays: in.PaymentTermDays,
+		AutoPublish:     in.AutoPublish,
+		CatchUp:         catchUp,
+		Active:          true,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var customer models.Customer
+		if err := tx.Select("id").First(&customer, "id = ?", in.CustomerID).Error; err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "customer not found")
+		}
+		if err := checkRecurringItems(tx, in.Items); err != nil {
+			return err
+		}
+		if err := tx.Create(&template).Error; err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "could not create recurring invoice")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(template)
+}
+
+// GET /api/recurring-invoices?active=true|false
+func GetRecurringInvoices(c *fiber.Ctx) error {
+	limit := parseIntDefault(c.Query("limit"), 50)
+	offset := parseIntDefault(c.Query("offset"), 0)
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	q := db.Model(&models.RecurringInvoice{}).Preload("Customer")
+	switch strings.ToLower(strings.TrimSpace(c.Query("active"))) {
+	case "true":
+		q = q.Where("active = ?", true)
+	case "false":
+		q = q.Where("active = ?", false)
+	}
+	var templates []models.RecurringInvoice
+	if err := q.Order("next_run_date ASC, id ASC").Limit(limit).Offset(offset).Find(&templates).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"recurring_invoices": templates, "message": "success"})
+}
+
+// GET /api/recurring-invoices/:id
+func GetRecurringInvoice(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid recurring invoice id")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var template models.RecurringInvoice
+	if err := db.Preload("Customer").First(&template, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "recurring invoice not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"recurring_invoice": template, "message": "success"})
+}
+
+// PUT /api/recurring-invoices/:id — requires optimistic-lock `version`
+// Changing the interval re-anchors the schedule at the next run date.
+func UpdateRecurringInvoice(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid recurring invoice id")
+	}
+
+	var in RecurringInvoiceUpdateDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+	if in.Items != nil {
+		for _, it := range *in.Items {
+			if err := middlewares.ValidateStruct(it); err != nil {
+				return err
+			}
+		}
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var out models.RecurringInvoice
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var existing models.RecurringInvoice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&existing, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fiber.NewError(fiber.StatusNotFound, "recurring invoice not found")
+			}
+			return err
+		}
+		if existing.Version != in.Version {
+			return fiber.NewError(fiber.StatusConflict, "stale update, please reload")
+		}
+
+		updates := map[string]any{"version": gorm.Expr("version + 1")}
+		if in.Name != nil {
+			updates["name"] = strings.TrimSpace(*in.Name)
+		}
+		if in.CustomerID != nil {
+			updates["c_id"] = *in.CustomerID
+		}
+		if in.Items != nil {
+			if err := checkRecurringItems(tx, *in.Items); err != nil {
+				return err
+			}
+			updates["items"] = toRecurringItems(*in.Items)
+		}
+		if in.EndDate != nil {
+			if strings.TrimSpace(*in.EndDate) == "" {
+				updates["end_date"] = nil
+			} else {
+				e, err := parseDate(*in.EndDate)
+				if err != nil || e.Before(existing.StartDate) {
+					return fiber.NewError(fiber.StatusBadRequest, "end_date must not be before start_date")
+				}
+				updates["end_date"] = e
+			}
+		}
+		if in.PaymentTermDays != nil {
+			updates["payment_term_days"] = *in.PaymentTermDays
+		}
+		if in.AutoPublish != nil {
+			updates["auto_publish"] = *in.AutoPublish
+		}
+		if in.CatchUp != nil {
+			updates["catch_up"] = *in.CatchUp
+		}
+		if in.Active != nil {
+			updates["active"] = *in.Active
+		}
+
+		// Schedule changes: restart the period count at the (new) next run date
+		next := existing.NextRunDate
+		reanchor := false
+		if in.NextRunDate != nil {
+			d, err := parseDate(*in.NextRunDate)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "invalid next_run_date")
+			}
+			next, reanchor = d, true
+		}
+		if in.Interval != nil && *in.Interval != existing.Interval {
+			updates["interval"] = *in.Interval
+			reanchor = true
+		}
+		if in.IntervalCount != nil && *in.IntervalCount != existing.IntervalCount {
+			updates["interval_count"] = *in.IntervalCount
+			reanchor = true
+		}
+		if reanchor {
+			updates["start_date"] = next
+			updates["next_run_date"] = next
+			updates["occurrences"] = 0
+		}
+
+		if err := tx.Model(&models.RecurringInvoice{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "could not update recurring invoice")
+		}
+		return tx.Preload("Customer").First(&out, "id = ?", id).Error
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(out)
+}
+
+// GET /api/recurring-invoices/:id/runs
+func GetRecurringRuns(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid recurring invoice id")
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	var runs []models.RecurringRun
+	if err := db.Where("recurring_id = ?", id).Order("period_date ASC").Find(&runs).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"runs": runs})
+}
+
+// POST /api/recurring-invoices/run
+// Runs the generator for the current tenant right away (same as the scheduler tick).
+func RunRecurringInvoicesNow(c *fiber.Ctx) error {
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	created, err := runRecurringTx(db, tenantSchema(c), today, requestActor(c))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "recurring invoice run failed")
+	}
+	return c.JSON(fiber.Map{"created": created, "message": "success"})
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestAddMonthsClamped(t *testing.T) {
+	tests := []struct {
+		from   time.Time
+		months int
+		want   time.Time
+	}{
+		{date(2025, 1, 31), 1, date(2025, 2, 28)},
+		{date(2024, 1, 31), 1, date(2024, 2, 29)},
+		{date(2025, 1, 31), 2, date(2025, 3, 31)},
+		{date(2025, 1, 30), 1, date(2025, 2, 28)},
+		{date(2025, 3, 31), 1, date(2025, 4, 30)},
+		{date(2025, 1, 15), 1, date(2025, 2, 15)},
+		{date(2025, 11, 30), 3, date(2026, 2, 28)},
+		{date(2024, 2, 29), 12, date(2025, 2, 28)},
+		{date(2025, 3, 31), -1, date(2025, 2, 28)},
+		{date(2025, 1, 31), 0, date(2025, 1, 31)},
+	}
+	for _, tt := range tests {
+		if got := addMonthsClamped(tt.from, tt.months); !got.Equal(tt.want) {
+			t.Errorf("addMonthsClamped(%s, %d) = %s, want %s",
+				tt.from.Format(time.DateOnly), tt.months, got.Format(time.DateOnly), tt.want.Format(time.DateOnly))
+		}
+	}
+}
+
+// Period dates are the keys of recurring runs: every period is derived from the
+// start date, so a clamped month does not shift the following ones.
+func TestRecurringPeriodDate(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    time.Time
+		interval string
+		every    int
+		want     []time.Time
+	}{
+		{"month end", date(2024, 1, 31), "month", 1,
+			[]time.Time{date(2024, 1, 31), date(2024, 2, 29), date(2024, 3, 31), date(2024, 4, 30), date(2024, 5, 31)}},
+		{"month end outside leap years", date(2025, 1, 31), "month", 1,
+			[]time.Time{date(2025, 1, 31), date(2025, 2, 28), date(2025, 3, 31)}},
+		{"every second month", date(2025, 12, 31), "month", 2,
+			[]time.Time{date(2025, 12, 31), date(2026, 2, 28), date(2026, 4, 30), date(2026, 6, 30)}},
+		{"quarter", date(2025, 11, 30), "quarter", 1,
+			[]time.Time{date(2025, 11, 30), date(2026, 2, 28), date(2026, 5, 30), date(2026, 8, 30)}},
+		{"leap day yearly", date(2024, 2, 29), "year", 1,
+			[]time.Time{date(2024, 2, 29), date(2025, 2, 28), date(2026, 2, 28), date(2027, 2, 28), date(2028, 2, 29)}},
+		{"week", date(2025, 12, 29), "week", 2,
+			[]time.Time{date(2025, 12, 29), date(2026, 1, 12), date(2026, 1, 26)}},
+		{"count below one is one", date(2025, 1, 10), "month", 0,
+			[]time.Time{date(2025, 1, 10), date(2025, 2, 10)}},
+		{"unknown interval is monthly", date(2025, 1, 10), "", 1,
+			[]time.Time{date(2025, 1, 10), date(2025, 2, 10)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := map[time.Time]bool{}
+			for n, want := range tt.want {
+				got := recurringPeriodDate(tt.start, tt.interval, tt.every, n)
+				if !got.Equal(want) {
+					t.Errorf("period %d = %s, want %s", n, got.Format(time.DateOnly), want.Format(time.DateOnly))
+				}
+				if seen[got] {
+					t.Errorf("period %d repeats key %s", n, got.Format(time.DateOnly))
+				}
+				seen[got] = true
+			}
+		})
+	}
+}
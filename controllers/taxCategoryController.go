@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"fakturierung-backend/database"
+	"fakturierung-backend/documents"
+	"fakturierung-backend/middlewares"
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ===== DTOs =====
+
+type TaxCategoryCreateDTO struct {
+	Name      string  `json:"name" validate:"required,min=1"`
+	Rate      float64 `json:"rate" validate:"gte=0,lte=1"` // fraction, e.g. 0.1 == 10%
+	IsDefault bool    `json:"is_default" validate:"omitempty"`
+}
+
+// Pointer-based partial update; requires optimistic-lock version
+type TaxCategoryUpdateDTO struct {
+	Version   uint     `json:"version" validate:"required,gt=0"`
+	Name      *string  `json:"name" validate:"omitempty,min=1"`
+	Rate      *float64 `json:"rate" validate:"omitempty,gte=0,lte=1"`
+	IsDefault *bool    `json:"is_default" validate:"omitempty"`
+	Active    *bool    `json:"active" validate:"omitempty"`
+}
+
+// clearDefaultTaxCategory unsets the default flag on all categories except keepID.
+func clearDefaultTaxCategory(tx *gorm.DB, keepID uint) error {
+	return tx.Model(&models.TaxCategory{}).
+		Where("is_default = ? AND id <> ?", true, keepID).
+		Update("is_default", false).Error
+}
+
+// reVATID is the shape of an EU VAT identification number: country prefix and
+// 2-13 characters (checked without spaces, upper-cased).
+var reVATID = regexp.MustCompile(`^[A-Z]{2}[0-9A-Z+*]{2,13}$`)
+
+// normalizeVATID strips spaces and upper-cases a VAT identification number.
+func normalizeVATID(s string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(s), " ", ""))
+}
+
+// validTaxTreatment reports whether s is a known tax treatment.
+func validTaxTreatment(s string) bool {
+	switch s {
+	case models.TaxTreatmentDomestic, models.TaxTreatmentReverseCharge, models.TaxTreatmentIntraEU,
+		models.TaxTreatmentExport, models.TaxTreatmentExempt:
+		return true
+	}
+	return false
+}
+
+// zeroRated reports whether a treatment bills the lines without VAT.
+func zeroRated(treatment string) bool {
+	return treatment != "" && treatment != models.TaxTreatmentDomestic
+}
+
+// needsCustomerVATID reports whether a treatment is only valid for customers with a
+// VAT identification number (EU B2B).
+func needsCustomerVATID(treatment string) bool {
+	return treatment == models.TaxTreatmentReverseCharge || treatment == models.TaxTreatmentIntraEU
+}
+
+// taxNotice returns the legal notice a treatment requires on the invoice
+// (Art. 226 MwStSystRL), worded for the issuer's country.
+func taxNotice(treatment, companyCountry, customerVATID string) string {
+	switch treatment {
+	case models.TaxTreatmentReverseCharge:
+		return "Steuerschuldnerschaft des Leistungsempfängers (Reverse Charge). UID des Leistungsempfängers: " + customerVATID
+	case models.TaxTreatmentIntraEU:
+		return "Steuerfreie innergemeinschaftliche Lieferung. UID des Leistungsempfängers: " + customerVATID
+	case models.TaxTreatmentExport:
+		return "Steuerfreie Ausfuhrlieferung."
+	case models.TaxTreatmentExempt:
+		if documents.CountryCode(companyCountry) == "DE" {
+			return "Gemäß § 19 UStG wird keine Umsatzsteuer berechnet."
+		}
+		return "Umsatzsteuerfrei aufgrund der Kleinunternehmerregelung gemäß § 6 Abs. 1 Z 27 UStG."
+	}
+	return ""
+}
+
+// taxTreatmentFor resolves a document's tax treatment and legal notice for the
+// customer: the requested treatment, else the customer's default, else "exempt" for
+// small businesses and "domestic" otherwise. EU B2B treatments need the customer's
+// VAT identification number.
+func taxTreatmentFor(tx *gorm.DB, schema string, customerID uint, requested string) (string, string, error) {
+	var customer models.Customer
+	if err := tx.First(&customer, "id = ?", customerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", "", fiber.NewError(fiber.StatusBadRequest, "customer not found")
+		}
+		return "", "", err
+	}
+	company, err := loadCompany(tx, schema)
+	if err != nil {
+		return "", "", err
+	}
+	treatment := requested
+	if treatment == "" {
+		treatment = customer.TaxTreatment
+	}
+	if treatment == "" {
+		treatment = models.TaxTreatmentDomestic
+		if company.SmallBusiness {
+			treatment = models.TaxTreatmentExempt
+		}
+	}
+	vatID := normalizeVATID(customer.UID)
+	if needsCustomerVATID(treatment) && !reVATID.MatchString(vatID) {
+		return "", "", fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("tax treatment %s requires a valid customer uid", treatment))
+	}
+	return treatment, taxNotice(treatment, company.Country, vatID), nil
+}
+
+// ===== Handlers =====
+
+// POST /api/tax-category
+func CreateTaxCategory(c *fiber.Ctx) error {
+	var in TaxCategoryCreateDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+	in.Name = strings.TrimSpace(in.Name)
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	category := models.TaxCategory{
+		Name:      in.Name,
+		Rate:      in.Rate,
+		IsDefault: in.IsDefault,
+		Active:    true,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&category).Error; err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "could not create tax category")
+		}
+		if category.IsDefault {
+			return clearDefaultTaxCategory(tx, category.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(category)
+}
+
+// GET /api/tax-categories?active=true|false
+func GetTaxCategories(c *fiber.Ctx) error {
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	query := db.Model(&models.TaxCategory{})
+	if activeStr := strings.TrimSpace(c.Query("active")); activeStr != "" {
+		if active, err := strconv.ParseBool(activeStr); err == nil {
+			query = query.Where("active = ?", active)
+		}
+	}
+
+	var categories []models.TaxCategory
+	if err := query.Order("rate DESC, id ASC").Find(&categories).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+	return c.JSON(fiber.Map{"tax_categories": categories, "message": "success"})
+}
+
+// PUT /api/tax-categories/:id
+func UpdateTaxCategory(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid tax category id")
+	}
+
+	var in TaxCategoryUpdateDTO
+	if err := middlewares.BindAndValidate(c, &in); err != nil {
+		return err
+	}
+	if in.Name != nil {
+		trim := strings.TrimSpace(*in.Name)
+		in.Name = &trim
+	}
+
+	db, err := database.GetTenantDB(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "tenant db unavailable")
+	}
+
+	// Ensure exists for clean 404
+	var existing models.TaxCategory
+	if err := db.First(&existing, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "tax category not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "db error")
+	}
+
+	updates := utils.UpdatesFromPtrDTO(&in, nil)
+	if len(updates) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "no fields to update")
+	}
+	updates["version"] = gorm.Expr("version + 1")
+
+	var out models.TaxCategory
+	err = db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.TaxCategory{}).
+			Where("id = ? AND version = ?", id, in.Version).
+			Updates(updates)
+		if res.Error != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "could not update tax category")
+		}
+		if res.RowsAffected == 0 {
+			return fiber.NewError(fiber.StatusConflict, "stale update, please reload")
+		}
+		if in.IsDefault != nil && *in.IsDefault {
+			if err := clearDefaultTaxCategory(tx, uint(id)); err != nil {
+				return err
+			}
+		}
+		return tx.First(&out, "id = ?", id).Error
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(out)
+}
@@ -11,11 +11,20 @@ import (
 // MigrateTenantSchema applies (idempotent) schema migrations for a single tenant schema.
 // It pins search_path to the tenant and performs:
 // - AutoMigrate (tables/columns)
-// - Money column types (NUMERIC(12,2))
+// - Money column types (NUMERIC(12,2)) and line quantities (NUMERIC(12,3))
 // - Indexes (versions, payments, invoice_items)
 // - Foreign key: invoice_items.article_id → articles.id
 // - Basic CHECK constraints
+// - Read-only triggers for published invoices, their items and down-payment deductions
 // - Idempotency keys table + unique index
+// - Default tax categories (seeded once for a fresh tenant)
+// - Document types replacing the former draft flag (existing rows converted once)
+// - Number sequences per document type (partial unique indexes on the numbers)
+// - Due dates for published invoices and default dunning levels
+// - Recurring invoice templates and their run log
+// - Bank statements, CSV import profiles and statement lines
+// - SEPA direct debit batches
+// - Exchange rates; documents issued before currencies existed are locked as EUR
 func MigrateTenantSchema(schema string) error {
 	if schema == "" {
 		return fmt.Errorf("schema name is empty")
@@ -27,16 +36,47 @@ func MigrateTenantSchema(schema string) error {
 			return fmt.Errorf("set search_path failed: %w", err)
 		}
 
+		// --- invoice_number: plain unique constraint -> partial unique index (below),
+		// so that unnumbered drafts ("") don't collide ---
+		for _, stmt := range []string{
+			`ALTER TABLE IF EXISTS invoices DROP CONSTRAINT IF EXISTS uni_invoices_invoice_number`,
+			`ALTER TABLE IF EXISTS invoices DROP CONSTRAINT IF EXISTS invoices_invoice_number_key`,
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("invoice number constraint migration failed: %w", err)
+			}
+		}
+
+		// --- Existing invoices get the usual 14-day term; AutoMigrate then resets the
+		// column default to 0 so an explicit "due immediately" is not overridden ---
+		if err := tx.Exec(`ALTER TABLE IF EXISTS invoices ADD COLUMN IF NOT EXISTS payment_term_days bigint NOT NULL DEFAULT 14`).Error; err != nil {
+			return fmt.Errorf("payment term migration failed: %w", err)
+		}
+
 		// --- AutoMigrate tables/columns/index tags (non-destructive) ---
 		if err := tx.AutoMigrate(
+			&models.TaxCategory{},
 			&models.Article{},
 			&models.Customer{},
 			&models.Supplier{},
 			&models.Invoice{},
 			&models.InvoiceItem{},
+			&models.InvoiceDeduction{},
 			&models.InvoiceVersion{},
 			&models.Payment{},
 			&models.IdempotencyKey{}, // NEW
+			&models.NumberSequence{},
+			&models.InvoiceDocument{},
+			&models.DunningLevel{},
+			&models.DunningNotice{},
+			&models.RecurringInvoice{},
+			&models.RecurringRun{},
+			&models.BankCSVProfile{},
+			&models.BankStatement{},
+			&models.BankStatementLine{},
+			&models.DirectDebitBatch{},
+			&models.DirectDebitItem{},
+			&models.ExchangeRate{},
 		); err != nil {
 			return fmt.Errorf("tenant automigrate failed: %w", err)
 		}
@@ -49,10 +89,12 @@ func MigrateTenantSchema(schema string) error {
 			`ALTER TABLE invoices       ALTER COLUMN total      TYPE numeric(12,2)`,
 			`ALTER TABLE invoices       ALTER COLUMN paid_total TYPE numeric(12,2)`,
 			`ALTER TABLE invoice_items  ALTER COLUMN unit_price TYPE numeric(12,2)`,
+			`ALTER TABLE invoice_items  ALTER COLUMN amount     TYPE numeric(12,3)`, // quantity
 			`ALTER TABLE invoice_items  ALTER COLUMN net_price  TYPE numeric(12,2)`,
 			`ALTER TABLE invoice_items  ALTER COLUMN tax_amount TYPE numeric(12,2)`,
 			`ALTER TABLE invoice_items  ALTER COLUMN gross_price TYPE numeric(12,2)`,
 			`ALTER TABLE payments       ALTER COLUMN amount     TYPE numeric(12,2)`,
+			`ALTER TABLE invoice_items  ALTER COLUMN tax_rate   TYPE numeric(5,4)`,
 		}
 		for _, stmt := range alters {
 			if err := tx.Exec(stmt).Error; err != nil {
@@ -60,6 +102,30 @@ func MigrateTenantSchema(schema string) error {
 			}
 		}
 
+		// --- Dedupe keys for statement lines imported before they had one (same
+		// formula as the import: account, booking date, amount, reference, occurrence) ---
+		lineKeys := `
+UPDATE bank_statement_lines l
+SET dedupe_key = k.key
+FROM (
+	SELECT l.id, md5(concat_ws('|',
+		upper(replace(s.account_iban, ' ', '')),
+		to_char(l.booking_date, 'YYYY-MM-DD'),
+		l.amount::text,
+		COALESCE(NULLIF(l.bank_reference, ''), NULLIF(l.end_to_end_id, ''), l.counterparty_iban || '/' || l.remittance_info),
+		row_number() OVER (
+			PARTITION BY upper(replace(s.account_iban, ' ', '')), l.booking_date, l.amount,
+				COALESCE(NULLIF(l.bank_reference, ''), NULLIF(l.end_to_end_id, ''), l.counterparty_iban || '/' || l.remittance_info)
+			ORDER BY l.id)::text)) AS key
+	FROM bank_statement_lines l
+	JOIN bank_statements s ON s.id = l.statement_id
+	WHERE l.dedupe_key = ''
+) k
+WHERE l.id = k.id;`
+		if err := tx.Exec(lineKeys).Error; err != nil {
+			return fmt.Errorf("statement line dedupe key backfill failed: %w", err)
+		}
+
 		// --- Composite / helpful indexes (idempotent) ---
 		indexes := []string{
 			`CREATE UNIQUE INDEX IF NOT EXISTS idx_invoice_versions_invoice_id_version_no ON invoice_versions (invoice_id, version_no)`,
@@ -67,6 +133,11 @@ func MigrateTenantSchema(schema string) error {
 			`CREATE INDEX IF NOT EXISTS idx_invoice_items_invoice ON invoice_items (invoice_id)`,
 			`CREATE INDEX IF NOT EXISTS idx_invoice_items_article ON invoice_items (article_id)`,
 			`CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_keys_key ON idempotency_keys (key)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_invoice_documents_version_format ON invoice_documents (invoice_id, version_no, format)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_invoice_number ON invoices (invoice_number) WHERE invoice_number <> ''`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_quotation_number ON invoices (quotation_number) WHERE quotation_number <> ''`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_document_number ON invoices (document_type, document_number) WHERE document_number <> ''`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_bank_statement_lines_dedupe_key ON bank_statement_lines (dedupe_key) WHERE status <> 'duplicate'`,
 		}
 		for _, stmt := range indexes {
 			if err := tx.Exec(stmt).Error; err != nil {
@@ -116,17 +187,23 @@ END $$;`
 					CHECK (unit_price >= 0);
 				END IF;
 			END $$;`,
-			// Payments.amount >= 0
+			// Payments: received amounts >= 0, refunds < 0 and linked to the original,
+			// early-payment discounts > 0
+			// (replaces the former chk_payments_amount_nonneg and chk_payments_amount_sign)
+			`ALTER TABLE payments DROP CONSTRAINT IF EXISTS chk_payments_amount_nonneg`,
+			`ALTER TABLE payments DROP CONSTRAINT IF EXISTS chk_payments_amount_sign`,
 			`DO $$
 			BEGIN
 				IF NOT EXISTS (
 					SELECT 1 FROM pg_constraint
 					WHERE conrelid = 'payments'::regclass
-					  AND conname  = 'chk_payments_amount_nonneg'
+					  AND conname  = 'chk_payments_amount_kind'
 				) THEN
 					ALTER TABLE payments
-					ADD CONSTRAINT chk_payments_amount_nonneg
-					CHECK (amount >= 0);
+					ADD CONSTRAINT chk_payments_amount_kind
+					CHECK ((kind = 'payment' AND amount >= 0)
+					    OR (kind = 'refund' AND amount < 0 AND refund_of_id IS NOT NULL)
+					    OR (kind = 'discount' AND amount > 0));
 				END IF;
 			END $$;`,
 			// Invoice items: amount >= 0
@@ -149,6 +226,162 @@ END $$;`
 			}
 		}
 
+		// --- Due dates and base-currency totals for invoices published before payment
+		// terms and currencies existed ---
+		// (runs while the read-only guard is dropped; it is recreated right below)
+		backfill := []string{
+			`DROP TRIGGER IF EXISTS trg_invoices_guard_published ON invoices`,
+			`UPDATE invoices
+				SET due_date = published_at + payment_term_days * interval '1 day'
+				WHERE published AND due_date IS NULL AND published_at IS NOT NULL AND corrects_id IS NULL`,
+			// everything was billed in EUR before documents had a currency
+			`UPDATE invoices
+				SET base_currency = currency, exchange_rate = 1, exchange_rate_date = published_at::date,
+					base_subtotal = subtotal, base_tax_total = tax_total, base_total = total
+				WHERE published AND base_currency = '' AND currency = 'EUR'`,
+		}
+		for _, stmt := range backfill {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("published invoice backfill failed: %w", err)
+			}
+		}
+
+		// --- Document types: the former draft flag meant "quotation", credit notes are
+		// the rows correcting an invoice. Converted once, then the column is dropped
+		// (also while the read-only guard is dropped) ---
+		docTypes := `
+DO $$
+BEGIN
+	IF EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'invoices' AND column_name = 'draft'
+	) THEN
+		UPDATE invoices SET document_type = CASE
+			WHEN corrects_id IS NOT NULL THEN 'credit_note'
+			WHEN draft THEN 'quotation'
+			ELSE 'invoice'
+		END;
+		ALTER TABLE invoices DROP COLUMN draft;
+	END IF;
+END$$;`
+		if err := tx.Exec(docTypes).Error; err != nil {
+			return fmt.Errorf("document type migration failed: %w", err)
+		}
+		// Quotations finalized before they had a status count as sent
+		if err := tx.Exec(`UPDATE invoices SET quotation_status = 'sent'
+			WHERE document_type = 'quotation' AND published AND quotation_status = ''`).Error; err != nil {
+			return fmt.Errorf("quotation status backfill failed: %w", err)
+		}
+
+		// --- Published invoices are read-only (GoBD / BAO) ---
+		// Only payment summary / cancellation / collection fields and a quotation's status
+		// may change once published; published rows cannot be deleted and their items and
+		// deductions are frozen.
+		guards := []string{
+			`CREATE OR REPLACE FUNCTION invoices_guard_published() RETURNS trigger AS $$
+			DECLARE
+				mutable text[] := ARRAY['paid_total', 'cancelled', 'cancelled_at', 'collection_pending', 'quotation_status'];
+			BEGIN
+				IF TG_OP = 'DELETE' THEN
+					IF OLD.published THEN
+						RAISE EXCEPTION 'invoice % is published and cannot be deleted', OLD.id
+							USING ERRCODE = 'integrity_constraint_violation';
+					END IF;
+					RETURN OLD;
+				END IF;
+				IF OLD.published AND (to_jsonb(NEW) - mutable) IS DISTINCT FROM (to_jsonb(OLD) - mutable) THEN
+					RAISE EXCEPTION 'invoice % is published and read-only', OLD.id
+						USING ERRCODE = 'integrity_constraint_violation';
+				END IF;
+				RETURN NEW;
+			END;
+			$$ LANGUAGE plpgsql`,
+			`DROP TRIGGER IF EXISTS trg_invoices_guard_published ON invoices`,
+			`CREATE TRIGGER trg_invoices_guard_published
+				BEFORE UPDATE OR DELETE ON invoices
+				FOR EACH ROW EXECUTE FUNCTION invoices_guard_published()`,
+			`CREATE OR REPLACE FUNCTION invoice_items_guard_published() RETURNS trigger AS $$
+			BEGIN
+				IF TG_OP IN ('UPDATE', 'DELETE') AND EXISTS (
+					SELECT 1 FROM invoices WHERE id = OLD.invoice_id AND published
+				) THEN
+					RAISE EXCEPTION 'items of published invoice % are read-only', OLD.invoice_id
+						USING ERRCODE = 'integrity_constraint_violation';
+				END IF;
+				IF TG_OP IN ('INSERT', 'UPDATE') AND EXISTS (
+					SELECT 1 FROM invoices WHERE id = NEW.invoice_id AND published
+				) THEN
+					RAISE EXCEPTION 'items of published invoice % are read-only', NEW.invoice_id
+						USING ERRCODE = 'integrity_constraint_violation';
+				END IF;
+				IF TG_OP = 'DELETE' THEN
+					RETURN OLD;
+				END IF;
+				RETURN NEW;
+			END;
+			$$ LANGUAGE plpgsql`,
+			`DROP TRIGGER IF EXISTS trg_invoice_items_guard_published ON invoice_items`,
+			`CREATE TRIGGER trg_invoice_items_guard_published
+				BEFORE INSERT OR UPDATE OR DELETE ON invoice_items
+				FOR EACH ROW EXECUTE FUNCTION invoice_items_guard_published()`,
+			// same rule for a final invoice's down-payment deductions (the function only uses invoice_id)
+			`DROP TRIGGER IF EXISTS trg_invoice_deductions_guard_published ON invoice_deductions`,
+			`CREATE TRIGGER trg_invoice_deductions_guard_published
+				BEFORE INSERT OR UPDATE OR DELETE ON invoice_deductions
+				FOR EACH ROW EXECUTE FUNCTION invoice_items_guard_published()`,
+		}
+		for _, stmt := range guards {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("read-only guard migration failed: %w", err)
+			}
+		}
+
+		// --- Seed default tax categories (Austrian rates) only if none exist yet ---
+		seed := `
+INSERT INTO tax_categories (name, rate, is_default, active, version)
+SELECT v.name, v.rate, v.is_default, true, 1
+FROM (VALUES
+	('standard', 0.2000, true),
+	('reduced', 0.1000, false),
+	('reduced-13', 0.1300, false),
+	('zero', 0.0000, false)
+) AS v(name, rate, is_default)
+WHERE NOT EXISTS (SELECT 1 FROM tax_categories);`
+		if err := tx.Exec(seed).Error; err != nil {
+			return fmt.Errorf("tax category seed failed: %w", err)
+		}
+
+		// --- Seed number sequences (one per numbered document type), keep existing configuration ---
+		seqSeed := `
+INSERT INTO number_sequences (kind, prefix, format, padding, yearly_reset, year, last_value, version)
+VALUES
+	('invoice',   'RE', '{prefix}{yyyy}-{seq}', 5, true, 0, 0, 1),
+	('quotation', 'AN', '{prefix}{yyyy}-{seq}', 5, true, 0, 0, 1),
+	('credit_note', 'GS', '{prefix}{yyyy}-{seq}', 5, true, 0, 0, 1),
+	('order_confirmation', 'AB', '{prefix}{yyyy}-{seq}', 5, true, 0, 0, 1),
+	('delivery_note', 'LS', '{prefix}{yyyy}-{seq}', 5, true, 0, 0, 1)
+ON CONFLICT (kind) DO NOTHING;`
+		if err := tx.Exec(seqSeed).Error; err != nil {
+			return fmt.Errorf("number sequence seed failed: %w", err)
+		}
+
+		// --- Seed default dunning levels only if none exist yet ---
+		dunningSeed := `
+INSERT INTO dunning_levels (level, name, days_overdue, payment_days, fee, interest_rate, text, active, version)
+SELECT v.level, v.name, v.days_overdue, v.payment_days, v.fee, v.interest_rate, v.text, true, 1
+FROM (VALUES
+	(1, 'Zahlungserinnerung', 7, 7, 0.00, 0.0000,
+		'Sicher haben Sie übersehen, dass die folgende Rechnung bereits fällig ist. Wir bitten Sie um Begleichung des offenen Betrags.'),
+	(2, '1. Mahnung', 21, 7, 5.00, 0.0400,
+		'Leider konnten wir trotz unserer Zahlungserinnerung noch keinen Zahlungseingang feststellen.'),
+	(3, '2. Mahnung', 35, 7, 10.00, 0.0400,
+		'Trotz wiederholter Aufforderung ist die folgende Rechnung weiterhin offen. Bitte begleichen Sie den Betrag umgehend, um weitere Schritte zu vermeiden.')
+) AS v(level, name, days_overdue, payment_days, fee, interest_rate, text)
+WHERE NOT EXISTS (SELECT 1 FROM dunning_levels);`
+		if err := tx.Exec(dunningSeed).Error; err != nil {
+			return fmt.Errorf("dunning level seed failed: %w", err)
+		}
+
 		return nil
 	})
 }
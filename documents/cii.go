@@ -0,0 +1,381 @@
+package documents
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// UN/CEFACT Cross Industry Invoice (D16B) structures, limited to the EN 16931 subset.
+
+type ciiText struct {
+	Value    string `xml:",chardata"`
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+}
+
+type ciiAmount struct {
+	Value      string `xml:",chardata"`
+	CurrencyID string `xml:"currencyID,attr,omitempty"`
+}
+
+type ciiQuantity struct {
+	Value    string `xml:",chardata"`
+	UnitCode string `xml:"unitCode,attr"`
+}
+
+type ciiDate struct {
+	DateTimeString struct {
+		Value  string `xml:",chardata"`
+		Format string `xml:"format,attr"`
+	} `xml:"udt:DateTimeString"`
+}
+
+func newCIIDate(t time.Time) *ciiDate {
+	d := &ciiDate{}
+	d.DateTimeString.Value = t.Format("20060102")
+	d.DateTimeString.Format = "102"
+	return d
+}
+
+type ciiID struct {
+	ID string `xml:"ram:ID"`
+}
+
+type ciiAddress struct {
+	PostcodeCode string `xml:"ram:PostcodeCode,omitempty"`
+	LineOne      string `xml:"ram:LineOne,omitempty"`
+	CityName     string `xml:"ram:CityName,omitempty"`
+	CountryID    string `xml:"ram:CountryID"`
+}
+
+type ciiContact struct {
+	PersonName string `xml:"ram:PersonName,omitempty"`
+	Telephone  *struct {
+		CompleteNumber string `xml:"ram:CompleteNumber"`
+	} `xml:"ram:TelephoneUniversalCommunication,omitempty"`
+	Email *struct {
+		URIID string `xml:"ram:URIID"`
+	} `xml:"ram:EmailURIUniversalCommunication,omitempty"`
+}
+
+type ciiParty struct {
+	Name    string      `xml:"ram:Name"`
+	Contact *ciiContact `xml:"ram:DefinedTradeContact,omitempty"`
+	Address ciiAddress  `xml:"ram:PostalTradeAddress"`
+	URI     *struct {
+		URIID ciiText `xml:"ram:URIID"`
+	} `xml:"ram:URIUniversalCommunication,omitempty"`
+	TaxRegistration *struct {
+		ID ciiText `xml:"ram:ID"`
+	} `xml:"ram:SpecifiedTaxRegistration,omitempty"`
+}
+
+type ciiTradeTax struct {
+	CalculatedAmount *ciiAmount `xml:"ram:CalculatedAmount,omitempty"`
+	TypeCode         string     `xml:"ram:TypeCode"`
+	ExemptionReason  string     `xml:"ram:ExemptionReason,omitempty"`
+	BasisAmount      *ciiAmount `xml:"ram:BasisAmount,omitempty"`
+	CategoryCode     string     `xml:"ram:CategoryCode"`
+	ExemptionCode    string     `xml:"ram:ExemptionReasonCode,omitempty"`
+	RatePercent      string     `xml:"ram:RateApplicablePercent,omitempty"`
+}
+
+type ciiDelivery struct {
+	ShipTo *struct {
+		Address ciiAddress `xml:"ram:PostalTradeAddress"`
+	} `xml:"ram:ShipToTradeParty,omitempty"`
+	Event *struct {
+		Date *ciiDate `xml:"ram:OccurrenceDateTime"`
+	} `xml:"ram:ActualDeliverySupplyChainEvent,omitempty"`
+}
+
+// ciiAllowance is a trade allowance (ChargeIndicator false), on a line or the document.
+type ciiAllowance struct {
+	ChargeIndicator struct {
+		Indicator bool `xml:"udt:Indicator"`
+	} `xml:"ram:ChargeIndicator"`
+	CalculationPercent string       `xml:"ram:CalculationPercent,omitempty"`
+	BasisAmount        *ciiAmount   `xml:"ram:BasisAmount,omitempty"`
+	ActualAmount       ciiAmount    `xml:"ram:ActualAmount"`
+	Reason             string       `xml:"ram:Reason,omitempty"`
+	Tax                *ciiTradeTax `xml:"ram:CategoryTradeTax,omitempty"`
+}
+
+type ciiLineItem struct {
+	LineDocument struct {
+		LineID string `xml:"ram:LineID"`
+	} `xml:"ram:AssociatedDocumentLineDocument"`
+	Product struct {
+		SellerAssignedID string `xml:"ram:SellerAssignedID,omitempty"`
+		Name             string `xml:"ram:Name"`
+	} `xml:"ram:SpecifiedTradeProduct"`
+	Agreement struct {
+		NetPrice struct {
+			ChargeAmount ciiAmount `xml:"ram:ChargeAmount"`
+		} `xml:"ram:NetPriceProductTradePrice"`
+	} `xml:"ram:SpecifiedLineTradeAgreement"`
+	Delivery struct {
+		BilledQuantity ciiQuantity `xml:"ram:BilledQuantity"`
+	} `xml:"ram:SpecifiedLineTradeDelivery"`
+	Settlement struct {
+		Tax        ciiTradeTax    `xml:"ram:ApplicableTradeTax"`
+		Allowances []ciiAllowance `xml:"ram:SpecifiedTradeAllowanceCharge,omitempty"`
+		Summation  struct {
+			LineTotalAmount ciiAmount `xml:"ram:LineTotalAmount"`
+		} `xml:"ram:SpecifiedTradeSettlementLineMonetarySummation"`
+	} `xml:"ram:SpecifiedLineTradeSettlement"`
+}
+
+type ciiPaymentMeans struct {
+	TypeCode string `xml:"ram:TypeCode"`
+	Account  *struct {
+		IBANID string `xml:"ram:IBANID"`
+	} `xml:"ram:PayeePartyCreditorFinancialAccount,omitempty"`
+	Institution *struct {
+		BICID string `xml:"ram:BICID"`
+	} `xml:"ram:PayeeSpecifiedCreditorFinancialInstitution,omitempty"`
+}
+
+type ciiPaymentTerms struct {
+	Description string   `xml:"ram:Description,omitempty"`
+	DueDate     *ciiDate `xml:"ram:DueDateDateTime,omitempty"`
+}
+
+type ciiSummation struct {
+	LineTotalAmount      ciiAmount   `xml:"ram:LineTotalAmount"`
+	AllowanceTotalAmount *ciiAmount  `xml:"ram:AllowanceTotalAmount,omitempty"`
+	TaxBasisTotalAmount  ciiAmount   `xml:"ram:TaxBasisTotalAmount"`
+	TaxTotalAmount       []ciiAmount `xml:"ram:TaxTotalAmount"` // BT-110, BT-111
+	GrandTotalAmount     ciiAmount   `xml:"ram:GrandTotalAmount"`
+	TotalPrepaidAmount   *ciiAmount  `xml:"ram:TotalPrepaidAmount,omitempty"`
+	DuePayableAmount     ciiAmount   `xml:"ram:DuePayableAmount"`
+}
+
+type ciiReferencedDocument struct {
+	IssuerAssignedID string   `xml:"ram:IssuerAssignedID"`
+	IssueDate        *ciiDate `xml:"ram:FormattedIssueDateTime,omitempty"`
+}
+
+type ciiInvoice struct {
+	XMLName  xml.Name `xml:"rsm:CrossIndustryInvoice"`
+	XmlnsRSM string   `xml:"xmlns:rsm,attr"`
+	XmlnsRAM string   `xml:"xmlns:ram,attr"`
+	XmlnsQDT string   `xml:"xmlns:qdt,attr"`
+	XmlnsUDT string   `xml:"xmlns:udt,attr"`
+
+	Context struct {
+		BusinessProcess *ciiID `xml:"ram:BusinessProcessSpecifiedDocumentContextParameter,omitempty"`
+		Guideline       ciiID  `xml:"ram:GuidelineSpecifiedDocumentContextParameter"`
+	} `xml:"rsm:ExchangedDocumentContext"`
+
+	Document struct {
+		ID        string   `xml:"ram:ID"`
+		TypeCode  string   `xml:"ram:TypeCode"`
+		IssueDate *ciiDate `xml:"ram:IssueDateTime"`
+		Notes     []struct {
+			Content string `xml:"ram:Content"`
+		} `xml:"ram:IncludedNote,omitempty"`
+	} `xml:"rsm:ExchangedDocument"`
+
+	Transaction struct {
+		Lines     []ciiLineItem `xml:"ram:IncludedSupplyChainTradeLineItem"`
+		Agreement struct {
+			BuyerReference string   `xml:"ram:BuyerReference,omitempty"`
+			Seller         ciiParty `xml:"ram:SellerTradeParty"`
+			Buyer          ciiParty `xml:"ram:BuyerTradeParty"`
+		} `xml:"ram:ApplicableHeaderTradeAgreement"`
+		Delivery   ciiDelivery `xml:"ram:ApplicableHeaderTradeDelivery"`
+		Settlement struct {
+			TaxCurrency  string                 `xml:"ram:TaxCurrencyCode,omitempty"`
+			Currency     string                 `xml:"ram:InvoiceCurrencyCode"`
+			PaymentMeans ciiPaymentMeans        `xml:"ram:SpecifiedTradeSettlementPaymentMeans"`
+			Taxes        []ciiTradeTax          `xml:"ram:ApplicableTradeTax"`
+			Allowances   []ciiAllowance         `xml:"ram:SpecifiedTradeAllowanceCharge,omitempty"`
+			PaymentTerms *ciiPaymentTerms       `xml:"ram:SpecifiedTradePaymentTerms,omitempty"`
+			Summation    ciiSummation           `xml:"ram:SpecifiedTradeSettlementHeaderMonetarySummation"`
+			Preceding    *ciiReferencedDocument `xml:"ram:InvoiceReferencedDocument,omitempty"`
+		} `xml:"ram:ApplicableHeaderTradeSettlement"`
+	} `xml:"rsm:SupplyChainTradeTransaction"`
+}
+
+func ciiPartyFrom(p EParty, withContact bool) ciiParty {
+	out := ciiParty{
+		Name: p.Name,
+		Address: ciiAddress{
+			PostcodeCode: p.PostCode,
+			LineOne:      p.Street,
+			CityName:     p.City,
+			CountryID:    p.CountryCode,
+		},
+	}
+	if withContact && (p.ContactName != "" || p.ContactPhone != "" || p.ContactEmail != "") {
+		ct := &ciiContact{PersonName: p.ContactName}
+		if p.ContactPhone != "" {
+			ct.Telephone = &struct {
+				CompleteNumber string `xml:"ram:CompleteNumber"`
+			}{p.ContactPhone}
+		}
+		if p.ContactEmail != "" {
+			ct.Email = &struct {
+				URIID string `xml:"ram:URIID"`
+			}{p.ContactEmail}
+		}
+		out.Contact = ct
+	}
+	if p.Email != "" {
+		out.URI = &struct {
+			URIID ciiText `xml:"ram:URIID"`
+		}{ciiText{Value: p.Email, SchemeID: "EM"}}
+	}
+	if p.VATID != "" {
+		out.TaxRegistration = &struct {
+			ID ciiText `xml:"ram:ID"`
+		}{ciiText{Value: p.VATID, SchemeID: "VA"}}
+	}
+	return out
+}
+
+// RenderCII serializes the e-invoice as UN/CEFACT CII XML. format selects the
+// specification identifier: XRechnung 3.0 or plain EN 16931 (used by Factur-X).
+func RenderCII(e EInvoice, format string) ([]byte, error) {
+	var x ciiInvoice
+	x.XmlnsRSM = "urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100"
+	x.XmlnsRAM = "urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100"
+	x.XmlnsQDT = "urn:un:unece:uncefact:data:standard:QualifiedDataType:100"
+	x.XmlnsUDT = "urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100"
+
+	if format == FormatXRechnungCII {
+		x.Context.BusinessProcess = &ciiID{ID: processPeppol}
+		x.Context.Guideline.ID = specXRechnung
+	} else {
+		x.Context.Guideline.ID = specEN16931
+	}
+
+	x.Document.ID = e.Number
+	x.Document.TypeCode = e.TypeCode
+	x.Document.IssueDate = newCIIDate(e.IssueDate)
+	if e.Note != "" {
+		x.Document.Notes = append(x.Document.Notes, struct {
+			Content string `xml:"ram:Content"`
+		}{e.Note})
+	}
+
+	t := &x.Transaction
+	for _, l := range e.Lines {
+		var li ciiLineItem
+		li.LineDocument.LineID = l.ID
+		li.Product.SellerAssignedID = l.ArticleID
+		li.Product.Name = l.Name
+		li.Agreement.NetPrice.ChargeAmount = ciiAmount{Value: amount(l.NetPrice)}
+		li.Delivery.BilledQuantity = ciiQuantity{Value: decimal(l.Quantity), UnitCode: l.UnitCode}
+		li.Settlement.Tax = ciiTradeTax{
+			TypeCode:     "VAT",
+			CategoryCode: l.TaxCategory,
+			RatePercent:  decimal(l.TaxPercent),
+		}
+		if l.Discount != 0 {
+			a := ciiAllowance{
+				BasisAmount:  &ciiAmount{Value: amount(l.DiscountBase)},
+				ActualAmount: ciiAmount{Value: amount(l.Discount)},
+				Reason:       "Rabatt",
+			}
+			if l.DiscountPercent > 0 {
+				a.CalculationPercent = decimal(l.DiscountPercent)
+			}
+			li.Settlement.Allowances = append(li.Settlement.Allowances, a)
+		}
+		li.Settlement.Summation.LineTotalAmount = ciiAmount{Value: amount(l.NetAmount)}
+		t.Lines = append(t.Lines, li)
+	}
+
+	t.Agreement.BuyerReference = e.BuyerReference
+	t.Agreement.Seller = ciiPartyFrom(e.Seller, true)
+	t.Agreement.Buyer = ciiPartyFrom(e.Buyer, false)
+	if e.DeliverTo != "" {
+		t.Delivery.ShipTo = &struct {
+			Address ciiAddress `xml:"ram:PostalTradeAddress"`
+		}{ciiAddress{CountryID: e.DeliverTo}}
+	}
+	if e.DeliveryDate != nil {
+		t.Delivery.Event = &struct {
+			Date *ciiDate `xml:"ram:OccurrenceDateTime"`
+		}{newCIIDate(*e.DeliveryDate)}
+	}
+
+	s := &t.Settlement
+	s.TaxCurrency = e.TaxCurrency
+	s.Currency = e.Currency
+	s.PaymentMeans.TypeCode = e.PaymentMeans
+	if e.IBAN != "" {
+		s.PaymentMeans.Account = &struct {
+			IBANID string `xml:"ram:IBANID"`
+		}{e.IBAN}
+	}
+	if e.BIC != "" {
+		s.PaymentMeans.Institution = &struct {
+			BICID string `xml:"ram:BICID"`
+		}{e.BIC}
+	}
+	for _, tx := range e.Taxes {
+		s.Taxes = append(s.Taxes, ciiTradeTax{
+			CalculatedAmount: &ciiAmount{Value: amount(tx.Amount)},
+			TypeCode:         "VAT",
+			ExemptionReason:  tx.ExemptionReason,
+			BasisAmount:      &ciiAmount{Value: amount(tx.Basis)},
+			CategoryCode:     tx.Category,
+			ExemptionCode:    tx.ExemptionCode,
+			RatePercent:      decimal(tx.Percent),
+		})
+	}
+	for _, al := range e.Allowances {
+		a := ciiAllowance{
+			BasisAmount:  &ciiAmount{Value: amount(al.Base)},
+			ActualAmount: ciiAmount{Value: amount(al.Amount)},
+			Reason:       al.Reason,
+			Tax: &ciiTradeTax{
+				TypeCode:     "VAT",
+				CategoryCode: al.TaxCategory,
+				RatePercent:  decimal(al.TaxPercent),
+			},
+		}
+		if al.Percent > 0 {
+			a.CalculationPercent = decimal(al.Percent)
+		}
+		s.Allowances = append(s.Allowances, a)
+	}
+	if e.PaymentTerms != "" || e.DueDate != nil {
+		s.PaymentTerms = &ciiPaymentTerms{Description: e.PaymentTerms}
+		if e.DueDate != nil {
+			s.PaymentTerms.DueDate = newCIIDate(*e.DueDate)
+		}
+	}
+	s.Summation = ciiSummation{
+		LineTotalAmount:     ciiAmount{Value: amount(e.LineTotal)},
+		TaxBasisTotalAmount: ciiAmount{Value: amount(e.TaxBasisTotal)},
+		TaxTotalAmount:      []ciiAmount{{Value: amount(e.TaxTotal), CurrencyID: e.Currency}},
+		GrandTotalAmount:    ciiAmount{Value: amount(e.GrandTotal)},
+		DuePayableAmount:    ciiAmount{Value: amount(e.DuePayable)},
+	}
+	if e.TaxCurrency != "" {
+		s.Summation.TaxTotalAmount = append(s.Summation.TaxTotalAmount,
+			ciiAmount{Value: amount(e.TaxTotalBase), CurrencyID: e.TaxCurrency})
+	}
+	if e.AllowanceTotal != 0 {
+		s.Summation.AllowanceTotalAmount = &ciiAmount{Value: amount(e.AllowanceTotal)}
+	}
+	if e.Prepaid != 0 {
+		s.Summation.TotalPrepaidAmount = &ciiAmount{Value: amount(e.Prepaid)}
+	}
+	if e.PrecedingNumber != "" {
+		ref := &ciiReferencedDocument{IssuerAssignedID: e.PrecedingNumber}
+		if e.PrecedingDate != nil {
+			ref.IssueDate = newCIIDate(*e.PrecedingDate)
+		}
+		s.Preceding = ref
+	}
+
+	out, err := xml.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
@@ -0,0 +1,331 @@
+package documents
+
+import (
+	"encoding/xml"
+	"strconv"
+
+	"fakturierung-backend/utils"
+)
+
+// FormatEbInterface is the Austrian ebInterface 6.1 XML format accepted by the
+// federal e-Rechnung.gv.at portal.
+const FormatEbInterface = "ebinterface"
+
+const (
+	ebInterfaceNS         = "http://www.ebinterface.at/schema/6p1/"
+	ebGeneratingSystem    = "fakturierung-backend"
+	ebNoVATID             = "00000000" // placeholder for recipients without UID
+	ebDocTypeInvoice      = "Invoice"
+	ebDocTypeCreditMemo   = "CreditMemo"
+	ebDocTypeAdvance      = "InvoiceForAdvancePayment"
+	ebDocTypeFinal        = "FinalSettlement"
+	ebArticleNumberSeller = "SellersArticleNumber"
+)
+
+type ebCountry struct {
+	Name string `xml:",chardata"`
+	Code string `xml:"CountryCode,attr"`
+}
+
+type ebAddress struct {
+	Name    string    `xml:"Name"`
+	Street  string    `xml:"Street,omitempty"`
+	Town    string    `xml:"Town"`
+	ZIP     string    `xml:"ZIP"`
+	Country ebCountry `xml:"Country"`
+	Phone   string    `xml:"Phone,omitempty"`
+	Email   string    `xml:"Email,omitempty"`
+}
+
+type ebContact struct {
+	Name  string `xml:"Name"`
+	Phone string `xml:"Phone,omitempty"`
+	Email string `xml:"Email,omitempty"`
+}
+
+type ebTaxPercent struct {
+	Value    string `xml:",chardata"`
+	Category string `xml:"TaxCategoryCode,attr"`
+}
+
+type ebTaxItem struct {
+	TaxableAmount string       `xml:"TaxableAmount"`
+	TaxPercent    ebTaxPercent `xml:"TaxPercent"`
+	TaxAmount     string       `xml:"TaxAmount"`
+	Comment       string       `xml:"Comment,omitempty"` // exemption reason
+}
+
+// ebReduction is a reduction (discount) on a line or, with its TaxItem, on the invoice.
+type ebReduction struct {
+	BaseAmount string     `xml:"BaseAmount"`
+	Percentage string     `xml:"Percentage,omitempty"`
+	Amount     string     `xml:"Amount"`
+	Comment    string     `xml:"Comment,omitempty"`
+	TaxItem    *ebTaxItem `xml:"TaxItem,omitempty"`
+}
+
+type ebLineItem struct {
+	PositionNumber string `xml:"PositionNumber"`
+	Description    string `xml:"Description"`
+	ArticleNumber  *struct {
+		Value string `xml:",chardata"`
+		Type  string `xml:"ArticleNumberType,attr"`
+	} `xml:"ArticleNumber,omitempty"`
+	Quantity struct {
+		Value string `xml:",chardata"`
+		Unit  string `xml:"Unit,attr"`
+	} `xml:"Quantity"`
+	UnitPrice  string    `xml:"UnitPrice"`
+	TaxItem    ebTaxItem `xml:"TaxItem"`
+	Reductions *struct {
+		Items []ebReduction `xml:"ReductionListLineItem"`
+	} `xml:"ReductionAndSurchargeListLineItemDetails,omitempty"`
+	LineItemAmount string `xml:"LineItemAmount"`
+}
+
+type ebRelatedDocument struct {
+	InvoiceNumber string `xml:"InvoiceNumber"`
+	InvoiceDate   string `xml:"InvoiceDate,omitempty"`
+	DocumentType  string `xml:"DocumentType"`
+}
+
+type ebInvoice struct {
+	XMLName          xml.Name `xml:"Invoice"`
+	Xmlns            string   `xml:"xmlns,attr"`
+	GeneratingSystem string   `xml:"GeneratingSystem,attr"`
+	DocumentType     string   `xml:"DocumentType,attr"`
+	InvoiceCurrency  string   `xml:"InvoiceCurrency,attr"`
+	DocumentTitle    string   `xml:"DocumentTitle,attr,omitempty"`
+	Language         string   `xml:"Language,attr"`
+
+	InvoiceNumber   string              `xml:"InvoiceNumber"`
+	InvoiceDate     string              `xml:"InvoiceDate"`
+	RelatedDocument []ebRelatedDocument `xml:"RelatedDocument,omitempty"`
+	Delivery        struct {
+		Date string `xml:"Date"`
+	} `xml:"Delivery"`
+	Biller struct {
+		VATIdentificationNumber   string     `xml:"VATIdentificationNumber"`
+		Address                   ebAddress  `xml:"Address"`
+		Contact                   *ebContact `xml:"Contact,omitempty"`
+		InvoiceRecipientsBillerID string     `xml:"InvoiceRecipientsBillerID,omitempty"`
+	} `xml:"Biller"`
+	InvoiceRecipient struct {
+		VATIdentificationNumber string `xml:"VATIdentificationNumber"`
+		OrderReference          *struct {
+			OrderID string `xml:"OrderID"`
+		} `xml:"OrderReference,omitempty"`
+		Address ebAddress `xml:"Address"`
+	} `xml:"InvoiceRecipient"`
+	Details struct {
+		ItemList struct {
+			Items []ebLineItem `xml:"ListLineItem"`
+		} `xml:"ItemList"`
+	} `xml:"Details"`
+	Reductions *struct {
+		Items []ebReduction `xml:"Reduction"`
+	} `xml:"ReductionAndSurchargeDetails,omitempty"`
+	Tax struct {
+		Items []ebTaxItem `xml:"TaxItem"`
+	} `xml:"Tax"`
+	TotalGrossAmount string `xml:"TotalGrossAmount"`
+	PrepaidAmount    string `xml:"PrepaidAmount,omitempty"`
+	PayableAmount    string `xml:"PayableAmount"`
+	PaymentMethod    *struct {
+		Comment                  string `xml:"Comment,omitempty"`
+		UniversalBankTransaction struct {
+			BeneficiaryAccount struct {
+				BankName         string `xml:"BankName,omitempty"`
+				BIC              string `xml:"BIC,omitempty"`
+				IBAN             string `xml:"IBAN"`
+				BankAccountOwner string `xml:"BankAccountOwner,omitempty"`
+			} `xml:"BeneficiaryAccount"`
+		} `xml:"UniversalBankTransaction"`
+	} `xml:"PaymentMethod,omitempty"`
+	PaymentConditions *struct {
+		DueDate string `xml:"DueDate"`
+	} `xml:"PaymentConditions,omitempty"`
+	Comment string `xml:"Comment,omitempty"`
+}
+
+func ebAddressFrom(p EParty) ebAddress {
+	return ebAddress{
+		Name:    p.Name,
+		Street:  p.Street,
+		Town:    p.City,
+		ZIP:     p.PostCode,
+		Country: ebCountry{Name: countryDisplayName(p.CountryCode), Code: p.CountryCode},
+		Email:   p.Email,
+	}
+}
+
+// countryDisplayName returns the German country name ebInterface shows next to
+// the code; unknown codes fall back to the code itself.
+func countryDisplayName(code string) string {
+	switch code {
+	case "AT":
+		return "Österreich"
+	case "DE":
+		return "Deutschland"
+	case "CH":
+		return "Schweiz"
+	case "IT":
+		return "Italien"
+	case "LI":
+		return "Liechtenstein"
+	}
+	return code
+}
+
+// RenderEbInterface serializes the e-invoice as ebInterface 6.1 XML. Credit notes
+// become CreditMemo documents referencing the corrected invoice. We do not track
+// delivery dates separately, so the issue date is used as delivery date.
+func RenderEbInterface(e EInvoice) ([]byte, error) {
+	x := ebInvoice{
+		Xmlns:            ebInterfaceNS,
+		GeneratingSystem: ebGeneratingSystem,
+		DocumentType:     ebDocTypeInvoice,
+		InvoiceCurrency:  e.Currency,
+		DocumentTitle:    "Rechnung",
+		Language:         "ger",
+		InvoiceNumber:    e.Number,
+		InvoiceDate:      e.IssueDate.Format("2006-01-02"),
+		Comment:          e.Note,
+	}
+	switch {
+	case e.TypeCode == typeCodePrepay:
+		x.DocumentType = ebDocTypeAdvance
+		x.DocumentTitle = "Anzahlungsrechnung"
+	case e.Final && !e.IsCreditNote():
+		x.DocumentType = ebDocTypeFinal
+		x.DocumentTitle = "Schlussrechnung"
+	}
+	if e.IsCreditNote() {
+		x.DocumentType = ebDocTypeCreditMemo
+		x.DocumentTitle = "Gutschrift"
+		if e.PrecedingNumber != "" {
+			ref := ebRelatedDocument{InvoiceNumber: e.PrecedingNumber, DocumentType: ebDocTypeInvoice}
+			if e.PrecedingDate != nil {
+				ref.InvoiceDate = e.PrecedingDate.Format("2006-01-02")
+			}
+			x.RelatedDocument = append(x.RelatedDocument, ref)
+		}
+	}
+	x.Delivery.Date = x.InvoiceDate
+
+	x.Biller.VATIdentificationNumber = e.Seller.VATID
+	x.Biller.Address = ebAddressFrom(e.Seller)
+	x.Biller.Address.Phone = e.Seller.ContactPhone
+	if e.Seller.ContactName != "" {
+		x.Biller.Contact = &ebContact{Name: e.Seller.ContactName, Phone: e.Seller.ContactPhone, Email: e.Seller.ContactEmail}
+	}
+	x.Biller.InvoiceRecipientsBillerID = e.SupplierNumber
+
+	x.InvoiceRecipient.VATIdentificationNumber = e.Buyer.VATID
+	if x.InvoiceRecipient.VATIdentificationNumber == "" {
+		x.InvoiceRecipient.VATIdentificationNumber = ebNoVATID
+	}
+	if e.BuyerReference != "" {
+		x.InvoiceRecipient.OrderReference = &struct {
+			OrderID string `xml:"OrderID"`
+		}{e.BuyerReference}
+	}
+	x.InvoiceRecipient.Address = ebAddressFrom(e.Buyer)
+
+	for _, l := range e.Lines {
+		li := ebLineItem{
+			PositionNumber: l.ID,
+			Description:    l.Name,
+			UnitPrice:      strconv.FormatFloat(l.NetPrice.Float64(), 'f', 4, 64),
+			TaxItem: ebTaxItem{
+				TaxableAmount: amount(l.NetAmount),
+				TaxPercent:    ebTaxPercent{Value: decimal(l.TaxPercent), Category: l.TaxCategory},
+				TaxAmount:     amount(l.NetAmount.MulRate(l.TaxPercent/100, utils.RoundHalfUp)),
+			},
+			LineItemAmount: amount(l.NetAmount),
+		}
+		if l.Discount != 0 {
+			r := ebReduction{BaseAmount: amount(l.DiscountBase), Amount: amount(l.Discount), Comment: "Rabatt"}
+			if l.DiscountPercent > 0 {
+				r.Percentage = decimal(l.DiscountPercent)
+			}
+			li.Reductions = &struct {
+				Items []ebReduction `xml:"ReductionListLineItem"`
+			}{[]ebReduction{r}}
+		}
+		if l.ArticleID != "" {
+			li.ArticleNumber = &struct {
+				Value string `xml:",chardata"`
+				Type  string `xml:"ArticleNumberType,attr"`
+			}{l.ArticleID, ebArticleNumberSeller}
+		}
+		li.Quantity.Value = strconv.FormatFloat(l.Quantity, 'f', 4, 64)
+		li.Quantity.Unit = l.UnitCode
+		x.Details.ItemList.Items = append(x.Details.ItemList.Items, li)
+	}
+	if len(e.Allowances) > 0 {
+		x.Reductions = &struct {
+			Items []ebReduction `xml:"Reduction"`
+		}{}
+		for _, a := range e.Allowances {
+			r := ebReduction{
+				BaseAmount: amount(a.Base),
+				Amount:     amount(a.Amount),
+				Comment:    a.Reason,
+				TaxItem: &ebTaxItem{
+					TaxableAmount: amount(a.Amount),
+					TaxPercent:    ebTaxPercent{Value: decimal(a.TaxPercent), Category: a.TaxCategory},
+					TaxAmount:     amount(a.Amount.MulRate(a.TaxPercent/100, utils.RoundHalfUp)),
+				},
+			}
+			if a.Percent > 0 {
+				r.Percentage = decimal(a.Percent)
+			}
+			x.Reductions.Items = append(x.Reductions.Items, r)
+		}
+	}
+	for _, t := range e.Taxes {
+		x.Tax.Items = append(x.Tax.Items, ebTaxItem{
+			TaxableAmount: amount(t.Basis),
+			TaxPercent:    ebTaxPercent{Value: decimal(t.Percent), Category: t.Category},
+			TaxAmount:     amount(t.Amount),
+			Comment:       t.ExemptionReason,
+		})
+	}
+	x.TotalGrossAmount = amount(e.GrandTotal)
+	if e.Prepaid != 0 {
+		x.PrepaidAmount = amount(e.Prepaid)
+	}
+	x.PayableAmount = amount(e.DuePayable)
+
+	if e.IBAN != "" {
+		pm := &struct {
+			Comment                  string `xml:"Comment,omitempty"`
+			UniversalBankTransaction struct {
+				BeneficiaryAccount struct {
+					BankName         string `xml:"BankName,omitempty"`
+					BIC              string `xml:"BIC,omitempty"`
+					IBAN             string `xml:"IBAN"`
+					BankAccountOwner string `xml:"BankAccountOwner,omitempty"`
+				} `xml:"BeneficiaryAccount"`
+			} `xml:"UniversalBankTransaction"`
+		}{Comment: e.PaymentTerms}
+		acc := &pm.UniversalBankTransaction.BeneficiaryAccount
+		acc.BankName = e.BankName
+		acc.BIC = e.BIC
+		acc.IBAN = e.IBAN
+		acc.BankAccountOwner = e.Seller.Name
+		x.PaymentMethod = pm
+	}
+	if e.DueDate != nil {
+		x.PaymentConditions = &struct {
+			DueDate string `xml:"DueDate"`
+		}{e.DueDate.Format("2006-01-02")}
+	}
+
+	out, err := xml.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
@@ -0,0 +1,129 @@
+package documents
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"fakturierung-backend/utils"
+)
+
+// childElements lists, for every element path, the local names of its direct
+// children in document order, one entry per occurrence of the parent.
+func childElements(t *testing.T, doc []byte) map[string][][]string {
+	t.Helper()
+	out := map[string][][]string{}
+	var path []string
+	var open [][]string
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			if len(open) > 0 {
+				open[len(open)-1] = append(open[len(open)-1], el.Name.Local)
+			}
+			path = append(path, el.Name.Local)
+			open = append(open, []string{})
+		case xml.EndElement:
+			p := strings.Join(path, "/")
+			out[p] = append(out[p], open[len(open)-1])
+			path, open = path[:len(path)-1], open[:len(open)-1]
+		}
+	}
+}
+
+func discountedEInvoice() EInvoice {
+	due := time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC)
+	return EInvoice{
+		Number:    "RE-2025-0001",
+		IssueDate: time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC),
+		TypeCode:  typeCodeInvoice,
+		Currency:  "EUR",
+		Seller:    EParty{Name: "Muster GmbH", Street: "Hauptplatz 1", City: "Wien", PostCode: "1010", CountryCode: "AT", VATID: "ATU12345678"},
+		Buyer:     EParty{Name: "Kunde AG", Street: "Ring 2", City: "Graz", PostCode: "8010", CountryCode: "AT", VATID: "ATU87654321"},
+		IBAN:      "AT611904300234573201",
+		DueDate:   &due,
+		Lines: []ELine{{
+			ID: "1", Name: "Beratung", ArticleID: "A-1", Quantity: 2, UnitCode: "HUR",
+			NetPrice: utils.Cents(10000), NetAmount: utils.Cents(18000), TaxCategory: "S", TaxPercent: 20,
+			Discount: utils.Cents(2000), DiscountBase: utils.Cents(20000), DiscountPercent: 10,
+		}},
+		Allowances: []EAllowance{{
+			Amount: utils.Cents(1800), Base: utils.Cents(18000), Percent: 10, TaxCategory: "S", TaxPercent: 20, Reason: "Rabatt",
+		}},
+		Taxes:      []ETax{{Category: "S", Percent: 20, Basis: utils.Cents(16200), Amount: utils.Cents(3240)}},
+		GrandTotal: utils.Cents(19440),
+		DuePayable: utils.Cents(19440),
+	}
+}
+
+// The expected sequences follow the ebInterface 6.1 content models (InvoiceType,
+// ListLineItemType, ReductionAndSurchargeBaseType, ReductionAndSurchargeType) with
+// the optional elements we do not produce left out.
+func TestRenderEbInterfaceDiscountElementOrder(t *testing.T) {
+	doc, err := RenderEbInterface(discountedEInvoice())
+	if err != nil {
+		t.Fatal(err)
+	}
+	children := childElements(t, doc)
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"Invoice", []string{
+			"InvoiceNumber", "InvoiceDate", "Delivery", "Biller", "InvoiceRecipient", "Details",
+			"ReductionAndSurchargeDetails", "Tax", "TotalGrossAmount", "PayableAmount", "PaymentMethod", "PaymentConditions",
+		}},
+		{"Invoice/Details/ItemList/ListLineItem", []string{
+			"PositionNumber", "Description", "ArticleNumber", "Quantity", "UnitPrice", "TaxItem",
+			"ReductionAndSurchargeListLineItemDetails", "LineItemAmount",
+		}},
+		{"Invoice/Details/ItemList/ListLineItem/ReductionAndSurchargeListLineItemDetails", []string{"ReductionListLineItem"}},
+		{"Invoice/Details/ItemList/ListLineItem/ReductionAndSurchargeListLineItemDetails/ReductionListLineItem", []string{
+			"BaseAmount", "Percentage", "Amount", "Comment",
+		}},
+		{"Invoice/ReductionAndSurchargeDetails", []string{"Reduction"}},
+		{"Invoice/ReductionAndSurchargeDetails/Reduction", []string{
+			"BaseAmount", "Percentage", "Amount", "Comment", "TaxItem",
+		}},
+		{"Invoice/ReductionAndSurchargeDetails/Reduction/TaxItem", []string{"TaxableAmount", "TaxPercent", "TaxAmount"}},
+	}
+	for _, tt := range tests {
+		got := children[tt.path]
+		if len(got) != 1 || !reflect.DeepEqual(got[0], tt.want) {
+			t.Errorf("%s:\n got  %v\n want %v", tt.path, got, [][]string{tt.want})
+		}
+	}
+	for _, want := range []string{
+		"<BaseAmount>200.00</BaseAmount>", "<Percentage>10</Percentage>", "<Amount>20.00</Amount>",
+		"<LineItemAmount>180.00</LineItemAmount>", "<TaxableAmount>18.00</TaxableAmount>",
+	} {
+		if !bytes.Contains(doc, []byte(want)) {
+			t.Errorf("missing %s", want)
+		}
+	}
+}
+
+func TestRenderEbInterfaceWithoutDiscounts(t *testing.T) {
+	e := discountedEInvoice()
+	e.Lines[0].Discount, e.Lines[0].DiscountBase, e.Lines[0].DiscountPercent = 0, 0, 0
+	e.Allowances = nil
+	doc, err := RenderEbInterface(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(doc, []byte("ReductionAndSurcharge")) {
+		t.Errorf("reduction elements without discounts:\n%s", doc)
+	}
+}
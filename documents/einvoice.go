@@ -0,0 +1,459 @@
+package documents
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+)
+
+// E-invoice formats supported by the export endpoint.
+const (
+	FormatXRechnungCII = "xrechnung-cii"
+	FormatUBL          = "ubl"
+	FormatFacturX      = "facturx"
+)
+
+// Specification identifiers (BT-24) and business process (BT-23).
+const (
+	specXRechnung     = "urn:cen.eu:en16931:2017#compliant#urn:xeinkauf.de:kosit:xrechnung_3.0"
+	specEN16931       = "urn:cen.eu:en16931:2017"
+	specPeppolBIS     = "urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0"
+	processPeppol     = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+	typeCodeInvoice   = "380"
+	typeCodeCredit    = "381"
+	typeCodePrepay    = "386" // prepayment (down-payment) invoice
+	paymentMeansSEPA  = "58"  // SEPA credit transfer
+	paymentMeansOther = "1"   // instrument not defined
+	unitCodePiece     = "C62"
+)
+
+// EParty is a seller or buyer in EN 16931 terms.
+type EParty struct {
+	Name         string // BT-27 / BT-44
+	Street       string // BT-35 / BT-50
+	City         string // BT-37 / BT-52
+	PostCode     string // BT-38 / BT-53
+	CountryCode  string // BT-40 / BT-55 (ISO 3166-1 alpha-2)
+	VATID        string // BT-31 / BT-48
+	Email        string // BT-34 / BT-49 electronic address (scheme EM)
+	ContactName  string // BT-41
+	ContactPhone string // BT-42
+	ContactEmail string // BT-43
+}
+
+// ELine is one invoice line (BG-25).
+type ELine struct {
+	ID          string      // BT-126
+	Name        string      // BT-153
+	ArticleID   string      // BT-155
+	Quantity    float64     // BT-129
+	UnitCode    string      // BT-130
+	NetPrice    utils.Money // BT-146
+	NetAmount   utils.Money // BT-131
+	TaxCategory string      // BT-151
+	TaxPercent  float64     // BT-152
+
+	// Line allowance (BG-27): the line discount, NetAmount is after it
+	Discount        utils.Money // BT-136
+	DiscountBase    utils.Money // BT-137
+	DiscountPercent float64     // BT-138 (0 => fixed amount)
+}
+
+// EAllowance is a document level allowance (BG-20): the share of the document
+// discount on one VAT rate.
+type EAllowance struct {
+	Amount      utils.Money // BT-92
+	Base        utils.Money // BT-93
+	Percent     float64     // BT-94 (0 => fixed amount or not exact per rate)
+	TaxCategory string      // BT-95
+	TaxPercent  float64     // BT-96
+	Reason      string      // BT-97
+}
+
+// ETax is one VAT breakdown entry (BG-23).
+type ETax struct {
+	Category        string      // BT-118
+	Percent         float64     // BT-119
+	Basis           utils.Money // BT-116
+	Amount          utils.Money // BT-117
+	ExemptionReason string      // BT-120 (zero-rated treatments)
+	ExemptionCode   string      // BT-121 (VATEX code)
+}
+
+// EInvoice is the format-neutral EN 16931 view of an invoice; the CII, UBL and
+// ebInterface serializers all render from it.
+type EInvoice struct {
+	Number          string    // BT-1
+	IssueDate       time.Time // BT-2
+	TypeCode        string    // BT-3
+	Currency        string    // BT-5
+	TaxCurrency     string    // BT-6 (only when VAT is accounted in another currency)
+	BuyerReference  string    // BT-10
+	SupplierNumber  string    // our ID at the buyer (ebInterface InvoiceRecipientsBillerID)
+	PrecedingNumber string    // BT-25
+	PrecedingDate   *time.Time
+	PaymentTerms    string     // BT-20
+	DueDate         *time.Time // BT-9
+	Note            string     // BT-22
+	DeliveryDate    *time.Time // BT-72 (intra-community supplies)
+	DeliverTo       string     // BT-80 deliver-to country code (intra-community supplies)
+	Seller          EParty
+	Buyer           EParty
+	Final           bool   // final invoice deducting down payments (lines with negative quantity)
+	PaymentMeans    string // BT-81
+	IBAN            string // BT-84
+	BIC             string // BT-86
+	BankName        string
+	Lines           []ELine
+	Allowances      []EAllowance
+	Taxes           []ETax
+	LineTotal       utils.Money // BT-106
+	AllowanceTotal  utils.Money // BT-107
+	TaxBasisTotal   utils.Money // BT-109
+	TaxTotal        utils.Money // BT-110
+	TaxTotalBase    utils.Money // BT-111 (in TaxCurrency)
+	GrandTotal      utils.Money // BT-112
+	Prepaid         utils.Money // BT-113
+	DuePayable      utils.Money // BT-115
+}
+
+// IsCreditNote reports whether the document is a credit note (type 381).
+func (e *EInvoice) IsCreditNote() bool { return e.TypeCode == typeCodeCredit }
+
+// BuildEInvoice maps invoice data onto the EN 16931 semantic model.
+// Credit notes are stored with negative amounts; EN 16931 expects them positive
+// under type code 381, so their signs are flipped here.
+func BuildEInvoice(d InvoiceData) EInvoice {
+	inv := &d.Invoice
+	co := &d.Company
+	cu := &inv.Customer
+
+	credit := inv.CorrectsID != nil
+	signed := func(m utils.Money) utils.Money {
+		if credit {
+			return -m
+		}
+		return m
+	}
+	e := EInvoice{
+		Number:         inv.InvoiceNumber,
+		IssueDate:      IssueDate(inv),
+		TypeCode:       typeCodeInvoice,
+		Currency:       Currency(inv),
+		Note:           inv.TaxNote,
+		BuyerReference: strings.TrimSpace(cu.BuyerReference),
+		SupplierNumber: strings.TrimSpace(cu.SupplierNumber),
+		PaymentTerms:   strings.TrimSpace(co.PaymentTerms),
+		PaymentMeans:   paymentMeansOther,
+		IBAN:           strings.ReplaceAll(co.IBAN, " ", ""),
+		BIC:            co.BIC,
+		BankName:       co.BankName,
+	}
+	if inv.CorrectsID == nil && inv.SkontoRate > 0 {
+		// XRechnung convention for structured early-payment discounts in BT-20
+		skonto := "#SKONTO#TAGE=" + strconv.Itoa(inv.SkontoDays) +
+			"#PROZENT=" + strconv.FormatFloat(inv.SkontoRate*100, 'f', 2, 64) + "#\n"
+		if e.PaymentTerms != "" {
+			skonto = e.PaymentTerms + "\n" + skonto
+		}
+		e.PaymentTerms = skonto
+	}
+	switch inv.InvoiceType {
+	case "down_payment":
+		e.TypeCode = typeCodePrepay
+	case "final":
+		e.Final = true
+	}
+	if credit {
+		e.TypeCode = typeCodeCredit
+		if d.Corrected != nil {
+			e.PrecedingNumber = d.Corrected.InvoiceNumber
+			e.PrecedingDate = d.Corrected.PublishedAt
+		}
+	}
+	if e.IBAN != "" {
+		e.PaymentMeans = paymentMeansSEPA
+	}
+	if inv.CorrectsID == nil {
+		e.DueDate = inv.DueDate
+	}
+
+	contact := ""
+	if co.ContactPerson.FirstName != "" || co.ContactPerson.LastName != "" {
+		contact = strings.TrimSpace(co.ContactPerson.FirstName + " " + co.ContactPerson.LastName)
+	}
+	phone := co.Phone
+	if phone == "" {
+		phone = co.ContactPerson.PhoneNumber
+	}
+	e.Seller = EParty{
+		Name:         co.CompanyName,
+		Street:       co.Address,
+		City:         co.City,
+		PostCode:     co.Zip,
+		CountryCode:  CountryCode(co.Country),
+		VATID:        strings.ReplaceAll(co.UID, " ", ""),
+		Email:        co.Email,
+		ContactName:  contact,
+		ContactPhone: phone,
+		ContactEmail: co.Email,
+	}
+	buyerName := cu.CompanyName
+	if buyerName == "" {
+		buyerName = strings.TrimSpace(cu.FirstName + " " + cu.LastName)
+	}
+	e.Buyer = EParty{
+		Name:        buyerName,
+		Street:      cu.Address,
+		City:        cu.City,
+		PostCode:    cu.Zip,
+		CountryCode: CountryCode(cu.Country),
+		VATID:       strings.ReplaceAll(cu.UID, " ", ""),
+		Email:       cu.Email,
+		ContactName: strings.TrimSpace(cu.FirstName + " " + cu.LastName),
+	}
+
+	if inv.TaxTreatment == models.TaxTreatmentIntraEU {
+		// BR-IC-11/12: the supply date and destination of the goods
+		delivered := e.IssueDate
+		e.DeliveryDate = &delivered
+		e.DeliverTo = e.Buyer.CountryCode
+	}
+
+	lineNets := make(map[float64]utils.Money) // per rate, before the document discount
+	for i, it := range inv.Items {
+		l := ELine{
+			ID:          strconv.Itoa(i + 1),
+			Name:        d.LineDescription(it),
+			ArticleID:   it.ArticleID,
+			Quantity:    it.Amount,
+			UnitCode:    unitCode(it.Unit),
+			NetPrice:    signed(it.UnitPrice),
+			NetAmount:   signed(it.NetPrice),
+			TaxCategory: taxCategoryCode(inv.TaxTreatment, it.TaxRate),
+			TaxPercent:  ratePercent(it.TaxRate),
+		}
+		if it.Discount != 0 {
+			l.Discount = signed(it.Discount)
+			l.DiscountBase = signed(it.NetPrice + it.Discount)
+			l.DiscountPercent = round2(it.DiscountRate * 100)
+		}
+		e.Lines = append(e.Lines, l)
+		lineNets[it.TaxRate] += signed(it.NetPrice)
+	}
+	// Deducted down payments: one line per invoice and rate with negative quantity,
+	// so that the line total and the VAT breakdown are the remaining amounts
+	for _, d := range inv.Deductions {
+		for _, tl := range d.TaxBreakdown {
+			e.Lines = append(e.Lines, ELine{
+				ID:          strconv.Itoa(len(e.Lines) + 1),
+				Name:        "Abzug Anzahlungsrechnung " + d.InvoiceNumber,
+				Quantity:    -1,
+				UnitCode:    unitCodePiece,
+				NetPrice:    signed(tl.Net),
+				NetAmount:   -signed(tl.Net),
+				TaxCategory: taxCategoryCode(inv.TaxTreatment, tl.Rate),
+				TaxPercent:  ratePercent(tl.Rate),
+			})
+		}
+	}
+	// Document discount: one allowance per rate it was split over
+	for _, tl := range inv.TaxBreakdown {
+		if tl.Discount == 0 {
+			continue
+		}
+		a := EAllowance{
+			Amount:      signed(tl.Discount),
+			Base:        lineNets[tl.Rate],
+			TaxCategory: taxCategoryCode(inv.TaxTreatment, tl.Rate),
+			TaxPercent:  ratePercent(tl.Rate),
+			Reason:      "Rabatt",
+		}
+		if inv.DiscountRate > 0 && a.Base.MulRate(inv.DiscountRate, utils.RoundingMode(inv.RoundingMode)) == a.Amount {
+			a.Percent = round2(inv.DiscountRate * 100)
+		}
+		e.Allowances = append(e.Allowances, a)
+		e.AllowanceTotal += a.Amount
+	}
+	for _, tl := range inv.TaxBreakdown {
+		t := ETax{
+			Category: taxCategoryCode(inv.TaxTreatment, tl.Rate),
+			Percent:  ratePercent(tl.Rate),
+			Basis:    signed(tl.Net),
+			Amount:   signed(tl.Tax),
+		}
+		if t.Category != "S" && t.Category != "Z" {
+			t.ExemptionReason = inv.TaxNote
+			t.ExemptionCode = exemptionCodes[t.Category]
+		}
+		e.Taxes = append(e.Taxes, t)
+	}
+	e.LineTotal = signed(inv.Subtotal) + e.AllowanceTotal
+	e.TaxBasisTotal = signed(inv.Subtotal)
+	e.TaxTotal = signed(inv.TaxTotal)
+	if inv.BaseTaxTotal != nil && inv.BaseCurrency != "" && inv.BaseCurrency != e.Currency {
+		e.TaxCurrency = inv.BaseCurrency
+		e.TaxTotalBase = signed(*inv.BaseTaxTotal)
+	}
+	e.GrandTotal = signed(inv.Total)
+	e.Prepaid = signed(inv.PaidTotal)
+	e.DuePayable = e.GrandTotal - e.Prepaid
+	return e
+}
+
+// Validate checks the mandatory business terms for the given format and returns
+// a human-readable entry per missing term (empty => valid).
+func (e *EInvoice) Validate(format string) []string {
+	var missing []string
+	need := func(ok bool, msg string) {
+		if !ok {
+			missing = append(missing, msg)
+		}
+	}
+	has := func(s string) bool { return strings.TrimSpace(s) != "" }
+	xr := format == FormatXRechnungCII
+	peppol := format == FormatUBL // Peppol BIS Billing 3.0
+	eb := format == FormatEbInterface
+
+	need(has(e.Number), "BT-1 invoice number (publish the invoice first)")
+	need(len(e.Lines) > 0, "BG-25 at least one invoice line")
+
+	need(has(e.Seller.Name), "BT-27 seller name (company name)")
+	need(has(e.Seller.Street), "BT-35 seller address line (company address)")
+	need(has(e.Seller.City), "BT-37 seller city (company city)")
+	need(has(e.Seller.PostCode), "BT-38 seller post code (company zip)")
+	need(len(e.Seller.CountryCode) == 2, "BT-40 seller country code (company country as ISO 3166 code)")
+	for _, t := range e.Taxes {
+		if t.Category != "Z" {
+			need(has(e.Seller.VATID), "BT-31 seller VAT identifier (company uid)")
+			break
+		}
+	}
+	for _, t := range e.Taxes {
+		if t.Category == "AE" || t.Category == "K" {
+			need(has(e.Buyer.VATID), "BT-48 buyer VAT identifier (customer uid)")
+			break
+		}
+	}
+
+	need(has(e.Buyer.Name), "BT-44 buyer name (customer company name)")
+	need(has(e.Buyer.City), "BT-52 buyer city (customer city)")
+	need(has(e.Buyer.PostCode), "BT-53 buyer post code (customer zip)")
+	need(len(e.Buyer.CountryCode) == 2, "BT-55 buyer country code (customer country as ISO 3166 code)")
+
+	if e.DuePayable > 0 {
+		need(has(e.PaymentTerms) || e.DueDate != nil, "BT-9 due date or BT-20 payment terms (company payment_terms)")
+	}
+
+	if xr || peppol {
+		need(has(e.BuyerReference), "BT-10 buyer reference / Leitweg-ID (customer buyer_reference)")
+		need(has(e.Seller.Email), "BT-34 seller electronic address (company email)")
+		need(has(e.Buyer.Email), "BT-49 buyer electronic address (customer email)")
+	}
+	if xr {
+		need(has(e.Seller.ContactName), "BT-41 seller contact point (company contact person)")
+		need(has(e.Seller.ContactPhone), "BT-42 seller contact telephone (company phone)")
+		need(has(e.Seller.ContactEmail), "BT-43 seller contact email (company email)")
+		need(has(e.IBAN), "BT-84 payment account identifier (company iban)")
+	}
+	if eb {
+		// e-Rechnung.gv.at: federal recipients need the order reference and our supplier number
+		need(has(e.Seller.VATID), "Biller VATIdentificationNumber (company uid)")
+		need(has(e.BuyerReference), "InvoiceRecipient OrderReference/OrderID (customer buyer_reference)")
+		need(has(e.SupplierNumber), "Biller InvoiceRecipientsBillerID (customer supplier_number)")
+		if e.DuePayable > 0 {
+			need(has(e.IBAN), "PaymentMethod IBAN (company iban)")
+		}
+	}
+	return missing
+}
+
+// taxCategoryCode maps a tax treatment and rate onto the UNCL5305 VAT category.
+func taxCategoryCode(treatment string, rate float64) string {
+	switch treatment {
+	case models.TaxTreatmentReverseCharge:
+		return "AE"
+	case models.TaxTreatmentIntraEU:
+		return "K"
+	case models.TaxTreatmentExport:
+		return "G"
+	case models.TaxTreatmentExempt:
+		return "E"
+	}
+	if rate == 0 {
+		return "Z"
+	}
+	return "S"
+}
+
+// exemptionCodes are the VATEX reason codes (BT-121) of the exempt categories;
+// "E" is explained by the reason text alone.
+var exemptionCodes = map[string]string{
+	"AE": "VATEX-EU-AE",
+	"K":  "VATEX-EU-IC",
+	"G":  "VATEX-EU-G",
+}
+
+func ratePercent(rate float64) float64 { return round2(rate * 100) }
+
+func round2(x float64) float64 { return math.Round(x*100) / 100 }
+
+// amount formats a monetary value with exactly two decimals.
+func amount(x utils.Money) string { return x.String() }
+
+// decimal formats a quantity/percentage without trailing zeros.
+func decimal(x float64) string { return strconv.FormatFloat(x, 'f', -1, 64) }
+
+// unitCodes maps line units to UN/ECE Recommendation 20 codes (BT-130).
+var unitCodes = map[string]string{
+	models.UnitPiece:    unitCodePiece,
+	models.UnitHour:     "HUR",
+	models.UnitDay:      "DAY",
+	models.UnitKilogram: "KGM",
+	models.UnitMeter:    "MTR",
+	models.UnitFlatRate: "LS",
+}
+
+// unitCode returns the Rec. 20 code of a line unit; unknown units count as pieces.
+func unitCode(unit string) string {
+	if c, ok := unitCodes[unit]; ok {
+		return c
+	}
+	return unitCodePiece
+}
+
+var countryNames = map[string]string{
+	"austria": "AT", "österreich": "AT", "oesterreich": "AT",
+	"germany": "DE", "deutschland": "DE",
+	"switzerland": "CH", "schweiz": "CH", "suisse": "CH",
+	"liechtenstein": "LI",
+	"italy":         "IT", "italien": "IT", "italia": "IT",
+	"france": "FR", "frankreich": "FR",
+	"netherlands": "NL", "niederlande": "NL",
+	"belgium": "BE", "belgien": "BE",
+	"luxembourg": "LU", "luxemburg": "LU",
+	"czech republic": "CZ", "czechia": "CZ", "tschechien": "CZ",
+	"slovakia": "SK", "slowakei": "SK",
+	"slovenia": "SI", "slowenien": "SI",
+	"hungary": "HU", "ungarn": "HU",
+	"poland": "PL", "polen": "PL",
+	"croatia": "HR", "kroatien": "HR",
+	"spain": "ES", "spanien": "ES",
+	"denmark": "DK", "dänemark": "DK",
+	"sweden": "SE", "schweden": "SE",
+	"united kingdom": "GB", "großbritannien": "GB", "uk": "GB",
+	"united states": "US", "usa": "US",
+}
+
+// CountryCode normalizes a free-text country into ISO 3166-1 alpha-2 ("" if unknown).
+func CountryCode(country string) string {
+	s := strings.TrimSpace(country)
+	if len(s) == 2 {
+		return strings.ToUpper(s)
+	}
+	return countryNames[strings.ToLower(s)]
+}
@@ -0,0 +1,166 @@
+package documents
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"fakturierung-backend/banking"
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/skip2/go-qrcode"
+)
+
+// EPC069-12 ("GiroCode") QR codes for SEPA credit transfers.
+
+const (
+	epcMaxPayload   = 331                      // bytes, per EPC069-12
+	epcMaxAmount    = utils.Money(99999999999) // 999999999.99
+	epcQRSizeMM     = 30.0
+	epcQRModuleSize = 4 // SVG user units per module
+)
+
+// EPCData is the content of a GiroCode payment request.
+type EPCData struct {
+	Name       string // beneficiary (max 70 characters)
+	IBAN       string
+	BIC        string // optional since version 002
+	Amount     utils.Money
+	Remittance string // unstructured remittance (max 140 characters)
+}
+
+// EPCForInvoice builds the payment request for the open amount (Total - PaidTotal)
+// of an issued invoice. ok is false for quotations, credit notes, settled invoices
+// or when the issuer has no bank account.
+func EPCForInvoice(d InvoiceData) (e EPCData, ok bool) {
+	inv := &d.Invoice
+	if inv.DocumentType != models.DocumentInvoice || inv.InvoiceNumber == "" {
+		return e, false
+	}
+	return epcFor(d.Company.CompanyName, d.Company.IBAN, d.Company.BIC, Currency(inv), inv.Total-inv.PaidTotal, inv.InvoiceNumber)
+}
+
+// epcFor builds the GiroCode data; SEPA credit transfers are euro only.
+func epcFor(name, iban, bic, currency string, amount utils.Money, remittance string) (EPCData, bool) {
+	if currency != "EUR" {
+		return EPCData{}, false
+	}
+	e := EPCData{
+		Name:       name,
+		IBAN:       banking.NormalizeIBAN(iban),
+		BIC:        strings.ToUpper(strings.TrimSpace(bic)),
+		Amount:     amount,
+		Remittance: remittance,
+	}
+	return e, e.IBAN != "" && e.Amount > 0
+}
+
+func truncateRunes(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// Payload returns the EPC069-12 version 002 payload (UTF-8, SEPA credit transfer).
+func (e EPCData) Payload() (string, error) {
+	if !banking.ValidIBAN(e.IBAN) {
+		return "", fmt.Errorf("epc qr: invalid iban")
+	}
+	if e.BIC != "" && !banking.ValidBIC(e.BIC) {
+		return "", fmt.Errorf("epc qr: invalid bic")
+	}
+	name := truncateRunes(e.Name, 70)
+	if name == "" {
+		return "", fmt.Errorf("epc qr: beneficiary name is required")
+	}
+	if e.Amount < 1 || e.Amount > epcMaxAmount {
+		return "", fmt.Errorf("epc qr: amount out of range")
+	}
+	lines := []string{
+		"BCD",
+		"002",
+		"1", // UTF-8
+		"SCT",
+		e.BIC,
+		name,
+		e.IBAN,
+		"EUR" + amount(e.Amount),
+		"", // purpose code
+		"", // structured creditor reference
+		truncateRunes(e.Remittance, 140),
+	}
+	p := strings.Join(lines, "\n")
+	if len(p) > epcMaxPayload {
+		return "", fmt.Errorf("epc qr: payload exceeds %d bytes", epcMaxPayload)
+	}
+	return p, nil
+}
+
+// EPC QR codes use error correction level M.
+func epcQR(payload string) (*qrcode.QRCode, error) {
+	return qrcode.New(payload, qrcode.Medium)
+}
+
+// EPCQRPNG renders the payload as a PNG of size x size pixels.
+func EPCQRPNG(payload string, size int) ([]byte, error) {
+	q, err := epcQR(payload)
+	if err != nil {
+		return nil, err
+	}
+	return q.PNG(size)
+}
+
+// EPCQRSVG renders the payload as a scalable SVG (including the quiet zone).
+func EPCQRSVG(payload string) ([]byte, error) {
+	q, err := epcQR(payload)
+	if err != nil {
+		return nil, err
+	}
+	bm := q.Bitmap()
+	n := len(bm) * epcQRModuleSize
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" shape-rendering="crispEdges">`, n, n, n, n)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bm {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d %dh%dv%dh-%dz", x*epcQRModuleSize, y*epcQRModuleSize, epcQRModuleSize, epcQRModuleSize, epcQRModuleSize)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>` + "\n")
+	return b.Bytes(), nil
+}
+
+// writePaymentQR places a GiroCode with caption at the right margin, starting at
+// the current line. It returns false (drawing nothing) if no valid code can be built.
+func writePaymentQR(pdf *fpdf.Fpdf, tr func(string) string, e EPCData) bool {
+	payload, err := e.Payload()
+	if err != nil {
+		return false
+	}
+	png, err := EPCQRPNG(payload, 256)
+	if err != nil {
+		return false
+	}
+	_, pageH := pdf.GetPageSize()
+	if pdf.GetY()+epcQRSizeMM+8 > pageH-30 {
+		pdf.AddPage()
+	}
+	name := "epcqr"
+	pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(png))
+	x := pdfMarginLeft + pdfContentW - epcQRSizeMM
+	y := pdf.GetY()
+	pdf.ImageOptions(name, x, y, epcQRSizeMM, epcQRSizeMM, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+	pdf.SetFont("Helvetica", "", 7)
+	pdf.SetXY(x, y+epcQRSizeMM)
+	pdf.CellFormat(epcQRSizeMM, 4, tr("Zahlen mit Code"), "", 0, "C", false, 0, "")
+	pdf.SetXY(pdfMarginLeft, y)
+	return true
+}
@@ -0,0 +1,130 @@
+package documents
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"fakturierung-backend/utils"
+)
+
+func epcData() EPCData {
+	return EPCData{
+		Name:       "Muster GmbH",
+		IBAN:       "AT611904300234573201",
+		BIC:        "GIBAATWWXXX",
+		Amount:     1234,
+		Remittance: "RE-2025-0001",
+	}
+}
+
+func TestEPCPayloadLines(t *testing.T) {
+	p, err := epcData().Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"BCD", "002", "1", "SCT", "GIBAATWWXXX", "Muster GmbH", "AT611904300234573201", "EUR12.34", "", "", "RE-2025-0001"}
+	if got := strings.Split(p, "\n"); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("payload lines\n got  %q\n want %q", got, want)
+	}
+	if strings.HasSuffix(p, "\n") || strings.Contains(p, "\r") {
+		t.Errorf("payload must use bare LF separators without a trailing one: %q", p)
+	}
+}
+
+func TestEPCPayloadAmount(t *testing.T) {
+	tests := []struct {
+		amount utils.Money
+		want   string
+	}{
+		{1, "EUR0.01"},
+		{1234, "EUR12.34"},
+		{1200, "EUR12.00"},
+		{123456789, "EUR1234567.89"},
+		{epcMaxAmount, "EUR999999999.99"},
+	}
+	for _, tt := range tests {
+		e := epcData()
+		e.Amount = tt.amount
+		p, err := e.Payload()
+		if err != nil {
+			t.Fatalf("amount %d: %v", tt.amount, err)
+		}
+		if got := strings.Split(p, "\n")[7]; got != tt.want {
+			t.Errorf("amount %d = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestEPCPayloadLimits(t *testing.T) {
+	umlauts := strings.Repeat("ä", 200)
+	tests := []struct {
+		name        string
+		change      func(e *EPCData)
+		wantErr     bool
+		beneficiary string
+		remittance  string
+	}{
+		{"name cut to 70 characters", func(e *EPCData) { e.Name = strings.Repeat("N", 80) }, false, strings.Repeat("N", 70), "RE-2025-0001"},
+		{"remittance cut to 140 characters", func(e *EPCData) { e.Remittance = strings.Repeat("R", 150) }, false, "Muster GmbH", strings.Repeat("R", 140)},
+		{"whitespace collapsed", func(e *EPCData) { e.Name = " Muster \n\t GmbH " }, false, "Muster GmbH", "RE-2025-0001"},
+		{"umlauts kept as UTF-8", func(e *EPCData) { e.Name = "Müller & Söhne" }, false, "Müller & Söhne", "RE-2025-0001"},
+		{"multi-byte text over 331 bytes", func(e *EPCData) { e.Name, e.Remittance = umlauts, umlauts }, true, "", ""},
+		{"without bic", func(e *EPCData) { e.BIC = "" }, false, "Muster GmbH", "RE-2025-0001"},
+		{"invalid iban", func(e *EPCData) { e.IBAN = "AT611904300234573202" }, true, "", ""},
+		{"invalid bic", func(e *EPCData) { e.BIC = "GIBA" }, true, "", ""},
+		{"missing name", func(e *EPCData) { e.Name = "  " }, true, "", ""},
+		{"zero amount", func(e *EPCData) { e.Amount = 0 }, true, "", ""},
+		{"amount too large", func(e *EPCData) { e.Amount = epcMaxAmount + 1 }, true, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := epcData()
+			tt.change(&e)
+			p, err := e.Payload()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %q", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(p) > epcMaxPayload || !utf8.ValidString(p) {
+				t.Errorf("payload of %d bytes, valid UTF-8 %v", len(p), utf8.ValidString(p))
+			}
+			lines := strings.Split(p, "\n")
+			if lines[5] != tt.beneficiary || lines[10] != tt.remittance {
+				t.Errorf("name/remittance = %q/%q, want %q/%q", lines[5], lines[10], tt.beneficiary, tt.remittance)
+			}
+		})
+	}
+}
+
+func TestEPCFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		iban     string
+		currency string
+		amount   utils.Money
+		ok       bool
+	}{
+		{"open euro invoice", "at61 1904 3002 3457 3201", "EUR", 1000, true},
+		{"foreign currency", "AT611904300234573201", "USD", 1000, false},
+		{"no bank account", "", "EUR", 1000, false},
+		{"settled", "AT611904300234573201", "EUR", 0, false},
+		{"overpaid", "AT611904300234573201", "EUR", -500, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, ok := epcFor("Muster GmbH", tt.iban, " gibaatwwxxx ", tt.currency, tt.amount, "RE-1")
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && (e.IBAN != "AT611904300234573201" || e.BIC != "GIBAATWWXXX") {
+				t.Errorf("iban/bic = %q/%q, want normalized", e.IBAN, e.BIC)
+			}
+		})
+	}
+}
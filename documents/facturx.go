@@ -0,0 +1,189 @@
+package documents
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/go-pdf/fpdf"
+)
+
+const facturXFilename = "factur-x.xml"
+
+var (
+	reStartXref = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	reSize      = regexp.MustCompile(`/Size (\d+)`)
+	reRoot      = regexp.MustCompile(`/Root (\d+) 0 R`)
+	reInfo      = regexp.MustCompile(`/Info (\d+) 0 R`)
+	reFilespec  = regexp.MustCompile(`(\d+) 0 obj\s*<< /Type /Filespec .*?/EF << /F (\d+) 0 R >>`)
+	reMetadata  = regexp.MustCompile(`(\d+) 0 obj\s*<< /Type /Metadata`)
+)
+
+// RenderFacturX renders the visual invoice PDF with the CII XML embedded as
+// factur-x.xml (AFRelationship /Data) and PDF/A-3B + Factur-X XMP metadata
+// (EN 16931 conformance level).
+//
+// Limitation: the layout uses the PDF core fonts, which are not embedded, and no
+// output intent is written; strict PDF/A validators will flag that, while
+// Factur-X/ZUGFeRD receivers read the embedded XML, which is the legally
+// relevant part.
+func RenderFacturX(d InvoiceData, ciiXML []byte) ([]byte, error) {
+	pdf := buildInvoicePDF(d)
+	pdf.SetProducer("fakturierung-backend", true)
+	pdf.SetAttachments([]fpdf.Attachment{{
+		Content:     ciiXML,
+		Filename:    facturXFilename,
+		Description: "Factur-X/ZUGFeRD invoice data",
+	}})
+	pdf.SetXmpMetadata(facturXMP(d))
+	raw, err := outputPDF(pdf)
+	if err != nil {
+		return nil, err
+	}
+	return linkAssociatedFile(raw)
+}
+
+// linkAssociatedFile appends an incremental update that turns the embedded file
+// into a PDF/A-3 associated file: the catalog gets /AF and /Metadata, the file
+// specification gets /F, /UF and /AFRelationship.
+func linkAssociatedFile(raw []byte) ([]byte, error) {
+	m := reStartXref.FindSubmatch(raw)
+	if m == nil {
+		return nil, errors.New("facturx: startxref not found")
+	}
+	prevXref := string(m[1])
+	trailer := raw[bytes.LastIndex(raw, []byte("trailer")):]
+	size, root, info := reSize.FindSubmatch(trailer), reRoot.FindSubmatch(trailer), reInfo.FindSubmatch(trailer)
+	fs := reFilespec.FindSubmatch(raw)
+	meta := reMetadata.FindSubmatch(raw)
+	if size == nil || root == nil || info == nil || fs == nil || meta == nil {
+		return nil, errors.New("facturx: unexpected PDF structure")
+	}
+	filespec, _ := strconv.Atoi(string(fs[1]))
+	stream, _ := strconv.Atoi(string(fs[2]))
+	catalog, _ := strconv.Atoi(string(root[1]))
+
+	name := fmt.Sprintf("(%s)", facturXFilename)
+	objects := map[int]string{
+		filespec: fmt.Sprintf("<< /Type /Filespec /F %s /UF %s /EF << /F %d 0 R /UF %d 0 R >> /Desc (Factur-X/ZUGFeRD invoice data) /AFRelationship /Data >>",
+			name, name, stream, stream),
+		catalog: fmt.Sprintf("<< /Type /Catalog /Pages 1 0 R /Metadata %s 0 R /Names << /EmbeddedFiles << /Names [%s %d 0 R] >> >> /AF [%d 0 R] >>",
+			meta[1], name, filespec, filespec),
+	}
+
+	var out bytes.Buffer
+	out.Write(bytes.Replace(raw, []byte("%PDF-1.3"), []byte("%PDF-1.7"), 1))
+	if !bytes.HasSuffix(raw, []byte("\n")) {
+		out.WriteByte('\n')
+	}
+	nums := make([]int, 0, len(objects))
+	for n := range objects {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	offsets := make(map[int]int, len(nums))
+	for _, n := range nums {
+		offsets[n] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", n, objects[n])
+	}
+
+	sum := sha256.Sum256(raw)
+	id := hex.EncodeToString(sum[:16])
+	xref := out.Len()
+	out.WriteString("xref\n")
+	for _, n := range nums {
+		fmt.Fprintf(&out, "%d 1\n%010d 00000 n \n", n, offsets[n])
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %s /Root %d 0 R /Info %s 0 R /Prev %s /ID [<%s> <%s>] >>\nstartxref\n%d\n%%%%EOF\n",
+		size[1], catalog, info[1], prevXref, id, id, xref)
+	return out.Bytes(), nil
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// facturXMP builds the XMP packet declaring PDF/A-3B and the Factur-X extension schema.
+func facturXMP(d InvoiceData) []byte {
+	inv := &d.Invoice
+	issued := IssueDate(inv).Format("2006-01-02T15:04:05")
+	title := Title(inv) + " " + Number(inv)
+	return []byte(`<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">
+   <pdfaid:part>3</pdfaid:part>
+   <pdfaid:conformance>B</pdfaid:conformance>
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">` + xmlEscape(title) + `</rdf:li></rdf:Alt></dc:title>
+   <dc:creator><rdf:Seq><rdf:li>` + xmlEscape(d.Company.CompanyName) + `</rdf:li></rdf:Seq></dc:creator>
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/">
+   <pdf:Producer>fakturierung-backend</pdf:Producer>
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+   <xmp:CreatorTool>fakturierung-backend</xmp:CreatorTool>
+   <xmp:CreateDate>` + issued + `</xmp:CreateDate>
+   <xmp:ModifyDate>` + issued + `</xmp:ModifyDate>
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:fx="urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#">
+   <fx:DocumentType>INVOICE</fx:DocumentType>
+   <fx:DocumentFileName>` + facturXFilename + `</fx:DocumentFileName>
+   <fx:Version>1.0</fx:Version>
+   <fx:ConformanceLevel>EN 16931</fx:ConformanceLevel>
+  </rdf:Description>
+  <rdf:Description rdf:about=""
+    xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/"
+    xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#"
+    xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+   <pdfaExtension:schemas>
+    <rdf:Bag>
+     <rdf:li rdf:parseType="Resource">
+      <pdfaSchema:schema>Factur-X PDFA Extension Schema</pdfaSchema:schema>
+      <pdfaSchema:namespaceURI>urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#</pdfaSchema:namespaceURI>
+      <pdfaSchema:prefix>fx</pdfaSchema:prefix>
+      <pdfaSchema:property>
+       <rdf:Seq>
+        <rdf:li rdf:parseType="Resource">
+         <pdfaProperty:name>DocumentFileName</pdfaProperty:name>
+         <pdfaProperty:valueType>Text</pdfaProperty:valueType>
+         <pdfaProperty:category>external</pdfaProperty:category>
+         <pdfaProperty:description>name of the embedded XML invoice file</pdfaProperty:description>
+        </rdf:li>
+        <rdf:li rdf:parseType="Resource">
+         <pdfaProperty:name>DocumentType</pdfaProperty:name>
+         <pdfaProperty:valueType>Text</pdfaProperty:valueType>
+         <pdfaProperty:category>external</pdfaProperty:category>
+         <pdfaProperty:description>INVOICE</pdfaProperty:description>
+        </rdf:li>
+        <rdf:li rdf:parseType="Resource">
+         <pdfaProperty:name>Version</pdfaProperty:name>
+         <pdfaProperty:valueType>Text</pdfaProperty:valueType>
+         <pdfaProperty:category>external</pdfaProperty:category>
+         <pdfaProperty:description>The actual version of the Factur-X XML schema</pdfaProperty:description>
+        </rdf:li>
+        <rdf:li rdf:parseType="Resource">
+         <pdfaProperty:name>ConformanceLevel</pdfaProperty:name>
+         <pdfaProperty:valueType>Text</pdfaProperty:valueType>
+         <pdfaProperty:category>external</pdfaProperty:category>
+         <pdfaProperty:description>The conformance level of the embedded Factur-X data</pdfaProperty:description>
+        </rdf:li>
+       </rdf:Seq>
+      </pdfaSchema:property>
+     </rdf:li>
+    </rdf:Bag>
+   </pdfaExtension:schemas>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`)
+}
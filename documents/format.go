@@ -0,0 +1,139 @@
+// Package documents renders invoices and quotations into printable/exchange formats.
+package documents
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+)
+
+// InvoiceData bundles everything needed to render one invoice document.
+type InvoiceData struct {
+	Invoice      models.Invoice    // with Items and Customer loaded
+	Company      models.Company    // issuer (tenant), with ContactPerson loaded
+	ArticleNames map[string]string // article ID -> name, fallback for empty line descriptions
+	Corrected    *models.Invoice   // credit notes: the invoice being corrected
+}
+
+// Title returns the document heading for the invoice's kind.
+func Title(inv *models.Invoice) string {
+	switch {
+	case inv.CorrectsID != nil || inv.DocumentType == models.DocumentCreditNote:
+		return "Gutschrift"
+	case inv.DocumentType == models.DocumentQuotation:
+		return "Angebot"
+	case inv.DocumentType == models.DocumentOrderConfirmation:
+		return "Auftragsbestätigung"
+	case inv.DocumentType == models.DocumentDeliveryNote:
+		return "Lieferschein"
+	case inv.InvoiceType == "down_payment":
+		return "Anzahlungsrechnung"
+	case inv.InvoiceType == "final":
+		return "Schlussrechnung"
+	default:
+		return "Rechnung"
+	}
+}
+
+// Number returns the document number shown to the customer.
+func Number(inv *models.Invoice) string {
+	switch inv.DocumentType {
+	case models.DocumentQuotation:
+		return inv.QuotationNumber
+	case models.DocumentOrderConfirmation, models.DocumentDeliveryNote:
+		return inv.DocumentNumber
+	}
+	return inv.InvoiceNumber
+}
+
+// IssueDate is the publish date for issued documents, else the creation date.
+func IssueDate(inv *models.Invoice) time.Time {
+	if inv.PublishedAt != nil {
+		return *inv.PublishedAt
+	}
+	return inv.CreatedAt
+}
+
+// LineDescription prefers the line text and falls back to the article name.
+func (d *InvoiceData) LineDescription(it models.InvoiceItem) string {
+	if s := strings.TrimSpace(it.Description); s != "" {
+		return s
+	}
+	if name := d.ArticleNames[it.ArticleID]; name != "" {
+		return name
+	}
+	return it.ArticleID
+}
+
+// unitLabels are the unit abbreviations printed next to line quantities.
+var unitLabels = map[string]string{
+	models.UnitPiece:    "Stk.",
+	models.UnitHour:     "Std.",
+	models.UnitDay:      "Tage",
+	models.UnitKilogram: "kg",
+	models.UnitMeter:    "m",
+	models.UnitFlatRate: "pauschal",
+}
+
+// UnitLabel returns the printed abbreviation of a line unit (the raw value if unknown).
+func UnitLabel(unit string) string {
+	if l, ok := unitLabels[unit]; ok {
+		return l
+	}
+	return unit
+}
+
+// Quantity formats a line quantity with up to 3 decimals: "2", "2,5", "0,125".
+func Quantity(x float64) string {
+	s := strconv.FormatFloat(math.Round(x*1000)/1000, 'f', -1, 64)
+	return strings.Replace(s, ".", ",", 1)
+}
+
+// Money formats an amount the Austrian/German way: 1.234,56
+func Money(x utils.Money) string {
+	neg := x < 0
+	s := x.Abs().String()
+	intPart, frac := s[:len(s)-3], s[len(s)-2:]
+	var b strings.Builder
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(r)
+	}
+	out := b.String() + "," + frac
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
+
+// Currency returns the document's currency code (documents before multi-currency are EUR).
+func Currency(inv *models.Invoice) string {
+	if inv.Currency == "" {
+		return "EUR"
+	}
+	return inv.Currency
+}
+
+// Rate formats an exchange rate with up to 6 decimals: "1,0823", "0,9412".
+func Rate(x float64) string {
+	s := strconv.FormatFloat(math.Round(x*1e6)/1e6, 'f', -1, 64)
+	return strings.Replace(s, ".", ",", 1)
+}
+
+// Percent formats a tax rate fraction (0.2) as "20 %" / "12,5 %".
+func Percent(rate float64) string {
+	s := strconv.FormatFloat(rate*100, 'f', -1, 64)
+	return strings.Replace(s, ".", ",", 1) + " %"
+}
+
+// Date formats a date as dd.mm.yyyy.
+func Date(t time.Time) string {
+	return fmt.Sprintf("%02d.%02d.%04d", t.Day(), int(t.Month()), t.Year())
+}
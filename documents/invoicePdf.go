@@ -0,0 +1,399 @@
+package documents
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"fakturierung-backend/models"
+	"fakturierung-backend/utils"
+
+	"github.com/go-pdf/fpdf"
+)
+
+const (
+	pdfMarginLeft  = 20.0
+	pdfMarginRight = 20.0
+	pdfPageWidth   = 210.0
+	pdfContentW    = pdfPageWidth - pdfMarginLeft - pdfMarginRight
+)
+
+// RenderInvoicePDF renders an invoice/quotation/credit note as an A4 PDF.
+// Output is deterministic for the same input (fixed creation date, sorted catalog).
+func RenderInvoicePDF(d InvoiceData) ([]byte, error) {
+	return outputPDF(buildInvoicePDF(d))
+}
+
+func outputPDF(pdf *fpdf.Fpdf) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// buildInvoicePDF lays out the document; callers may add attachments/metadata before output.
+func buildInvoicePDF(d InvoiceData) *fpdf.Fpdf {
+	inv := &d.Invoice
+	co := &d.Company
+	cu := &inv.Customer
+
+	pdf, tr := newLetterPDF(d, IssueDate(inv), Title(inv)+" "+Number(inv))
+
+	writeMeta(pdf, tr, [][2]string{
+		{"Nummer", Number(inv)},
+		{"Datum", Date(IssueDate(inv))},
+		{"Kunden-Nr.", fmt.Sprintf("%d", cu.Id)},
+	})
+	title := Title(inv)
+	if n := Number(inv); n != "" {
+		title += " " + n
+	}
+	writeHeading(pdf, tr, title)
+
+	// Items table; delivery notes list quantities only
+	delivery := inv.DocumentType == models.DocumentDeliveryNote
+	cols := []struct {
+		label string
+		w     float64
+		align string
+	}{
+		{"Pos", 10, "L"},
+		{"Beschreibung", 62, "L"},
+		{"Menge", 26, "R"},
+		{"Einzelpreis", 27, "R"},
+		{"USt", 15, "R"},
+		{"Netto", 30, "R"},
+	}
+	if delivery {
+		cols = cols[:3]
+		cols[1].w, cols[2].w = 130, 30
+	}
+	header := func() {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.SetFillColor(235, 235, 235)
+		for _, col := range cols {
+			pdf.CellFormat(col.w, 7, tr(col.label), "B", 0, col.align, true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", 9)
+	}
+	header()
+	for i, it := range inv.Items {
+		if pdf.GetY() > 250 {
+			pdf.AddPage()
+			header()
+		}
+		desc := tr(d.LineDescription(it))
+		lines := pdf.SplitLines([]byte(desc), cols[1].w-2)
+		h := 5.0 * float64(max(1, len(lines)))
+		y := pdf.GetY()
+		pdf.CellFormat(cols[0].w, 5, fmt.Sprintf("%d", i+1), "", 0, "L", false, 0, "")
+		x := pdf.GetX()
+		pdf.MultiCell(cols[1].w, 5, desc, "", "L", false)
+		pdf.SetXY(x+cols[1].w, y)
+		pdf.CellFormat(cols[2].w, 5, tr(Quantity(it.Amount)+" "+UnitLabel(it.Unit)), "", 0, "R", false, 0, "")
+		if !delivery {
+			pdf.CellFormat(cols[3].w, 5, tr(Money(it.UnitPrice)), "", 0, "R", false, 0, "")
+			pdf.CellFormat(cols[4].w, 5, tr(Percent(it.TaxRate)), "", 0, "R", false, 0, "")
+			pdf.CellFormat(cols[5].w, 5, tr(Money(it.NetPrice+it.Discount)), "", 0, "R", false, 0, "")
+		}
+		pdf.SetXY(pdfMarginLeft, y+h)
+		if it.Discount != 0 && !delivery {
+			// the line discount as its own row below the line
+			pdf.SetX(pdfMarginLeft + cols[0].w)
+			pdf.CellFormat(cols[1].w+cols[2].w+cols[3].w+cols[4].w, 5, tr(discountLabel(it.DiscountRate)), "", 0, "L", false, 0, "")
+			pdf.CellFormat(cols[5].w, 5, tr(Money(-it.Discount)), "", 1, "R", false, 0, "")
+		}
+	}
+	pdf.Line(pdfMarginLeft, pdf.GetY()+1, pdfMarginLeft+pdfContentW, pdf.GetY()+1)
+	pdf.Ln(3)
+	if delivery {
+		return pdf
+	}
+
+	// Totals with per-rate tax breakdown
+	total := func(label, value string, bold bool) {
+		style := ""
+		if bold {
+			style = "B"
+		}
+		pdf.SetFont("Helvetica", style, 9)
+		pdf.SetX(pdfMarginLeft + 90)
+		pdf.CellFormat(50, 5.5, tr(label), "", 0, "L", false, 0, "")
+		pdf.CellFormat(pdfContentW-140, 5.5, tr(value+" "+Currency(inv)), "", 1, "R", false, 0, "")
+	}
+	if len(inv.Deductions) > 0 {
+		writeDeductions(pdf, tr, inv, total)
+	} else {
+		writeDiscount(inv, total)
+		total("Summe netto", Money(inv.Subtotal), false)
+		for _, tl := range inv.TaxBreakdown {
+			total(fmt.Sprintf("USt %s auf %s", Percent(tl.Rate), Money(tl.Net)), Money(tl.Tax), false)
+		}
+		total("Gesamtbetrag", Money(inv.Total), true)
+	}
+	if inv.PaidTotal != 0 && inv.DocumentType == models.DocumentInvoice {
+		total("Bereits bezahlt", Money(inv.PaidTotal), false)
+		total("Offener Betrag", Money(inv.Total-inv.PaidTotal), true)
+	}
+	writeBaseCurrency(pdf, tr, inv)
+	pdf.Ln(6)
+
+	// Legal notice of a zero-rated tax treatment (reverse charge, exemptions)
+	if inv.TaxNote != "" {
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.MultiCell(pdfContentW, 5, tr(inv.TaxNote), "", "L", false)
+		pdf.Ln(2)
+	}
+
+	// Quotations: how long the offer holds
+	if inv.DocumentType == models.DocumentQuotation && inv.ValidUntil != nil {
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.MultiCell(pdfContentW, 5, tr("Dieses Angebot ist gültig bis "+Date(*inv.ValidUntil)+"."), "", "L", false)
+	}
+
+	// Payment terms, with a GiroCode for the open amount next to them
+	if inv.DocumentType == models.DocumentInvoice {
+		textW, qrBottom := pdfContentW, 0.0
+		if e, ok := EPCForInvoice(d); ok && writePaymentQR(pdf, tr, e) {
+			textW -= epcQRSizeMM + 5
+			qrBottom = pdf.GetY() + epcQRSizeMM + 5
+		}
+		pdf.SetFont("Helvetica", "", 9)
+		if inv.DueDate != nil {
+			pdf.MultiCell(textW, 5, tr("Zahlbar ohne Abzug bis "+Date(*inv.DueDate)+"."), "", "L", false)
+		}
+		if inv.SkontoDueDate != nil && inv.SkontoTotal != nil {
+			pdf.MultiCell(textW, 5, tr(fmt.Sprintf("Bei Zahlung bis %s abzüglich %s Skonto: %s %s.",
+				Date(*inv.SkontoDueDate), Percent(inv.SkontoRate), Money(*inv.SkontoTotal), Currency(inv))), "", "L", false)
+		}
+		if co.PaymentTerms != "" {
+			pdf.MultiCell(textW, 5, tr(co.PaymentTerms), "", "L", false)
+		}
+		if pdf.GetY() < qrBottom {
+			pdf.SetY(qrBottom)
+		}
+	}
+
+	return pdf
+}
+
+// writeBaseCurrency states the locked exchange rate of a foreign-currency document and
+// its totals in the base currency, as the VAT has to be shown in the latter.
+func writeBaseCurrency(pdf *fpdf.Fpdf, tr func(string) string, inv *models.Invoice) {
+	if inv.ExchangeRate == nil || inv.BaseTotal == nil || inv.BaseCurrency == Currency(inv) {
+		return
+	}
+	pdf.Ln(2)
+	pdf.SetFont("Helvetica", "", 8)
+	rate := fmt.Sprintf("Umrechnungskurs: 1 %s = %s %s", inv.BaseCurrency, Rate(*inv.ExchangeRate), Currency(inv))
+	if inv.ExchangeRateDate != nil {
+		rate += " vom " + Date(*inv.ExchangeRateDate)
+	}
+	for _, row := range [][2]string{
+		{rate, ""},
+		{"Summe netto in " + inv.BaseCurrency, Money(*inv.BaseSubtotal) + " " + inv.BaseCurrency},
+		{"USt in " + inv.BaseCurrency, Money(*inv.BaseTaxTotal) + " " + inv.BaseCurrency},
+		{"Gesamtbetrag in " + inv.BaseCurrency, Money(*inv.BaseTotal) + " " + inv.BaseCurrency},
+	} {
+		pdf.SetX(pdfMarginLeft + 30)
+		pdf.CellFormat(110, 4.5, tr(row[0]), "", 0, "L", false, 0, "")
+		pdf.CellFormat(pdfContentW-140, 4.5, tr(row[1]), "", 1, "R", false, 0, "")
+	}
+}
+
+// discountLabel names a line or document discount, with its rate if it has one.
+func discountLabel(rate float64) string {
+	if rate > 0 {
+		return "Rabatt " + Percent(rate)
+	}
+	return "Rabatt"
+}
+
+// writeDiscount renders the document discount, if any, between the lines' sum and
+// the net total.
+func writeDiscount(inv *models.Invoice, total func(label, value string, bold bool)) {
+	if inv.Discount == 0 {
+		return
+	}
+	var lines utils.Money
+	for _, it := range inv.Items {
+		lines += it.NetPrice
+	}
+	total("Summe Positionen", Money(lines), false)
+	total(discountLabel(inv.DiscountRate), Money(-inv.Discount), false)
+}
+
+// writeDeductions renders the totals of a final invoice: the full service with its
+// tax, each deducted down-payment invoice with the tax contained in it, and the
+// remaining amount per rate (§ 14 Abs. 5 UStG).
+func writeDeductions(pdf *fpdf.Fpdf, tr func(string) string, inv *models.Invoice, total func(label, value string, bold bool)) {
+	full := make(map[float64]*models.TaxLine)
+	add := func(lines []models.TaxLine) {
+		for _, tl := range lines {
+			l, ok := full[tl.Rate]
+			if !ok {
+				l = &models.TaxLine{Rate: tl.Rate}
+				full[tl.Rate] = l
+			}
+			l.Net, l.Tax, l.Gross = l.Net+tl.Net, l.Tax+tl.Tax, l.Gross+tl.Gross
+		}
+	}
+	add(inv.TaxBreakdown)
+	for _, d := range inv.Deductions {
+		add(d.TaxBreakdown)
+	}
+	rates := make([]float64, 0, len(full))
+	for r := range full {
+		rates = append(rates, r)
+	}
+	sort.Float64s(rates)
+	var net, gross utils.Money
+	for _, r := range rates {
+		net, gross = net+full[r].Net, gross+full[r].Gross
+	}
+
+	writeDiscount(inv, total)
+	total("Gesamtleistung netto", Money(net), false)
+	for _, r := range rates {
+		total(fmt.Sprintf("USt %s auf %s", Percent(r), Money(full[r].Net)), Money(full[r].Tax), false)
+	}
+	total("Gesamtleistung brutto", Money(gross), true)
+
+	wide := func(label, value string) {
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.SetX(pdfMarginLeft + 30)
+		pdf.CellFormat(110, 5.5, tr(label), "", 0, "L", false, 0, "")
+		pdf.CellFormat(pdfContentW-140, 5.5, tr(value+" "+Currency(inv)), "", 1, "R", false, 0, "")
+	}
+	for _, d := range inv.Deductions {
+		label := "abzüglich Anzahlungsrechnung " + d.InvoiceNumber
+		if d.IssuedAt != nil {
+			label += " vom " + Date(*d.IssuedAt)
+		}
+		wide(label, Money(-d.Total))
+		for _, tl := range d.TaxBreakdown {
+			wide(fmt.Sprintf("    darin USt %s auf %s", Percent(tl.Rate), Money(-tl.Net)), Money(-tl.Tax))
+		}
+	}
+
+	total("Restbetrag netto", Money(inv.Subtotal), false)
+	for _, tl := range inv.TaxBreakdown {
+		total(fmt.Sprintf("USt %s auf %s", Percent(tl.Rate), Money(tl.Net)), Money(tl.Tax), false)
+	}
+	total("Restbetrag", Money(inv.Total), true)
+}
+
+// newLetterPDF starts an A4 business letter from the invoice's issuer to its
+// customer: metadata, footer with bank details, issuer header and address block.
+// It returns the document and the cp1252 translator for the core fonts.
+func newLetterPDF(d InvoiceData, date time.Time, title string) (*fpdf.Fpdf, func(string) string) {
+	co := &d.Company
+	cu := &d.Invoice.Customer
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pdfMarginLeft, 20, pdfMarginRight)
+	pdf.SetAutoPageBreak(true, 30)
+	pdf.SetCatalogSort(true)
+	pdf.SetCreationDate(date)
+	pdf.SetModificationDate(date)
+	pdf.SetTitle(title, true)
+	pdf.SetAuthor(co.CompanyName, true)
+	pdf.SetCreator("fakturierung-backend", true)
+	tr := pdf.UnicodeTranslatorFromDescriptor("") // cp1252 for core fonts (umlauts, €)
+
+	// Footer: bank details + page number on every page
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-25)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.SetTextColor(90, 90, 90)
+		var parts []string
+		parts = append(parts, co.CompanyName)
+		if co.UID != "" {
+			parts = append(parts, "UID: "+co.UID)
+		}
+		if co.Homepage != "" {
+			parts = append(parts, co.Homepage)
+		}
+		pdf.CellFormat(pdfContentW, 4, tr(strings.Join(parts, " | ")), "T", 1, "C", false, 0, "")
+		if co.IBAN != "" {
+			bank := []string{}
+			if co.BankName != "" {
+				bank = append(bank, co.BankName)
+			}
+			bank = append(bank, "IBAN: "+co.IBAN)
+			if co.BIC != "" {
+				bank = append(bank, "BIC: "+co.BIC)
+			}
+			pdf.CellFormat(pdfContentW, 4, tr(strings.Join(bank, " | ")), "", 1, "C", false, 0, "")
+		}
+		pdf.CellFormat(pdfContentW, 4, fmt.Sprintf("Seite %d/{nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+	})
+	pdf.AliasNbPages("{nb}")
+	pdf.AddPage()
+
+	// Header: issuer
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.CellFormat(pdfContentW, 7, tr(co.CompanyName), "", 1, "R", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	for _, l := range []string{
+		co.Address,
+		strings.TrimSpace(co.Zip + " " + co.City),
+		co.Country,
+		co.Phone,
+		co.Email,
+	} {
+		if strings.TrimSpace(l) != "" {
+			pdf.CellFormat(pdfContentW, 4.5, tr(l), "", 1, "R", false, 0, "")
+		}
+	}
+
+	// Recipient
+	pdf.SetY(55)
+	pdf.SetFont("Helvetica", "", 7)
+	pdf.CellFormat(90, 4, tr(co.CompanyName+" · "+co.Address+" · "+co.Zip+" "+co.City), "B", 1, "L", false, 0, "")
+	pdf.Ln(2)
+	pdf.SetFont("Helvetica", "", 10)
+	contact := strings.TrimSpace(strings.Join([]string{cu.Title, cu.FirstName, cu.LastName}, " "))
+	for _, l := range []string{
+		cu.CompanyName,
+		contact,
+		cu.Address,
+		strings.TrimSpace(cu.Zip + " " + cu.City),
+		cu.Country,
+	} {
+		if strings.TrimSpace(l) != "" {
+			pdf.CellFormat(90, 5, tr(l), "", 1, "L", false, 0, "")
+		}
+	}
+	if cu.UID != "" {
+		pdf.CellFormat(90, 5, tr("UID: "+cu.UID), "", 1, "L", false, 0, "")
+	}
+	return pdf, tr
+}
+
+// writeMeta prints label/value pairs in the right column next to the address block.
+func writeMeta(pdf *fpdf.Fpdf, tr func(string) string, meta [][2]string) {
+	pdf.SetXY(pdfMarginLeft+100, 60)
+	for _, m := range meta {
+		if m[1] == "" {
+			continue
+		}
+		pdf.SetX(pdfMarginLeft + 100)
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(30, 5, tr(m[0]+":"), "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.CellFormat(pdfContentW-130, 5, tr(m[1]), "", 1, "R", false, 0, "")
+	}
+}
+
+// writeHeading prints the document title below the address block.
+func writeHeading(pdf *fpdf.Fpdf, tr func(string) string, title string) {
+	pdf.SetY(100)
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(pdfContentW, 9, tr(title), "", 1, "L", false, 0, "")
+	pdf.Ln(3)
+}
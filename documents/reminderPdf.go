@@ -0,0 +1,96 @@
+package documents
+
+import (
+	"fmt"
+
+	"fakturierung-backend/models"
+)
+
+// ReminderData bundles a dunning notice with the invoice it refers to.
+type ReminderData struct {
+	InvoiceData
+	Notice models.DunningNotice
+	Text   string // intro text of the dunning level
+}
+
+// RenderReminderPDF renders a payment reminder / dunning letter for one invoice.
+// Output is deterministic for the same input.
+func RenderReminderPDF(r ReminderData) ([]byte, error) {
+	inv := &r.Invoice
+	n := &r.Notice
+
+	pdf, tr := newLetterPDF(r.InvoiceData, n.IssuedAt, n.LevelName+" "+inv.InvoiceNumber)
+	writeMeta(pdf, tr, [][2]string{
+		{"Datum", Date(n.IssuedAt)},
+		{"Rechnung", inv.InvoiceNumber},
+		{"Kunden-Nr.", fmt.Sprintf("%d", inv.Customer.Id)},
+	})
+	writeHeading(pdf, tr, n.LevelName)
+
+	pdf.SetFont("Helvetica", "", 10)
+	if r.Text != "" {
+		pdf.MultiCell(pdfContentW, 5, tr(r.Text), "", "L", false)
+		pdf.Ln(4)
+	}
+
+	// Overdue invoice
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetFillColor(235, 235, 235)
+	pdf.CellFormat(40, 7, "Rechnung", "B", 0, "L", true, 0, "")
+	pdf.CellFormat(30, 7, "Datum", "B", 0, "L", true, 0, "")
+	pdf.CellFormat(30, 7, tr("Fällig seit"), "B", 0, "L", true, 0, "")
+	pdf.CellFormat(35, 7, "Betrag", "B", 0, "R", true, 0, "")
+	pdf.CellFormat(pdfContentW-135, 7, "Offen", "B", 1, "R", true, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	cur := Currency(inv)
+	due := ""
+	if inv.DueDate != nil {
+		due = Date(*inv.DueDate)
+	}
+	pdf.CellFormat(40, 6, tr(inv.InvoiceNumber), "", 0, "L", false, 0, "")
+	pdf.CellFormat(30, 6, Date(IssueDate(inv)), "", 0, "L", false, 0, "")
+	pdf.CellFormat(30, 6, due, "", 0, "L", false, 0, "")
+	pdf.CellFormat(35, 6, tr(Money(inv.Total)+" "+cur), "", 0, "R", false, 0, "")
+	pdf.CellFormat(pdfContentW-135, 6, tr(Money(n.OpenAmount)+" "+cur), "", 1, "R", false, 0, "")
+	pdf.Line(pdfMarginLeft, pdf.GetY()+1, pdfMarginLeft+pdfContentW, pdf.GetY()+1)
+	pdf.Ln(3)
+
+	total := func(label, value string, bold bool) {
+		style := ""
+		if bold {
+			style = "B"
+		}
+		pdf.SetFont("Helvetica", style, 9)
+		pdf.SetX(pdfMarginLeft + 90)
+		pdf.CellFormat(50, 5.5, tr(label), "", 0, "L", false, 0, "")
+		pdf.CellFormat(pdfContentW-140, 5.5, tr(value+" "+cur), "", 1, "R", false, 0, "")
+	}
+	total("Offener Rechnungsbetrag", Money(n.OpenAmount), false)
+	if n.FeesTotal != 0 {
+		total("Mahnspesen", Money(n.FeesTotal), false)
+	}
+	if n.Interest != 0 {
+		total(fmt.Sprintf("Verzugszinsen (%d Tage)", n.DaysOverdue), Money(n.Interest), false)
+	}
+	total("Zu zahlen", Money(n.TotalDue), true)
+	pdf.Ln(6)
+
+	// GiroCode for the total due next to the payment request
+	textW, qrBottom := pdfContentW, 0.0
+	co := &r.Company
+	if e, ok := epcFor(co.CompanyName, co.IBAN, co.BIC, cur, n.TotalDue, inv.InvoiceNumber); ok && writePaymentQR(pdf, tr, e) {
+		textW -= epcQRSizeMM + 5
+		qrBottom = pdf.GetY() + epcQRSizeMM + 5
+	}
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.MultiCell(textW, 5, tr(fmt.Sprintf(
+		"Bitte überweisen Sie den Betrag von %s %s bis spätestens %s unter Angabe der Rechnungsnummer %s.",
+		Money(n.TotalDue), cur, Date(n.DueDate), inv.InvoiceNumber)), "", "L", false)
+	pdf.Ln(2)
+	pdf.MultiCell(textW, 5, tr("Sollten Sie die Zahlung bereits veranlasst haben, betrachten Sie dieses Schreiben bitte als gegenstandslos."), "", "L", false)
+	if pdf.GetY() < qrBottom {
+		pdf.SetY(qrBottom)
+	}
+
+	return outputPDF(pdf)
+}
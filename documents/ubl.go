@@ -0,0 +1,364 @@
+package documents
+
+import (
+	"encoding/xml"
+
+	"fakturierung-backend/utils"
+)
+
+// OASIS UBL 2.1 Invoice / CreditNote structures (Peppol BIS Billing 3.0 subset).
+
+type ublAmount struct {
+	Value      string `xml:",chardata"`
+	CurrencyID string `xml:"currencyID,attr"`
+}
+
+type ublID struct {
+	Value    string `xml:",chardata"`
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+}
+
+type ublTaxScheme struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type ublTaxCategory struct {
+	ID                     string       `xml:"cbc:ID"`
+	Percent                string       `xml:"cbc:Percent"`
+	TaxExemptionReasonCode string       `xml:"cbc:TaxExemptionReasonCode,omitempty"` // VAT breakdown only
+	TaxExemptionReason     string       `xml:"cbc:TaxExemptionReason,omitempty"`
+	TaxScheme              ublTaxScheme `xml:"cac:TaxScheme"`
+}
+
+type ublTaxSubtotal struct {
+	TaxableAmount ublAmount      `xml:"cbc:TaxableAmount"`
+	TaxAmount     ublAmount      `xml:"cbc:TaxAmount"`
+	TaxCategory   ublTaxCategory `xml:"cac:TaxCategory"`
+}
+
+type ublTaxTotal struct {
+	TaxAmount ublAmount        `xml:"cbc:TaxAmount"`
+	Subtotals []ublTaxSubtotal `xml:"cac:TaxSubtotal,omitempty"`
+}
+
+type ublParty struct {
+	EndpointID    *ublID `xml:"cbc:EndpointID,omitempty"`
+	PostalAddress struct {
+		StreetName string `xml:"cbc:StreetName,omitempty"`
+		CityName   string `xml:"cbc:CityName,omitempty"`
+		PostalZone string `xml:"cbc:PostalZone,omitempty"`
+		Country    struct {
+			IdentificationCode string `xml:"cbc:IdentificationCode"`
+		} `xml:"cac:Country"`
+	} `xml:"cac:PostalAddress"`
+	TaxScheme *struct {
+		CompanyID string       `xml:"cbc:CompanyID"`
+		TaxScheme ublTaxScheme `xml:"cac:TaxScheme"`
+	} `xml:"cac:PartyTaxScheme,omitempty"`
+	LegalEntity struct {
+		RegistrationName string `xml:"cbc:RegistrationName"`
+	} `xml:"cac:PartyLegalEntity"`
+	Contact *struct {
+		Name           string `xml:"cbc:Name,omitempty"`
+		Telephone      string `xml:"cbc:Telephone,omitempty"`
+		ElectronicMail string `xml:"cbc:ElectronicMail,omitempty"`
+	} `xml:"cac:Contact,omitempty"`
+}
+
+// ublAllowance is an allowance (ChargeIndicator false); only document level ones
+// carry a tax category.
+type ublAllowance struct {
+	ChargeIndicator bool            `xml:"cbc:ChargeIndicator"`
+	Reason          string          `xml:"cbc:AllowanceChargeReason,omitempty"`
+	Multiplier      string          `xml:"cbc:MultiplierFactorNumeric,omitempty"`
+	Amount          ublAmount       `xml:"cbc:Amount"`
+	BaseAmount      *ublAmount      `xml:"cbc:BaseAmount,omitempty"`
+	TaxCategory     *ublTaxCategory `xml:"cac:TaxCategory,omitempty"`
+}
+
+type ublLine struct {
+	ID               string         `xml:"cbc:ID"`
+	InvoicedQuantity *ublQty        `xml:"cbc:InvoicedQuantity,omitempty"`
+	CreditedQuantity *ublQty        `xml:"cbc:CreditedQuantity,omitempty"`
+	LineExtension    ublAmount      `xml:"cbc:LineExtensionAmount"`
+	Allowances       []ublAllowance `xml:"cac:AllowanceCharge,omitempty"`
+	Item             struct {
+		Name                  string `xml:"cbc:Name"`
+		SellersIdentification *struct {
+			ID string `xml:"cbc:ID"`
+		} `xml:"cac:SellersItemIdentification,omitempty"`
+		ClassifiedTaxCategory ublTaxCategory `xml:"cac:ClassifiedTaxCategory"`
+	} `xml:"cac:Item"`
+	Price struct {
+		PriceAmount ublAmount `xml:"cbc:PriceAmount"`
+	} `xml:"cac:Price"`
+}
+
+type ublQty struct {
+	Value    string `xml:",chardata"`
+	UnitCode string `xml:"unitCode,attr"`
+}
+
+type ublDocument struct {
+	XMLName  xml.Name
+	Xmlns    string `xml:"xmlns,attr"`
+	XmlnsCAC string `xml:"xmlns:cac,attr"`
+	XmlnsCBC string `xml:"xmlns:cbc,attr"`
+
+	CustomizationID    string `xml:"cbc:CustomizationID"`
+	ProfileID          string `xml:"cbc:ProfileID"`
+	ID                 string `xml:"cbc:ID"`
+	IssueDate          string `xml:"cbc:IssueDate"`
+	DueDate            string `xml:"cbc:DueDate,omitempty"` // Invoice only
+	InvoiceTypeCode    string `xml:"cbc:InvoiceTypeCode,omitempty"`
+	CreditNoteTypeCode string `xml:"cbc:CreditNoteTypeCode,omitempty"`
+	Note               string `xml:"cbc:Note,omitempty"`
+	Currency           string `xml:"cbc:DocumentCurrencyCode"`
+	TaxCurrency        string `xml:"cbc:TaxCurrencyCode,omitempty"`
+	BuyerReference     string `xml:"cbc:BuyerReference,omitempty"`
+	BillingReference   *struct {
+		InvoiceDocumentReference struct {
+			ID        string `xml:"cbc:ID"`
+			IssueDate string `xml:"cbc:IssueDate,omitempty"`
+		} `xml:"cac:InvoiceDocumentReference"`
+	} `xml:"cac:BillingReference,omitempty"`
+	Supplier struct {
+		Party ublParty `xml:"cac:Party"`
+	} `xml:"cac:AccountingSupplierParty"`
+	Customer struct {
+		Party ublParty `xml:"cac:Party"`
+	} `xml:"cac:AccountingCustomerParty"`
+	Delivery *struct {
+		ActualDeliveryDate string `xml:"cbc:ActualDeliveryDate,omitempty"`
+		Location           *struct {
+			Address struct {
+				Country struct {
+					IdentificationCode string `xml:"cbc:IdentificationCode"`
+				} `xml:"cac:Country"`
+			} `xml:"cac:Address"`
+		} `xml:"cac:DeliveryLocation,omitempty"`
+	} `xml:"cac:Delivery,omitempty"`
+	PaymentMeans struct {
+		Code    string `xml:"cbc:PaymentMeansCode"`
+		Account *struct {
+			ID     string `xml:"cbc:ID"`
+			Branch *struct {
+				ID string `xml:"cbc:ID"`
+			} `xml:"cac:FinancialInstitutionBranch,omitempty"`
+		} `xml:"cac:PayeeFinancialAccount,omitempty"`
+	} `xml:"cac:PaymentMeans"`
+	PaymentTerms *struct {
+		Note string `xml:"cbc:Note"`
+	} `xml:"cac:PaymentTerms,omitempty"`
+	Allowances []ublAllowance `xml:"cac:AllowanceCharge,omitempty"`
+	// BT-110 with the breakdown; BT-111 in the tax currency, without breakdown
+	TaxTotals     []ublTaxTotal `xml:"cac:TaxTotal"`
+	MonetaryTotal struct {
+		LineExtension ublAmount  `xml:"cbc:LineExtensionAmount"`
+		TaxExclusive  ublAmount  `xml:"cbc:TaxExclusiveAmount"`
+		TaxInclusive  ublAmount  `xml:"cbc:TaxInclusiveAmount"`
+		Allowances    *ublAmount `xml:"cbc:AllowanceTotalAmount,omitempty"`
+		Prepaid       *ublAmount `xml:"cbc:PrepaidAmount,omitempty"`
+		Payable       ublAmount  `xml:"cbc:PayableAmount"`
+	} `xml:"cac:LegalMonetaryTotal"`
+	InvoiceLines    []ublLine `xml:"cac:InvoiceLine,omitempty"`
+	CreditNoteLines []ublLine `xml:"cac:CreditNoteLine,omitempty"`
+}
+
+func ublPartyFrom(p EParty, withContact bool) ublParty {
+	var out ublParty
+	if p.Email != "" {
+		out.EndpointID = &ublID{Value: p.Email, SchemeID: "EM"}
+	}
+	out.PostalAddress.StreetName = p.Street
+	out.PostalAddress.CityName = p.City
+	out.PostalAddress.PostalZone = p.PostCode
+	out.PostalAddress.Country.IdentificationCode = p.CountryCode
+	if p.VATID != "" {
+		out.TaxScheme = &struct {
+			CompanyID string       `xml:"cbc:CompanyID"`
+			TaxScheme ublTaxScheme `xml:"cac:TaxScheme"`
+		}{p.VATID, ublTaxScheme{ID: "VAT"}}
+	}
+	out.LegalEntity.RegistrationName = p.Name
+	if withContact && (p.ContactName != "" || p.ContactPhone != "" || p.ContactEmail != "") {
+		out.Contact = &struct {
+			Name           string `xml:"cbc:Name,omitempty"`
+			Telephone      string `xml:"cbc:Telephone,omitempty"`
+			ElectronicMail string `xml:"cbc:ElectronicMail,omitempty"`
+		}{p.ContactName, p.ContactPhone, p.ContactEmail}
+	}
+	return out
+}
+
+// RenderUBL serializes the e-invoice as UBL 2.1 (Invoice, or CreditNote for type 381).
+func RenderUBL(e EInvoice) ([]byte, error) {
+	var x ublDocument
+	cur := e.Currency
+	money := func(v utils.Money) ublAmount { return ublAmount{Value: amount(v), CurrencyID: cur} }
+
+	if e.IsCreditNote() {
+		x.XMLName = xml.Name{Local: "CreditNote"}
+		x.Xmlns = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+		x.CreditNoteTypeCode = e.TypeCode
+	} else {
+		x.XMLName = xml.Name{Local: "Invoice"}
+		x.Xmlns = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+		x.InvoiceTypeCode = e.TypeCode
+	}
+	x.XmlnsCAC = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	x.XmlnsCBC = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+
+	x.CustomizationID = specPeppolBIS
+	x.ProfileID = processPeppol
+	x.ID = e.Number
+	x.IssueDate = e.IssueDate.Format("2006-01-02")
+	if e.DueDate != nil && !e.IsCreditNote() {
+		x.DueDate = e.DueDate.Format("2006-01-02")
+	}
+	x.Note = e.Note
+	x.Currency = cur
+	x.TaxCurrency = e.TaxCurrency
+	x.BuyerReference = e.BuyerReference
+	if e.PrecedingNumber != "" {
+		x.BillingReference = &struct {
+			InvoiceDocumentReference struct {
+				ID        string `xml:"cbc:ID"`
+				IssueDate string `xml:"cbc:IssueDate,omitempty"`
+			} `xml:"cac:InvoiceDocumentReference"`
+		}{}
+		x.BillingReference.InvoiceDocumentReference.ID = e.PrecedingNumber
+		if e.PrecedingDate != nil {
+			x.BillingReference.InvoiceDocumentReference.IssueDate = e.PrecedingDate.Format("2006-01-02")
+		}
+	}
+	x.Supplier.Party = ublPartyFrom(e.Seller, true)
+	x.Customer.Party = ublPartyFrom(e.Buyer, false)
+	if e.DeliveryDate != nil || e.DeliverTo != "" {
+		x.Delivery = &struct {
+			ActualDeliveryDate string `xml:"cbc:ActualDeliveryDate,omitempty"`
+			Location           *struct {
+				Address struct {
+					Country struct {
+						IdentificationCode string `xml:"cbc:IdentificationCode"`
+					} `xml:"cac:Country"`
+				} `xml:"cac:Address"`
+			} `xml:"cac:DeliveryLocation,omitempty"`
+		}{}
+		if e.DeliveryDate != nil {
+			x.Delivery.ActualDeliveryDate = e.DeliveryDate.Format("2006-01-02")
+		}
+		if e.DeliverTo != "" {
+			x.Delivery.Location = &struct {
+				Address struct {
+					Country struct {
+						IdentificationCode string `xml:"cbc:IdentificationCode"`
+					} `xml:"cac:Country"`
+				} `xml:"cac:Address"`
+			}{}
+			x.Delivery.Location.Address.Country.IdentificationCode = e.DeliverTo
+		}
+	}
+
+	x.PaymentMeans.Code = e.PaymentMeans
+	if e.IBAN != "" {
+		x.PaymentMeans.Account = &struct {
+			ID     string `xml:"cbc:ID"`
+			Branch *struct {
+				ID string `xml:"cbc:ID"`
+			} `xml:"cac:FinancialInstitutionBranch,omitempty"`
+		}{ID: e.IBAN}
+		if e.BIC != "" {
+			x.PaymentMeans.Account.Branch = &struct {
+				ID string `xml:"cbc:ID"`
+			}{e.BIC}
+		}
+	}
+	if e.PaymentTerms != "" {
+		x.PaymentTerms = &struct {
+			Note string `xml:"cbc:Note"`
+		}{e.PaymentTerms}
+	}
+
+	for _, al := range e.Allowances {
+		base := money(al.Base)
+		a := ublAllowance{
+			Reason:      al.Reason,
+			Amount:      money(al.Amount),
+			BaseAmount:  &base,
+			TaxCategory: &ublTaxCategory{ID: al.TaxCategory, Percent: decimal(al.TaxPercent), TaxScheme: ublTaxScheme{ID: "VAT"}},
+		}
+		if al.Percent > 0 {
+			a.Multiplier = decimal(al.Percent)
+		}
+		x.Allowances = append(x.Allowances, a)
+	}
+
+	taxTotal := ublTaxTotal{TaxAmount: money(e.TaxTotal)}
+	for _, t := range e.Taxes {
+		taxTotal.Subtotals = append(taxTotal.Subtotals, ublTaxSubtotal{money(t.Basis), money(t.Amount), ublTaxCategory{
+			ID:                     t.Category,
+			Percent:                decimal(t.Percent),
+			TaxExemptionReasonCode: t.ExemptionCode,
+			TaxExemptionReason:     t.ExemptionReason,
+			TaxScheme:              ublTaxScheme{ID: "VAT"},
+		}})
+	}
+
+	x.TaxTotals = []ublTaxTotal{taxTotal}
+	if e.TaxCurrency != "" {
+		x.TaxTotals = append(x.TaxTotals, ublTaxTotal{TaxAmount: ublAmount{Value: amount(e.TaxTotalBase), CurrencyID: e.TaxCurrency}})
+	}
+
+	x.MonetaryTotal.LineExtension = money(e.LineTotal)
+	x.MonetaryTotal.TaxExclusive = money(e.TaxBasisTotal)
+	x.MonetaryTotal.TaxInclusive = money(e.GrandTotal)
+	if e.AllowanceTotal != 0 {
+		a := money(e.AllowanceTotal)
+		x.MonetaryTotal.Allowances = &a
+	}
+	if e.Prepaid != 0 {
+		p := money(e.Prepaid)
+		x.MonetaryTotal.Prepaid = &p
+	}
+	x.MonetaryTotal.Payable = money(e.DuePayable)
+
+	for _, l := range e.Lines {
+		var ul ublLine
+		ul.ID = l.ID
+		qty := &ublQty{Value: decimal(l.Quantity), UnitCode: l.UnitCode}
+		if e.IsCreditNote() {
+			ul.CreditedQuantity = qty
+		} else {
+			ul.InvoicedQuantity = qty
+		}
+		ul.LineExtension = money(l.NetAmount)
+		if l.Discount != 0 {
+			base := money(l.DiscountBase)
+			a := ublAllowance{Reason: "Rabatt", Amount: money(l.Discount), BaseAmount: &base}
+			if l.DiscountPercent > 0 {
+				a.Multiplier = decimal(l.DiscountPercent)
+			}
+			ul.Allowances = append(ul.Allowances, a)
+		}
+		ul.Item.Name = l.Name
+		if l.ArticleID != "" {
+			ul.Item.SellersIdentification = &struct {
+				ID string `xml:"cbc:ID"`
+			}{l.ArticleID}
+		}
+		ul.Item.ClassifiedTaxCategory = ublTaxCategory{ID: l.TaxCategory, Percent: decimal(l.TaxPercent), TaxScheme: ublTaxScheme{ID: "VAT"}}
+		ul.Price.PriceAmount = money(l.NetPrice)
+		if e.IsCreditNote() {
+			x.CreditNoteLines = append(x.CreditNoteLines, ul)
+		} else {
+			x.InvoiceLines = append(x.InvoiceLines, ul)
+		}
+	}
+
+	out, err := xml.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strconv"
 	"time"
+	_ "time/tzdata" // company time zones resolve without system zoneinfo
 
 	"fakturierung-backend/database"
 	"fakturierung-backend/middlewares"
 	"fakturierung-backend/routes"
+	"fakturierung-backend/scheduler"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -52,7 +55,7 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     allowedOrigins,
 		AllowCredentials: false, // using Bearer tokens, not cookies
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-Tenant-Schema",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-Tenant-Schema, X-Change-Reason",
 	}))
 
 	// ---- Global rate limiter (applies to all routes; tune via env)
@@ -68,6 +71,14 @@ func main() {
 	// ---- Routes
 	routes.Register(app)
 
+	// ---- Recurring invoices (in-process scheduler; 0 disables it)
+	recurringEvery := time.Duration(envInt("RECURRING_INTERVAL_MINUTES", 15)) * time.Minute
+	go scheduler.StartRecurring(context.Background(), recurringEvery)
+
+	// ---- Quotation expiry (in-process scheduler; 0 disables it)
+	expiryEvery := time.Duration(envInt("QUOTATION_EXPIRY_INTERVAL_MINUTES", 60)) * time.Minute
+	go scheduler.StartQuotationExpiry(context.Background(), expiryEvery)
+
 	// ---- Start
 	port := os.Getenv("PORT")
 	if port == "" {
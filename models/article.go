@@ -1,17 +1,34 @@
 package models
 
 import (
+	"fakturierung-backend/utils"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Units of measure for articles and invoice lines.
+const (
+	UnitPiece    = "piece"
+	UnitHour     = "hour"
+	UnitDay      = "day"
+	UnitKilogram = "kg"
+	UnitMeter    = "m"
+	UnitFlatRate = "flat_rate"
+)
+
 type Article struct {
-	Id          string  `json:"id" gorm:"primaryKey"`
-	Name        string  `json:"name" gorm:"not null;index"`
-	Description string  `json:"description"`
-	UnitPrice   float64 `json:"unit_price" gorm:"type:numeric(12,2)"`
-	Active      bool    `json:"active" gorm:"index"`
-	Version     uint    `json:"version" gorm:"not null;default:1"`
+	Id          string      `json:"id" gorm:"primaryKey"`
+	Name        string      `json:"name" gorm:"not null;index"`
+	Description string      `json:"description"`
+	UnitPrice   utils.Money `json:"unit_price" gorm:"type:numeric(12,2)"`
+	Unit        string      `json:"unit" gorm:"type:varchar(20);not null;default:'piece'"` // default unit of invoice lines
+	Active      bool        `json:"active" gorm:"index"`
+	Version     uint        `json:"version" gorm:"not null;default:1"`
+
+	// Optional; nil => tenant default tax category
+	TaxCategoryID *uint        `json:"tax_category_id" gorm:"index"`
+	TaxCategory   *TaxCategory `json:"tax_category,omitempty" gorm:"foreignKey:TaxCategoryID;references:ID;constraint:OnUpdate:RESTRICT,OnDelete:RESTRICT"`
 }
 
 func (article *Article) BeforeCreate(tx *gorm.DB) (err error) {
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"fakturierung-backend/utils"
+
+	"gorm.io/datatypes"
+)
+
+// BankCSVProfile describes the column layout of one bank's CSV export.
+type BankCSVProfile struct {
+	ID                uint                        `json:"id" gorm:"primaryKey"`
+	Name              string                      `json:"name" gorm:"not null;unique"`
+	Delimiter         string                      `json:"delimiter" gorm:"type:varchar(1)"`
+	SkipLines         int                         `json:"skip_lines" gorm:"not null;default:0"`
+	DateColumn        string                      `json:"date_column" gorm:"not null"`
+	ValueDateColumn   string                      `json:"value_date_column"`
+	DateFormat        string                      `json:"date_format"`
+	AmountColumn      string                      `json:"amount_column"`
+	CreditColumn      string                      `json:"credit_column"`
+	DebitColumn       string                      `json:"debit_column"`
+	DecimalComma      bool                        `json:"decimal_comma"`
+	CurrencyColumn    string                      `json:"currency_column"`
+	NameColumn        string                      `json:"name_column"`
+	IBANColumn        string                      `json:"iban_column"`
+	RemittanceColumns datatypes.JSONSlice[string] `json:"remittance_columns" gorm:"type:jsonb"`
+	ReferenceColumn   string                      `json:"reference_column"`
+	Version           uint                        `json:"version" gorm:"not null;default:1"`
+}
+
+// BankStatement is one imported statement file (a file may yield several).
+// SHA256 of the file prevents importing the same upload twice.
+type BankStatement struct {
+	ID           uint                `json:"id" gorm:"primaryKey"`
+	Format       string              `json:"format" gorm:"type:varchar(10);not null"` // "camt053" | "mt940" | "csv"
+	FileName     string              `json:"file_name"`
+	SHA256       string              `json:"sha256" gorm:"type:char(64);not null;uniqueIndex:idx_bank_statements_file"`
+	Seq          int                 `json:"seq" gorm:"not null;default:0;uniqueIndex:idx_bank_statements_file"` // position within the file
+	AccountIBAN  string              `json:"account_iban"`
+	StatementRef string              `json:"statement_ref"` // bank's statement id
+	LineCount    int                 `json:"line_count"`
+	Matched      int                 `json:"matched"`
+	Duplicates   int                 `json:"duplicates"` // lines already imported with an earlier statement
+	ImportedAt   time.Time           `json:"imported_at"`
+	Lines        []BankStatementLine `json:"lines,omitempty" gorm:"foreignKey:StatementID;constraint:OnDelete:CASCADE"`
+}
+
+// MatchCandidate is a possible invoice for a statement line, kept for review.
+type MatchCandidate struct {
+	InvoiceID     uint        `json:"invoice_id"`
+	InvoiceNumber string      `json:"invoice_number"`
+	OpenAmount    utils.Money `json:"open_amount"`
+	Score         int         `json:"score"`
+	Reasons       []string    `json:"reasons"` // "number" | "amount" | "iban"
+}
+
+// BankStatementLine is one booked transaction of a statement and its matching state:
+// "matched" (payment booked), "review" (ambiguous candidates), "unmatched"
+// (no candidate), "ignored" (debits and lines dismissed in review) or "duplicate"
+// (already imported with an overlapping statement; never matched).
+// DedupeKey identifies the transaction across imports (unique among non-duplicates).
+type BankStatementLine struct {
+	ID               uint                                `json:"id" gorm:"primaryKey"`
+	StatementID      uint                                `json:"statement_id" gorm:"not null;index"`
+	BookingDate      time.Time                           `json:"booking_date" gorm:"type:date;not null"`
+	ValueDate        *time.Time                          `json:"value_date" gorm:"type:date"`
+	Amount           utils.Money                         `json:"amount" gorm:"type:numeric(12,2);not null"` // credits positive
+	Currency         string                              `json:"currency" gorm:"type:varchar(3)"`
+	CounterpartyName string                              `json:"counterparty_name"`
+	CounterpartyIBAN string                              `json:"counterparty_iban" gorm:"index"`
+	RemittanceInfo   string                              `json:"remittance_info"`
+	EndToEndID       string                              `json:"end_to_end_id"`
+	BankReference    string                              `json:"bank_reference"`
+	Status           string                              `json:"status" gorm:"type:varchar(10);not null;index"`
+	DedupeKey        string                              `json:"dedupe_key" gorm:"type:varchar(32);not null;default:''"`
+	Candidates       datatypes.JSONSlice[MatchCandidate] `json:"candidates" gorm:"type:jsonb"`
+	InvoiceID        *uint                               `json:"invoice_id" gorm:"index"`
+	PaymentID        *uint                               `json:"payment_id"`
+	MatchedBy        string                              `json:"matched_by" gorm:"type:varchar(10)"` // "auto" | "manual"
+	CreatedAt        time.Time                           `json:"created_at"`
+}
@@ -6,19 +6,35 @@ import (
 )
 
 type Company struct {
-	Id            string        `json:"id" gorm:"primaryKey"`
-	CompanyName   string        `json:"company_name" gorm:"not null;unique"`
-	Address       string        `json:"address" gorm:"not null"`
-	City          string        `json:"city" gorm:"not null"`
-	Country       string        `json:"country" gorm:"not null"`
-	Zip           string        `json:"zip" gorm:"not null"`
-	Homepage      string        `json:"homepage" gorm:"null"`
-	UID           string        `json:"uid" gorm:"null"`
-	UserId        string        `json:"-"`
-	User          User          `json:"user" gorm:"foreignKey:UserId;references:Id"`
-	PId           uint          `json:"-"`
-	ContactPerson ContactPerson `json:"contact_person" gorm:"foreignKey:PId;references:Id"`
-	SchemaName    string        `json:"-"`
+	Id              string        `json:"id" gorm:"primaryKey"`
+	CompanyName     string        `json:"company_name" gorm:"not null;unique"`
+	Address         string        `json:"address" gorm:"not null"`
+	City            string        `json:"city" gorm:"not null"`
+	Country         string        `json:"country" gorm:"not null"`
+	Zip             string        `json:"zip" gorm:"not null"`
+	Homepage        string        `json:"homepage" gorm:"null"`
+	UID             string        `json:"uid" gorm:"null"`
+	Email           string        `json:"email" gorm:"null"`
+	Phone           string        `json:"phone" gorm:"null"`
+	BankName        string        `json:"bank_name" gorm:"null"`
+	IBAN            string        `json:"iban" gorm:"null"`
+	BIC             string        `json:"bic" gorm:"null"`
+	CreditorID      string        `json:"creditor_id" gorm:"null"`                                            // SEPA creditor identifier for direct debits
+	PaymentTerms    string        `json:"payment_terms" gorm:"null"`                                          // footer text on rendered documents
+	PaymentTermDays int           `json:"payment_term_days" gorm:"not null;default:14"`                       // default term for new invoices
+	SkontoRate      float64       `json:"skonto_rate" gorm:"type:numeric(5,4);not null;default:0"`            // default early-payment discount (0.02 == 2 %)
+	SkontoDays      int           `json:"skonto_days" gorm:"not null;default:0"`                              // days the discount applies after publishing
+	TaxRounding     string        `json:"tax_rounding" gorm:"type:varchar(10);not null;default:'line'"`       // "line" | "document"
+	RoundingMode    string        `json:"rounding_mode" gorm:"type:varchar(10);not null;default:'half_up'"`   // "half_up" | "half_even"
+	SmallBusiness   bool          `json:"small_business" gorm:"not null;default:false"`                       // Kleinunternehmer: new invoices are VAT exempt
+	Currency        string        `json:"currency" gorm:"type:varchar(3);not null;default:'EUR'"`             // base currency (bookkeeping, reports)
+	TimeZone        string        `json:"time_zone" gorm:"type:varchar(64);not null;default:'Europe/Vienna'"` // IANA zone; decides the year of document numbers
+	UserId          string        `json:"-"`
+	User            User          `json:"user" gorm:"foreignKey:UserId;references:Id"`
+	PId             uint          `json:"-"`
+	ContactPerson   ContactPerson `json:"contact_person" gorm:"foreignKey:PId;references:Id"`
+	SchemaName      string        `json:"-"`
+	Version         uint          `json:"version" gorm:"not null;default:1"`
 }
 
 func (company *Company) BeforeCreate(tx *gorm.DB) (err error) {
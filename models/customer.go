@@ -1,21 +1,39 @@
 package models
 
+import "time"
+
 type Customer struct {
-	Id           uint   `json:"id" gorm:"primaryKey"`
-	CompanyName  string `json:"company_name" gorm:"not null;unique"`
-	Address      string `json:"address" gorm:"not null"`
-	City         string `json:"city" gorm:"not null"`
-	Country      string `json:"country" gorm:"not null"`
-	Zip          string `json:"zip" gorm:"not null"`
-	Homepage     string `json:"homepage" gorm:"null"`
-	UID          string `json:"uid" gorm:"null"`
-	Email        string `json:"email" gorm:"unique;not null"`
-	FirstName    string `json:"first_name" gorm:"not null"`
-	LastName     string `json:"last_name" gorm:"not null"`
-	PhoneNumber  string `json:"phone_number" gorm:"not null"`
-	MobileNumber string `json:"mobile_number" gorm:"not null"`
-	Salutation   string `json:"saluatation" gorm:"not null"`
-	Title        string `json:"title" gorm:"not null"`
-	Active       bool   `json:"-"`
-	Version      uint   `json:"version" gorm:"not null;default:1"`
+	Id          uint   `json:"id" gorm:"primaryKey"`
+	CompanyName string `json:"company_name" gorm:"not null;unique"`
+	Address     string `json:"address" gorm:"not null"`
+	City        string `json:"city" gorm:"not null"`
+	Country     string `json:"country" gorm:"not null"`
+	Zip         string `json:"zip" gorm:"not null"`
+	Homepage    string `json:"homepage" gorm:"null"`
+	UID         string `json:"uid" gorm:"null"`
+	// Default VAT treatment of the customer's invoices ("" => domestic, or exempt for
+	// small businesses); reverse_charge / intra_eu_supply need the UID
+	TaxTreatment string `json:"tax_treatment" gorm:"type:varchar(20);not null;default:''"`
+	// Currency the customer is billed in ("" => the company's base currency)
+	Currency string `json:"currency" gorm:"type:varchar(3);not null;default:''"`
+	// Buyer reference for e-invoices (BT-10), e.g. the German Leitweg-ID
+	BuyerReference string `json:"buyer_reference" gorm:"null"`
+	// Our supplier number at the customer (ebInterface InvoiceRecipientsBillerID)
+	SupplierNumber string `json:"supplier_number" gorm:"null"`
+	// Customer's bank account; used to match incoming bank transfers
+	IBAN string `json:"iban" gorm:"null;index"`
+	BIC  string `json:"bic" gorm:"null"`
+	// SEPA direct debit mandate; sequence type FRST switches to RCUR after the first collection
+	MandateReference string     `json:"mandate_reference" gorm:"null"`
+	MandateSignedAt  *time.Time `json:"mandate_signed_at" gorm:"type:date"`
+	MandateSequence  string     `json:"mandate_sequence" gorm:"type:varchar(4)"` // "FRST" | "RCUR" | "OOFF" | "FNAL"
+	Email            string     `json:"email" gorm:"unique;not null"`
+	FirstName        string     `json:"first_name" gorm:"not null"`
+	LastName         string     `json:"last_name" gorm:"not null"`
+	PhoneNumber      string     `json:"phone_number" gorm:"not null"`
+	MobileNumber     string     `json:"mobile_number" gorm:"not null"`
+	Salutation       string     `json:"saluatation" gorm:"not null"`
+	Title            string     `json:"title" gorm:"not null"`
+	Active           bool       `json:"-"`
+	Version          uint       `json:"version" gorm:"not null;default:1"`
 }
@@ -0,0 +1,35 @@
+package models
+
+import "fakturierung-backend/utils"
+
+import "time"
+
+// DirectDebitBatch is one generated SEPA pain.008 file. Its invoices are marked
+// collection pending until the batch is confirmed (payments booked) or cancelled.
+type DirectDebitBatch struct {
+	ID             uint              `json:"id" gorm:"primaryKey"`
+	MessageID      string            `json:"message_id" gorm:"type:varchar(35);not null;unique"`
+	CollectionDate time.Time         `json:"collection_date" gorm:"type:date;not null"`
+	Status         string            `json:"status" gorm:"type:varchar(10);not null;index"` // "pending" | "confirmed" | "cancelled"
+	Count          int               `json:"count"`
+	Total          utils.Money       `json:"total" gorm:"type:numeric(12,2)"`
+	Content        []byte            `json:"-" gorm:"type:bytea"` // pain.008.001.02 XML
+	SHA256         string            `json:"sha256" gorm:"type:char(64)"`
+	CreatedAt      time.Time         `json:"created_at"`
+	ConfirmedAt    *time.Time        `json:"confirmed_at"`
+	CancelledAt    *time.Time        `json:"cancelled_at"`
+	Items          []DirectDebitItem `json:"items,omitempty" gorm:"foreignKey:BatchID;constraint:OnDelete:CASCADE"`
+}
+
+// DirectDebitItem is one collected invoice of a batch.
+type DirectDebitItem struct {
+	ID           uint        `json:"id" gorm:"primaryKey"`
+	BatchID      uint        `json:"batch_id" gorm:"not null;index"`
+	InvoiceID    uint        `json:"invoice_id" gorm:"not null;index"`
+	CustomerID   uint        `json:"customer_id" gorm:"not null"`
+	Amount       utils.Money `json:"amount" gorm:"type:numeric(12,2);not null"`
+	EndToEndID   string      `json:"end_to_end_id" gorm:"type:varchar(35)"`
+	MandateID    string      `json:"mandate_id"`
+	SequenceType string      `json:"sequence_type" gorm:"type:varchar(4)"`
+	PaymentID    *uint       `json:"payment_id"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import "fakturierung-backend/utils"
+
+import "time"
+
+// DunningLevel configures one escalation step (Mahnstufe) of the dunning run.
+type DunningLevel struct {
+	ID           uint        `json:"id" gorm:"primaryKey"`
+	Level        int         `json:"level" gorm:"not null;uniqueIndex"`
+	Name         string      `json:"name" gorm:"not null"`         // e.g. "Zahlungserinnerung", "1. Mahnung"
+	DaysOverdue  int         `json:"days_overdue" gorm:"not null"` // min. days past the invoice due date
+	PaymentDays  int         `json:"payment_days" gorm:"not null"` // new deadline = issue date + PaymentDays
+	Fee          utils.Money `json:"fee" gorm:"type:numeric(12,2);not null;default:0"`
+	InterestRate float64     `json:"interest_rate" gorm:"type:numeric(5,4);not null;default:0"` // annual rate on the open amount
+	Text         string      `json:"text"`                                                      // intro text on the reminder
+	Active       bool        `json:"active" gorm:"not null;default:true"`
+	Version      uint        `json:"version" gorm:"not null;default:1"`
+}
+
+// DunningNotice is one issued reminder for an invoice; together they form the
+// invoice's dunning history. At most one notice per invoice and level.
+type DunningNotice struct {
+	ID          uint        `json:"id" gorm:"primaryKey"`
+	InvoiceID   uint        `json:"invoice_id" gorm:"not null;uniqueIndex:idx_dunning_notices_invoice_level"`
+	Level       int         `json:"level" gorm:"not null;uniqueIndex:idx_dunning_notices_invoice_level"`
+	LevelName   string      `json:"level_name"`
+	IssuedAt    time.Time   `json:"issued_at"`
+	DaysOverdue int         `json:"days_overdue"`
+	OpenAmount  utils.Money `json:"open_amount" gorm:"type:numeric(12,2)"`
+	Fee         utils.Money `json:"fee" gorm:"type:numeric(12,2)"`        // fee of this level
+	FeesTotal   utils.Money `json:"fees_total" gorm:"type:numeric(12,2)"` // fees of all levels so far
+	Interest    utils.Money `json:"interest" gorm:"type:numeric(12,2)"`
+	TotalDue    utils.Money `json:"total_due" gorm:"type:numeric(12,2)"`
+	DueDate     time.Time   `json:"due_date"` // payment deadline given in the reminder
+	Content     []byte      `json:"-" gorm:"type:bytea"`
+	SHA256      string      `json:"sha256" gorm:"type:char(64)"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
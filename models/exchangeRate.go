@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// ExchangeRate is a tenant's reference rate of a foreign currency on one day, in the
+// ECB convention: Rate units of Currency per one unit of the company's base currency.
+// A document in a foreign currency locks the latest rate on or before its issue date.
+type ExchangeRate struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Currency  string    `json:"currency" gorm:"type:varchar(3);not null;uniqueIndex:idx_exchange_rates_currency_date"`
+	Date      time.Time `json:"date" gorm:"type:date;not null;uniqueIndex:idx_exchange_rates_currency_date"`
+	Rate      float64   `json:"rate" gorm:"type:numeric(18,6);not null"`
+	Source    string    `json:"source" gorm:"type:varchar(10);not null;default:'manual'"` // "manual" | "ecb"
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -3,65 +3,236 @@ package models
 import (
 	"time"
 
+	"fakturierung-backend/utils"
+
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Document types of an Invoice row.
+const (
+	DocumentQuotation         = "quotation"
+	DocumentOrderConfirmation = "order_confirmation"
+	DocumentDeliveryNote      = "delivery_note"
+	DocumentInvoice           = "invoice"
+	DocumentCreditNote        = "credit_note"
+)
+
+// Tax rounding of an Invoice / Company.
+const (
+	TaxRoundingLine     = "line"     // round the tax of every line, sum per rate
+	TaxRoundingDocument = "document" // round the tax once per rate on the summed nets
+)
+
+// Tax treatment of an Invoice: which VAT rules apply to its lines. Every treatment
+// but TaxTreatmentDomestic bills the lines at 0 %.
+const (
+	TaxTreatmentDomestic      = "domestic"        // VAT at the lines' rates
+	TaxTreatmentReverseCharge = "reverse_charge"  // the customer owes the VAT (EU B2B services)
+	TaxTreatmentIntraEU       = "intra_eu_supply" // tax-free intra-community supply of goods
+	TaxTreatmentExport        = "export"          // tax-free export outside the EU
+	TaxTreatmentExempt        = "exempt"          // small business (Kleinunternehmer) without VAT
 )
 
-// Invoice is the current/live state of a commercial document.
-// Draft=true means it's a Quotation; Draft=false means it's an Invoice.
-// Published indicates a legally issued invoice (you can still convert; payments remain linked).
+// Invoice is the current/live state of a commercial document of any DocumentType.
+// The lifecycle is independent of the type: every document starts as a draft
+// (Published=false, editable and convertible) and is finalized by publishing it,
+// after which it is read-only. For invoices publishing is the legal issue.
 type Invoice struct {
-	ID            uint     `json:"id" gorm:"primaryKey"`
-	InvoiceNumber string   `json:"invoice_number" gorm:"unique"`
-	CId           uint     `json:"-"`
-	Customer      Customer `json:"customer" gorm:"foreignKey:CId;references:Id"`
+	ID              uint     `json:"id" gorm:"primaryKey"`
+	DocumentType    string   `json:"document_type" gorm:"type:varchar(30);not null;default:'invoice';index"`
+	InvoiceNumber   string   `json:"invoice_number"`   // invoices/credit notes: gapless, assigned on publish (unique when set)
+	QuotationNumber string   `json:"quotation_number"` // own sequence, assigned to quotations (unique when set)
+	DocumentNumber  string   `json:"document_number"`  // order confirmations/delivery notes: own sequences, assigned on publish
+	CId             uint     `json:"-"`
+	Customer        Customer `json:"customer" gorm:"foreignKey:CId;references:Id"`
+
+	// Document currency (ISO 4217); amounts below are in it
+	Currency string `json:"currency" gorm:"type:varchar(3);not null;default:'EUR'"`
 
 	// Live items (latest state)
-	Items    []InvoiceItem `json:"articles" gorm:"foreignKey:InvoiceID;constraint:OnDelete:CASCADE"`
-	Subtotal float64       `json:"subtotal"`
-	TaxTotal float64       `json:"tax_total"`
-	Total    float64       `json:"total"`
+	Items        []InvoiceItem                `json:"articles" gorm:"foreignKey:InvoiceID;constraint:OnDelete:CASCADE"`
+	Subtotal     utils.Money                  `json:"subtotal"`
+	TaxTotal     utils.Money                  `json:"tax_total"`
+	Total        utils.Money                  `json:"total"`
+	TaxBreakdown datatypes.JSONSlice[TaxLine] `json:"tax_breakdown" gorm:"type:jsonb"` // per-rate totals
+
+	// Document discount before tax: DiscountRate of the lines' net total, or a fixed
+	// amount when the rate is 0. Discount is the resulting reduction, split over the
+	// rates in TaxBreakdown; Subtotal is after it.
+	DiscountRate float64     `json:"discount_rate" gorm:"type:numeric(5,4);not null;default:0"` // 0.05 == 5 %
+	Discount     utils.Money `json:"discount" gorm:"not null;default:0"`
+
+	// VAT treatment, defaulted from the customer (or the company's small-business
+	// status). TaxNote is the legal notice it requires (e.g. reverse charge with the
+	// customer's VAT id), printed on the document and carried into e-invoices.
+	TaxTreatment string `json:"tax_treatment" gorm:"type:varchar(20);not null;default:'domestic'"`
+	TaxNote      string `json:"tax_note" gorm:"not null;default:''"`
+
+	// Conversion into the company's base currency, locked when the document is
+	// finalized: ExchangeRate units of Currency per unit of BaseCurrency (1 when they
+	// are the same), quoted on ExchangeRateDate. Base* are the totals in BaseCurrency.
+	BaseCurrency     string       `json:"base_currency" gorm:"type:varchar(3);not null;default:''"`
+	ExchangeRate     *float64     `json:"exchange_rate" gorm:"type:numeric(18,6)"`
+	ExchangeRateDate *time.Time   `json:"exchange_rate_date" gorm:"type:date"`
+	BaseSubtotal     *utils.Money `json:"base_subtotal" gorm:"type:numeric(12,2)"`
+	BaseTaxTotal     *utils.Money `json:"base_tax_total" gorm:"type:numeric(12,2)"`
+	BaseTotal        *utils.Money `json:"base_total" gorm:"type:numeric(12,2)"`
+
+	// How the amounts are rounded, taken from the company when the document is created:
+	// TaxRounding "line" rounds the tax of every line, "document" rounds it once per rate
+	// on the summed nets; RoundingMode is "half_up" or "half_even".
+	TaxRounding  string `json:"tax_rounding" gorm:"type:varchar(10);not null;default:'line'"`
+	RoundingMode string `json:"rounding_mode" gorm:"type:varchar(10);not null;default:'half_up'"`
+
+	// Invoice type (DocumentInvoice only): "standard" | "down_payment" | "final".
+	// A final invoice deducts its down-payment invoices including their tax; its
+	// Subtotal/TaxTotal/Total/TaxBreakdown are the remaining amounts after Deductions.
+	InvoiceType string             `json:"invoice_type" gorm:"type:varchar(20);not null;default:'standard'"`
+	Deductions  []InvoiceDeduction `json:"deductions,omitempty" gorm:"foreignKey:InvoiceID;constraint:OnDelete:CASCADE"`
 
 	// State
-	Draft       bool       `json:"draft"`        // true => Quotation, false => Invoice
-	Published   bool       `json:"published"`    // true => legally issued
-	PublishedAt *time.Time `json:"published_at"` // when legally issued
-	PaidTotal   float64    `json:"paid_total"`   // payments summary
+	Published   bool        `json:"published"`    // true => finalized (legally issued for invoices)
+	PublishedAt *time.Time  `json:"published_at"` // when finalized
+	PaidTotal   utils.Money `json:"paid_total"`   // payments summary
+
+	// Part of a SEPA direct debit batch that is not confirmed yet
+	CollectionPending bool `json:"collection_pending" gorm:"not null;default:false"`
+
+	// Derived in queries (not stored): open balance after payments and credit notes,
+	// and "open" | "partially_paid" | "paid" | "overpaid" | "overdue" | "cancelled" |
+	// "collection_pending".
+	// Only set for issued invoices loaded by the invoice list/detail endpoints.
+	OpenAmount    *utils.Money `json:"open_amount,omitempty" gorm:"->;-:migration"`
+	PaymentStatus string       `json:"payment_status,omitempty" gorm:"->;-:migration"`
+
+	// Payment terms: the due date is fixed on publish as published date + PaymentTermDays
+	PaymentTermDays int        `json:"payment_term_days" gorm:"not null;default:0"`
+	DueDate         *time.Time `json:"due_date" gorm:"index"`
+
+	// Early-payment discount (Skonto), e.g. "14 days 2 %, 30 days net": SkontoRate off
+	// the total when paid within SkontoDays. Deadline and discounted total are fixed on publish.
+	SkontoRate    float64      `json:"skonto_rate" gorm:"type:numeric(5,4);not null;default:0"` // 0.02 == 2 %
+	SkontoDays    int          `json:"skonto_days" gorm:"not null;default:0"`
+	SkontoDueDate *time.Time   `json:"skonto_due_date"`
+	SkontoTotal   *utils.Money `json:"skonto_total" gorm:"type:numeric(12,2)"` // amount that settles the invoice by SkontoDueDate
+
+	// Recurring invoices: the template this invoice was generated from
+	RecurringID *uint `json:"recurring_id" gorm:"index"`
+
+	// Quotations: the offer holds until ValidUntil (defaulted when finalized).
+	// QuotationStatus is "sent" once finalized, then "accepted" | "declined" | "expired".
+	ValidUntil      *time.Time `json:"valid_until"`
+	QuotationStatus string     `json:"quotation_status" gorm:"type:varchar(20);not null;default:''"`
+
+	// The document this one was created from (e.g. the quotation behind an invoice)
+	SourceID *uint `json:"source_id" gorm:"index"`
+
+	// Credit notes (Storno): a credit note points at the invoice it corrects;
+	// a fully credited invoice is marked cancelled.
+	CorrectsID  *uint      `json:"corrects_id" gorm:"index"`
+	Cancelled   bool       `json:"cancelled" gorm:"not null;default:false"`
+	CancelledAt *time.Time `json:"cancelled_at"`
 	CreatedAt   time.Time  `json:"created_at"`
 	Version     uint       `json:"version" gorm:"not null;default:1"` // <— optimistic lock
 }
 
+// IssuedInvoice reports whether the document is a legally issued invoice (payments,
+// dunning and credit notes apply).
+func (inv *Invoice) IssuedInvoice() bool {
+	return inv.Published && inv.DocumentType == DocumentInvoice
+}
+
 // InvoiceItem belongs to the live Invoice (latest snapshot).
 type InvoiceItem struct {
-	ID          uint    `json:"id" gorm:"primaryKey"`
-	InvoiceID   uint    `json:"-"`
-	ArticleID   string  `json:"article_id"`
-	Description string  `json:"description"`
-	Amount      int     `json:"amount"`
-	UnitPrice   float64 `json:"unit_price"`
-	TaxRate     float64 `json:"tax_rate"`
-	NetPrice    float64 `json:"net_price"`
-	TaxAmount   float64 `json:"tax_amount"`
-	GrossPrice  float64 `json:"gross_price"`
+	ID          uint        `json:"id" gorm:"primaryKey"`
+	InvoiceID   uint        `json:"-"`
+	ArticleID   string      `json:"article_id"`
+	Description string      `json:"description"`
+	Amount      float64     `json:"amount" gorm:"type:numeric(12,3)"` // quantity, up to 3 decimals
+	Unit        string      `json:"unit" gorm:"type:varchar(20);not null;default:'piece'"`
+	UnitPrice   utils.Money `json:"unit_price"`
+	TaxRate     float64     `json:"tax_rate"`
+	NetPrice    utils.Money `json:"net_price"`
+	TaxAmount   utils.Money `json:"tax_amount"`
+	GrossPrice  utils.Money `json:"gross_price"`
+
+	// Line discount before tax: DiscountRate of quantity x unit price, or a fixed amount
+	// when the rate is 0. Discount is the resulting reduction; NetPrice is after it.
+	DiscountRate float64     `json:"discount_rate" gorm:"type:numeric(5,4);not null;default:0"`
+	Discount     utils.Money `json:"discount" gorm:"not null;default:0"`
+
+	// Credit note lines: the original invoice line being credited
+	CreditedItemID *uint `json:"credited_item_id,omitempty" gorm:"index"`
+}
+
+// InvoiceDeduction is a down-payment invoice deducted on a final invoice, with the
+// amounts taken over from it. Credit notes of a final invoice carry them negated.
+type InvoiceDeduction struct {
+	ID            uint                         `json:"id" gorm:"primaryKey"`
+	InvoiceID     uint                         `json:"-" gorm:"index"`
+	DownPaymentID uint                         `json:"down_payment_id" gorm:"index"`
+	InvoiceNumber string                       `json:"invoice_number"` // of the down-payment invoice
+	IssuedAt      *time.Time                   `json:"issued_at"`
+	Subtotal      utils.Money                  `json:"subtotal" gorm:"type:numeric(12,2)"`
+	TaxTotal      utils.Money                  `json:"tax_total" gorm:"type:numeric(12,2)"`
+	Total         utils.Money                  `json:"total" gorm:"type:numeric(12,2)"`
+	TaxBreakdown  datatypes.JSONSlice[TaxLine] `json:"tax_breakdown" gorm:"type:jsonb"`
 }
 
-// InvoiceVersion is an immutable snapshot of an invoice at a point in time.
+// Actions recorded on an InvoiceVersion: what produced the snapshot.
+const (
+	VersionCreate  = "create"
+	VersionUpdate  = "update"
+	VersionRestore = "restore" // draft set back to an earlier version
+	VersionConvert = "convert"
+	VersionPublish = "publish"
+	VersionPayment = "payment" // payments, refunds, reversals and Skonto
+	VersionCredit  = "credit"  // credit note issued against the invoice
+	VersionStatus  = "status"  // quotation status
+)
+
+// InvoiceVersion is an immutable snapshot of an invoice at a point in time, with
+// who made the change, how and why.
 type InvoiceVersion struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
 	InvoiceID uint           `json:"invoice_id" gorm:"index"`
 	VersionNo int            `json:"version_no" gorm:"not null"`
-	Kind      string         `json:"kind" gorm:"type:VARCHAR(20)"` // "quotation" | "invoice"
+	Kind      string         `json:"kind" gorm:"type:VARCHAR(20)"` // document type; invoices as "down_payment" | "final_invoice" by type
+	Action    string         `json:"action" gorm:"type:varchar(20);not null;default:''"`
+	UserID    string         `json:"user_id" gorm:"type:varchar(64);not null;default:''"` // "" = scheduler
+	Reason    string         `json:"reason" gorm:"type:text;not null;default:''"`
 	Snapshot  datatypes.JSON `json:"snapshot" gorm:"type:jsonb"`
 	CreatedAt time.Time      `json:"created_at"`
 }
 
 // Payment records money received against an Invoice (survives conversions).
+// Refunds are separate rows with a negative amount pointing at the original payment.
+// An early-payment discount (Skonto) is booked as kind "discount" with its per-rate
+// tax correction, so a discounted payment settles the invoice.
+// Corrections never rewrite a booking: a wrong payment is marked reversed, and a
+// deleted one is only soft-deleted (with a reason), so the trail stays intact.
 type Payment struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	InvoiceID uint      `json:"invoice_id" gorm:"index"`
-	Amount    float64   `json:"amount"`
-	Method    string    `json:"method"`    // e.g., "bank-transfer", "card", "cash"
-	Reference string    `json:"reference"` // bank ref, transaction id, etc.
-	Note      string    `json:"note"`
-	PaidAt    time.Time `json:"paid_at"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         uint        `json:"id" gorm:"primaryKey"`
+	InvoiceID  uint        `json:"invoice_id" gorm:"index"`
+	Kind       string      `json:"kind" gorm:"type:varchar(10);not null;default:'payment'"` // "payment" | "refund" | "discount"
+	Currency   string      `json:"currency" gorm:"type:varchar(3);not null;default:'EUR'"`  // always the invoice's currency
+	RefundOfID *uint       `json:"refund_of_id,omitempty" gorm:"index"`                     // refunds: the original payment
+	Amount     utils.Money `json:"amount"`                                                  // refunds are negative
+	Method     string      `json:"method"`                                                  // e.g., "bank-transfer", "card", "cash"
+	Reference  string      `json:"reference"`                                               // bank ref, transaction id, etc.
+	Note       string      `json:"note"`
+	PaidAt     time.Time   `json:"paid_at"`
+	CreatedAt  time.Time   `json:"created_at"`
+
+	// Reversal of a wrongly booked payment (no longer counts towards PaidTotal)
+	Reversed       bool       `json:"reversed" gorm:"not null;default:false"`
+	ReversedAt     *time.Time `json:"reversed_at,omitempty"`
+	ReversalReason string     `json:"reversal_reason,omitempty"`
+
+	DeletedAt      gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	DeletionReason string         `json:"deletion_reason,omitempty"`
+
+	// Discounts: the granted amount split by tax rate (net/tax/gross reductions)
+	TaxCorrection datatypes.JSONSlice[TaxLine] `json:"tax_correction,omitempty" gorm:"type:jsonb"`
 }
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// InvoiceDocument is a stored rendering (e.g. PDF) of a published invoice version.
+// It is written once and served byte-identical on every later download.
+type InvoiceDocument struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	InvoiceID   uint      `json:"invoice_id" gorm:"index"`
+	VersionNo   int       `json:"version_no" gorm:"not null"`
+	Format      string    `json:"format" gorm:"type:VARCHAR(20);not null"` // "pdf"
+	ContentType string    `json:"content_type" gorm:"size:100"`
+	Content     []byte    `json:"-" gorm:"type:bytea"`
+	SHA256      string    `json:"sha256" gorm:"size:64"`
+	CreatedAt   time.Time `json:"created_at"`
+}
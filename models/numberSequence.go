@@ -0,0 +1,39 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NumberSequence hands out gapless document numbers per tenant and document kind.
+// Rows are locked (SELECT ... FOR UPDATE) while allocating, so a number is only
+// consumed if the surrounding transaction commits.
+//
+// Format tokens: {prefix}, {yyyy}, {yy}, {seq} (zero-padded to Padding digits).
+type NumberSequence struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	Kind        string `json:"kind" gorm:"type:VARCHAR(20);not null;unique"` // "invoice" | "quotation" | "credit_note"
+	Prefix      string `json:"prefix"`
+	Format      string `json:"format" gorm:"not null"`
+	Padding     int    `json:"padding" gorm:"not null;default:5"`
+	YearlyReset bool   `json:"yearly_reset" gorm:"not null;default:true"`
+	Year        int    `json:"year"`                                 // year the counter belongs to (yearly reset)
+	LastValue   int64  `json:"last_value" gorm:"not null;default:0"` // last allocated counter value
+	Version     uint   `json:"version" gorm:"not null;default:1"`
+}
+
+// Render formats counter n for the given year according to the sequence format.
+func (s *NumberSequence) Render(n int64, year int) string {
+	seq := strconv.FormatInt(n, 10)
+	if pad := s.Padding - len(seq); pad > 0 {
+		seq = strings.Repeat("0", pad) + seq
+	}
+	r := strings.NewReplacer(
+		"{prefix}", s.Prefix,
+		"{yyyy}", fmt.Sprintf("%04d", year),
+		"{yy}", fmt.Sprintf("%02d", year%100),
+		"{seq}", seq,
+	)
+	return r.Replace(s.Format)
+}
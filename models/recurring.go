@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"fakturierung-backend/utils"
+
+	"gorm.io/datatypes"
+)
+
+// RecurringItem is one line of a recurring invoice template.
+type RecurringItem struct {
+	ArticleID   string      `json:"article_id"`
+	Description string      `json:"description"`
+	Amount      float64     `json:"amount"`
+	Unit        string      `json:"unit,omitempty"` // "" => article's unit
+	UnitPrice   utils.Money `json:"unit_price"`
+	TaxRate     *float64    `json:"tax_rate,omitempty"` // nil => article's tax category
+	// line discount: a rate or a fixed amount
+	DiscountRate   float64     `json:"discount_rate,omitempty"`
+	DiscountAmount utils.Money `json:"discount_amount,omitempty"`
+}
+
+// RecurringInvoice is a subscription template; the scheduler turns each due
+// period into an invoice. Period n is dated StartDate + n * IntervalCount intervals.
+type RecurringInvoice struct {
+	ID              uint                               `json:"id" gorm:"primaryKey"`
+	Name            string                             `json:"name"`
+	CId             uint                               `json:"customer_id"`
+	Customer        Customer                           `json:"customer" gorm:"foreignKey:CId;references:Id"`
+	Items           datatypes.JSONSlice[RecurringItem] `json:"items" gorm:"type:jsonb"`
+	Interval        string                             `json:"interval" gorm:"type:varchar(10);not null"` // "week" | "month" | "quarter" | "year"
+	IntervalCount   int                                `json:"interval_count" gorm:"not null;default:1"`
+	StartDate       time.Time                          `json:"start_date" gorm:"type:date;not null"`
+	EndDate         *time.Time                         `json:"end_date" gorm:"type:date"`
+	NextRunDate     time.Time                          `json:"next_run_date" gorm:"type:date;not null;index"`
+	Occurrences     int                                `json:"occurrences" gorm:"not null;default:0"` // periods handled so far
+	PaymentTermDays *int                               `json:"payment_term_days"`                     // nil => company default
+	AutoPublish     bool                               `json:"auto_publish"`
+	CatchUp         bool                               `json:"catch_up"` // after downtime: invoice every missed period (else only the latest)
+	Active          bool                               `json:"active" gorm:"not null;default:true"`
+	LastRunAt       *time.Time                         `json:"last_run_at"`
+	LastError       string                             `json:"last_error"`
+	CreatedAt       time.Time                          `json:"created_at"`
+	Version         uint                               `json:"version" gorm:"not null;default:1"`
+}
+
+// RecurringRun records one handled period of a template. The unique
+// (template, period) index guarantees a period is invoiced at most once, even
+// with several scheduler instances.
+type RecurringRun struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	RecurringID uint      `json:"recurring_id" gorm:"not null;uniqueIndex:idx_recurring_runs_period"`
+	PeriodDate  time.Time `json:"period_date" gorm:"type:date;not null;uniqueIndex:idx_recurring_runs_period"`
+	Status      string    `json:"status" gorm:"type:varchar(10)"` // "created" | "skipped"
+	InvoiceID   *uint     `json:"invoice_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
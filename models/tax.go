@@ -0,0 +1,25 @@
+package models
+
+import "fakturierung-backend/utils"
+
+// TaxCategory is a tenant-defined VAT rate (e.g. "standard" 20%, "reduced" 10%).
+// Rate is stored as a fraction (0.2 == 20%). Exactly one category should be the default;
+// it applies to articles without an explicit category.
+type TaxCategory struct {
+	ID        uint    `json:"id" gorm:"primaryKey"`
+	Name      string  `json:"name" gorm:"not null;unique"`
+	Rate      float64 `json:"rate" gorm:"type:numeric(5,4);not null"`
+	IsDefault bool    `json:"is_default" gorm:"not null;default:false"`
+	Active    bool    `json:"active" gorm:"not null;default:true"`
+	Version   uint    `json:"version" gorm:"not null;default:1"`
+}
+
+// TaxLine is one row of an invoice's per-rate tax breakdown. Net is after the share
+// of the document discount that falls on the rate (Discount).
+type TaxLine struct {
+	Rate     float64     `json:"rate"`
+	Net      utils.Money `json:"net"`
+	Tax      utils.Money `json:"tax"`
+	Gross    utils.Money `json:"gross"`
+	Discount utils.Money `json:"discount,omitempty"`
+}
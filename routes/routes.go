@@ -41,6 +41,24 @@ func Register(app *fiber.App) {
 	protected.Get("/articles", controllers.GetArticles)
 	protected.Put("/articles/:id", controllers.UpdateArticle)
 
+	// Company (tenant issuer data: address, bank details, payment terms)
+	protected.Get("/company", controllers.GetCompany)
+	protected.Put("/company", controllers.UpdateCompany)
+
+	// Exchange rates (document currency per unit of the base currency, ECB import)
+	protected.Post("/exchange-rate", controllers.CreateExchangeRate)
+	protected.Get("/exchange-rates", controllers.GetExchangeRates)
+	protected.Post("/exchange-rates/ecb", controllers.ImportECBRates)
+
+	// Tax categories (tenant-defined VAT rates)
+	protected.Post("/tax-category", controllers.CreateTaxCategory)
+	protected.Get("/tax-categories", controllers.GetTaxCategories)
+	protected.Put("/tax-categories/:id", controllers.UpdateTaxCategory)
+
+	// Document number sequences
+	protected.Get("/number-sequences", controllers.GetNumberSequences)
+	protected.Put("/number-sequences/:kind", controllers.UpdateNumberSequence)
+
 	// Invoices (versioned model with payments)
 	protected.Post("/invoice", controllers.CreateInvoice)
 	protected.Get("/invoices", controllers.GetInvoices)
@@ -48,7 +66,59 @@ func Register(app *fiber.App) {
 	protected.Put("/invoices/:id", controllers.UpdateInvoice)
 	protected.Put("/invoices/:id/convert", controllers.ConvertInvoice)
 	protected.Put("/invoices/:id/publish", controllers.PublishInvoice)
+	protected.Post("/invoices/:id/cancel", controllers.CancelInvoice)
+	protected.Get("/invoices/:id/credit-notes", controllers.GetCreditNotes)
+	protected.Get("/down-payments", controllers.GetDownPayments)
+	protected.Put("/quotations/:id/status", controllers.SetQuotationStatus)
+	protected.Post("/quotations/:id/invoice", controllers.CreateInvoiceFromQuotation)
 	protected.Get("/invoices/:id/versions", controllers.GetInvoiceVersions)
+	protected.Get("/invoices/:id/versions/:a/diff/:b", controllers.GetInvoiceVersionDiff)
+	protected.Post("/invoices/:id/versions/:n/restore", controllers.RestoreInvoiceVersion)
+	protected.Get("/invoices/:id/pdf", controllers.GetInvoicePDF)
+	protected.Get("/invoices/:id/qr", controllers.GetInvoiceQR)
+	protected.Get("/invoices/:id/einvoice", controllers.GetInvoiceEInvoice)
+	protected.Get("/invoices/:id/ebinterface", controllers.GetInvoiceEbInterface)
+	protected.Get("/invoices/:id/documents", controllers.ListInvoiceDocuments)
 	protected.Post("/invoices/:id/payments", controllers.CreatePayment)
 	protected.Get("/invoices/:id/payments", controllers.ListPayments)
+	protected.Post("/payments/:id/refund", controllers.RefundPayment)
+	protected.Post("/payments/:id/reverse", controllers.ReversePayment)
+	protected.Delete("/payments/:id", controllers.DeletePayment)
+	protected.Get("/invoices/:id/dunning", controllers.GetInvoiceDunning)
+
+	// Dunning (reminder levels, runs, issued notices)
+	protected.Post("/dunning-level", controllers.CreateDunningLevel)
+	protected.Get("/dunning-levels", controllers.GetDunningLevels)
+	protected.Put("/dunning-levels/:id", controllers.UpdateDunningLevel)
+	protected.Post("/dunning/run", controllers.RunDunning)
+	protected.Get("/dunning-notices/:id/pdf", controllers.GetDunningNoticePDF)
+
+	// Bank statements (import, automatic matching, review queue)
+	protected.Post("/bank-csv-profile", controllers.CreateBankCSVProfile)
+	protected.Get("/bank-csv-profiles", controllers.GetBankCSVProfiles)
+	protected.Post("/bank-statements", controllers.ImportBankStatement)
+	protected.Get("/bank-statements", controllers.GetBankStatements)
+	protected.Get("/bank-statements/:id", controllers.GetBankStatement)
+	protected.Get("/bank-statement-lines", controllers.GetBankStatementLines)
+	protected.Post("/bank-statement-lines/:id/assign", controllers.AssignBankStatementLine)
+	protected.Post("/bank-statement-lines/:id/ignore", controllers.IgnoreBankStatementLine)
+
+	// SEPA direct debits (pain.008 batches)
+	protected.Post("/direct-debits", controllers.CreateDirectDebitBatch)
+	protected.Get("/direct-debits", controllers.GetDirectDebitBatches)
+	protected.Get("/direct-debits/:id", controllers.GetDirectDebitBatch)
+	protected.Get("/direct-debits/:id/xml", controllers.GetDirectDebitXML)
+	protected.Post("/direct-debits/:id/confirm", controllers.ConfirmDirectDebitBatch)
+	protected.Post("/direct-debits/:id/cancel", controllers.CancelDirectDebitBatch)
+
+	// Reports
+	protected.Get("/reports/revenue", controllers.GetRevenueReport)
+
+	// Recurring invoices (templates, schedule runs)
+	protected.Post("/recurring-invoice", controllers.CreateRecurringInvoice)
+	protected.Get("/recurring-invoices", controllers.GetRecurringInvoices)
+	protected.Post("/recurring-invoices/run", controllers.RunRecurringInvoicesNow)
+	protected.Get("/recurring-invoices/:id", controllers.GetRecurringInvoice)
+	protected.Put("/recurring-invoices/:id", controllers.UpdateRecurringInvoice)
+	protected.Get("/recurring-invoices/:id/runs", controllers.GetRecurringRuns)
 }
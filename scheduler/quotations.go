@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"fakturierung-backend/controllers"
+)
+
+// runQuotationExpiryOnce expires overdue quotations for every tenant.
+func runQuotationExpiryOnce(now time.Time) {
+	schemas, err := tenantSchemas()
+	if err != nil {
+		log.Printf("quotation expiry: list tenants: %v", err)
+		return
+	}
+	for _, schema := range schemas {
+		n, err := controllers.ExpireQuotations(schema, now)
+		if err != nil {
+			log.Printf("quotation expiry: %s: %v", schema, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("quotation expiry: %s: %d quotation(s) expired", schema, n)
+		}
+	}
+}
+
+// StartQuotationExpiry marks quotations past their validity as expired right away
+// and then every interval until ctx is cancelled.
+func StartQuotationExpiry(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	runQuotationExpiryOnce(time.Now().UTC())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			runQuotationExpiryOnce(t.UTC())
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"fakturierung-backend/controllers"
+	"fakturierung-backend/database"
+)
+
+// tenantSchemas lists the tenant schemas that already have the recurring
+// invoice tables (tenants are migrated on login).
+func tenantSchemas() ([]string, error) {
+	var schemas []string
+	err := database.DB.Raw(`
+		SELECT DISTINCT schema_name FROM public.users
+		WHERE schema_name <> ''
+		  AND to_regclass(quote_ident(schema_name) || '.recurring_invoices') IS NOT NULL
+		ORDER BY schema_name`).Scan(&schemas).Error
+	return schemas, err
+}
+
+// runRecurringOnce generates due recurring invoices for every tenant.
+// Errors are logged per tenant so one broken tenant does not block the others.
+func runRecurringOnce(now time.Time) {
+	schemas, err := tenantSchemas()
+	if err != nil {
+		log.Printf("recurring scheduler: list tenants: %v", err)
+		return
+	}
+	for _, schema := range schemas {
+		n, err := controllers.RunRecurringInvoices(schema, now)
+		if err != nil {
+			log.Printf("recurring scheduler: %s: %v", schema, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("recurring scheduler: %s: %d invoice(s) created", schema, n)
+		}
+	}
+}
+
+// StartRecurring runs the recurring invoice generator right away (catching up on
+// periods missed while the service was down) and then every interval until ctx
+// is cancelled. Safe to run on several instances: each tenant run takes an
+// advisory lock and every period is claimed exactly once.
+func StartRecurring(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	runRecurringOnce(time.Now().UTC())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			runRecurringOnce(t.UTC())
+		}
+	}
+}
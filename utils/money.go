@@ -1,8 +1,182 @@
 package utils
 
-import "math"
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
 
 // Round2 rounds x to 2 decimal places (banking-style simple round).
 func Round2(x float64) float64 {
 	return math.Round(x*100) / 100
 }
+
+// Round3 rounds a quantity to 3 decimal places.
+func Round3(x float64) float64 {
+	return math.Round(x*1000) / 1000
+}
+
+// RoundingMode selects how a result between two cents is rounded.
+type RoundingMode string
+
+const (
+	RoundHalfUp   RoundingMode = "half_up"   // ties away from zero: 0.125 -> 0.13
+	RoundHalfEven RoundingMode = "half_even" // ties to the even cent: 0.125 -> 0.12, 0.135 -> 0.14
+)
+
+// Money is an exact amount in cents. It maps to numeric(12,2) columns without a
+// float round-trip and keeps the plain JSON number form (19.9 -> 19.90).
+// Sums and differences are ordinary integer arithmetic; products with quantities,
+// rates or ratios round explicitly with a RoundingMode.
+type Money int64
+
+// Cents returns the amount of n cents.
+func Cents(n int64) Money { return Money(n) }
+
+// FromFloat converts a float amount (e.g. a parsed legacy form value) to Money,
+// rounding half-up on its shortest decimal representation.
+func FromFloat(x float64) Money {
+	m, _ := ParseMoney(strconv.FormatFloat(x, 'f', -1, 64))
+	return m
+}
+
+// ParseMoney reads a decimal amount ("12", "-0.5", "19.999") exactly; digits beyond
+// the cent are rounded half-up.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || strings.Contains(s, "/") {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	r.Mul(r, big.NewRat(100, 1))
+	return Money(roundRat(r, RoundHalfUp)), nil
+}
+
+// Float64 returns the amount as float (for formatting and float-based APIs only).
+func (m Money) Float64() float64 { return float64(m) / 100 }
+
+// String formats the amount with two decimals: "-1234.50".
+func (m Money) String() string {
+	sign, n := "", int64(m)
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, n/100, n%100)
+}
+
+// Abs returns the absolute amount.
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// MulQty multiplies by a quantity with up to 3 decimals (e.g. 2.5 hours).
+func (m Money) MulQty(qty float64, mode RoundingMode) Money {
+	return m.mulRat(big.NewRat(int64(math.Round(qty*1000)), 1000), mode)
+}
+
+// MulRate multiplies by a rate with up to 4 decimals (e.g. tax rate 0.2, Skonto 0.025).
+func (m Money) MulRate(rate float64, mode RoundingMode) Money {
+	return m.mulRat(big.NewRat(int64(math.Round(rate*10000)), 10000), mode)
+}
+
+// MulRatio returns m * num / den, e.g. the share of a discount that falls on one
+// tax rate or interest for days/365. A zero den yields 0 instead of panicking.
+func (m Money) MulRatio(num, den int64, mode RoundingMode) Money {
+	if den == 0 {
+		return 0
+	}
+	return m.mulRat(big.NewRat(num, den), mode)
+}
+
+// DivRate divides by an exchange rate with up to 6 decimals (units of the foreign
+// currency per unit of the base currency), converting a foreign amount to the base.
+// A rate that rounds to 0 yields 0 instead of panicking; callers validate rates.
+func (m Money) DivRate(rate float64, mode RoundingMode) Money {
+	micro := int64(math.Round(rate * 1000000))
+	if micro == 0 {
+		return 0
+	}
+	return m.mulRat(big.NewRat(1000000, micro), mode)
+}
+
+func (m Money) mulRat(f *big.Rat, mode RoundingMode) Money {
+	r := new(big.Rat).SetInt64(int64(m))
+	return Money(roundRat(r.Mul(r, f), mode))
+}
+
+// roundRat rounds r to an integer with the given mode (half-up if unknown).
+func roundRat(r *big.Rat, mode RoundingMode) int64 {
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if rem.Sign() == 0 {
+		return q.Int64()
+	}
+	// compare |2*rem| with the denominator: below => down, above => up, equal => tie
+	twice := new(big.Int).Abs(rem)
+	twice.Lsh(twice, 1)
+	away := false
+	switch c := twice.Cmp(r.Denom()); {
+	case c > 0:
+		away = true
+	case c == 0:
+		away = mode != RoundHalfEven || q.Bit(0) == 1
+	}
+	if away {
+		if r.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q.Int64()
+}
+
+// Value stores the amount as exact numeric text.
+func (m Money) Value() (driver.Value, error) { return m.String(), nil }
+
+// Scan reads numeric columns (text, bytes or numbers) without a float round-trip
+// where the driver allows it.
+func (m *Money) Scan(src any) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v * 100)
+	case float64:
+		*m = FromFloat(v)
+	case []byte:
+		*m, err = ParseMoney(string(v))
+	case string:
+		*m, err = ParseMoney(v)
+	default:
+		err = fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return err
+}
+
+// MarshalJSON writes the amount as a JSON number with two decimals.
+func (m Money) MarshalJSON() ([]byte, error) { return []byte(m.String()), nil }
+
+// UnmarshalJSON accepts a JSON number or numeric string; null leaves zero.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(strings.TrimSpace(string(b)), `"`)
+	if s == "null" || s == "" {
+		*m = 0
+		return nil
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// GormDataType keeps Money columns numeric(12,2) under AutoMigrate.
+func (Money) GormDataType() string { return "numeric(12,2)" }
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRoundingModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		m        Money
+		rate     float64
+		halfUp   Money
+		halfEven Money
+	}{
+		{"tie to odd cent", 25, 0.5, 13, 12},
+		{"tie to even cent", 35, 0.5, 18, 18},
+		{"negative tie to odd cent", -25, 0.5, -13, -12},
+		{"negative tie to even cent", -35, 0.5, -18, -18},
+		{"below half", 3, 0.1, 0, 0},
+		{"above half", 3, 0.2, 1, 1},
+		{"negative above half", -3, 0.2, -1, -1},
+		{"exact", 1000, 0.2, 200, 200},
+		{"vat tie", 1250, 0.01, 13, 12}, // 12.5 cents
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.m.MulRate(tt.rate, RoundHalfUp); got != tt.halfUp {
+				t.Errorf("half_up: %s * %v = %s, want %s", tt.m, tt.rate, got, tt.halfUp)
+			}
+			if got := tt.m.MulRate(tt.rate, RoundHalfEven); got != tt.halfEven {
+				t.Errorf("half_even: %s * %v = %s, want %s", tt.m, tt.rate, got, tt.halfEven)
+			}
+		})
+	}
+}
+
+func TestRoundingUnknownModeIsHalfUp(t *testing.T) {
+	if got := Money(25).MulRate(0.5, RoundingMode("")); got != 13 {
+		t.Errorf("got %s, want 0.13", got)
+	}
+}
+
+func TestMulQtyAndRatio(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Money
+		want Money
+	}{
+		{"quantity with 3 decimals", Money(1999).MulQty(2.5, RoundHalfUp), 4998}, // 49.975
+		{"quantity half even", Money(1999).MulQty(2.5, RoundHalfEven), 4998},
+		{"ratio", Money(1000).MulRatio(1, 3, RoundHalfUp), 333},
+		{"ratio tie", Money(1).MulRatio(1, 2, RoundHalfEven), 0},
+		{"ratio zero denominator", Money(1000).MulRatio(1, 0, RoundHalfUp), 0},
+		{"exchange rate", Money(11700).DivRate(1.17, RoundHalfUp), 10000},
+		{"exchange rate rounding", Money(1000).DivRate(3, RoundHalfUp), 333},
+		{"exchange rate rounding to zero", Money(1000).DivRate(0.0000001, RoundHalfUp), 0},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{"12", 1200, false},
+		{" 7.10 ", 710, false},
+		{"1.005", 101, false},
+		{"1.004", 100, false},
+		{"-1.005", -101, false},
+		{"-0.5", -50, false},
+		{"-0.005", -1, false},
+		{"0.0049", 0, false},
+		{"19.999", 2000, false},
+		{"1e2", 10000, false},
+		{"1.2345E1", 1235, false},
+		{"2.5e-2", 3, false},
+		{"-2.5e-2", -3, false},
+		{"", 0, true},
+		{"abc", 0, true},
+		{"1/2", 0, true},
+		{"1,50", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMoney(%q) = %s, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseMoney(%q) = %s, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want Money
+	}{
+		{0.1 + 0.2, 30},
+		{1.005, 101}, // shortest representation, not 1.00499999...
+		{-2.675, -268},
+		{19.9, 1990},
+	}
+	for _, tt := range tests {
+		if got := FromFloat(tt.in); got != tt.want {
+			t.Errorf("FromFloat(%v) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyStringAndJSON(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{1990, "19.90"},
+		{-123450, "-1234.50"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("String(%d) = %q, want %q", int64(tt.m), got, tt.want)
+		}
+		raw, err := json.Marshal(tt.m)
+		if err != nil || string(raw) != tt.want {
+			t.Errorf("Marshal(%d) = %s, %v", int64(tt.m), raw, err)
+		}
+		var back Money
+		if err := json.Unmarshal(raw, &back); err != nil || back != tt.m {
+			t.Errorf("Unmarshal(%s) = %s, %v", raw, back, err)
+		}
+	}
+	var m Money
+	if err := json.Unmarshal([]byte(`"12.345"`), &m); err != nil || m != 1235 {
+		t.Errorf(`Unmarshal("12.345") = %s, %v`, m, err)
+	}
+}
@@ -5,6 +5,12 @@ import (
 	"strings"
 )
 
+// Fields tagged `normalize:"-"` are left as they are, e.g. rates (fractions such as
+// 0.025) that the 2-decimal rounding would corrupt.
+const normalizeTag = "normalize"
+
+func skipNormalize(f reflect.StructField) bool { return f.Tag.Get(normalizeTag) == "-" }
+
 // NormalizePtrDTO trims *string fields and rounds *float64 fields on a pointer-to-struct DTO.
 // Only non-nil pointer fields are touched; nils stay nil so GORM won't update them.
 func NormalizePtrDTO(dto any) {
@@ -18,7 +24,7 @@ func NormalizePtrDTO(dto any) {
 	}
 	for i := 0; i < s.NumField(); i++ {
 		f := s.Field(i)
-		if f.Kind() != reflect.Ptr || f.IsNil() {
+		if f.Kind() != reflect.Ptr || f.IsNil() || skipNormalize(s.Type().Field(i)) {
 			continue
 		}
 		ef := f.Elem()
@@ -44,6 +50,9 @@ func NormalizeDTO(dto any) {
 	}
 	for i := 0; i < s.NumField(); i++ {
 		f := s.Field(i)
+		if skipNormalize(s.Type().Field(i)) {
+			continue
+		}
 		switch f.Kind() {
 		case reflect.String:
 			if f.CanSet() {
@@ -0,0 +1,29 @@
+package utils
+
+import "testing"
+
+func TestNormalizePtrDTOSkipsRates(t *testing.T) {
+	name, price, rate := "  Beratung ", 12.345, 0.025
+	in := struct {
+		Name  *string  `json:"name"`
+		Price *float64 `json:"price"`
+		Rate  *float64 `json:"rate" normalize:"-"`
+		Unset *float64 `json:"unset"`
+	}{Name: &name, Price: &price, Rate: &rate}
+	NormalizePtrDTO(&in)
+	if *in.Name != "Beratung" || *in.Price != 12.35 || *in.Rate != 0.025 || in.Unset != nil {
+		t.Errorf("normalized to %q %v %v %v", *in.Name, *in.Price, *in.Rate, in.Unset)
+	}
+}
+
+func TestNormalizeDTOSkipsRates(t *testing.T) {
+	in := struct {
+		Name  string  `json:"name"`
+		Price float64 `json:"price"`
+		Rate  float64 `json:"rate" normalize:"-"`
+	}{Name: " Beratung ", Price: 12.345, Rate: 0.025}
+	NormalizeDTO(&in)
+	if in.Name != "Beratung" || in.Price != 12.35 || in.Rate != 0.025 {
+		t.Errorf("normalized to %+v", in)
+	}
+}